@@ -0,0 +1,172 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/contactwajeeh/ollamagoweb-v2/mcp"
+)
+
+// AdminOverview is the operational state shown on the admin dashboard
+type AdminOverview struct {
+	Providers         AdminProviders `json:"providers"`
+	ChatsTotal        int            `json:"chats_total"`
+	MessagesTotal     int            `json:"messages_total"`
+	DBSizeBytes       int64          `json:"db_size_bytes"`
+	ActiveGenerations int            `json:"active_generations"`
+	Telegram          AdminTelegram  `json:"telegram"`
+	Skills            AdminSkills    `json:"skills"`
+	MCP               AdminMCP       `json:"mcp"`
+	UptimeSeconds     float64        `json:"uptime_seconds"`
+}
+
+type AdminProviders struct {
+	Total       int    `json:"total"`
+	ActiveName  string `json:"active_name,omitempty"`
+	ActiveModel string `json:"active_model,omitempty"`
+}
+
+type AdminTelegram struct {
+	Enabled  bool   `json:"enabled"`
+	Mode     string `json:"mode,omitempty"`
+	Username string `json:"username,omitempty"`
+}
+
+type AdminSkills struct {
+	Cached     int      `json:"cached"`
+	FetchedAt  string   `json:"fetched_at,omitempty"`
+	AgeSeconds *float64 `json:"age_seconds,omitempty"`
+	Stale      bool     `json:"stale"`
+}
+
+type AdminMCP struct {
+	Total     int              `json:"total"`
+	Enabled   int              `json:"enabled"`
+	Connected int              `json:"connected"`
+	Servers   []AdminMCPServer `json:"servers"`
+}
+
+type AdminMCPServer struct {
+	ID        int64  `json:"id"`
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Enabled   bool   `json:"enabled"`
+	Connected bool   `json:"connected"`
+	Status    string `json:"status"`
+}
+
+// getAdminOverview handles GET /api/admin/overview. Every figure comes from a small
+// table, in-memory state or COUNT(*), which SQLite answers from the narrowest index
+// instead of reading message content.
+func getAdminOverview(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var o AdminOverview
+
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM providers").Scan(&o.Providers.Total); err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if _, config, err := GetActiveProvider(db); err == nil {
+		o.Providers.ActiveName = config.Name
+		o.Providers.ActiveModel = config.Model
+	}
+
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM chats").Scan(&o.ChatsTotal); err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM messages").Scan(&o.MessagesTotal); err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	size, err := databaseSize(ctx, db)
+	if err != nil {
+		log.Printf("Error reading database size: %v", err)
+	}
+	o.DBSizeBytes = size
+
+	inflightGenerationsMu.Lock()
+	o.ActiveGenerations = len(inflightGenerations)
+	inflightGenerationsMu.Unlock()
+
+	if telegramBot != nil {
+		o.Telegram.Enabled = true
+		o.Telegram.Username = telegramBot.Self.UserName
+		o.Telegram.Mode = "polling"
+		if TelegramWebhookPath() != "" {
+			o.Telegram.Mode = "webhook"
+		}
+	}
+
+	o.Skills = adminSkillsStatus(db)
+
+	if o.MCP, err = adminMCPStatus(db); err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	o.UptimeSeconds = time.Since(startTime).Seconds()
+	WriteJSON(w, o)
+}
+
+// adminSkillsStatus reports the Open Skills cache, which is refreshed as a whole, so the
+// newest row's fetch time is the cache's
+func adminSkillsStatus(db *sql.DB) AdminSkills {
+	var s AdminSkills
+	if err := db.QueryRow("SELECT COUNT(*) FROM open_skills_cache").Scan(&s.Cached); err != nil {
+		log.Printf("Error counting cached skills: %v", err)
+		return s
+	}
+	if s.Cached == 0 {
+		s.Stale = true
+		return s
+	}
+
+	var fetchedAt time.Time
+	if err := db.QueryRow("SELECT fetched_at FROM open_skills_cache ORDER BY id DESC LIMIT 1").Scan(&fetchedAt); err != nil {
+		log.Printf("Error reading skills cache age: %v", err)
+		return s
+	}
+	age := time.Since(fetchedAt)
+	seconds := age.Seconds()
+	s.FetchedAt = fetchedAt.Format(time.RFC3339)
+	s.AgeSeconds = &seconds
+	s.Stale = age > SkillsCacheTTL
+	return s
+}
+
+// adminMCPStatus lists the configured MCP servers with their last health check and
+// whether each has a session open
+func adminMCPStatus(db *sql.DB) (AdminMCP, error) {
+	status := AdminMCP{Servers: []AdminMCPServer{}}
+	rows, err := db.Query(`
+		SELECT id, name, server_type, is_enabled, CASE WHEN is_enabled = 0 THEN 'disabled' ELSE COALESCE(status, 'unknown') END
+		FROM mcp_servers ORDER BY name
+	`)
+	if err != nil {
+		return status, err
+	}
+	defer rows.Close()
+
+	client := mcp.GetMCPClient()
+	for rows.Next() {
+		var s AdminMCPServer
+		if err := rows.Scan(&s.ID, &s.Name, &s.Type, &s.Enabled, &s.Status); err != nil {
+			return status, err
+		}
+		s.Connected = client != nil && client.IsConnected(s.ID)
+
+		status.Total++
+		if s.Enabled {
+			status.Enabled++
+		}
+		if s.Connected {
+			status.Connected++
+		}
+		status.Servers = append(status.Servers, s)
+	}
+	return status, rows.Err()
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log"
+	"os"
+)
+
+// embeddedStatic holds the web assets compiled into the binary, so it runs from any
+// working directory
+//
+//go:embed static
+var embeddedStatic embed.FS
+
+// devMode serves assets from ./static on disk and re-parses templates on every
+// request, so edits show up without a rebuild. Enabled with DEV=1.
+func devMode() bool {
+	return os.Getenv("DEV") == "1"
+}
+
+// staticFS returns the filesystem the static handler and templates read from
+func staticFS() fs.FS {
+	if devMode() {
+		return os.DirFS("static")
+	}
+	sub, err := fs.Sub(embeddedStatic, "static")
+	if err != nil {
+		log.Fatalf("Embedded static assets missing: %v", err)
+	}
+	return sub
+}
+
+// pageNames are the HTML templates parsed by InitTemplates
+var pageNames = []string{"index.html", "settings.html"}
+
+// pageTemplates is filled once at startup and only read afterwards
+var pageTemplates = make(map[string]*template.Template)
+
+// InitTemplates parses the page templates once, so a broken template fails at startup
+// rather than on the first request. Dev mode skips the cache.
+func InitTemplates() {
+	if devMode() {
+		return
+	}
+	for _, name := range pageNames {
+		t, err := template.ParseFS(staticFS(), name)
+		if err != nil {
+			log.Fatalf("Error parsing template %s: %v", name, err)
+		}
+		pageTemplates[name] = t
+	}
+}
+
+// loadTemplate returns the parsed page template. In dev mode it is parsed from disk on
+// every call so edits show up on reload.
+func loadTemplate(name string) (*template.Template, error) {
+	if devMode() {
+		return template.ParseFS(staticFS(), name)
+	}
+	if t, ok := pageTemplates[name]; ok {
+		return t, nil
+	}
+	return nil, fmt.Errorf("template %s not loaded", name)
+}
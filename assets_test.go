@@ -0,0 +1,52 @@
+package main
+
+import (
+	"io"
+	"testing"
+)
+
+var benchmarkPageData = map[string]interface{}{
+	"provider":     "Ollama (Local)",
+	"llm":          "llama3.1:8b",
+	"providerInfo": "",
+	"theme":        "dark",
+	"nonce":        "benchmark-nonce",
+}
+
+// benchmarkRenderPage loads and executes a page the way a request does
+func benchmarkRenderPage(b *testing.B, name string) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		t, err := loadTemplate(name)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := t.Execute(io.Discard, benchmarkPageData); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkRenderIndexCached uses the templates parsed once by InitTemplates
+func BenchmarkRenderIndexCached(b *testing.B) {
+	b.Setenv("DEV", "")
+	InitTemplates()
+	benchmarkRenderPage(b, "index.html")
+}
+
+// BenchmarkRenderIndexParsedPerRequest re-parses the template from disk every time, as
+// dev mode and the code before the cache did
+func BenchmarkRenderIndexParsedPerRequest(b *testing.B) {
+	b.Setenv("DEV", "1")
+	benchmarkRenderPage(b, "index.html")
+}
+
+func TestInitTemplatesParsesEveryPage(t *testing.T) {
+	t.Setenv("DEV", "")
+	InitTemplates()
+	for _, name := range pageNames {
+		if _, err := loadTemplate(name); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
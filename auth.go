@@ -5,11 +5,13 @@ import (
 	"database/sql"
 	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"sync"
 	"time"
 
+	"github.com/go-chi/chi"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -25,6 +27,13 @@ type User struct {
 	Password string `json:"-"`
 }
 
+const (
+	// sessionIDPrefixLength is how much of a session token is shown when listing sessions
+	sessionIDPrefixLength = 12
+	// lastSeenInterval limits how often a session's last_seen_at is rewritten
+	lastSeenInterval = time.Minute
+)
+
 var (
 	sessionTTL  = 24 * time.Hour
 	sessionMu   sync.RWMutex
@@ -116,6 +125,18 @@ func ValidateSession(sessionID string) bool {
 	return true
 }
 
+// touchSession records that a session was just used, at most once per lastSeenInterval
+func touchSession(sessionID string) {
+	now := time.Now()
+	_, err := db.Exec(`
+		UPDATE sessions SET last_seen_at = ?
+		WHERE id = ? AND (last_seen_at IS NULL OR last_seen_at < ?)
+	`, now, sessionID, now.Add(-lastSeenInterval))
+	if err != nil {
+		log.Printf("Error updating session last seen: %v", err)
+	}
+}
+
 func DestroySession(sessionID string) {
 	_, err := db.Exec("DELETE FROM sessions WHERE id = ?", sessionID)
 	if err != nil {
@@ -152,11 +173,28 @@ func AuthMiddleware(next http.Handler) http.Handler {
 			http.Error(w, `{"error": true, "message": "Invalid or expired session"}`, http.StatusUnauthorized)
 			return
 		}
+		touchSession(sessionID.Value)
 
 		next.ServeHTTP(w, r)
 	})
 }
 
+// AdminMiddleware allows only the admin user's sessions. Session management needs
+// authentication, so it is refused while auth is disabled.
+func AdminMiddleware(next http.Handler) http.Handler {
+	return AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !authEnabled {
+			WriteError(w, http.StatusForbidden, "Authentication is not configured")
+			return
+		}
+		if requestUserID(r) != adminUser.ID {
+			WriteError(w, http.StatusForbidden, "Admin access required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	}))
+}
+
 func OptionalAuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if !authEnabled {
@@ -279,6 +317,118 @@ func sessionStatusHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// SessionInfo describes an active session without exposing its token
+type SessionInfo struct {
+	ID         string `json:"id"`
+	UserID     string `json:"user_id"`
+	CreatedAt  string `json:"created_at"`
+	ExpiresAt  string `json:"expires_at"`
+	LastSeenAt string `json:"last_seen_at,omitempty"`
+	Current    bool   `json:"current"`
+}
+
+// listSessionsHandler handles GET /api/auth/sessions, listing unexpired sessions with
+// their ids truncated to sessionIDPrefixLength characters
+func listSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	rows, err := db.Query(`
+		SELECT id, user_id, created_at, expires_at, last_seen_at
+		FROM sessions
+		WHERE expires_at > ?
+		ORDER BY COALESCE(last_seen_at, created_at) DESC
+	`, time.Now())
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	current := ""
+	if cookie, err := r.Cookie("session_id"); err == nil {
+		current = cookie.Value
+	}
+
+	sessions := []SessionInfo{}
+	for rows.Next() {
+		var id, userID string
+		var createdAt, expiresAt time.Time
+		var lastSeenAt sql.NullTime
+		if err := rows.Scan(&id, &userID, &createdAt, &expiresAt, &lastSeenAt); err != nil {
+			log.Println("Error scanning session:", err)
+			continue
+		}
+		info := SessionInfo{
+			ID:        truncateSessionID(id),
+			UserID:    userID,
+			CreatedAt: createdAt.Format(time.RFC3339),
+			ExpiresAt: expiresAt.Format(time.RFC3339),
+			Current:   id == current,
+		}
+		if lastSeenAt.Valid {
+			info.LastSeenAt = lastSeenAt.Time.Format(time.RFC3339)
+		}
+		sessions = append(sessions, info)
+	}
+	if err := rows.Err(); err != nil {
+		WriteError(w, http.StatusInternalServerError, "Error iterating sessions: "+err.Error())
+		return
+	}
+
+	WriteJSON(w, sessions)
+}
+
+// revokeSessionHandler handles DELETE /api/auth/sessions/{id}, where id is the truncated
+// id from the session list
+func revokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	prefix := chi.URLParam(r, "id")
+	if len(prefix) != sessionIDPrefixLength {
+		WriteError(w, http.StatusBadRequest, fmt.Sprintf("Session id must be the %d-character id from the session list", sessionIDPrefixLength))
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer tx.Rollback()
+
+	var matches int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM sessions WHERE substr(id, 1, ?) = ?", sessionIDPrefixLength, prefix).Scan(&matches); err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	switch {
+	case matches == 0:
+		WriteError(w, http.StatusNotFound, "Session not found")
+		return
+	case matches > 1:
+		WriteError(w, http.StatusConflict, "Session id is ambiguous")
+		return
+	}
+
+	if _, err := tx.Exec("DELETE FROM sessions WHERE substr(id, 1, ?) = ?", sessionIDPrefixLength, prefix); err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	WriteJSON(w, map[string]interface{}{
+		"success": true,
+		"id":      prefix,
+	})
+}
+
+// truncateSessionID shortens a session token for display
+func truncateSessionID(id string) string {
+	if len(id) <= sessionIDPrefixLength {
+		return id
+	}
+	return id[:sessionIDPrefixLength]
+}
+
 func adminHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
 		html := `<!DOCTYPE html>
@@ -316,13 +466,13 @@ func adminHandler(w http.ResponseWriter, r *http.Request) {
             <button type="submit">Login</button>
         </form>
     </div>
-    <script>
+    <script nonce="` + cspNonce(r) + `">
         document.getElementById('loginForm').addEventListener('submit', async (e) => {
             e.preventDefault();
             const username = document.getElementById('username').value;
             const password = document.getElementById('password').value;
             try {
-                const res = await fetch('/api/auth/login', {
+                const res = await fetch('/api/v1/auth/login', {
                     method: 'POST',
                     headers: { 'Content-Type': 'application/json' },
                     body: JSON.stringify({ username, password })
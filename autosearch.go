@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultAutoSearchMaxPerChat = 5
+	autoSearchDecisionTimeout   = 15 * time.Second
+)
+
+// autoSearchKeywords suggest the question needs information newer than the model's training data
+var autoSearchKeywords = []string{
+	"latest", "today", "tonight", "yesterday", "tomorrow", "this week", "this month",
+	"this year", "right now", "currently", "current", "recent", "recently", "news",
+	"breaking", "update on", "price of", "stock", "weather", "score", "release date",
+	"who won", "happening",
+}
+
+const autoSearchDecisionPrompt = `Decide whether answering the user's message needs a live web search for recent or changing information.
+Reply with only the search query to run, or with exactly NO if a search is not needed.
+
+User message: %s`
+
+var (
+	autoSearchCounts   = make(map[string]int)
+	autoSearchCountsMu sync.Mutex
+)
+
+// getAutoSearchMode returns the auto_search setting: "off", "heuristic" or "model"
+func getAutoSearchMode(db *sql.DB) string {
+	switch mode := GetSetting(db, "auto_search", "off"); mode {
+	case "heuristic", "model":
+		return mode
+	default:
+		return "off"
+	}
+}
+
+func getAutoSearchMaxPerChat(db *sql.DB) int {
+	max, err := strconv.Atoi(GetSetting(db, "auto_search_max_per_chat", ""))
+	if err != nil || max < 0 {
+		return DefaultAutoSearchMaxPerChat
+	}
+	return max
+}
+
+// reserveAutoSearch counts an automatic search against the conversation's budget,
+// returning false once the budget is used up
+func reserveAutoSearch(conversationKey string, max int) bool {
+	autoSearchCountsMu.Lock()
+	defer autoSearchCountsMu.Unlock()
+
+	if autoSearchCounts[conversationKey] >= max {
+		return false
+	}
+	autoSearchCounts[conversationKey]++
+	return true
+}
+
+// looksTimeSensitive reports whether the query mentions recency keywords or the current year
+func looksTimeSensitive(query string) bool {
+	lower := strings.ToLower(query)
+	for _, keyword := range autoSearchKeywords {
+		if strings.Contains(lower, keyword) {
+			return true
+		}
+	}
+	return strings.Contains(lower, strconv.Itoa(time.Now().Year()))
+}
+
+// askModelForSearch asks the provider whether a search would help and returns the
+// query it suggests, or "" when it declines
+func askModelForSearch(ctx context.Context, provider Provider, query string) string {
+	ctx, cancel := context.WithTimeout(ctx, autoSearchDecisionTimeout)
+	defer cancel()
+
+	response, err := provider.GenerateNonStreaming(ctx, nil, fmt.Sprintf(autoSearchDecisionPrompt, query), "")
+	if err != nil {
+		log.Printf("Auto-search decision failed: %v", err)
+		return ""
+	}
+
+	suggested := strings.Trim(strings.TrimSpace(response), "\"'`.")
+	if suggested == "" || strings.EqualFold(suggested, "no") || strings.Contains(suggested, "\n") {
+		return ""
+	}
+	return truncate(suggested, 200)
+}
+
+// MaybeAutoSearch enriches a prompt with web results when the auto_search setting is
+// enabled and the query appears to need them. Failures fall back to the original query.
+func MaybeAutoSearch(ctx context.Context, db *sql.DB, conversationKey, query string, searcher Searcher, provider Provider) string {
+	mode := getAutoSearchMode(db)
+	if mode == "off" || searcher == nil || strings.HasPrefix(strings.TrimSpace(query), "/") {
+		return query
+	}
+
+	searchTerm := ""
+	switch mode {
+	case "heuristic":
+		if looksTimeSensitive(query) {
+			searchTerm = query
+		}
+	case "model":
+		searchTerm = askModelForSearch(ctx, provider, query)
+	}
+	if searchTerm == "" {
+		return query
+	}
+
+	if !reserveAutoSearch(conversationKey, getAutoSearchMaxPerChat(db)) {
+		log.Printf("Auto-search limit reached for %s", conversationKey)
+		return query
+	}
+
+	results, err := searcher.Search(searchTerm)
+	if err != nil || len(results) == 0 {
+		if err != nil {
+			log.Printf("Auto-search failed: %v", err)
+		}
+		return query
+	}
+
+	log.Printf("Auto-search ran for %s: %s", conversationKey, truncate(searchTerm, 50))
+	return buildSearchContext(results, query)
+}
@@ -4,15 +4,18 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi"
 )
 
 func RegisterBackupRoutes(r chi.Router, db *sql.DB) {
-	r.Get("/api/backup", getBackup(db))
-	r.Post("/api/restore", restoreBackup(db))
+	r.Get("/backup", getBackup(db))
+	r.Post("/restore", restoreBackup(db))
 }
 
 type BackupData struct {
@@ -38,9 +41,41 @@ type BackupMessage struct {
 	ModelName    string `json:"model_name,omitempty"`
 	TokensUsed   int    `json:"tokens_used,omitempty"`
 	VersionGroup string `json:"version_group,omitempty"`
+	Inactive     bool   `json:"inactive,omitempty"`
 	CreatedAt    string `json:"created_at"`
 }
 
+// getBackupMessages loads the messages of one chat for a backup
+func getBackupMessages(db *sql.DB, chatID int64) ([]BackupMessage, error) {
+	rows, err := db.Query(`
+		SELECT id, role, content,
+		       COALESCE(model_name, ''),
+		       COALESCE(tokens_used, 0),
+		       COALESCE(version_group, ''),
+		       COALESCE(is_active_version, 1) = 0,
+		       COALESCE(created_at, datetime('now'))
+		FROM messages
+		WHERE chat_id = ?
+		ORDER BY id ASC
+	`, chatID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []BackupMessage{}
+	for rows.Next() {
+		var m BackupMessage
+		if err := rows.Scan(&m.ID, &m.Role, &m.Content, &m.ModelName, &m.TokensUsed, &m.VersionGroup, &m.Inactive, &m.CreatedAt); err != nil {
+			continue
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+// getBackup streams the backup one chat at a time so memory use does not grow with
+// the size of the database
 func getBackup(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		rows, err := db.Query(`
@@ -56,59 +91,256 @@ func getBackup(db *sql.DB) http.HandlerFunc {
 		}
 		defer rows.Close()
 
-		var chats []BackupChat
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", "attachment; filename=ollamagoweb-backup.json")
+
+		exportedAt, _ := json.Marshal(time.Now().Format(time.RFC3339))
+		fmt.Fprintf(w, `{"version":1,"exported_at":%s,"chats":[`, exportedAt)
+
+		enc := json.NewEncoder(w)
+		first := true
 		for rows.Next() {
 			var c BackupChat
 			if err := rows.Scan(&c.ID, &c.Title, &c.SystemPrompt, &c.IsPinned, &c.CreatedAt, &c.UpdatedAt); err != nil {
 				continue
 			}
 
-			msgRows, err := db.Query(`
-				SELECT id, role, content,
-				       COALESCE(model_name, ''),
-				       COALESCE(tokens_used, 0),
-				       COALESCE(version_group, ''),
-				       COALESCE(created_at, datetime('now'))
-				FROM messages
-				WHERE chat_id = ?
-				ORDER BY id ASC
-			`, c.ID)
+			c.Messages, err = getBackupMessages(db, c.ID)
 			if err != nil {
+				log.Printf("Error fetching messages for backup of chat %d: %v", c.ID, err)
 				continue
 			}
 
-			var messages []BackupMessage
-			for msgRows.Next() {
-				var m BackupMessage
-				var modelName, versionGroup sql.NullString
-				if err := msgRows.Scan(&m.ID, &m.Role, &m.Content, &modelName, &m.TokensUsed, &versionGroup, &m.CreatedAt); err != nil {
-					continue
-				}
-				m.ModelName = modelName.String
-				m.VersionGroup = versionGroup.String
-				messages = append(messages, m)
+			if !first {
+				w.Write([]byte(","))
 			}
-			msgRows.Close()
+			first = false
 
-			c.Messages = messages
-			chats = append(chats, c)
+			if err := enc.Encode(c); err != nil {
+				log.Printf("Error streaming backup: %v", err)
+				return
+			}
+		}
+		if err := rows.Err(); err != nil {
+			log.Printf("Error reading chats for backup: %v", err)
 		}
 
-		backup := BackupData{
-			Version:    1,
-			ExportedAt: time.Now().Format(time.RFC3339),
-			Chats:      chats,
+		w.Write([]byte("]}\n"))
+	}
+}
+
+// exportFilename turns a chat title into a safe attachment filename
+func exportFilename(title, ext string) string {
+	var b strings.Builder
+	lastDash := false
+	for _, r := range strings.ToLower(title) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			b.WriteRune(r)
+			lastDash = false
+		} else if !lastDash && b.Len() > 0 {
+			b.WriteRune('-')
+			lastDash = true
 		}
+	}
 
-		w.Header().Set("Content-Type", "application/json")
-		w.Header().Set("Content-Disposition", "attachment; filename=ollamagoweb-backup.json")
+	name := strings.TrimRight(b.String(), "-")
+	if len(name) > 80 {
+		name = strings.TrimRight(name[:80], "-")
+	}
+	if name == "" {
+		name = "chat"
+	}
+	return name + "." + ext
+}
+
+// renderChatMarkdown renders a chat as Markdown. Message content is written verbatim
+// so code fences survive; an unterminated fence is closed so it cannot swallow the
+// rest of the document.
+func renderChatMarkdown(chat BackupChat, withModels, withTimestamps bool) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", chat.Title)
+
+	written := 0
+	for _, m := range chat.Messages {
+		// Tool calls are kept in JSON backups but are not part of the readable transcript
+		if m.Role == "tool" {
+			continue
+		}
+		if written > 0 {
+			b.WriteString("\n---\n\n")
+		}
+		written++
+
+		role := "User"
+		switch m.Role {
+		case "assistant":
+			role = "Assistant"
+		case "system":
+			role = "System"
+		}
+		fmt.Fprintf(&b, "**%s**", role)
+		if withModels && m.ModelName != "" {
+			fmt.Fprintf(&b, " (%s)", m.ModelName)
+		}
+		if withTimestamps && m.CreatedAt != "" {
+			fmt.Fprintf(&b, " · %s", m.CreatedAt)
+		}
+		b.WriteString("\n\n")
+
+		content := strings.TrimRight(m.Content, "\n")
+		b.WriteString(content)
+		b.WriteString("\n")
+
+		fences := 0
+		for _, line := range strings.Split(content, "\n") {
+			if strings.HasPrefix(strings.TrimSpace(line), "```") {
+				fences++
+			}
+		}
+		if fences%2 == 1 {
+			b.WriteString("```\n")
+		}
+	}
+
+	return b.String()
+}
+
+// exportChat downloads one chat as Markdown (format=md) or as a single-chat backup
+// (format=json) that can be restored through /api/restore
+func exportChat(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, "Invalid chat ID")
+			return
+		}
+
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = "md"
+		}
+		if format != "md" && format != "json" {
+			WriteError(w, http.StatusBadRequest, "format must be md or json")
+			return
+		}
+
+		var c BackupChat
+		err = db.QueryRow(`
+			SELECT id, title, COALESCE(system_prompt, ''), is_pinned,
+			       COALESCE(created_at, datetime('now')),
+			       COALESCE(updated_at, datetime('now'))
+			FROM chats WHERE id = ?
+		`, id).Scan(&c.ID, &c.Title, &c.SystemPrompt, &c.IsPinned, &c.CreatedAt, &c.UpdatedAt)
+		if err == sql.ErrNoRows {
+			WriteError(w, http.StatusNotFound, "Chat not found")
+			return
+		}
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		c.Messages, err = getBackupMessages(db, c.ID)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "Failed to fetch messages")
+			return
+		}
 
-		json.NewEncoder(w).Encode(backup)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", exportFilename(c.Title, format)))
+
+		if format == "json" {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(BackupData{
+				Version:    1,
+				ExportedAt: time.Now().Format(time.RFC3339),
+				Chats:      []BackupChat{c},
+			})
+			return
+		}
+
+		query := r.URL.Query()
+		withModels := query.Get("models") == "true"
+		withTimestamps := query.Get("timestamps") == "true"
+
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		w.Write([]byte(renderChatMarkdown(c, withModels, withTimestamps)))
 	}
 }
 
+// RestoreResult reports the outcome of restoring one chat
+type RestoreResult struct {
+	Title            string `json:"title"`
+	ChatID           int64  `json:"chat_id,omitempty"`
+	Status           string `json:"status"`
+	MessagesImported int    `json:"messages_imported"`
+	MessagesFailed   int    `json:"messages_failed"`
+	Error            string `json:"error,omitempty"`
+}
+
+// restoreChat inserts a backup chat and its messages with fresh ids in one transaction.
+// Messages that fail to insert are counted rather than aborting the chat.
+func restoreChat(db *sql.DB, chat BackupChat, replaceID int64) (RestoreResult, error) {
+	result := RestoreResult{Title: chat.Title}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback()
+
+	if replaceID > 0 {
+		if _, err := tx.Exec("DELETE FROM messages WHERE chat_id = ?", replaceID); err != nil {
+			return result, err
+		}
+		if _, err := tx.Exec("DELETE FROM chats WHERE id = ?", replaceID); err != nil {
+			return result, err
+		}
+	}
+
+	res, err := tx.Exec(`
+		INSERT INTO chats (title, system_prompt, is_pinned, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, chat.Title, chat.SystemPrompt, chat.IsPinned, chat.CreatedAt, chat.UpdatedAt)
+	if err != nil {
+		return result, err
+	}
+
+	chatID, err := res.LastInsertId()
+	if err != nil {
+		return result, err
+	}
+	result.ChatID = chatID
+
+	for _, msg := range chat.Messages {
+		_, err := tx.Exec(`
+			INSERT INTO messages (chat_id, role, content, model_name, tokens_used, version_group, is_active_version, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`, chatID, msg.Role, msg.Content, msg.ModelName, msg.TokensUsed, msg.VersionGroup, !msg.Inactive, msg.CreatedAt)
+		if err != nil {
+			log.Printf("Error importing message %d of chat %q: %v", msg.ID, chat.Title, err)
+			result.MessagesFailed++
+			continue
+		}
+		result.MessagesImported++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
 func restoreBackup(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		mode := r.URL.Query().Get("mode")
+		if mode == "" {
+			mode = "merge"
+		}
+		if mode != "merge" && mode != "replace" {
+			WriteError(w, http.StatusBadRequest, "mode must be merge or replace")
+			return
+		}
+
 		var backup BackupData
 		if err := json.NewDecoder(r.Body).Decode(&backup); err != nil {
 			WriteError(w, http.StatusBadRequest, "Invalid backup file format")
@@ -121,55 +353,60 @@ func restoreBackup(db *sql.DB) http.HandlerFunc {
 		}
 
 		imported := 0
+		replaced := 0
 		skipped := 0
+		failed := 0
+		results := make([]RestoreResult, 0, len(backup.Chats))
 
 		for _, chat := range backup.Chats {
+			// A chat with the same title and updated_at is treated as already restored
 			var existingID int64
 			err := db.QueryRow("SELECT id FROM chats WHERE title = ? AND updated_at = ?",
 				chat.Title, chat.UpdatedAt).Scan(&existingID)
-
-			if err == nil {
-				skipped++
+			if err != nil && err != sql.ErrNoRows {
+				failed++
+				results = append(results, RestoreResult{Title: chat.Title, Status: "failed", Error: err.Error()})
 				continue
 			}
 
-			if err != sql.ErrNoRows {
+			if err == nil && mode == "merge" {
+				skipped++
+				results = append(results, RestoreResult{Title: chat.Title, ChatID: existingID, Status: "skipped"})
 				continue
 			}
 
-			result, err := db.Exec(`
-				INSERT INTO chats (id, title, system_prompt, is_pinned, created_at, updated_at)
-				VALUES (?, ?, ?, ?, ?, ?)
-			`, chat.ID, chat.Title, chat.SystemPrompt, chat.IsPinned, chat.CreatedAt, chat.UpdatedAt)
+			result, err := restoreChat(db, chat, existingID)
 			if err != nil {
+				log.Printf("Error restoring chat %q: %v", chat.Title, err)
+				failed++
+				result.Status = "failed"
+				result.Error = err.Error()
+				result.ChatID = 0
+				result.MessagesImported = 0
+				result.MessagesFailed = len(chat.Messages)
+				results = append(results, result)
 				continue
 			}
 
-			var chatID int64
-			if chat.ID > 0 {
-				chatID = chat.ID
+			if existingID > 0 {
+				replaced++
+				result.Status = "replaced"
 			} else {
-				chatID, _ = result.LastInsertId()
+				imported++
+				result.Status = "imported"
 			}
-
-			for _, msg := range chat.Messages {
-				_, err := db.Exec(`
-					INSERT INTO messages (id, chat_id, role, content, model_name, tokens_used, version_group, created_at)
-					VALUES (?, ?, ?, ?, ?, ?, ?, ?)
-				`, msg.ID, chatID, msg.Role, msg.Content, msg.ModelName, msg.TokensUsed, msg.VersionGroup, msg.CreatedAt)
-				if err != nil {
-					fmt.Println("Error importing message:", err)
-				}
-			}
-
-			imported++
+			results = append(results, result)
 		}
 
 		WriteJSON(w, map[string]interface{}{
 			"status":   "success",
+			"mode":     mode,
 			"imported": imported,
+			"replaced": replaced,
 			"skipped":  skipped,
-			"message":  fmt.Sprintf("Imported %d chats, skipped %d duplicates", imported, skipped),
+			"failed":   failed,
+			"chats":    results,
+			"message":  fmt.Sprintf("Imported %d chats, replaced %d, skipped %d duplicates, %d failed", imported, replaced, skipped, failed),
 		})
 	}
 }
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func seedBackupChat(t *testing.T) {
+	t.Helper()
+	res, err := db.Exec("INSERT INTO chats (title, system_prompt, is_pinned, updated_at) VALUES ('Trip plans', 'Be brief', 1, '2026-05-01 10:00:00')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	chatID, _ := res.LastInsertId()
+	if _, err := db.Exec(`INSERT INTO messages (chat_id, role, content, model_name, version_group, is_active_version) VALUES
+		(?, 'user', 'Where should I go?', '', 'g1', 1),
+		(?, 'assistant', 'Lisbon.', 'llama3', 'g1', 0),
+		(?, 'assistant', 'Porto.', 'llama3', 'g1', 1)`, chatID, chatID, chatID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBackupRoundTripsThroughRestore(t *testing.T) {
+	newTestDB(t)
+	seedBackupChat(t)
+
+	rec := httptest.NewRecorder()
+	getBackup(db)(rec, httptest.NewRequest(http.MethodGet, "/backup", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("backup status %d: %s", rec.Code, rec.Body.String())
+	}
+	streamed := rec.Body.Bytes()
+	var backup BackupData
+	if err := json.Unmarshal(streamed, &backup); err != nil {
+		t.Fatalf("backup is not valid JSON: %v", err)
+	}
+
+	// Restore the streamed bytes as-is into an empty database
+	newTestDB(t)
+	restored := httptest.NewRecorder()
+	restoreBackup(db)(restored, httptest.NewRequest(http.MethodPost, "/restore", bytes.NewReader(streamed)))
+	if restored.Code != http.StatusOK {
+		t.Fatalf("restore status %d: %s", restored.Code, restored.Body.String())
+	}
+
+	again := httptest.NewRecorder()
+	getBackup(db)(again, httptest.NewRequest(http.MethodGet, "/backup", nil))
+	var roundTripped BackupData
+	if err := json.Unmarshal(again.Body.Bytes(), &roundTripped); err != nil {
+		t.Fatal(err)
+	}
+	if len(roundTripped.Chats) != 1 {
+		t.Fatalf("restored %d chats, want 1", len(roundTripped.Chats))
+	}
+	want, got := backup.Chats[0], roundTripped.Chats[0]
+	if got.Title != want.Title || got.SystemPrompt != want.SystemPrompt || got.IsPinned != want.IsPinned || got.UpdatedAt != want.UpdatedAt {
+		t.Errorf("restored chat = %+v, want %+v", got, want)
+	}
+	if len(got.Messages) != len(want.Messages) {
+		t.Fatalf("restored %d messages, want %d", len(got.Messages), len(want.Messages))
+	}
+	for i := range want.Messages {
+		w, g := want.Messages[i], got.Messages[i]
+		if g.Role != w.Role || g.Content != w.Content || g.ModelName != w.ModelName || g.VersionGroup != w.VersionGroup || g.Inactive != w.Inactive {
+			t.Errorf("message %d = %+v, want %+v", i, g, w)
+		}
+	}
+}
+
+func TestBackupRouteReturnsJSONAndRequiresAuth(t *testing.T) {
+	newTestDB(t)
+	seedBackupChat(t)
+	enableAuthForTest(t)
+	api := newTestAPI()
+
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, apiV1Prefix+"/backup", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("backup without a session: status %d, want 401", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, apiV1Prefix+"/backup", nil)
+	req.AddCookie(&http.Cookie{Name: "session_id", Value: CreateSession("admin")})
+	rec = httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("backup with a session: status %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("Content-Disposition"); got != "attachment; filename=ollamagoweb-backup.json" {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+	var backup BackupData
+	if err := json.Unmarshal(rec.Body.Bytes(), &backup); err != nil {
+		t.Fatalf("backup is not valid JSON: %v", err)
+	}
+	if backup.Version != 1 || len(backup.Chats) != 1 || len(backup.Chats[0].Messages) != 3 {
+		t.Errorf("backup = %+v, want one chat with three messages", backup)
+	}
+}
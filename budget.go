@@ -0,0 +1,221 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+// TokenBudget is one cap on tokens_used and how much of it has been spent. A Limit of 0
+// means unlimited, and Remaining is then omitted.
+type TokenBudget struct {
+	Limit     int64  `json:"limit"`
+	Used      int64  `json:"used"`
+	Remaining *int64 `json:"remaining,omitempty"`
+}
+
+// Exhausted reports whether a limited budget has no tokens left
+func (b TokenBudget) Exhausted() bool {
+	return b.Limit > 0 && b.Used >= b.Limit
+}
+
+func newTokenBudget(limit, used int64) TokenBudget {
+	b := TokenBudget{Limit: limit, Used: used}
+	if limit > 0 {
+		remaining := max(limit-used, 0)
+		b.Remaining = &remaining
+	}
+	return b
+}
+
+// TokenBudgetStatus holds the daily budget, shared by all chats, and the budget of one
+// chat when a chat was given
+type TokenBudgetStatus struct {
+	Daily   TokenBudget  `json:"daily"`
+	Chat    *TokenBudget `json:"chat,omitempty"`
+	ResetAt string       `json:"reset_at"`
+}
+
+// Sources of recorded token usage
+const (
+	usageSourceChat       = "chat"
+	usageSourceSummary    = "summary"
+	usageSourceExtraction = "memory_extraction"
+)
+
+// recordTokenUsage appends tokens spent for a chat, or for no chat when chatID is 0, to
+// the token_usage ledger. Budgets are counted from the ledger rather than from messages,
+// so deleting or editing messages does not give tokens back.
+func recordTokenUsage(db *sql.DB, chatID int64, source string, tokens int) {
+	if tokens <= 0 {
+		return
+	}
+	var chat interface{}
+	if chatID > 0 {
+		chat = chatID
+	}
+	if _, err := db.Exec("INSERT INTO token_usage (chat_id, source, tokens) VALUES (?, ?, ?)", chat, source, tokens); err != nil {
+		log.Printf("Error recording %s token usage: %v", source, err)
+	}
+}
+
+// tokenBudgetDayStart returns the start of the current budget day, which runs in UTC to
+// match the CURRENT_TIMESTAMP values in token_usage.created_at
+func tokenBudgetDayStart(now time.Time) time.Time {
+	y, m, d := now.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// chatTokenBudgetLimit returns a chat's own token_budget, falling back to the
+// token_budget setting when the chat has none
+func chatTokenBudgetLimit(db *sql.DB, chatID int64) int64 {
+	var override sql.NullInt64
+	err := db.QueryRow("SELECT token_budget FROM chats WHERE id = ?", chatID).Scan(&override)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Error reading token budget for chat %d: %v", chatID, err)
+	}
+	if override.Valid {
+		return override.Int64
+	}
+	limit, _ := strconv.ParseInt(GetSetting(db, "token_budget", "0"), 10, 64)
+	return limit
+}
+
+// GetTokenBudgetStatus sums the recorded token usage for today and, when chatID is set,
+// for the whole chat, against the token_budget_daily and token_budget limits
+func GetTokenBudgetStatus(db *sql.DB, chatID int64) (TokenBudgetStatus, error) {
+	dayStart := tokenBudgetDayStart(time.Now())
+	status := TokenBudgetStatus{ResetAt: dayStart.Add(24 * time.Hour).Format(time.RFC3339)}
+
+	var dailyUsed int64
+	err := db.QueryRow("SELECT COALESCE(SUM(tokens), 0) FROM token_usage WHERE created_at >= ?",
+		dayStart.Format("2006-01-02 15:04:05")).Scan(&dailyUsed)
+	if err != nil {
+		return status, fmt.Errorf("summing daily token usage: %w", err)
+	}
+	dailyLimit, _ := strconv.ParseInt(GetSetting(db, "token_budget_daily", "0"), 10, 64)
+	status.Daily = newTokenBudget(dailyLimit, dailyUsed)
+
+	if chatID > 0 {
+		var chatUsed int64
+		err := db.QueryRow("SELECT COALESCE(SUM(tokens), 0) FROM token_usage WHERE chat_id = ?", chatID).Scan(&chatUsed)
+		if err != nil {
+			return status, fmt.Errorf("summing token usage for chat %d: %w", chatID, err)
+		}
+		chat := newTokenBudget(chatTokenBudgetLimit(db, chatID), chatUsed)
+		status.Chat = &chat
+	}
+	return status, nil
+}
+
+// tokenBudgetError says which budget stops a generation from starting. RetryAfter is the
+// number of seconds until the daily budget resets, or 0 for a chat's budget.
+type tokenBudgetError struct {
+	Code       string
+	Message    string
+	RetryAfter int
+}
+
+// checkTokenBudget returns the exhausted budget that stops a generation for chatID, or
+// nil when there are tokens left. When the budget cannot be read the generation is
+// allowed.
+func checkTokenBudget(chatID int64) *tokenBudgetError {
+	status, err := GetTokenBudgetStatus(db, chatID)
+	if err != nil {
+		log.Printf("Error checking token budget: %v", err)
+		return nil
+	}
+	if status.Daily.Exhausted() {
+		return &tokenBudgetError{
+			Code:       "daily_token_budget_exhausted",
+			Message:    fmt.Sprintf("Daily token budget of %d tokens is used up; it resets at %s", status.Daily.Limit, status.ResetAt),
+			RetryAfter: int(time.Until(tokenBudgetDayStart(time.Now()).Add(24*time.Hour)).Seconds()) + 1,
+		}
+	}
+	if status.Chat != nil && status.Chat.Exhausted() {
+		return &tokenBudgetError{
+			Code:    "chat_token_budget_exhausted",
+			Message: fmt.Sprintf("This chat has used its token budget of %d tokens; raise it or start a new chat", status.Chat.Limit),
+		}
+	}
+	return nil
+}
+
+// enforceTokenBudget writes a 429 and returns false when the daily budget or the chat's
+// budget is used up
+func enforceTokenBudget(w http.ResponseWriter, chatID int64) bool {
+	budgetErr := checkTokenBudget(chatID)
+	if budgetErr == nil {
+		return true
+	}
+	if budgetErr.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(budgetErr.RetryAfter))
+	}
+	WriteErrorWithCode(w, http.StatusTooManyRequests, budgetErr.Code, budgetErr.Message)
+	return false
+}
+
+// getTokenBudget handles GET /api/usage/budget, reporting the remaining daily budget and,
+// with ?chat_id=, the chat's budget
+func getTokenBudget(w http.ResponseWriter, r *http.Request) {
+	var chatID int64
+	if v := r.URL.Query().Get("chat_id"); v != "" {
+		var err error
+		if chatID, err = strconv.ParseInt(v, 10, 64); err != nil {
+			WriteError(w, http.StatusBadRequest, "Invalid chat_id")
+			return
+		}
+	}
+
+	status, err := GetTokenBudgetStatus(db, chatID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	WriteJSON(w, status)
+}
+
+// setChatTokenBudget handles PUT /api/chats/{id}/budget. A token_budget of null clears
+// the override so the chat follows the token_budget setting; 0 makes it unlimited.
+func setChatTokenBudget(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid chat ID")
+		return
+	}
+
+	var req struct {
+		TokenBudget *int64 `json:"token_budget"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.TokenBudget != nil && *req.TokenBudget < 0 {
+		WriteError(w, http.StatusBadRequest, "token_budget must be 0 or more")
+		return
+	}
+
+	result, err := db.Exec("UPDATE chats SET token_budget = ? WHERE id = ?", req.TokenBudget, id)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		WriteError(w, http.StatusNotFound, "Chat not found")
+		return
+	}
+
+	status, err := GetTokenBudgetStatus(db, id)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	WriteJSON(w, status)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTokenBudgetSurvivesMessageDeletion(t *testing.T) {
+	testDB := newTestDB(t)
+	res, err := testDB.Exec("INSERT INTO chats (title) VALUES ('budgeted')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	chatID, _ := res.LastInsertId()
+	if _, err := testDB.Exec("INSERT INTO settings (key, value) VALUES ('token_budget_daily', '1000'), ('token_budget', '500')"); err != nil {
+		t.Fatal(err)
+	}
+
+	recordTokenUsage(testDB, chatID, usageSourceChat, 300)
+	recordTokenUsage(testDB, chatID, usageSourceSummary, 150)
+	recordTokenUsage(testDB, 0, usageSourceExtraction, 50)
+	recordTokenUsage(testDB, chatID, usageSourceChat, 0)
+
+	if _, err := testDB.Exec("INSERT INTO messages (chat_id, role, content, tokens_used) VALUES (?, 'assistant', 'reply', 300)", chatID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testDB.Exec("DELETE FROM chats WHERE id = ?", chatID); err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := GetTokenBudgetStatus(testDB, chatID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Daily.Used != 500 {
+		t.Errorf("daily used = %d, want 500", status.Daily.Used)
+	}
+	if status.Chat == nil || status.Chat.Used != 450 {
+		t.Fatalf("chat used = %+v, want 450", status.Chat)
+	}
+	if *status.Daily.Remaining != 500 {
+		t.Errorf("daily remaining = %d, want 500", *status.Daily.Remaining)
+	}
+}
+
+func TestTokenBudgetExhausted(t *testing.T) {
+	testDB := newTestDB(t)
+	res, _ := testDB.Exec("INSERT INTO chats (title, token_budget) VALUES ('small', 100)")
+	chatID, _ := res.LastInsertId()
+	recordTokenUsage(testDB, chatID, usageSourceChat, 100)
+
+	status, err := GetTokenBudgetStatus(testDB, chatID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Daily.Exhausted() {
+		t.Error("an unlimited daily budget should never be exhausted")
+	}
+	if !status.Chat.Exhausted() {
+		t.Error("expected the chat budget of 100 to be exhausted")
+	}
+}
+
+func TestMigrateTokenUsageCopiesExistingUsage(t *testing.T) {
+	testDB := newTestDB(t)
+	res, _ := testDB.Exec("INSERT INTO chats (title) VALUES ('old')")
+	chatID, _ := res.LastInsertId()
+	testDB.Exec("INSERT INTO messages (chat_id, role, content, tokens_used) VALUES (?, 'assistant', 'a', 40), (?, 'assistant', 'b', 2)", chatID, chatID)
+
+	// A database from before the ledger: the table is missing until the migration runs
+	if _, err := testDB.Exec("DROP TABLE token_usage"); err != nil {
+		t.Fatal(err)
+	}
+	migrateTokenUsage(testDB)
+	migrateTokenUsage(testDB)
+
+	status, err := GetTokenBudgetStatus(testDB, chatID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Chat.Used != 42 {
+		t.Fatalf("chat used = %d after migration, want 42 copied once", status.Chat.Used)
+	}
+}
+
+func TestChatCompletionsRefusesWhenTheDailyBudgetIsUsedUp(t *testing.T) {
+	testDB := newTestDB(t)
+	srv := newChatCompletionServer(t, "too late")
+	newTestProvider(t, testDB, srv.URL)
+	setTestSetting(t, testDB, "token_budget_daily", "100")
+	recordTokenUsage(testDB, 0, usageSourceChat, 100)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions",
+		strings.NewReader(`{"messages": [{"role": "user", "content": "hello"}]}`))
+	chatCompletions(rec, req)
+
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status %d, want 429: %s", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("missing Retry-After header")
+	}
+	var out struct {
+		Error struct {
+			Type string `json:"type"`
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Error.Type != "rate_limit_error" || out.Error.Code != "daily_token_budget_exhausted" {
+		t.Errorf("error = %+v", out.Error)
+	}
+	if n := len(srv.requests()); n != 0 {
+		t.Errorf("provider got %d requests, want none", n)
+	}
+}
+
+func TestBotReplyRefusesWhenTheChatBudgetIsUsedUp(t *testing.T) {
+	testDB := newTestDB(t)
+	srv := newChatCompletionServer(t, "too late")
+	providerID := newTestProvider(t, testDB, srv.URL)
+	if _, err := testDB.Exec("INSERT INTO models (provider_id, model_name, is_default) VALUES (?, 'gpt-test', 1)", providerID); err != nil {
+		t.Fatal(err)
+	}
+	res, err := testDB.Exec("INSERT INTO chats (title, token_budget) VALUES ('bot chat', 50)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	chatID, _ := res.LastInsertId()
+	recordTokenUsage(testDB, chatID, usageSourceChat, 50)
+
+	reply := generateResponseForSession("tg-budget", chatID, "hello")
+	if !strings.Contains(reply, "token budget of 50 tokens") {
+		t.Errorf("reply = %q, want the budget message", reply)
+	}
+	if n := len(srv.requests()); n != 0 {
+		t.Errorf("provider got %d requests, want none", n)
+	}
+	var saved int
+	testDB.QueryRow("SELECT COUNT(*) FROM messages WHERE chat_id = ?", chatID).Scan(&saved)
+	if saved != 0 {
+		t.Errorf("%d messages saved, want none", saved)
+	}
+}
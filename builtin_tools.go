@@ -0,0 +1,422 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // current_datetime resolves zone names on hosts without a zone database
+
+	"github.com/contactwajeeh/ollamagoweb-v2/mcp"
+)
+
+const (
+	// builtinToolServerID marks built-in tools in Tool.ServerID, as -1 marks skills and
+	// -2 HTTP tools
+	builtinToolServerID = -3
+	// maxCalculatorExpression caps the length of a calculator expression
+	maxCalculatorExpression = 500
+)
+
+// builtinTools are answered in-process, for what models tend to get wrong on their own
+var builtinTools = []Tool{
+	{
+		Name:        "calculator",
+		Description: "Evaluate an arithmetic expression exactly. Supports + - * / % ^, parentheses, the constants pi and e, and sqrt, abs, round, floor, ceil, exp, ln, log10, log2, sin, cos, tan, min, max and pow.",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"expression": map[string]interface{}{
+					"type":        "string",
+					"description": "The expression, e.g. (17.5 * 3) / 4 + sqrt(2)",
+				},
+			},
+			"required": []string{"expression"},
+		},
+	},
+	{
+		Name:        "current_datetime",
+		Description: "Get the current date, time and weekday, in UTC or a given time zone.",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"timezone": map[string]interface{}{
+					"type":        "string",
+					"description": "IANA time zone name such as Europe/Berlin or America/New_York; UTC if omitted",
+				},
+			},
+		},
+	},
+}
+
+// appendBuiltinTools adds the built-in tools to tools when builtin_tools_enabled is set,
+// numbering a name that is already taken
+func appendBuiltinTools(db *sql.DB, tools []Tool) []Tool {
+	if !GetBoolSetting(db, "builtin_tools_enabled", false) {
+		return tools
+	}
+	used := make(map[string]bool, len(tools))
+	for _, t := range tools {
+		used[t.Name] = true
+	}
+	for _, t := range builtinTools {
+		t.ToolName = t.Name
+		t.Name = mcp.UniqueToolName(t.Name, used)
+		t.ServerID = builtinToolServerID
+		tools = append(tools, t)
+	}
+	return tools
+}
+
+// executeBuiltinTool runs the built-in tool named name
+func executeBuiltinTool(ctx context.Context, name string, arguments map[string]interface{}) (string, error) {
+	switch name {
+	case "calculator":
+		expression, _ := arguments["expression"].(string)
+		value, err := evaluateExpression(expression)
+		if err != nil {
+			return "", err
+		}
+		return formatNumber(value), nil
+	case "current_datetime":
+		timezone, _ := arguments["timezone"].(string)
+		return currentDatetime(time.Now(), timezone)
+	}
+	return "", fmt.Errorf("unknown built-in tool: %s", name)
+}
+
+// currentDatetime describes now in the named time zone, UTC when it is empty
+func currentDatetime(now time.Time, timezone string) (string, error) {
+	timezone = strings.TrimSpace(timezone)
+	loc := time.UTC
+	if timezone != "" && !strings.EqualFold(timezone, "UTC") {
+		var err error
+		if loc, err = time.LoadLocation(timezone); err != nil {
+			return "", fmt.Errorf("unknown time zone %q; use an IANA name such as Europe/London", timezone)
+		}
+	}
+	local := now.In(loc)
+	zone, offset := local.Zone()
+
+	result, err := json.Marshal(map[string]interface{}{
+		"datetime":       local.Format(time.RFC3339),
+		"date":           local.Format("2006-01-02"),
+		"time":           local.Format("15:04:05"),
+		"weekday":        local.Weekday().String(),
+		"timezone":       loc.String(),
+		"abbreviation":   zone,
+		"utc_offset":     local.Format("-07:00"),
+		"offset_seconds": offset,
+		"unix":           local.Unix(),
+	})
+	return string(result), err
+}
+
+// formatNumber prints a calculator result. Whole numbers are printed exactly, in full
+// below 1e21; other values are rounded to 15 significant digits, which hides float
+// noise such as 0.1 + 0.2 = 0.30000000000000004.
+func formatNumber(v float64) string {
+	if v == math.Trunc(v) {
+		if math.Abs(v) < 1e21 {
+			return strconv.FormatFloat(v+0, 'f', 0, 64)
+		}
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	return strconv.FormatFloat(v, 'g', 15, 64)
+}
+
+// evaluateExpression evaluates an arithmetic expression without running any code: a
+// recursive-descent parser over numbers, operators, constants and a fixed function list
+func evaluateExpression(expression string) (float64, error) {
+	expression = strings.TrimSpace(expression)
+	if expression == "" {
+		return 0, fmt.Errorf("expression is required")
+	}
+	if len(expression) > maxCalculatorExpression {
+		return 0, fmt.Errorf("expression is too long (max %d characters)", maxCalculatorExpression)
+	}
+
+	p := &exprParser{input: expression}
+	value, err := p.parseSum()
+	if err != nil {
+		return 0, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.input) {
+		return 0, fmt.Errorf("unexpected %q at position %d", p.input[p.pos], p.pos+1)
+	}
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, fmt.Errorf("result is not a finite number")
+	}
+	return value, nil
+}
+
+// exprParser holds the position in an expression. Precedence from loosest: + and -,
+// then * / and %, then unary signs, then ^ (right-associative), then atoms.
+type exprParser struct {
+	input string
+	pos   int
+	depth int
+}
+
+// maxExprDepth bounds nesting, so a pathological expression cannot exhaust the stack
+const maxExprDepth = 64
+
+var exprConstants = map[string]float64{
+	"pi": math.Pi,
+	"e":  math.E,
+}
+
+var exprFunctions = map[string]struct {
+	args int
+	fn   func(args []float64) (float64, error)
+}{
+	"sqrt": {1, func(a []float64) (float64, error) {
+		if a[0] < 0 {
+			return 0, fmt.Errorf("sqrt of a negative number")
+		}
+		return math.Sqrt(a[0]), nil
+	}},
+	"abs":   {1, func(a []float64) (float64, error) { return math.Abs(a[0]), nil }},
+	"round": {1, func(a []float64) (float64, error) { return math.Round(a[0]), nil }},
+	"floor": {1, func(a []float64) (float64, error) { return math.Floor(a[0]), nil }},
+	"ceil":  {1, func(a []float64) (float64, error) { return math.Ceil(a[0]), nil }},
+	"exp":   {1, func(a []float64) (float64, error) { return math.Exp(a[0]), nil }},
+	"ln":    {1, logFunction(math.Log)},
+	"log10": {1, logFunction(math.Log10)},
+	"log2":  {1, logFunction(math.Log2)},
+	"sin":   {1, func(a []float64) (float64, error) { return math.Sin(a[0]), nil }},
+	"cos":   {1, func(a []float64) (float64, error) { return math.Cos(a[0]), nil }},
+	"tan":   {1, func(a []float64) (float64, error) { return math.Tan(a[0]), nil }},
+	"min":   {2, func(a []float64) (float64, error) { return math.Min(a[0], a[1]), nil }},
+	"max":   {2, func(a []float64) (float64, error) { return math.Max(a[0], a[1]), nil }},
+	"pow":   {2, func(a []float64) (float64, error) { return math.Pow(a[0], a[1]), nil }},
+}
+
+func logFunction(log func(float64) float64) func([]float64) (float64, error) {
+	return func(a []float64) (float64, error) {
+		if a[0] <= 0 {
+			return 0, fmt.Errorf("logarithm of a non-positive number")
+		}
+		return log(a[0]), nil
+	}
+}
+
+func (p *exprParser) skipSpace() {
+	for p.pos < len(p.input) && (p.input[p.pos] == ' ' || p.input[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// peek returns the next non-space byte, or 0 at the end
+func (p *exprParser) peek() byte {
+	p.skipSpace()
+	if p.pos < len(p.input) {
+		return p.input[p.pos]
+	}
+	return 0
+}
+
+func (p *exprParser) parseSum() (float64, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		op := p.peek()
+		if op != '+' && op != '-' {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseProduct()
+		if err != nil {
+			return 0, err
+		}
+		if op == '+' {
+			left += right
+		} else {
+			left -= right
+		}
+	}
+}
+
+func (p *exprParser) parseProduct() (float64, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		op := p.peek()
+		if op != '*' && op != '/' && op != '%' {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case op == '*':
+			left *= right
+		case right == 0:
+			return 0, fmt.Errorf("division by zero")
+		case op == '/':
+			left /= right
+		default:
+			left = math.Mod(left, right)
+		}
+	}
+}
+
+func (p *exprParser) parseUnary() (float64, error) {
+	switch p.peek() {
+	case '-', '+':
+		sign := p.input[p.pos]
+		p.pos++
+		if err := p.enter(); err != nil {
+			return 0, err
+		}
+		defer p.leave()
+		value, err := p.parseUnary()
+		if sign == '-' {
+			value = -value
+		}
+		return value, err
+	}
+	return p.parsePower()
+}
+
+func (p *exprParser) parsePower() (float64, error) {
+	base, err := p.parseAtom()
+	if err != nil {
+		return 0, err
+	}
+	if p.peek() != '^' {
+		return base, nil
+	}
+	p.pos++
+	if err := p.enter(); err != nil {
+		return 0, err
+	}
+	defer p.leave()
+	// The exponent may carry its own sign, as in 2^-1
+	exponent, err := p.parseUnary()
+	if err != nil {
+		return 0, err
+	}
+	return math.Pow(base, exponent), nil
+}
+
+func (p *exprParser) parseAtom() (float64, error) {
+	c := p.peek()
+	switch {
+	case c == 0:
+		return 0, fmt.Errorf("expression ended unexpectedly")
+	case c == '(':
+		p.pos++
+		if err := p.enter(); err != nil {
+			return 0, err
+		}
+		defer p.leave()
+		value, err := p.parseSum()
+		if err != nil {
+			return 0, err
+		}
+		if p.peek() != ')' {
+			return 0, fmt.Errorf("missing closing parenthesis")
+		}
+		p.pos++
+		return value, nil
+	case c >= '0' && c <= '9' || c == '.':
+		return p.parseNumber()
+	case c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		return p.parseName()
+	}
+	return 0, fmt.Errorf("unexpected %q at position %d", c, p.pos+1)
+}
+
+func (p *exprParser) parseNumber() (float64, error) {
+	start := p.pos
+	for p.pos < len(p.input) && (p.input[p.pos] >= '0' && p.input[p.pos] <= '9' || p.input[p.pos] == '.') {
+		p.pos++
+	}
+	// Scientific notation such as 1.5e3
+	if p.pos < len(p.input) && (p.input[p.pos] == 'e' || p.input[p.pos] == 'E') {
+		end := p.pos + 1
+		if end < len(p.input) && (p.input[end] == '+' || p.input[end] == '-') {
+			end++
+		}
+		if end < len(p.input) && p.input[end] >= '0' && p.input[end] <= '9' {
+			for end < len(p.input) && p.input[end] >= '0' && p.input[end] <= '9' {
+				end++
+			}
+			p.pos = end
+		}
+	}
+	value, err := strconv.ParseFloat(p.input[start:p.pos], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", p.input[start:p.pos])
+	}
+	return value, nil
+}
+
+func (p *exprParser) parseName() (float64, error) {
+	start := p.pos
+	for p.pos < len(p.input) && (p.input[p.pos] >= 'a' && p.input[p.pos] <= 'z' || p.input[p.pos] >= 'A' && p.input[p.pos] <= 'Z' || p.input[p.pos] >= '0' && p.input[p.pos] <= '9') {
+		p.pos++
+	}
+	name := strings.ToLower(p.input[start:p.pos])
+
+	if value, ok := exprConstants[name]; ok {
+		return value, nil
+	}
+	f, ok := exprFunctions[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown name %q", name)
+	}
+	if p.peek() != '(' {
+		return 0, fmt.Errorf("%s needs its arguments in parentheses", name)
+	}
+	p.pos++
+	if err := p.enter(); err != nil {
+		return 0, err
+	}
+	defer p.leave()
+
+	var args []float64
+	for {
+		value, err := p.parseSum()
+		if err != nil {
+			return 0, err
+		}
+		args = append(args, value)
+		if p.peek() != ',' {
+			break
+		}
+		p.pos++
+	}
+	if p.peek() != ')' {
+		return 0, fmt.Errorf("missing closing parenthesis after %s arguments", name)
+	}
+	p.pos++
+	if len(args) != f.args {
+		return 0, fmt.Errorf("%s takes %d argument(s), got %d", name, f.args, len(args))
+	}
+	return f.fn(args)
+}
+
+func (p *exprParser) enter() error {
+	p.depth++
+	if p.depth > maxExprDepth {
+		return fmt.Errorf("expression is nested too deeply")
+	}
+	return nil
+}
+
+func (p *exprParser) leave() {
+	p.depth--
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestEvaluateExpression(t *testing.T) {
+	for _, tc := range []struct {
+		expression string
+		want       string
+	}{
+		{"1 + 2 * 3", "7"},
+		{"(1 + 2) * 3", "9"},
+		{"0.1 + 0.2", "0.3"},
+		{"2 ^ 3 ^ 2", "512"},
+		{"-2 ^ 2", "-4"},
+		{"2 ^ -1", "0.5"},
+		{"10 % 4", "2"},
+		{"7 / 2", "3.5"},
+		{"1 / 3", "0.333333333333333"},
+		{"sqrt(16) + abs(-3)", "7"},
+		{"max(2, min(5, 3))", "3"},
+		{"pow(2, 10)", "1024"},
+		{"round(2.5) + floor(-1.5) + ceil(1.2)", "3"},
+		{"1.5e3 + 1E-1", "1500.1"},
+		{"PI * 0 + e * 0", "0"},
+		{"123456789 * 1000000", "123456789000000"},
+		{"2 ^ 60", "1152921504606846976"},
+		{"9007199254740993", "9007199254740992"},
+		{"12345678901234.5", "12345678901234.5"},
+		{"-0", "0"},
+		{"1e300 * 10", "1e+301"},
+	} {
+		value, err := evaluateExpression(tc.expression)
+		if err != nil {
+			t.Errorf("%s: %v", tc.expression, err)
+			continue
+		}
+		if got := formatNumber(value); got != tc.want {
+			t.Errorf("%s = %s, want %s", tc.expression, got, tc.want)
+		}
+	}
+}
+
+func TestEvaluateExpressionErrors(t *testing.T) {
+	for _, expression := range []string{
+		"",
+		"1 +",
+		"(1 + 2",
+		"1 / 0",
+		"5 % 0",
+		"sqrt(-1)",
+		"ln(0)",
+		"max(1)",
+		"sqrt 4",
+		"foo(1)",
+		"1 2",
+		"2 ^ 10000",
+		"os.exit(1)",
+	} {
+		if value, err := evaluateExpression(expression); err == nil {
+			t.Errorf("%q: expected an error, got %v", expression, value)
+		}
+	}
+
+	deep := ""
+	for i := 0; i < maxExprDepth+1; i++ {
+		deep += "("
+	}
+	if _, err := evaluateExpression(deep + "1"); err == nil {
+		t.Error("expected deeply nested expressions to be refused")
+	}
+}
+
+func TestCurrentDatetime(t *testing.T) {
+	now := time.Date(2024, time.July, 1, 12, 30, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		timezone, datetime, weekday, zoneName string
+	}{
+		{"", "2024-07-01T12:30:00Z", "Monday", "UTC"},
+		{"utc", "2024-07-01T12:30:00Z", "Monday", "UTC"},
+		{"Europe/Berlin", "2024-07-01T14:30:00+02:00", "Monday", "Europe/Berlin"},
+		{"America/New_York", "2024-07-01T08:30:00-04:00", "Monday", "America/New_York"},
+		{"Pacific/Kiritimati", "2024-07-02T02:30:00+14:00", "Tuesday", "Pacific/Kiritimati"},
+	} {
+		out, err := currentDatetime(now, tc.timezone)
+		if err != nil {
+			t.Errorf("%q: %v", tc.timezone, err)
+			continue
+		}
+		var got map[string]interface{}
+		if err := json.Unmarshal([]byte(out), &got); err != nil {
+			t.Fatal(err)
+		}
+		if got["datetime"] != tc.datetime || got["weekday"] != tc.weekday || got["timezone"] != tc.zoneName {
+			t.Errorf("%q: got %s", tc.timezone, out)
+		}
+	}
+
+	if _, err := currentDatetime(now, "Mars/Olympus_Mons"); err == nil {
+		t.Error("expected an unknown time zone to be refused")
+	}
+}
+
+func TestExecuteBuiltinTool(t *testing.T) {
+	out, err := executeBuiltinTool(context.Background(), "calculator", map[string]interface{}{"expression": "6 * 7"})
+	if err != nil || out != "42" {
+		t.Fatalf("calculator = %q, %v", out, err)
+	}
+	if _, err := executeBuiltinTool(context.Background(), "nope", nil); err == nil {
+		t.Fatal("expected an unknown tool to be refused")
+	}
+}
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
 	"os"
+	"regexp"
+	"strings"
 	"time"
 
 	_ "modernc.org/sqlite"
@@ -80,7 +83,7 @@ func RunMigrations(db *sql.DB) {
 		`CREATE TABLE IF NOT EXISTS messages (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			chat_id INTEGER NOT NULL,
-			role TEXT NOT NULL CHECK(role IN ('user', 'assistant')),
+			role TEXT NOT NULL ` + messageRolesCheck + `,
 			content TEXT NOT NULL,
 			model_name TEXT,
 			tokens_used INTEGER,
@@ -96,6 +99,14 @@ func RunMigrations(db *sql.DB) {
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 		)`,
 
+		// Per-user overrides of user-scoped settings such as theme
+		`CREATE TABLE IF NOT EXISTS user_settings (
+			user_id TEXT NOT NULL,
+			key TEXT NOT NULL,
+			value TEXT NOT NULL,
+			PRIMARY KEY (user_id, key)
+		)`,
+
 		// MCP Servers table
 		`CREATE TABLE IF NOT EXISTS mcp_servers (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -110,6 +121,19 @@ func RunMigrations(db *sql.DB) {
 			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 		)`,
 
+		// REST endpoints offered to the model as tools
+		`CREATE TABLE IF NOT EXISTS http_tools (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE,
+			description TEXT NOT NULL,
+			url TEXT NOT NULL,
+			method TEXT NOT NULL DEFAULT 'POST',
+			input_schema TEXT NOT NULL,
+			is_enabled INTEGER DEFAULT 1,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
 		// User memories table
 		`CREATE TABLE IF NOT EXISTS user_memories (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -141,6 +165,24 @@ func RunMigrations(db *sql.DB) {
 			FOREIGN KEY (session_id) REFERENCES sessions(id)
 		)`,
 
+		// Chat each Telegram user switched to with /newchat or /chats
+		`CREATE TABLE IF NOT EXISTS telegram_current_chats (
+			telegram_user_id INTEGER PRIMARY KEY,
+			chat_id INTEGER NOT NULL,
+			selected_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (chat_id) REFERENCES chats(id) ON DELETE CASCADE
+		)`,
+
+		// Thumbs up/down on assistant messages, one per message
+		`CREATE TABLE IF NOT EXISTS message_feedback (
+			message_id INTEGER PRIMARY KEY,
+			rating TEXT NOT NULL CHECK (rating IN ('up', 'down')),
+			comment TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE
+		)`,
+
 		// Open Skills cache table
 		`CREATE TABLE IF NOT EXISTS open_skills_cache (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -151,19 +193,50 @@ func RunMigrations(db *sql.DB) {
 			fetched_at DATETIME DEFAULT CURRENT_TIMESTAMP
 		)`,
 
+		// Reusable system prompt presets
+		`CREATE TABLE IF NOT EXISTS prompt_presets (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE,
+			content TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		// Documents attached to a chat for retrieval, stored as chunks
+		`CREATE TABLE IF NOT EXISTS chat_documents (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			chat_id INTEGER NOT NULL,
+			filename TEXT NOT NULL,
+			content_type TEXT NOT NULL,
+			size_bytes INTEGER NOT NULL,
+			chunk_count INTEGER NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (chat_id) REFERENCES chats(id) ON DELETE CASCADE
+		)`,
+		`CREATE TABLE IF NOT EXISTS chat_document_chunks (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			document_id INTEGER NOT NULL,
+			chat_id INTEGER NOT NULL,
+			chunk_index INTEGER NOT NULL,
+			content TEXT NOT NULL,
+			embedding TEXT,
+			FOREIGN KEY (document_id) REFERENCES chat_documents(id) ON DELETE CASCADE
+		)`,
+
 		// Indexes
 		`CREATE INDEX IF NOT EXISTS idx_models_provider ON models(provider_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_providers_active ON providers(is_active)`,
 		`CREATE INDEX IF NOT EXISTS idx_messages_chat ON messages(chat_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_chats_updated ON chats(updated_at DESC)`,
-		`CREATE INDEX IF NOT EXISTS idx_chats_pinned ON chats(is_pinned, updated_at DESC)`,
-		`CREATE INDEX IF NOT EXISTS idx_messages_unsummarized ON messages(chat_id, is_summarized) WHERE is_summarized = 0`,
 		`CREATE INDEX IF NOT EXISTS idx_messages_role ON messages(chat_id, role)`,
 		`CREATE INDEX IF NOT EXISTS idx_sessions_expires ON sessions(expires_at)`,
 		`CREATE INDEX IF NOT EXISTS idx_mcp_servers_enabled ON mcp_servers(is_enabled)`,
 		`CREATE INDEX IF NOT EXISTS idx_memory_session ON user_memories(session_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_memory_category ON user_memories(category)`,
 		`CREATE INDEX IF NOT EXISTS idx_link_tokens_expiry ON session_link_tokens(expires_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_chat_documents_chat ON chat_documents(chat_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_document_chunks_chat ON chat_document_chunks(chat_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_document_chunks_document ON chat_document_chunks(document_id)`,
 	}
 
 	for _, migration := range migrations {
@@ -179,16 +252,43 @@ func RunMigrations(db *sql.DB) {
 		Column string
 		Schema string
 	}{
+		"providers": {
+			{"providers", "max_concurrent", "INTEGER DEFAULT 0"},
+			{"providers", "api_key_hint", "TEXT"},
+		},
+		"models": {
+			{"models", "owned_by", "TEXT"},
+			{"models", "capabilities", "TEXT"},
+		},
 		"messages": {
 			{"messages", "model_name", "TEXT"},
 			{"messages", "tokens_used", "INTEGER"},
 			{"messages", "version_group", "TEXT"},
 			{"messages", "is_summarized", "INTEGER DEFAULT 0"},
+			{"messages", "latency_ms", "INTEGER"},
+			{"messages", "tokens_per_sec", "REAL"},
+			{"messages", "is_active_version", "INTEGER DEFAULT 1"},
 		},
 		"chats": {
 			{"chats", "system_prompt", "TEXT"},
 			{"chats", "summary", "TEXT"},
 			{"chats", "is_pinned", "INTEGER DEFAULT 0"},
+			{"chats", "use_memory", "INTEGER DEFAULT 1"},
+			{"chats", "token_budget", "INTEGER"},
+			{"chats", "telegram_user_id", "INTEGER"},
+		},
+		"sessions": {
+			{"sessions", "last_seen_at", "DATETIME"},
+		},
+		"mcp_servers": {
+			{"mcp_servers", "status", "TEXT"},
+			{"mcp_servers", "last_checked", "DATETIME"},
+			{"mcp_servers", "last_ok", "DATETIME"},
+			{"mcp_servers", "last_error", "TEXT"},
+		},
+		"user_memories": {
+			{"user_memories", "embedding", "TEXT"},
+			{"user_memories", "expires_at", "DATETIME"},
 		},
 	}
 
@@ -203,12 +303,201 @@ func RunMigrations(db *sql.DB) {
 		}
 	}
 
+	// Indexes on added columns, which a new database only has from here on
+	for _, index := range []string{
+		`CREATE INDEX IF NOT EXISTS idx_chats_pinned ON chats(is_pinned, updated_at DESC)`,
+		`CREATE INDEX IF NOT EXISTS idx_messages_unsummarized ON messages(chat_id, is_summarized) WHERE is_summarized = 0`,
+	} {
+		if _, err := db.Exec(index); err != nil {
+			log.Fatal("Migration failed:", err)
+		}
+	}
+
 	// Migrate existing unencrypted API keys to encrypted format
 	migrateAPIKeys(db)
 
+	migrateAPIKeyHints(db)
+
+	migrateUniqueModels(db)
+
+	migrateMessageRoles(db)
+
+	migrateTokenUsage(db)
+
 	log.Println("Database migrations completed")
 }
 
+// migrateUniqueModels removes duplicate model rows per provider, keeping the default or
+// oldest one, then enforces uniqueness of (provider_id, model_name)
+func migrateUniqueModels(db *sql.DB) {
+	result, err := db.Exec(`
+		DELETE FROM models WHERE id NOT IN (
+			SELECT id FROM (
+				SELECT id, ROW_NUMBER() OVER (PARTITION BY provider_id, model_name ORDER BY is_default DESC, id) AS rn
+				FROM models
+			) WHERE rn = 1
+		)
+	`)
+	if err != nil {
+		log.Printf("Warning: Failed to remove duplicate models: %v", err)
+		return
+	}
+	if removed, _ := result.RowsAffected(); removed > 0 {
+		log.Printf("Removed %d duplicate model(s)", removed)
+	}
+
+	if _, err := db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_models_provider_name ON models(provider_id, model_name)`); err != nil {
+		log.Printf("Warning: Failed to create unique model index: %v", err)
+	}
+}
+
+// migrateTokenUsage creates the token_usage ledger that token budgets are counted from.
+// When it is new, the tokens already recorded on messages are copied in so budgets
+// carry over.
+func migrateTokenUsage(db *sql.DB) {
+	var exists bool
+	if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'token_usage')").Scan(&exists); err != nil {
+		log.Printf("Warning: Failed to check token_usage table: %v", err)
+		return
+	}
+
+	// No foreign key on chat_id, so deleting chats or messages leaves the usage in place
+	for _, stmt := range []string{
+		`CREATE TABLE IF NOT EXISTS token_usage (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			chat_id INTEGER,
+			source TEXT NOT NULL,
+			tokens INTEGER NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_token_usage_created ON token_usage(created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_token_usage_chat ON token_usage(chat_id)`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			log.Fatal("Migration failed:", err)
+		}
+	}
+	if exists {
+		return
+	}
+
+	result, err := db.Exec(`
+		INSERT INTO token_usage (chat_id, source, tokens, created_at)
+		SELECT chat_id, 'chat', tokens_used, created_at FROM messages WHERE tokens_used > 0
+	`)
+	if err != nil {
+		log.Printf("Warning: Failed to copy token usage from messages: %v", err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		log.Printf("Copied the token usage of %d message(s) to token_usage", n)
+	}
+}
+
+// messageRolesCheck constrains messages.role. System rows are instructions stored in a
+// chat; tool rows hold the calls made while answering and are hidden from the chat view.
+const messageRolesCheck = `CHECK(role IN ('user', 'assistant', 'system', 'tool'))`
+
+var roleCheckPattern = regexp.MustCompile(`CHECK\s*\(\s*role\s+IN\s*\([^)]*\)\s*\)`)
+
+// migrateMessageRoles rebuilds the messages table when its role CHECK predates
+// messageRolesCheck. SQLite cannot alter a constraint, so the table is copied into one
+// created from its stored schema with the new CHECK, and its indexes are recreated.
+func migrateMessageRoles(db *sql.DB) {
+	var schema string
+	if err := db.QueryRow("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = 'messages'").Scan(&schema); err != nil {
+		log.Printf("Warning: Failed to read messages schema: %v", err)
+		return
+	}
+	if strings.Contains(schema, messageRolesCheck) || !roleCheckPattern.MatchString(schema) {
+		return
+	}
+
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		log.Printf("Warning: Failed to migrate message roles: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	// Foreign keys must be off while messages is dropped, or rows referencing it would
+	// cascade. The pragma is a no-op inside a transaction, so it is set around it.
+	if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+		log.Printf("Warning: Failed to migrate message roles: %v", err)
+		return
+	}
+	defer conn.ExecContext(ctx, "PRAGMA foreign_keys = ON")
+
+	if err := rebuildMessagesTable(ctx, conn, schema); err != nil {
+		log.Printf("Warning: Failed to migrate message roles: %v", err)
+		return
+	}
+	log.Println("Migrated messages table to allow roles:", messageRolesCheck)
+}
+
+func rebuildMessagesTable(ctx context.Context, conn *sql.Conn, schema string) error {
+	var indexes []string
+	rows, err := conn.QueryContext(ctx, "SELECT sql FROM sqlite_master WHERE tbl_name = 'messages' AND type IN ('index', 'trigger') AND sql IS NOT NULL")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var stmt string
+		if err := rows.Scan(&stmt); err != nil {
+			rows.Close()
+			return err
+		}
+		indexes = append(indexes, stmt)
+	}
+	rows.Close()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	create := roleCheckPattern.ReplaceAllLiteralString(schema, messageRolesCheck)
+	create = strings.Replace(create, "messages", "messages_new", 1)
+	stmts := append([]string{
+		create,
+		"INSERT INTO messages_new SELECT * FROM messages",
+		"DROP TABLE messages",
+		"ALTER TABLE messages_new RENAME TO messages",
+	}, indexes...)
+	for _, stmt := range stmts {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("%s: %w", strings.SplitN(strings.TrimSpace(stmt), "(", 2)[0], err)
+		}
+	}
+	return tx.Commit()
+}
+
+// GetSetting returns the stored value for key, or defaultValue if it is not set
+func GetSetting(db *sql.DB, key, defaultValue string) string {
+	var value string
+	err := db.QueryRow("SELECT value FROM settings WHERE key = ?", key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return defaultValue
+	}
+	if err != nil {
+		log.Printf("Error reading setting %s: %v", key, err)
+		return defaultValue
+	}
+	return value
+}
+
+// GetBoolSetting reads a boolean setting stored as 1/0 (or true/false, yes/no, on/off),
+// returning defaultValue when it is unset or unrecognized
+func GetBoolSetting(db *sql.DB, key string, defaultValue bool) bool {
+	value, err := boolSetting(strings.TrimSpace(GetSetting(db, key, "")))
+	if err != nil {
+		return defaultValue
+	}
+	return value == "1"
+}
+
 func columnExists(db *sql.DB, table, column string) bool {
 	query := fmt.Sprintf("PRAGMA table_info(%s)", table)
 	rows, err := db.Query(query)
@@ -275,6 +564,65 @@ func migrateAPIKeys(db *sql.DB) {
 	}
 }
 
+// migrateAPIKeyHints stores the display hint of keys saved before hints were kept, which
+// is the only time stored keys are decrypted for display
+func migrateAPIKeyHints(db *sql.DB) {
+	rows, err := db.Query("SELECT id, api_key FROM providers WHERE api_key IS NOT NULL AND api_key != '' AND api_key_hint IS NULL")
+	if err != nil {
+		log.Println("Error checking API key hints for migration:", err)
+		return
+	}
+	hints := map[int64]string{}
+	for rows.Next() {
+		var id int64
+		var encrypted string
+		if err := rows.Scan(&id, &encrypted); err != nil {
+			continue
+		}
+		hints[id] = apiKeyMask
+		if key, err := Decrypt(encrypted); err == nil {
+			hints[id] = apiKeyHint(key)
+		}
+	}
+	rows.Close()
+
+	for id, hint := range hints {
+		if _, err := db.Exec("UPDATE providers SET api_key_hint = ? WHERE id = ?", hint, id); err != nil {
+			log.Printf("Warning: Could not store API key hint for provider %d: %v\n", id, err)
+		}
+	}
+}
+
+// defaultPromptPresets are created the first time the app starts with the presets table
+var defaultPromptPresets = []struct {
+	Name    string
+	Content string
+}{
+	{"Concise Assistant", "You are a helpful assistant. Answer concisely and directly. Use bullet points for lists and skip unnecessary preamble."},
+	{"Senior Go Developer", "You are a terse senior Go developer. Prefer idiomatic, standard-library solutions, show code first and explain only what is non-obvious."},
+	{"Writing Editor", "You are a careful editor. Improve clarity, grammar and flow while keeping the author's voice. Point out significant changes briefly."},
+}
+
+// SeedPromptPresets inserts the default presets once. Presets the user deletes later
+// are not recreated.
+func SeedPromptPresets(db *sql.DB) {
+	if GetSetting(db, "prompt_presets_seeded", "") == "1" {
+		return
+	}
+
+	for _, preset := range defaultPromptPresets {
+		_, err := db.Exec("INSERT OR IGNORE INTO prompt_presets (name, content) VALUES (?, ?)", preset.Name, preset.Content)
+		if err != nil {
+			log.Printf("Error seeding prompt preset %q: %v", preset.Name, err)
+			return
+		}
+	}
+
+	if _, err := db.Exec("INSERT OR REPLACE INTO settings (key, value) VALUES ('prompt_presets_seeded', '1')"); err != nil {
+		log.Printf("Error recording prompt preset seeding: %v", err)
+	}
+}
+
 // SeedFromEnvIfEmpty seeds the database with .env values if no providers exist
 func SeedFromEnvIfEmpty(db *sql.DB) {
 	var count int
@@ -326,8 +674,8 @@ func SeedFromEnvIfEmpty(db *sql.DB) {
 
 	// Insert the provider
 	result, err := db.Exec(
-		`INSERT INTO providers (name, type, base_url, api_key, is_active) VALUES (?, ?, ?, ?, 1)`,
-		providerName, providerType, baseURL, apiKey,
+		`INSERT INTO providers (name, type, base_url, api_key, api_key_hint, is_active) VALUES (?, ?, ?, ?, ?, 1)`,
+		providerName, providerType, baseURL, apiKey, apiKeyHint(apiKey),
 	)
 	if err != nil {
 		log.Println("Error seeding provider:", err)
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// discordMessageLimit stays under Discord's 2000 character limit per message
+const discordMessageLimit = 1900
+
+var (
+	discordSession         *discordgo.Session
+	discordSessions        = make(map[string]string)
+	discordMutex           sync.RWMutex
+	discordAllowedUsers    []string
+	discordAllowedChannels []string
+)
+
+// InitDiscordBot connects the Discord bot when DISCORD_BOT_TOKEN is set. Replies go
+// through the same generation path as Telegram, so memories, skills and tools apply.
+func InitDiscordBot() {
+	token := os.Getenv("DISCORD_BOT_TOKEN")
+	if token == "" {
+		log.Println("Discord bot not configured (DISCORD_BOT_TOKEN not set)")
+		return
+	}
+
+	log.Println("Initializing Discord bot...")
+	discordAllowedUsers = parseDiscordIDs("DISCORD_ALLOWED_USERS", "user")
+	discordAllowedChannels = parseDiscordIDs("DISCORD_ALLOWED_CHANNELS", "channel")
+
+	session, err := discordgo.New("Bot " + token)
+	if err != nil {
+		log.Printf("Failed to create Discord bot: %v", err)
+		return
+	}
+	session.Identify.Intents = discordgo.IntentsGuildMessages | discordgo.IntentsDirectMessages | discordgo.IntentMessageContent
+	session.AddHandler(handleDiscordMessage)
+
+	if err := session.Open(); err != nil {
+		log.Printf("Failed to connect Discord bot: %v", err)
+		return
+	}
+	discordSession = session
+	log.Printf("Discord bot started as %s", session.State.User.Username)
+}
+
+// StopDiscordBot closes the Discord connection
+func StopDiscordBot() {
+	if discordSession == nil {
+		return
+	}
+	if err := discordSession.Close(); err != nil {
+		log.Printf("Error closing Discord connection: %v", err)
+	}
+	log.Println("Discord bot stopped")
+}
+
+// parseDiscordIDs reads a comma-separated list of Discord ids from an environment
+// variable
+func parseDiscordIDs(env, kind string) []string {
+	var ids []string
+	for _, id := range strings.Split(os.Getenv(env), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) > 0 {
+		log.Printf("Discord allowlist configured with %d %s(s)", len(ids), kind)
+	}
+	return ids
+}
+
+// isDiscordAllowed checks the allowlists. With neither set everyone is allowed;
+// otherwise the user or the channel must be listed.
+func isDiscordAllowed(userID, channelID string) bool {
+	if len(discordAllowedUsers) == 0 && len(discordAllowedChannels) == 0 {
+		return true
+	}
+	return slices.Contains(discordAllowedUsers, userID) || slices.Contains(discordAllowedChannels, channelID)
+}
+
+// discordSessionKey identifies a conversation: a DM belongs to its user and a server
+// channel is shared by everyone in it, like a Telegram group
+func discordSessionKey(m *discordgo.MessageCreate) string {
+	if m.GuildID == "" {
+		return "user_" + m.Author.ID
+	}
+	return "channel_" + m.ChannelID
+}
+
+// getDiscordSession returns the session of a conversation
+func getDiscordSession(key string) string {
+	discordMutex.RLock()
+	sessionID, exists := discordSessions[key]
+	discordMutex.RUnlock()
+	if exists {
+		return sessionID
+	}
+	return resetDiscordSession(key, "discord_"+key)
+}
+
+// resetDiscordSession switches a conversation to sessionID, starting a new chat
+func resetDiscordSession(key, sessionID string) string {
+	discordMutex.Lock()
+	discordSessions[key] = sessionID
+	discordMutex.Unlock()
+	return sessionID
+}
+
+// discordPrompt reports whether a message is addressed to the bot and returns its text
+// without the bot's mentions. DMs are always addressed; in server channels the bot must
+// be mentioned or replied to.
+func discordPrompt(m *discordgo.MessageCreate, self *discordgo.User) (string, bool) {
+	addressed := m.GuildID == ""
+	if m.ReferencedMessage != nil && m.ReferencedMessage.Author != nil && m.ReferencedMessage.Author.ID == self.ID {
+		addressed = true
+	}
+	for _, u := range m.Mentions {
+		if u.ID == self.ID {
+			addressed = true
+		}
+	}
+
+	content := strings.NewReplacer("<@"+self.ID+">", "", "<@!"+self.ID+">", "").Replace(m.Content)
+	return strings.TrimSpace(content), addressed
+}
+
+// handleDiscordMessage answers messages addressed to the bot, running !commands and
+// otherwise generating a reply in the conversation's session
+func handleDiscordMessage(s *discordgo.Session, m *discordgo.MessageCreate) {
+	if m.Author == nil || m.Author.Bot || s.State.User == nil || m.Author.ID == s.State.User.ID {
+		return
+	}
+
+	prompt, addressed := discordPrompt(m, s.State.User)
+	if !addressed {
+		return
+	}
+
+	log.Printf("Discord message from user %s in channel %s: %s", m.Author.ID, m.ChannelID, m.Content)
+
+	if !isDiscordAllowed(m.Author.ID, m.ChannelID) {
+		log.Printf("Unauthorized Discord access attempt from user %s in channel %s", m.Author.ID, m.ChannelID)
+		sendDiscordMessage(s, m.ChannelID, "🚫 Access Denied: You are not authorized to use this bot.")
+		return
+	}
+	if prompt == "" {
+		sendDiscordMessage(s, m.ChannelID, "👋 Ask me something, or send `!help` for commands.")
+		return
+	}
+
+	key := discordSessionKey(m)
+	if strings.HasPrefix(prompt, "!") {
+		handleDiscordCommand(s, m, key, prompt)
+		return
+	}
+
+	if err := s.ChannelTyping(m.ChannelID); err != nil {
+		log.Printf("Error sending Discord typing indicator: %v", err)
+	}
+	sendDiscordMessage(s, m.ChannelID, generateResponseForSession(getDiscordSession(key), 0, prompt))
+}
+
+// handleDiscordCommand runs a !command. Per-user output such as !memories is limited to
+// DMs so it is not shown to a whole channel.
+func handleDiscordCommand(s *discordgo.Session, m *discordgo.MessageCreate, key, text string) {
+	cmd, args, _ := strings.Cut(strings.TrimPrefix(text, "!"), " ")
+	args = strings.TrimSpace(args)
+
+	switch strings.ToLower(cmd) {
+	case "help":
+		sendDiscordMessage(s, m.ChannelID, "📖 Available Commands:\n\n"+
+			"`!search <query>` - Search the web for info\n"+
+			"`!clear` - Start a new conversation\n"+
+			"`!memories` - View your saved memories (DM only)\n\n"+
+			"Mention me or reply to my messages to chat in a server channel.")
+
+	case "clear":
+		resetDiscordSession(key, fmt.Sprintf("discord_%s_%d", key, time.Now().Unix()))
+		sendDiscordMessage(s, m.ChannelID, "🧹 Conversation cleared! Starting a new session.")
+
+	case "search":
+		if args == "" {
+			sendDiscordMessage(s, m.ChannelID, "❌ Usage: `!search <query>`")
+			return
+		}
+		if err := s.ChannelTyping(m.ChannelID); err != nil {
+			log.Printf("Error sending Discord typing indicator: %v", err)
+		}
+		sendDiscordMessage(s, m.ChannelID, generateResponseForSession(getDiscordSession(key), 0, "/search "+args))
+
+	case "memories":
+		if m.GuildID != "" {
+			sendDiscordMessage(s, m.ChannelID, "ℹ️ `!memories` only works in a DM with me.")
+			return
+		}
+		memories, err := GetMemories(db, getDiscordSession(key))
+		if err != nil || len(memories) == 0 {
+			sendDiscordMessage(s, m.ChannelID, "📭 No memories saved yet.")
+			return
+		}
+		var sb strings.Builder
+		sb.WriteString("📋 Your Memories:\n\n")
+		for i, mem := range memories {
+			if i >= 10 {
+				sb.WriteString("\n...and more")
+				break
+			}
+			sb.WriteString(fmt.Sprintf("• %s: %s\n", mem.Key, mem.Value))
+		}
+		sendDiscordMessage(s, m.ChannelID, sb.String())
+
+	default:
+		sendDiscordMessage(s, m.ChannelID, fmt.Sprintf("❓ Unknown command: !%s\n\nUse `!help` for available commands.", cmd))
+	}
+}
+
+// sendDiscordMessage sends text to a channel, split to fit Discord's message limit
+func sendDiscordMessage(s *discordgo.Session, channelID, text string) {
+	for _, chunk := range splitMessage(text, discordMessageLimit) {
+		if _, err := s.ChannelMessageSend(channelID, chunk); err != nil {
+			log.Printf("Error sending Discord message: %v", err)
+		}
+	}
+}
@@ -0,0 +1,562 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// maxDocumentBytes caps the size of an uploaded document
+	maxDocumentBytes = 10 << 20
+	// maxPDFInflatedBytes caps the decompressed size of all of a PDF's streams together,
+	// so a small upload cannot expand into gigabytes
+	maxPDFInflatedBytes = 50 << 20
+	// documentChunkSize is the target length in characters of a stored chunk
+	documentChunkSize = 1000
+	// documentContextChunks is how many chunks are added to the context per message
+	documentContextChunks = 4
+)
+
+// ChatDocument is a file attached to a chat for retrieval
+type ChatDocument struct {
+	ID          int64  `json:"id"`
+	ChatID      int64  `json:"chat_id"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	SizeBytes   int64  `json:"size_bytes"`
+	ChunkCount  int    `json:"chunk_count"`
+	Embedded    bool   `json:"embedded"`
+	CreatedAt   string `json:"created_at"`
+}
+
+// documentContentType returns the supported type of an upload from its extension,
+// falling back to the declared MIME type for plain text
+func documentContentType(filename, declared string) (string, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".txt", ".text", ".log", ".csv":
+		return "text/plain", nil
+	case ".md", ".markdown":
+		return "text/markdown", nil
+	case ".pdf":
+		return "application/pdf", nil
+	}
+	if strings.HasPrefix(declared, "text/") {
+		return "text/plain", nil
+	}
+	return "", fmt.Errorf("unsupported document type; upload .txt, .md or .pdf files")
+}
+
+// ExtractDocumentText returns the plain text of an uploaded document
+func ExtractDocumentText(contentType string, data []byte) (string, error) {
+	var text string
+	if contentType == "application/pdf" {
+		text = extractPDFText(data)
+		if countLetters(text) < 20 {
+			return "", fmt.Errorf("could not extract text from PDF; scanned or image-only PDFs are not supported")
+		}
+	} else {
+		if !utf8.Valid(data) {
+			return "", fmt.Errorf("document is not valid UTF-8 text")
+		}
+		text = string(data)
+	}
+
+	text = strings.TrimSpace(strings.ReplaceAll(text, "\r\n", "\n"))
+	if text == "" {
+		return "", fmt.Errorf("document contains no text")
+	}
+	return text, nil
+}
+
+func countLetters(s string) int {
+	n := 0
+	for _, r := range s {
+		if unicode.IsLetter(r) {
+			n++
+		}
+	}
+	return n
+}
+
+// extractPDFText pulls the text shown by the text operators of a PDF's content
+// streams. It covers uncompressed and FlateDecode streams with standard encodings,
+// which is enough for most generated PDFs but not for scans or CID-keyed fonts.
+// Decompression stops once maxPDFInflatedBytes have been inflated.
+func extractPDFText(data []byte) string {
+	var out strings.Builder
+	pos := 0
+	inflateBudget := int64(maxPDFInflatedBytes)
+	for {
+		idx := bytes.Index(data[pos:], []byte("stream"))
+		if idx == -1 {
+			break
+		}
+		start := pos + idx
+		pos = start + len("stream")
+
+		// Skip "endstream" and find the stream dictionary after the preceding "obj"
+		if start >= 3 && string(data[start-3:start]) == "end" {
+			continue
+		}
+		dictStart := bytes.LastIndex(data[:start], []byte("obj"))
+		if dictStart == -1 {
+			continue
+		}
+		dict := data[dictStart:start]
+
+		body := pos
+		if body < len(data) && data[body] == '\r' {
+			body++
+		}
+		if body < len(data) && data[body] == '\n' {
+			body++
+		}
+		end := bytes.Index(data[body:], []byte("endstream"))
+		if end == -1 {
+			break
+		}
+		content := data[body : body+end]
+		pos = body + end + len("endstream")
+
+		if bytes.Contains(dict, []byte("/Subtype/Image")) || bytes.Contains(dict, []byte("/Subtype /Image")) {
+			continue
+		}
+		if bytes.Contains(dict, []byte("/FlateDecode")) {
+			r, err := zlib.NewReader(bytes.NewReader(content))
+			if err != nil {
+				continue
+			}
+			inflated, _ := io.ReadAll(io.LimitReader(r, inflateBudget))
+			r.Close()
+			content = inflated
+			inflateBudget -= int64(len(inflated))
+			if inflateBudget <= 0 {
+				parsePDFContent(content, &out)
+				break
+			}
+		} else if bytes.Contains(dict, []byte("/Filter")) {
+			continue
+		}
+
+		parsePDFContent(content, &out)
+	}
+	return out.String()
+}
+
+// parsePDFContent writes the strings drawn by Tj, TJ, ' and " in a content stream,
+// starting new lines on line-moving operators
+func parsePDFContent(content []byte, out *strings.Builder) {
+	var operands []string
+	var inArray bool
+	var array []string
+
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+		switch {
+		case c == '(':
+			s, next := readPDFLiteral(content, i)
+			i = next
+			if inArray {
+				array = append(array, s)
+			} else {
+				operands = append(operands, s)
+			}
+		case c == '<' && i+1 < len(content) && content[i+1] != '<':
+			end := bytes.IndexByte(content[i:], '>')
+			if end == -1 {
+				return
+			}
+			s := decodePDFHex(content[i+1 : i+end])
+			i += end
+			if inArray {
+				array = append(array, s)
+			} else {
+				operands = append(operands, s)
+			}
+		case c == '[':
+			inArray, array = true, nil
+		case c == ']':
+			inArray = false
+		case c == '/':
+			// Skip names such as /F1 so their letters are not read as operators
+			for i+1 < len(content) && !isPDFDelimiter(content[i+1]) {
+				i++
+			}
+		case c == '%':
+			for i < len(content) && content[i] != '\n' && content[i] != '\r' {
+				i++
+			}
+		case isPDFOperatorByte(c):
+			j := i
+			for j < len(content) && isPDFOperatorByte(content[j]) {
+				j++
+			}
+			switch string(content[i:j]) {
+			case "Tj":
+				out.WriteString(strings.Join(operands, ""))
+			case "'", "\"":
+				out.WriteString("\n" + strings.Join(operands, ""))
+			case "TJ":
+				out.WriteString(strings.Join(array, ""))
+				array = nil
+			case "T*", "Td", "TD", "ET":
+				out.WriteString("\n")
+			}
+			operands = nil
+			i = j - 1
+		}
+	}
+}
+
+func isPDFDelimiter(c byte) bool {
+	return strings.IndexByte(" \t\r\n\f\x00()<>[]{}/%", c) != -1
+}
+
+func isPDFOperatorByte(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '*' || c == '\'' || c == '"'
+}
+
+// readPDFLiteral reads a parenthesized PDF string starting at content[start] and
+// returns it with the index of its closing parenthesis
+func readPDFLiteral(content []byte, start int) (string, int) {
+	var b strings.Builder
+	depth := 0
+	for i := start; i < len(content); i++ {
+		c := content[i]
+		switch c {
+		case '\\':
+			if i+1 >= len(content) {
+				return b.String(), i
+			}
+			i++
+			switch e := content[i]; e {
+			case 'n':
+				b.WriteByte('\n')
+			case 'r', 't', 'b', 'f':
+				b.WriteByte(' ')
+			case '\r', '\n':
+				// line continuation
+			default:
+				if e >= '0' && e <= '7' {
+					v, n := 0, 0
+					for n < 3 && i < len(content) && content[i] >= '0' && content[i] <= '7' {
+						v = v*8 + int(content[i]-'0')
+						i++
+						n++
+					}
+					i--
+					b.WriteRune(rune(v))
+				} else {
+					b.WriteByte(e)
+				}
+			}
+		case '(':
+			if depth > 0 {
+				b.WriteByte(c)
+			}
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return b.String(), i
+			}
+			b.WriteByte(c)
+		default:
+			b.WriteRune(rune(c))
+		}
+	}
+	return b.String(), len(content)
+}
+
+func decodePDFHex(h []byte) string {
+	clean := bytes.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, h)
+	if len(clean)%2 == 1 {
+		clean = append(clean, '0')
+	}
+	raw := make([]byte, hex.DecodedLen(len(clean)))
+	if _, err := hex.Decode(raw, clean); err != nil {
+		return ""
+	}
+	var b strings.Builder
+	for _, c := range raw {
+		if c >= 0x20 || c == '\n' {
+			b.WriteRune(rune(c))
+		}
+	}
+	return b.String()
+}
+
+// ChunkDocumentText splits text into chunks of about documentChunkSize characters,
+// breaking on paragraph boundaries and, for long paragraphs, on words
+func ChunkDocumentText(text string) []string {
+	var chunks []string
+	var current strings.Builder
+
+	flush := func() {
+		if s := strings.TrimSpace(current.String()); s != "" {
+			chunks = append(chunks, s)
+		}
+		current.Reset()
+	}
+
+	for _, para := range strings.Split(text, "\n\n") {
+		para = strings.TrimSpace(para)
+		if para == "" {
+			continue
+		}
+		if current.Len() > 0 && current.Len()+len(para)+2 > documentChunkSize {
+			flush()
+		}
+		if len(para) <= documentChunkSize {
+			if current.Len() > 0 {
+				current.WriteString("\n\n")
+			}
+			current.WriteString(para)
+			continue
+		}
+
+		for _, word := range strings.Fields(para) {
+			if current.Len() > 0 && current.Len()+len(word)+1 > documentChunkSize {
+				flush()
+			}
+			if current.Len() > 0 {
+				current.WriteByte(' ')
+			}
+			current.WriteString(word)
+		}
+		flush()
+	}
+	flush()
+	return chunks
+}
+
+// SaveChatDocument stores a document and its chunks, embedding them when an embedding
+// model is configured. Chunks without embeddings are retrieved by keyword instead.
+func SaveChatDocument(ctx context.Context, db *sql.DB, chatID int64, filename, contentType string, size int64, text string) (*ChatDocument, error) {
+	chunks := ChunkDocumentText(text)
+
+	var vectors [][]float32
+	if provider, err := GetEmbeddingProvider(db); err == nil {
+		embedCtx, cancel := context.WithTimeout(ctx, EmbeddingTimeout)
+		for start := 0; start < len(chunks); start += embeddingBatchSize {
+			end := min(start+embeddingBatchSize, len(chunks))
+			batch, err := provider.Embed(embedCtx, chunks[start:end])
+			if err != nil {
+				log.Printf("Warning: Failed to embed document chunks, using keyword retrieval: %v", err)
+				vectors = nil
+				break
+			}
+			vectors = append(vectors, batch...)
+		}
+		cancel()
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`INSERT INTO chat_documents (chat_id, filename, content_type, size_bytes, chunk_count)
+		VALUES (?, ?, ?, ?, ?)`, chatID, filename, contentType, size, len(chunks))
+	if err != nil {
+		return nil, err
+	}
+	docID, _ := result.LastInsertId()
+
+	for i, chunk := range chunks {
+		var embedding interface{}
+		if len(vectors) == len(chunks) {
+			embedding = encodeEmbedding(vectors[i])
+		}
+		if _, err := tx.Exec(`INSERT INTO chat_document_chunks (document_id, chat_id, chunk_index, content, embedding)
+			VALUES (?, ?, ?, ?, ?)`, docID, chatID, i, chunk, embedding); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	doc := &ChatDocument{
+		ID:          docID,
+		ChatID:      chatID,
+		Filename:    filename,
+		ContentType: contentType,
+		SizeBytes:   size,
+		ChunkCount:  len(chunks),
+		Embedded:    len(vectors) == len(chunks),
+	}
+	db.QueryRow("SELECT created_at FROM chat_documents WHERE id = ?", docID).Scan(&doc.CreatedAt)
+	return doc, nil
+}
+
+// GetChatDocuments lists the documents attached to a chat
+func GetChatDocuments(db *sql.DB, chatID int64) ([]ChatDocument, error) {
+	rows, err := db.Query(`
+		SELECT d.id, d.chat_id, d.filename, d.content_type, d.size_bytes, d.chunk_count, d.created_at,
+			EXISTS(SELECT 1 FROM chat_document_chunks c WHERE c.document_id = d.id AND c.embedding IS NOT NULL)
+		FROM chat_documents d
+		WHERE d.chat_id = ?
+		ORDER BY d.created_at ASC, d.id ASC
+	`, chatID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	docs := []ChatDocument{}
+	for rows.Next() {
+		var d ChatDocument
+		if err := rows.Scan(&d.ID, &d.ChatID, &d.Filename, &d.ContentType, &d.SizeBytes, &d.ChunkCount, &d.CreatedAt, &d.Embedded); err != nil {
+			return nil, err
+		}
+		docs = append(docs, d)
+	}
+	return docs, rows.Err()
+}
+
+type documentChunk struct {
+	filename  string
+	content   string
+	embedding sql.NullString
+	score     float64
+}
+
+// keywordScores scores each chunk by the query's words of three or more letters,
+// weighting rare words higher so common ones such as "the" carry no weight
+func keywordScores(chunks []documentChunk, terms []string) {
+	lowered := make([]string, len(chunks))
+	for i, c := range chunks {
+		lowered[i] = strings.ToLower(c.content)
+	}
+
+	for _, term := range terms {
+		df := 0
+		for _, content := range lowered {
+			if strings.Contains(content, term) {
+				df++
+			}
+		}
+		if df == 0 {
+			continue
+		}
+		idf := math.Log(float64(len(chunks)) / float64(df))
+		for i, content := range lowered {
+			chunks[i].score += float64(strings.Count(content, term)) * idf
+		}
+	}
+}
+
+func queryTerms(query string) []string {
+	var terms []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len(word) >= 3 {
+			terms = append(terms, word)
+		}
+	}
+	return terms
+}
+
+// RelevantDocumentChunks returns up to documentContextChunks chunks of the chat's
+// documents for query, ranked by embedding similarity when every chunk has a vector and
+// by keyword matches otherwise. Small documents are included whole.
+func RelevantDocumentChunks(db *sql.DB, chatID int64, query string) []documentChunk {
+	rows, err := db.Query(`
+		SELECT d.filename, c.content, c.embedding
+		FROM chat_document_chunks c
+		JOIN chat_documents d ON d.id = c.document_id
+		WHERE c.chat_id = ?
+		ORDER BY d.id ASC, c.chunk_index ASC
+	`, chatID)
+	if err != nil {
+		log.Printf("Error loading document chunks: %v", err)
+		return nil
+	}
+	defer rows.Close()
+
+	var chunks []documentChunk
+	allEmbedded := true
+	for rows.Next() {
+		var c documentChunk
+		if err := rows.Scan(&c.filename, &c.content, &c.embedding); err != nil {
+			log.Printf("Error scanning document chunk: %v", err)
+			continue
+		}
+		allEmbedded = allEmbedded && c.embedding.Valid
+		chunks = append(chunks, c)
+	}
+	if len(chunks) <= documentContextChunks {
+		return chunks
+	}
+
+	ranked := false
+	if allEmbedded {
+		if provider, err := GetEmbeddingProvider(db); err == nil {
+			ctx, cancel := context.WithTimeout(context.Background(), EmbeddingTimeout)
+			vectors, err := provider.Embed(ctx, []string{query})
+			cancel()
+			if err == nil && len(vectors) == 1 {
+				for i := range chunks {
+					if v, err := decodeEmbedding(chunks[i].embedding.String); err == nil {
+						chunks[i].score = cosineSimilarity(vectors[0], v)
+					}
+				}
+				ranked = true
+			} else {
+				log.Printf("Warning: Failed to embed query for documents, using keywords: %v", err)
+			}
+		}
+	}
+
+	if !ranked {
+		keywordScores(chunks, queryTerms(query))
+		var matched []documentChunk
+		for _, c := range chunks {
+			if c.score > 0 {
+				matched = append(matched, c)
+			}
+		}
+		chunks = matched
+	}
+
+	sort.SliceStable(chunks, func(i, j int) bool { return chunks[i].score > chunks[j].score })
+	if len(chunks) > documentContextChunks {
+		chunks = chunks[:documentContextChunks]
+	}
+	return chunks
+}
+
+// FormatDocumentContext renders retrieved chunks as a context message
+func FormatDocumentContext(chunks []documentChunk) string {
+	if len(chunks) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("Relevant excerpts from documents attached to this chat:\n")
+	for _, c := range chunks {
+		fmt.Fprintf(&b, "\n--- %s ---\n%s\n", c.filename, c.content)
+	}
+	b.WriteString("\nUse these excerpts when they help answer the user.")
+	return b.String()
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// flateStream returns a PDF stream object whose content is compressed with zlib
+func flateStream(t *testing.T, content []byte) []byte {
+	t.Helper()
+	var compressed bytes.Buffer
+	w := zlib.NewWriter(&compressed)
+	if _, err := w.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	return []byte(fmt.Sprintf("1 0 obj\n<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream\nendobj\n", compressed.Len(), compressed.Bytes()))
+}
+
+func TestExtractPDFTextInflatesFlateStreams(t *testing.T) {
+	pdf := append([]byte("%PDF-1.4\n"), flateStream(t, []byte("BT (Hello PDF) Tj ET"))...)
+	if text := extractPDFText(pdf); !strings.Contains(text, "Hello PDF") {
+		t.Fatalf("expected the stream text, got %q", text)
+	}
+}
+
+func TestExtractPDFTextCapsInflatedBytes(t *testing.T) {
+	bomb := append([]byte("BT (first) Tj ET "), bytes.Repeat([]byte(" "), maxPDFInflatedBytes)...)
+	pdf := append([]byte("%PDF-1.4\n"), flateStream(t, bomb)...)
+	pdf = append(pdf, flateStream(t, []byte("BT (second) Tj ET"))...)
+
+	text := extractPDFText(pdf)
+	if !strings.Contains(text, "first") {
+		t.Fatalf("expected text from before the cap, got %q", text)
+	}
+	if strings.Contains(text, "second") {
+		t.Fatal("expected streams after the cap to be skipped")
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultMemoryTopK = 10
+	EmbeddingTimeout  = 30 * time.Second
+)
+
+var errEmbeddingsDisabled = errors.New("embeddings are not configured")
+
+// GetEmbeddingProvider returns a provider for the active provider configured with the
+// embedding_model setting. Embeddings are disabled while that setting is empty.
+func GetEmbeddingProvider(db *sql.DB) (Provider, error) {
+	model := GetSetting(db, "embedding_model", "")
+	if model == "" {
+		return nil, errEmbeddingsDisabled
+	}
+	return embeddingProviderForModel(db, model)
+}
+
+// embeddingProviderForModel returns the active provider configured with model. The
+// provider does not need any chat models for this.
+func embeddingProviderForModel(db *sql.DB, model string) (Provider, error) {
+	_, config, err := GetActiveProvider(db)
+	if err != nil && !errors.Is(err, ErrNoModelConfigured) {
+		return nil, err
+	}
+
+	embedConfig := *config
+	embedConfig.Model = model
+	return NewProviderFromConfig(&embedConfig)
+}
+
+// getMemoryTopK returns how many memories are injected when semantic retrieval is available
+func getMemoryTopK(db *sql.DB) int {
+	topK, err := strconv.Atoi(GetSetting(db, "memory_top_k", ""))
+	if err != nil || topK <= 0 {
+		return DefaultMemoryTopK
+	}
+	return topK
+}
+
+func memoryEmbeddingText(key, value string) string {
+	return key + ": " + value
+}
+
+// memoryEmbeddingKey identifies a memory waiting for its vector
+type memoryEmbeddingKey struct {
+	sessionID string
+	key       string
+}
+
+// memoryEmbeddings holds the memories whose vectors need recomputing. A single worker
+// drains it in batches of embeddingBatchSize, so saves never wait on the provider.
+var memoryEmbeddings struct {
+	mu      sync.Mutex
+	pending map[memoryEmbeddingKey]bool
+	running bool
+}
+
+// QueueMemoryEmbedding schedules a memory's vector to be recomputed in the background
+// from its current value
+func QueueMemoryEmbedding(db *sql.DB, sessionID, key string) {
+	memoryEmbeddings.mu.Lock()
+	defer memoryEmbeddings.mu.Unlock()
+
+	if memoryEmbeddings.pending == nil {
+		memoryEmbeddings.pending = make(map[memoryEmbeddingKey]bool)
+	}
+	memoryEmbeddings.pending[memoryEmbeddingKey{sessionID, key}] = true
+	if !memoryEmbeddings.running {
+		memoryEmbeddings.running = true
+		go drainMemoryEmbeddings(db)
+	}
+}
+
+func drainMemoryEmbeddings(db *sql.DB) {
+	for {
+		memoryEmbeddings.mu.Lock()
+		if len(memoryEmbeddings.pending) == 0 {
+			memoryEmbeddings.running = false
+			memoryEmbeddings.mu.Unlock()
+			return
+		}
+		batch := make([]memoryEmbeddingKey, 0, embeddingBatchSize)
+		for k := range memoryEmbeddings.pending {
+			if len(batch) == embeddingBatchSize {
+				break
+			}
+			batch = append(batch, k)
+			delete(memoryEmbeddings.pending, k)
+		}
+		memoryEmbeddings.mu.Unlock()
+
+		embedMemories(db, batch)
+	}
+}
+
+// embedMemories stores vectors for a batch of memories using one provider call. A memory
+// whose value changes meanwhile keeps no vector from the old value; its own queued
+// update replaces it.
+func embedMemories(db *sql.DB, keys []memoryEmbeddingKey) {
+	provider, err := GetEmbeddingProvider(db)
+	if err != nil {
+		if err != errEmbeddingsDisabled {
+			log.Printf("Warning: Embedding provider unavailable: %v", err)
+		}
+		return
+	}
+
+	var found []memoryEmbeddingKey
+	var values, texts []string
+	for _, k := range keys {
+		var value string
+		err := db.QueryRow("SELECT value FROM user_memories WHERE session_id = ? AND key = ?", k.sessionID, k.key).Scan(&value)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			log.Printf("Error loading memory %s for embedding: %v", k.key, err)
+			continue
+		}
+		found = append(found, k)
+		values = append(values, value)
+		texts = append(texts, memoryEmbeddingText(k.key, value))
+	}
+	if len(texts) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), EmbeddingTimeout)
+	defer cancel()
+
+	vectors, err := provider.Embed(ctx, texts)
+	if err != nil || len(vectors) != len(texts) {
+		log.Printf("Warning: Failed to embed %d memories: %v", len(texts), err)
+		return
+	}
+
+	for i, k := range found {
+		_, err := db.Exec("UPDATE user_memories SET embedding = ? WHERE session_id = ? AND key = ? AND value = ?",
+			encodeEmbedding(vectors[i]), k.sessionID, k.key, values[i])
+		if err != nil {
+			log.Printf("Error storing memory embedding: %v", err)
+		}
+	}
+}
+
+// GetRelevantMemories returns the eligible memories most similar to query, limited to the
+// memory_top_k setting. When embeddings are unavailable every eligible memory is returned.
+func GetRelevantMemories(db *sql.DB, sessionID, query string) ([]Memory, error) {
+	memories, err := GetMemories(db, sessionID)
+	if err != nil || len(memories) == 0 {
+		return memories, err
+	}
+
+	// Rank only memories that are eligible for injection
+	filter := GetMemoryInjectionFilter(db)
+	filter.Limit = 0
+	memories = FilterMemories(memories, filter)
+
+	provider, err := GetEmbeddingProvider(db)
+	if err != nil {
+		if err != errEmbeddingsDisabled {
+			log.Printf("Warning: Embedding provider unavailable, injecting all memories: %v", err)
+		}
+		return memories, nil
+	}
+
+	topK := getMemoryTopK(db)
+	if len(memories) <= topK {
+		return memories, nil
+	}
+
+	vectors, err := loadMemoryEmbeddings(db, sessionID)
+	if err != nil {
+		log.Printf("Warning: Failed to load memory embeddings, injecting all memories: %v", err)
+		return memories, nil
+	}
+
+	// Embed the query together with any memories that have no vector yet
+	texts := []string{query}
+	var missing []int
+	for i, m := range memories {
+		if _, ok := vectors[m.ID]; !ok {
+			texts = append(texts, memoryEmbeddingText(m.Key, m.Value))
+			missing = append(missing, i)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), EmbeddingTimeout)
+	defer cancel()
+
+	embedded, err := provider.Embed(ctx, texts)
+	if err != nil || len(embedded) != len(texts) {
+		log.Printf("Warning: Failed to embed query, injecting all memories: %v", err)
+		return memories, nil
+	}
+
+	queryVector := embedded[0]
+	for j, i := range missing {
+		m := memories[i]
+		vectors[m.ID] = embedded[j+1]
+		if _, err := db.Exec("UPDATE user_memories SET embedding = ? WHERE id = ?", encodeEmbedding(embedded[j+1]), m.ID); err != nil {
+			log.Printf("Error backfilling memory embedding: %v", err)
+		}
+	}
+
+	scores := make(map[int64]float64, len(memories))
+	for _, m := range memories {
+		scores[m.ID] = cosineSimilarity(queryVector, vectors[m.ID])
+	}
+
+	sort.SliceStable(memories, func(i, j int) bool {
+		return scores[memories[i].ID] > scores[memories[j].ID]
+	})
+
+	return memories[:topK], nil
+}
+
+func loadMemoryEmbeddings(db *sql.DB, sessionID string) (map[int64][]float32, error) {
+	rows, err := db.Query(`
+		SELECT id, embedding
+		FROM user_memories
+		WHERE session_id = ? AND embedding IS NOT NULL AND embedding != ''
+	`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	vectors := make(map[int64][]float32)
+	for rows.Next() {
+		var id int64
+		var encoded string
+		if err := rows.Scan(&id, &encoded); err != nil {
+			continue
+		}
+		vector, err := decodeEmbedding(encoded)
+		if err != nil {
+			continue
+		}
+		vectors[id] = vector
+	}
+	return vectors, rows.Err()
+}
+
+func encodeEmbedding(vector []float32) string {
+	data, _ := json.Marshal(vector)
+	return string(data)
+}
+
+func decodeEmbedding(encoded string) ([]float32, error) {
+	var vector []float32
+	if err := json.Unmarshal([]byte(encoded), &vector); err != nil {
+		return nil, fmt.Errorf("invalid embedding: %w", err)
+	}
+	return vector, nil
+}
+
+// cosineSimilarity returns the cosine of the angle between a and b, or 0 when the
+// vectors are empty or of different dimensions
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
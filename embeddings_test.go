@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newEmbeddingServer serves OpenAI-format embeddings and counts the requests it receives
+func newEmbeddingServer(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		var req struct {
+			Input []string `json:"input"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data := make([]map[string]interface{}, len(req.Input))
+		for i := range req.Input {
+			data[i] = map[string]interface{}{"object": "embedding", "index": i, "embedding": []float32{1, float32(i)}}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"object": "list", "data": data, "model": "test-embed"})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func countEmbedded(t *testing.T, sessionID string) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM user_memories WHERE session_id = ? AND embedding IS NOT NULL", sessionID).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestEmbedMemoriesUsesOneRequestPerBatch(t *testing.T) {
+	testDB := newTestDB(t)
+	srv, requests := newEmbeddingServer(t)
+	newTestProvider(t, testDB, srv.URL)
+	setTestSetting(t, testDB, "embedding_model", "test-embed")
+
+	var keys []memoryEmbeddingKey
+	for _, key := range []string{"name", "city", "language"} {
+		if err := upsertMemory(testDB, "s1", key, "value of "+key, "general", 80, nil); err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, memoryEmbeddingKey{"s1", key})
+	}
+
+	embedMemories(testDB, keys)
+	if got := requests.Load(); got != 1 {
+		t.Errorf("provider requests = %d, want 1", got)
+	}
+	if got := countEmbedded(t, "s1"); got != 3 {
+		t.Errorf("embedded memories = %d, want 3", got)
+	}
+}
+
+func TestSetMemoryEmbedsInBackground(t *testing.T) {
+	testDB := newTestDB(t)
+	srv, _ := newEmbeddingServer(t)
+	newTestProvider(t, testDB, srv.URL)
+	setTestSetting(t, testDB, "embedding_model", "test-embed")
+
+	if err := SetMemory(testDB, "s1", "name", "Ada", "general", 80, nil); err != nil {
+		t.Fatal(err)
+	}
+	waitForMemoryEmbeddings(t)
+	if got := countEmbedded(t, "s1"); got != 1 {
+		t.Fatalf("embedded memories = %d, want 1", got)
+	}
+
+	// A new value must not keep the vector computed from the old one
+	setTestSetting(t, testDB, "embedding_model", "")
+	if err := SetMemory(testDB, "s1", "name", "Grace", "general", 80, nil); err != nil {
+		t.Fatal(err)
+	}
+	waitForMemoryEmbeddings(t)
+	if got := countEmbedded(t, "s1"); got != 0 {
+		t.Errorf("embedded memories after the value changed = %d, want 0", got)
+	}
+}
+
+func waitForMemoryEmbeddings(t *testing.T) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		memoryEmbeddings.mu.Lock()
+		running := memoryEmbeddings.running
+		memoryEmbeddings.mu.Unlock()
+		if !running {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("memory embeddings did not finish")
+}
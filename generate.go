@@ -0,0 +1,607 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/ollama/ollama/api"
+)
+
+const (
+	analyticsMarker = "\n\n__ANALYTICS__"
+
+	continuePrompt = "Continue your previous response exactly where it stopped. Do not repeat any of it or add a preamble."
+)
+
+// maxGenerationIDLength caps client-supplied generation request ids
+const maxGenerationIDLength = 128
+
+// generationIDPattern restricts request ids to URL-safe characters
+var generationIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// inflightGeneration is a running generation that can be cancelled by its request id
+type inflightGeneration struct {
+	sessionID string
+	cancel    context.CancelFunc
+}
+
+var (
+	inflightGenerations   = make(map[string]*inflightGeneration)
+	inflightGenerationsMu sync.Mutex
+)
+
+var (
+	errInvalidGenerationID   = errors.New("request_id may only contain letters, digits, '-' and '_' (max 128 characters)")
+	errDuplicateGenerationID = errors.New("a generation with this request_id is already running")
+)
+
+// registerGeneration derives a cancellable context for a generation. With an empty
+// requestID the context is returned unchanged. The returned func must be called when
+// the generation ends to release the id.
+func registerGeneration(ctx context.Context, requestID, sessionID string) (context.Context, func(), error) {
+	if requestID == "" {
+		return ctx, func() {}, nil
+	}
+	if len(requestID) > maxGenerationIDLength || !generationIDPattern.MatchString(requestID) {
+		return nil, nil, errInvalidGenerationID
+	}
+
+	inflightGenerationsMu.Lock()
+	defer inflightGenerationsMu.Unlock()
+
+	if _, exists := inflightGenerations[requestID]; exists {
+		return nil, nil, errDuplicateGenerationID
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	gen := &inflightGeneration{sessionID: sessionID, cancel: cancel}
+	inflightGenerations[requestID] = gen
+
+	return ctx, func() {
+		inflightGenerationsMu.Lock()
+		// The id may already have been cancelled and reused by a newer generation
+		if inflightGenerations[requestID] == gen {
+			delete(inflightGenerations, requestID)
+		}
+		inflightGenerationsMu.Unlock()
+		cancel()
+	}, nil
+}
+
+// writeGenerationIDError reports a registerGeneration failure
+func writeGenerationIDError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errDuplicateGenerationID) {
+		WriteError(w, http.StatusConflict, err.Error())
+		return
+	}
+	WriteError(w, http.StatusBadRequest, err.Error())
+}
+
+// cancelGeneration stops the in-flight generation registered under {request_id}.
+// Only the session that started it may cancel it.
+func cancelGeneration(w http.ResponseWriter, r *http.Request) {
+	requestID := chi.URLParam(r, "request_id")
+
+	inflightGenerationsMu.Lock()
+	gen, ok := inflightGenerations[requestID]
+	if ok && gen.sessionID == getSessionIDFromRequest(r) {
+		delete(inflightGenerations, requestID)
+	} else {
+		ok = false
+	}
+	inflightGenerationsMu.Unlock()
+
+	if !ok {
+		WriteError(w, http.StatusNotFound, "No running generation with this request ID")
+		return
+	}
+
+	gen.cancel()
+	log.Printf("Generation %s cancelled", requestID)
+	WriteJSON(w, map[string]interface{}{
+		"success":    true,
+		"request_id": requestID,
+	})
+}
+
+// buildChatHistory assembles the context sent to the model for a chat: the rolling
+// summary, recent unsummarized messages and, when enabled, the user's memories
+func buildChatHistory(chatID int64, sessionID, input string) []api.Message {
+	// 1. Get Chat Summary
+	var chatSummary sql.NullString
+	if chatID > 0 {
+		err := db.QueryRow("SELECT summary FROM chats WHERE id = ?", chatID).Scan(&chatSummary)
+		if err != nil {
+			log.Println("Error fetching chat summary:", err)
+		}
+	}
+
+	// 2. Fetch Unsummarized Messages
+	// The summarizer normally keeps this list short; max_context_messages caps it
+	// for chats that have not reached the summary threshold yet.
+	var history []api.Message
+
+	if chatID > 0 {
+		// Fetch the most recent unsummarized messages
+		messages, err := GetContextMessages(db, chatID)
+		if err != nil {
+			log.Println("Error fetching history:", err)
+		}
+		history = append(history, messages...)
+
+		// Inject Summary as the first "system" or "context" message if it exists
+		if chatSummary.String != "" {
+			summaryMsg := api.Message{
+				Role:    "system", // Or 'user' with a preamble if system prompt is strict. 'system' is usually best.
+				Content: fmt.Sprintf("Here is a summary of the earlier conversation:\n%s", chatSummary.String),
+			}
+			// Prepend summary
+			history = append([]api.Message{summaryMsg}, history...)
+		}
+
+		// Add excerpts of attached documents relevant to this message
+		if docContext := FormatDocumentContext(RelevantDocumentChunks(db, chatID, input)); docContext != "" {
+			history = append([]api.Message{{Role: "system", Content: docContext}}, history...)
+		}
+	}
+
+	// 3. Inject User Memories (only if enabled globally and for this chat)
+	if ChatUsesMemory(db, chatID) {
+		memories, err := GetRelevantMemories(db, sessionID, input)
+		if err != nil {
+			log.Println("Error fetching memories:", err)
+		} else if memoryPrompt := FormatMemoriesForPrompt(memories, GetMemoryInjectionFilter(db)); memoryPrompt != "" {
+			memoryMsg := api.Message{
+				Role:    "system",
+				Content: fmt.Sprintf("You have access to the following information about this user:\n%s\nUse this information to personalize your responses.", memoryPrompt),
+			}
+			history = append([]api.Message{memoryMsg}, history...)
+		}
+
+		// 4. Check if user is asking about reminders/memories
+		if strings.Contains(strings.ToLower(input), "reminder") ||
+			strings.Contains(strings.ToLower(input), "show me") ||
+			strings.Contains(strings.ToLower(input), "what do you know") ||
+			strings.Contains(strings.ToLower(input), "my meetings") {
+			searchResults, err := SearchMemories(db, sessionID, "reminder")
+			if err == nil && len(searchResults) > 0 {
+				var reminderList strings.Builder
+				reminderList.WriteString("\n=== USER'S REMINDERS ===\n")
+				for _, mem := range searchResults {
+					reminderList.WriteString(fmt.Sprintf("- %s\n", mem.Value))
+				}
+				reminderList.WriteString("=== END REMINDERS ===\n")
+
+				reminderContextMsg := api.Message{
+					Role:    "system",
+					Content: reminderList.String(),
+				}
+				history = append([]api.Message{reminderContextMsg}, history...)
+			}
+		}
+	}
+
+	return history
+}
+
+// streamGeneration writes the model's response for prompt to w, running the agentic
+// loop when MCP tools or skills are available
+func streamGeneration(ctx context.Context, w http.ResponseWriter, provider Provider, history []api.Message, prompt, systemPrompt string) error {
+	tools, err := GetAllEnabledMCPTools(ctx)
+	if err != nil {
+		log.Printf("Warning: Failed to get MCP tools: %v", err)
+		tools = nil
+	}
+
+	skills, err := GetCachedSkills(ctx)
+	if err != nil {
+		log.Printf("Warning: Failed to get Open Skills: %v", err)
+		skills = nil
+	}
+
+	if len(tools) > 0 || len(skills) > 0 {
+		log.Printf("Web: Running agentic loop with %d tools and %d skills", len(tools), len(skills))
+		start := time.Now()
+		response, err := RunAgenticLoopWithSkills(ctx, provider, tools, skills, history, prompt, systemPrompt, nil)
+		if err != nil {
+			log.Println("Generation error:", err)
+			status := http.StatusInternalServerError
+			if errors.Is(err, ErrProviderBusy) {
+				status = generationErrorStatus(w, err)
+			}
+			http.Error(w, "Generation error: "+err.Error(), status)
+			return err
+		}
+		// The loop reports no token usage, so only the wall-clock latency is known
+		analyticsJSON, _ := json.Marshal(map[string]interface{}{"latency_ms": time.Since(start).Milliseconds()})
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(response + analyticsMarker + string(analyticsJSON)))
+		return nil
+	}
+
+	if err := provider.Generate(ctx, history, prompt, systemPrompt, w); err != nil {
+		log.Println("Generation error:", err)
+		return err
+	}
+	return nil
+}
+
+// captureWriter passes a streamed response through while keeping a copy of it
+type captureWriter struct {
+	http.ResponseWriter
+	buf strings.Builder
+}
+
+func (c *captureWriter) Write(p []byte) (int, error) {
+	c.buf.Write(p)
+	return c.ResponseWriter.Write(p)
+}
+
+func (c *captureWriter) Flush() {
+	if f, ok := c.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// bufferWriter collects a generated response instead of sending it, for clients that
+// asked for a single JSON reply
+type bufferWriter struct {
+	header http.Header
+	status int
+	buf    strings.Builder
+}
+
+func (b *bufferWriter) Header() http.Header {
+	if b.header == nil {
+		b.header = http.Header{}
+	}
+	return b.header
+}
+
+func (b *bufferWriter) WriteHeader(status int) { b.status = status }
+
+func (b *bufferWriter) Write(p []byte) (int, error) { return b.buf.Write(p) }
+
+func (b *bufferWriter) Flush() {}
+
+// generateComplete runs streamGeneration to completion and returns the response
+// without its analytics block, together with the reported stats
+func generateComplete(ctx context.Context, provider Provider, history []api.Message, prompt, systemPrompt string) (string, generationStats, error) {
+	out := &bufferWriter{}
+	if err := streamGeneration(ctx, out, provider, history, prompt, systemPrompt); err != nil {
+		return "", generationStats{}, err
+	}
+	if out.status >= http.StatusBadRequest {
+		return "", generationStats{}, errors.New(strings.TrimSpace(out.buf.String()))
+	}
+	content, stats := splitAnalytics(out.buf.String())
+	return content, stats, nil
+}
+
+// generationStats holds the figures a provider reports in its analytics block
+type generationStats struct {
+	Model        string  `json:"model"`
+	LatencyMs    int64   `json:"latency_ms"`
+	TokensPerSec float64 `json:"tokens_per_sec"`
+	Usage        struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+		TotalTokens      int `json:"total_tokens"`
+	} `json:"usage"`
+}
+
+// splitAnalytics separates a generated response from its trailing analytics block,
+// returning the content and the reported stats
+func splitAnalytics(response string) (string, generationStats) {
+	var stats generationStats
+	idx := strings.Index(response, analyticsMarker)
+	if idx == -1 {
+		return response, stats
+	}
+
+	json.Unmarshal([]byte(response[idx+len(analyticsMarker):]), &stats)
+	return response[:idx], stats
+}
+
+// regenerateChat streams a new answer to the last user message of a chat and saves it
+// as a new version of that exchange, so earlier attempts stay linked and browsable
+func regenerateChat(w http.ResponseWriter, r *http.Request) {
+	chatID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid chat ID")
+		return
+	}
+	if !enforceTokenBudget(w, chatID) {
+		return
+	}
+
+	ctx, done, err := registerGeneration(r.Context(), r.URL.Query().Get("request_id"), getSessionIDFromRequest(r))
+	if err != nil {
+		writeGenerationIDError(w, err)
+		return
+	}
+	defer done()
+
+	var systemPrompt string
+	err = db.QueryRow("SELECT COALESCE(system_prompt, '') FROM chats WHERE id = ?", chatID).Scan(&systemPrompt)
+	if err == sql.ErrNoRows {
+		WriteError(w, http.StatusNotFound, "Chat not found")
+		return
+	}
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	systemPrompt = withGlobalSystemPrompt(db, capSystemPrompt(db, systemPrompt))
+
+	var lastID int64
+	var lastRole string
+	err = db.QueryRow("SELECT id, role FROM messages WHERE chat_id = ? AND COALESCE(is_active_version, 1) = 1 ORDER BY id DESC LIMIT 1", chatID).Scan(&lastID, &lastRole)
+	if err == sql.ErrNoRows || (err == nil && lastRole != "assistant") {
+		WriteError(w, http.StatusBadRequest, "The last message is not an assistant response")
+		return
+	}
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var userID int64
+	var userContent, versionGroup string
+	err = db.QueryRow(`
+		SELECT id, content, COALESCE(version_group, '')
+		FROM messages
+		WHERE chat_id = ? AND id < ? AND role = 'user' AND COALESCE(is_active_version, 1) = 1
+		ORDER BY id DESC LIMIT 1
+	`, chatID, lastID).Scan(&userID, &userContent, &versionGroup)
+	if err == sql.ErrNoRows {
+		WriteError(w, http.StatusBadRequest, "No user message to regenerate a response for")
+		return
+	}
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	provider, _, err := GetActiveProvider(db)
+	if err != nil {
+		writeActiveProviderError(w, err)
+		return
+	}
+
+	// The old response stays stored and active until the new one is saved, so leave the
+	// user message and everything after it out of the history; it is passed as the prompt
+	history := buildChatHistory(chatID, getSessionIDFromRequest(r), userContent)
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Role == "user" && history[i].Content == userContent {
+			history = history[:i]
+			break
+		}
+	}
+
+	ctx, transcript := withToolTranscript(ctx)
+	capture := &captureWriter{ResponseWriter: w}
+	if err := streamGeneration(ctx, capture, provider, history, userContent, systemPrompt); err != nil {
+		return
+	}
+
+	content, stats := splitAnalytics(capture.buf.String())
+	recordTokenUsage(db, chatID, usageSourceChat, stats.Usage.TotalTokens)
+	if strings.TrimSpace(content) == "" {
+		return
+	}
+
+	wasSummarized, err := saveRegeneratedVersion(db, chatID, userID, lastID, versionGroup, transcript, content, stats)
+	if err != nil {
+		log.Printf("Error saving regenerated message: %v", err)
+		return
+	}
+	InvalidateSummaryForMessage(r.Context(), db, chatID, wasSummarized)
+
+	if _, err := db.Exec("UPDATE chats SET updated_at = CURRENT_TIMESTAMP WHERE id = ?", chatID); err != nil {
+		log.Println("Error updating chat timestamp:", err)
+	}
+}
+
+// saveRegeneratedVersion stores a regenerated response as a new version of the user
+// message userID: a copy of that message, the tool calls and the response. The old
+// response lastID and its tool calls join the version group and, once the new version
+// is saved, are deactivated with the rest of it, so they can still be browsed and
+// restored. It reports whether the old version was already in the chat summary.
+func saveRegeneratedVersion(db *sql.DB, chatID, userID, lastID int64, versionGroup string, transcript *ToolTranscript, content string, stats generationStats) (bool, error) {
+	if versionGroup == "" {
+		versionGroup = fmt.Sprintf("vg-%d", userID)
+	}
+	if _, err := db.Exec(`
+		UPDATE messages SET version_group = ?
+		WHERE id IN (?, ?) OR (chat_id = ? AND role = 'tool' AND id > ? AND id < ?)
+	`, versionGroup, userID, lastID, chatID, userID, lastID); err != nil {
+		return false, fmt.Errorf("linking the old response: %w", err)
+	}
+
+	res, err := db.Exec(`
+		INSERT INTO messages (chat_id, role, content, version_group)
+		SELECT chat_id, role, content, version_group FROM messages WHERE id = ?
+	`, userID)
+	if err != nil {
+		return false, fmt.Errorf("copying the user message: %w", err)
+	}
+	newUserID, _ := res.LastInsertId()
+
+	// Drops the partly saved new version, leaving the old one as it was
+	discard := func(err error) (bool, error) {
+		if _, delErr := db.Exec("DELETE FROM messages WHERE chat_id = ? AND version_group = ? AND id >= ?", chatID, versionGroup, newUserID); delErr != nil {
+			log.Printf("Error discarding regenerated version: %v", delErr)
+		}
+		return false, err
+	}
+
+	if err := saveToolTranscript(db, chatID, versionGroup, transcript); err != nil {
+		return discard(fmt.Errorf("saving tool calls: %w", err))
+	}
+	if _, err := db.Exec(`
+		INSERT INTO messages (chat_id, role, content, model_name, tokens_used, version_group, latency_ms, tokens_per_sec)
+		VALUES (?, 'assistant', ?, ?, ?, ?, ?, ?)
+	`, chatID, content, stats.Model, stats.Usage.TotalTokens, versionGroup, stats.LatencyMs, stats.TokensPerSec); err != nil {
+		return discard(err)
+	}
+
+	var wasSummarized bool
+	if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM messages WHERE chat_id = ? AND version_group = ? AND id < ? AND is_summarized = 1 AND COALESCE(is_active_version, 1) = 1)",
+		chatID, versionGroup, newUserID).Scan(&wasSummarized); err != nil {
+		return discard(err)
+	}
+	if _, err := db.Exec("UPDATE messages SET is_active_version = 0 WHERE chat_id = ? AND version_group = ? AND id < ?",
+		chatID, versionGroup, newUserID); err != nil {
+		return discard(err)
+	}
+	return wasSummarized, nil
+}
+
+// continueMessage streams a continuation of a truncated assistant message and
+// appends it to the same message
+func continueMessage(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid message ID")
+		return
+	}
+
+	ctx, done, err := registerGeneration(r.Context(), r.URL.Query().Get("request_id"), getSessionIDFromRequest(r))
+	if err != nil {
+		writeGenerationIDError(w, err)
+		return
+	}
+	defer done()
+
+	var chatID int64
+	var role, content, systemPrompt string
+	var tokensUsed int
+	err = db.QueryRow(`
+		SELECT m.chat_id, m.role, m.content, COALESCE(m.tokens_used, 0), COALESCE(c.system_prompt, '')
+		FROM messages m JOIN chats c ON c.id = m.chat_id
+		WHERE m.id = ?
+	`, id).Scan(&chatID, &role, &content, &tokensUsed, &systemPrompt)
+	if err == sql.ErrNoRows {
+		WriteError(w, http.StatusNotFound, "Message not found")
+		return
+	}
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if role != "assistant" {
+		WriteError(w, http.StatusBadRequest, "Only assistant messages can be continued")
+		return
+	}
+	if !enforceTokenBudget(w, chatID) {
+		return
+	}
+	systemPrompt = withGlobalSystemPrompt(db, capSystemPrompt(db, systemPrompt))
+
+	provider, _, err := GetActiveProvider(db)
+	if err != nil {
+		writeActiveProviderError(w, err)
+		return
+	}
+
+	// Keep the conversation up to the partial message, which becomes the last turn
+	history := buildChatHistory(chatID, getSessionIDFromRequest(r), content)
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Role == "assistant" && history[i].Content == content {
+			history = history[:i]
+			break
+		}
+	}
+	history = append(history, api.Message{Role: "assistant", Content: content})
+
+	capture := &captureWriter{ResponseWriter: w}
+	if err := streamGeneration(ctx, capture, provider, history, continuePrompt, systemPrompt); err != nil {
+		return
+	}
+
+	continuation, stats := splitAnalytics(capture.buf.String())
+	recordTokenUsage(db, chatID, usageSourceChat, stats.Usage.TotalTokens)
+	if strings.TrimSpace(continuation) == "" {
+		return
+	}
+
+	// Latency accumulates across continuations; the speed is that of the latest one
+	_, err = db.Exec(`
+		UPDATE messages SET content = ?, tokens_used = ?, latency_ms = COALESCE(latency_ms, 0) + ?,
+			tokens_per_sec = CASE WHEN ? > 0 THEN ? ELSE tokens_per_sec END
+		WHERE id = ?
+	`, content+continuation, tokensUsed+stats.Usage.TotalTokens, stats.LatencyMs, stats.TokensPerSec, stats.TokensPerSec, id)
+	if err != nil {
+		log.Printf("Error saving continued message: %v", err)
+		return
+	}
+
+	if _, err := db.Exec("UPDATE chats SET updated_at = CURRENT_TIMESTAMP WHERE id = ?", chatID); err != nil {
+		log.Println("Error updating chat timestamp:", err)
+	}
+}
+
+// estimateChatContext reports the estimated token cost of sending a draft to a chat,
+// using the same context assembly as generation
+func estimateChatContext(w http.ResponseWriter, r *http.Request) {
+	chatID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid chat ID")
+		return
+	}
+
+	var req struct {
+		Input string `json:"input"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	var systemPrompt string
+	err = db.QueryRow("SELECT COALESCE(system_prompt, '') FROM chats WHERE id = ?", chatID).Scan(&systemPrompt)
+	if err == sql.ErrNoRows {
+		WriteError(w, http.StatusNotFound, "Chat not found")
+		return
+	}
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	systemPrompt = withGlobalSystemPrompt(db, capSystemPrompt(db, systemPrompt))
+
+	history := buildChatHistory(chatID, getSessionIDFromRequest(r), req.Input)
+	historyTokens := 0
+	for _, m := range history {
+		historyTokens += EstimateTokens(m.Content)
+	}
+
+	systemTokens := EstimateTokens(systemPrompt)
+	draftTokens := EstimateTokens(req.Input)
+	total := systemTokens + historyTokens + draftTokens
+	budget := GetContextTokenBudget(db)
+
+	WriteJSON(w, map[string]interface{}{
+		"estimated_tokens": total,
+		"system_prompt":    systemTokens,
+		"history":          historyTokens,
+		"draft":            draftTokens,
+		"messages":         len(history),
+		"budget":           budget,
+		"exceeds_budget":   total > budget,
+	})
+}
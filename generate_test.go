@@ -0,0 +1,59 @@
+package main
+
+import "testing"
+
+func TestSaveRegeneratedVersionKeepsOldResponse(t *testing.T) {
+	testDB := newTestDB(t)
+	res, _ := testDB.Exec("INSERT INTO chats (title) VALUES ('chat')")
+	chatID, _ := res.LastInsertId()
+	insert := func(role, content string) int64 {
+		res, err := testDB.Exec("INSERT INTO messages (chat_id, role, content) VALUES (?, ?, ?)", chatID, role, content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, _ := res.LastInsertId()
+		return id
+	}
+	userID := insert("user", "question")
+	insert("tool", `{"name":"lookup"}`)
+	lastID := insert("assistant", "old answer")
+
+	if _, err := saveRegeneratedVersion(testDB, chatID, userID, lastID, "", nil, "new answer", generationStats{}); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := testDB.Query("SELECT role, content FROM messages WHERE chat_id = ? AND COALESCE(is_active_version, 1) = 1 ORDER BY id", chatID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var active []string
+	for rows.Next() {
+		var role, content string
+		rows.Scan(&role, &content)
+		active = append(active, role+": "+content)
+	}
+	if len(active) != 2 || active[0] != "user: question" || active[1] != "assistant: new answer" {
+		t.Fatalf("active messages = %q", active)
+	}
+
+	var oldContent string
+	var oldActive bool
+	if err := testDB.QueryRow("SELECT content, is_active_version FROM messages WHERE id = ?", lastID).Scan(&oldContent, &oldActive); err != nil {
+		t.Fatalf("old response was not kept: %v", err)
+	}
+	if oldActive {
+		t.Fatal("old response is still active")
+	}
+
+	group, _, target, err := loadMessageVersions(testDB, lastID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(group.Versions) != 2 || target != 0 || group.ActiveVersion != 1 {
+		t.Fatalf("versions = %d, old in %d, active %d; want 2, 0, 1", len(group.Versions), target, group.ActiveVersion)
+	}
+	if n := len(group.Versions[0].Messages); n != 3 {
+		t.Fatalf("old version has %d messages, want user, tool and assistant", n)
+	}
+}
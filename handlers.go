@@ -4,31 +4,58 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"strconv"
-	"text/template"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi"
 )
 
 type ProviderResponse struct {
-	ID        int64           `json:"id"`
-	Name      string          `json:"name"`
-	Type      string          `json:"type"`
-	BaseURL   string          `json:"base_url,omitempty"`
-	HasAPIKey bool            `json:"has_api_key"`
-	IsActive  bool            `json:"is_active"`
-	Models    []ModelResponse `json:"models"`
-	CreatedAt string          `json:"created_at"`
-	UpdatedAt string          `json:"updated_at"`
+	ID            int64           `json:"id"`
+	Name          string          `json:"name"`
+	Type          string          `json:"type"`
+	BaseURL       string          `json:"base_url,omitempty"`
+	HasAPIKey     bool            `json:"has_api_key"`
+	APIKeyHint    string          `json:"api_key_hint,omitempty"`
+	IsActive      bool            `json:"is_active"`
+	MaxConcurrent int             `json:"max_concurrent"`
+	Models        []ModelResponse `json:"models"`
+	CreatedAt     string          `json:"created_at"`
+	UpdatedAt     string          `json:"updated_at"`
+}
+
+const (
+	// apiKeyMask stands in for a stored key in responses; sending it back leaves the key unchanged
+	apiKeyMask = "********"
+	// apiKeyClearSentinel sent as api_key removes the stored key
+	apiKeyClearSentinel = "__clear__"
+)
+
+// apiKeyHint returns the display hint stored alongside a key, showing at most its last
+// four characters. It is computed once when the key is saved, so listing providers never
+// decrypts keys.
+func apiKeyHint(key string) string {
+	if key == "" {
+		return ""
+	}
+	if len(key) < 12 {
+		return apiKeyMask
+	}
+	return apiKeyMask + key[len(key)-4:]
 }
 
 type ModelResponse struct {
 	ID        int64  `json:"id"`
 	ModelName string `json:"model_name"`
 	IsDefault bool   `json:"is_default"`
+
+	OwnedBy      string            `json:"owned_by,omitempty"`
+	Capabilities ModelCapabilities `json:"capabilities"`
 }
 
 type ProviderRequest struct {
@@ -37,11 +64,16 @@ type ProviderRequest struct {
 	BaseURL string   `json:"base_url,omitempty"`
 	APIKey  string   `json:"api_key,omitempty"`
 	Models  []string `json:"models,omitempty"`
+	// MaxConcurrent is left unchanged on update when omitted
+	MaxConcurrent *int `json:"max_concurrent,omitempty"`
+	// ModelOwners maps names in Models to the owned_by reported when they were discovered
+	ModelOwners map[string]string `json:"model_owners,omitempty"`
 }
 
 type Metrics struct {
 	ChatsTotal     int     `json:"chats_total"`
 	MessagesTotal  int     `json:"messages_total"`
+	TokensTotal    int64   `json:"tokens_total"`
 	ProvidersTotal int     `json:"providers_total"`
 	ModelsTotal    int     `json:"models_total"`
 	UptimeSeconds  float64 `json:"uptime_seconds"`
@@ -51,127 +83,131 @@ type Metrics struct {
 var startTime = time.Now()
 
 func settingsPage(w http.ResponseWriter, r *http.Request) {
-	t, err := template.ParseFiles("static/settings.html")
+	t, err := loadTemplate("settings.html")
 	if err != nil {
 		http.Error(w, "Settings page not found", http.StatusNotFound)
 		return
 	}
-	t.Execute(w, nil)
+	t.Execute(w, map[string]interface{}{
+		"theme": ThemePreference(r),
+		"nonce": cspNonce(r),
+	})
 }
 
+// getProviders lists providers with their models, active first. ?type= and ?active=
+// filter the list and ?limit= with ?offset= page it; X-Total-Count carries the number
+// of matching providers. Providers and models come back from one joined query.
 func getProviders(w http.ResponseWriter, r *http.Request) {
-	rows, err := db.Query(`
-		SELECT p.id, p.name, p.type, COALESCE(p.base_url, ''), p.api_key IS NOT NULL AND p.api_key != '', p.is_active, p.created_at, p.updated_at
-		FROM providers p
-		ORDER BY p.is_active DESC, p.name ASC
-	`)
-	if err != nil {
-		WriteError(w, http.StatusInternalServerError, err.Error())
-		return
+	query := r.URL.Query()
+	var conditions []string
+	var args []interface{}
+	if t := query.Get("type"); t != "" {
+		conditions = append(conditions, "p.type = ?")
+		args = append(args, t)
+	}
+	if a := query.Get("active"); a != "" {
+		active, err := strconv.ParseBool(a)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, "active must be true or false")
+			return
+		}
+		conditions = append(conditions, "p.is_active = ?")
+		args = append(args, active)
 	}
-	defer rows.Close()
-
-	type providerWithModels struct {
-		ID        int64
-		Name      string
-		Type      string
-		BaseURL   string
-		HasAPIKey bool
-		IsActive  bool
-		CreatedAt time.Time
-		UpdatedAt time.Time
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
 	}
 
-	var providersWithIDs []providerWithModels
-
-	for rows.Next() {
-		var p providerWithModels
-		err := rows.Scan(&p.ID, &p.Name, &p.Type, &p.BaseURL, &p.HasAPIKey, &p.IsActive, &p.CreatedAt, &p.UpdatedAt)
-		if err != nil {
-			log.Println("Error scanning provider:", err)
-			continue
+	limit := -1
+	offset := 0
+	if l := query.Get("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed <= 0 {
+			WriteError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
 		}
-		providersWithIDs = append(providersWithIDs, p)
+		limit = parsed
 	}
-
-	if err := rows.Err(); err != nil {
-		WriteError(w, http.StatusInternalServerError, "Error iterating providers: "+err.Error())
-		return
+	if o := query.Get("offset"); o != "" {
+		parsed, err := strconv.Atoi(o)
+		if err != nil || parsed < 0 {
+			WriteError(w, http.StatusBadRequest, "offset must be 0 or more")
+			return
+		}
+		offset = parsed
 	}
 
-	if len(providersWithIDs) == 0 {
-		WriteJSON(w, []ProviderResponse{})
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM providers p "+where, args...).Scan(&total); err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
 
-	providerIDs := make([]int64, len(providersWithIDs))
-	for i, p := range providersWithIDs {
-		providerIDs[i] = p.ID
-	}
-
-	modelsByProviderID := make(map[int64][]ModelResponse)
-	modelRows, err := db.Query(`
-		SELECT id, model_name, is_default, provider_id
-		FROM models
-		WHERE provider_id IN (`+placeholders(len(providerIDs))+`)
-		ORDER BY is_default DESC, model_name ASC
-	`, intsToInterfaces(providerIDs...)...)
+	// The page is taken from providers before the join so limit counts providers, not
+	// provider-model rows
+	rows, err := db.Query(`
+		SELECT p.id, p.name, p.type, COALESCE(p.base_url, ''), COALESCE(p.api_key, '') != '',
+		       COALESCE(p.api_key_hint, ''), p.is_active, COALESCE(p.max_concurrent, 0), p.created_at, p.updated_at,
+		       m.id, COALESCE(m.model_name, ''), COALESCE(m.is_default, 0),
+		       COALESCE(m.owned_by, ''), COALESCE(m.capabilities, '')
+		FROM (
+			SELECT * FROM providers p `+where+`
+			ORDER BY p.is_active DESC, p.name ASC, p.id ASC
+			LIMIT ? OFFSET ?
+		) p
+		LEFT JOIN models m ON m.provider_id = p.id
+		ORDER BY p.is_active DESC, p.name ASC, p.id ASC, m.is_default DESC, m.model_name ASC
+	`, append(args, limit, offset)...)
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	defer modelRows.Close()
+	defer rows.Close()
 
-	for modelRows.Next() {
+	providers := []ProviderResponse{}
+	for rows.Next() {
+		var p ProviderResponse
+		var createdAt, updatedAt time.Time
+		var modelID sql.NullInt64
 		var m ModelResponse
-		var providerID int64
-		if err := modelRows.Scan(&m.ID, &m.ModelName, &m.IsDefault, &providerID); err != nil {
-			log.Println("Error scanning model:", err)
+		var capabilities string
+		err := rows.Scan(&p.ID, &p.Name, &p.Type, &p.BaseURL, &p.HasAPIKey, &p.APIKeyHint, &p.IsActive, &p.MaxConcurrent, &createdAt, &updatedAt,
+			&modelID, &m.ModelName, &m.IsDefault, &m.OwnedBy, &capabilities)
+		if err != nil {
+			log.Println("Error scanning provider:", err)
 			continue
 		}
-		modelsByProviderID[providerID] = append(modelsByProviderID[providerID], m)
-	}
-
-	providers := make([]ProviderResponse, 0, len(providersWithIDs))
-	for _, p := range providersWithIDs {
-		providers = append(providers, ProviderResponse{
-			ID:        p.ID,
-			Name:      p.Name,
-			Type:      p.Type,
-			BaseURL:   p.BaseURL,
-			HasAPIKey: p.HasAPIKey,
-			IsActive:  p.IsActive,
-			CreatedAt: p.CreatedAt.Format(time.RFC3339),
-			UpdatedAt: p.UpdatedAt.Format(time.RFC3339),
-			Models:    modelsByProviderID[p.ID],
-		})
-	}
 
-	WriteJSON(w, providers)
-}
-
-func intsToInterfaces(ints ...int64) []interface{} {
-	ifaces := make([]interface{}, len(ints))
-	for i, v := range ints {
-		ifaces[i] = v
+		// Rows arrive grouped by provider, one per model
+		if n := len(providers); n == 0 || providers[n-1].ID != p.ID {
+			if p.HasAPIKey && p.APIKeyHint == "" {
+				p.APIKeyHint = apiKeyMask
+			}
+			p.CreatedAt = createdAt.Format(time.RFC3339)
+			p.UpdatedAt = updatedAt.Format(time.RFC3339)
+			providers = append(providers, p)
+		}
+		if modelID.Valid {
+			m.ID = modelID.Int64
+			m.Capabilities = decodeModelCapabilities(capabilities, m.ModelName)
+			last := &providers[len(providers)-1]
+			last.Models = append(last.Models, m)
+		}
 	}
-	return ifaces
-}
 
-func placeholders(n int) string {
-	if n <= 0 {
-		return ""
-	}
-	result := "?"
-	for i := 1; i < n; i++ {
-		result += ", ?"
+	if err := rows.Err(); err != nil {
+		WriteError(w, http.StatusInternalServerError, "Error iterating providers: "+err.Error())
+		return
 	}
-	return result
+
+	WriteJSON(w, providers)
 }
 
 func getModelsForProvider(providerID int64) []ModelResponse {
 	rows, err := db.Query(`
-		SELECT id, model_name, is_default
+		SELECT id, model_name, is_default, COALESCE(owned_by, ''), COALESCE(capabilities, '')
 		FROM models
 		WHERE provider_id = ?
 		ORDER BY is_default DESC, model_name ASC
@@ -184,14 +220,51 @@ func getModelsForProvider(providerID int64) []ModelResponse {
 	models := []ModelResponse{}
 	for rows.Next() {
 		var m ModelResponse
-		if err := rows.Scan(&m.ID, &m.ModelName, &m.IsDefault); err != nil {
+		var capabilities string
+		if err := rows.Scan(&m.ID, &m.ModelName, &m.IsDefault, &m.OwnedBy, &capabilities); err != nil {
 			continue
 		}
+		m.Capabilities = decodeModelCapabilities(capabilities, m.ModelName)
 		models = append(models, m)
 	}
 	return models
 }
 
+// getProvider returns one provider with its models and a masked API key
+func getProvider(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid provider ID")
+		return
+	}
+
+	var p ProviderResponse
+	var createdAt, updatedAt time.Time
+	err = db.QueryRow(`
+		SELECT id, name, type, COALESCE(base_url, ''), COALESCE(api_key, '') != '', COALESCE(api_key_hint, ''),
+		       is_active, COALESCE(max_concurrent, 0), created_at, updated_at
+		FROM providers WHERE id = ?
+	`, id).Scan(&p.ID, &p.Name, &p.Type, &p.BaseURL, &p.HasAPIKey, &p.APIKeyHint, &p.IsActive, &p.MaxConcurrent, &createdAt, &updatedAt)
+	if err == sql.ErrNoRows {
+		WriteError(w, http.StatusNotFound, "Provider not found")
+		return
+	}
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if p.HasAPIKey && p.APIKeyHint == "" {
+		p.APIKeyHint = apiKeyMask
+	}
+	p.CreatedAt = createdAt.Format(time.RFC3339)
+	p.UpdatedAt = updatedAt.Format(time.RFC3339)
+	p.Models = getModelsForProvider(id)
+
+	WriteJSON(w, p)
+}
+
 func createProvider(w http.ResponseWriter, r *http.Request) {
 	var req ProviderRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -209,11 +282,31 @@ func createProvider(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if req.MaxConcurrent != nil && *req.MaxConcurrent < 0 {
+		WriteError(w, http.StatusBadRequest, "max_concurrent must be 0 (no limit) or greater")
+		return
+	}
+	maxConcurrent := 0
+	if req.MaxConcurrent != nil {
+		maxConcurrent = *req.MaxConcurrent
+	}
+
+	if req.APIKey == apiKeyClearSentinel || strings.HasPrefix(req.APIKey, apiKeyMask) {
+		req.APIKey = ""
+	}
+
 	if req.Type == "openai_compatible" && (req.BaseURL == "" || req.APIKey == "") {
 		WriteError(w, http.StatusBadRequest, "Base URL and API key required for OpenAI-compatible providers")
 		return
 	}
 
+	if req.BaseURL != "" {
+		if err := ValidateProviderURL(req.Type, req.BaseURL); err != nil {
+			WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
 	encryptedAPIKey := ""
 	if req.APIKey != "" {
 		var err error
@@ -226,9 +319,9 @@ func createProvider(w http.ResponseWriter, r *http.Request) {
 	}
 
 	result, err := db.Exec(`
-		INSERT INTO providers (name, type, base_url, api_key, is_active)
-		VALUES (?, ?, ?, ?, 0)
-	`, req.Name, req.Type, req.BaseURL, encryptedAPIKey)
+		INSERT INTO providers (name, type, base_url, api_key, api_key_hint, is_active, max_concurrent)
+		VALUES (?, ?, ?, ?, ?, 0, ?)
+	`, req.Name, req.Type, req.BaseURL, encryptedAPIKey, apiKeyHint(req.APIKey), maxConcurrent)
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -239,15 +332,21 @@ func createProvider(w http.ResponseWriter, r *http.Request) {
 		log.Println("Error getting last insert ID:", err)
 	}
 
-	for i, model := range req.Models {
-		isDefault := 0
-		if i == 0 {
-			isDefault = 1
+	// Duplicate names are ignored; the first model added becomes the default
+	hasDefault := false
+	for _, model := range req.Models {
+		model = strings.TrimSpace(model)
+		if model == "" {
+			continue
 		}
-		_, err := db.Exec(`INSERT INTO models (provider_id, model_name, is_default) VALUES (?, ?, ?)`,
-			providerID, model, isDefault)
+		result, err := db.Exec(insertModelQuery, providerID, model, !hasDefault,
+			req.ModelOwners[model], encodeModelCapabilities(inferModelCapabilities(model)))
 		if err != nil {
 			log.Println("Error inserting model:", err)
+			continue
+		}
+		if rows, _ := result.RowsAffected(); rows > 0 {
+			hasDefault = true
 		}
 	}
 
@@ -271,6 +370,36 @@ func updateProvider(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if req.MaxConcurrent != nil && *req.MaxConcurrent < 0 {
+		WriteError(w, http.StatusBadRequest, "max_concurrent must be 0 (no limit) or greater")
+		return
+	}
+
+	if req.BaseURL != "" || req.Type != "" {
+		var providerType, baseURL string
+		err := db.QueryRow("SELECT type, COALESCE(base_url, '') FROM providers WHERE id = ?", id).Scan(&providerType, &baseURL)
+		if err == sql.ErrNoRows {
+			WriteError(w, http.StatusNotFound, "Provider not found")
+			return
+		}
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if req.Type != "" {
+			providerType = req.Type
+		}
+		if req.BaseURL != "" {
+			baseURL = req.BaseURL
+		}
+		if baseURL != "" {
+			if err := ValidateProviderURL(providerType, baseURL); err != nil {
+				WriteError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+	}
+
 	query := "UPDATE providers SET updated_at = CURRENT_TIMESTAMP"
 	args := []interface{}{}
 
@@ -286,24 +415,35 @@ func updateProvider(w http.ResponseWriter, r *http.Request) {
 		query += ", base_url = ?"
 		args = append(args, req.BaseURL)
 	}
-	if req.APIKey != "" {
+	if req.MaxConcurrent != nil {
+		query += ", max_concurrent = ?"
+		args = append(args, *req.MaxConcurrent)
+	}
+	// An empty key or the mask leaves the stored key untouched
+	if req.APIKey == apiKeyClearSentinel {
+		query += ", api_key = '', api_key_hint = ''"
+	} else if req.APIKey != "" && !strings.HasPrefix(req.APIKey, apiKeyMask) {
 		encryptedAPIKey, err := Encrypt(req.APIKey)
 		if err != nil {
 			WriteError(w, http.StatusInternalServerError, "Failed to secure API key")
 			return
 		}
-		query += ", api_key = ?"
-		args = append(args, encryptedAPIKey)
+		query += ", api_key = ?, api_key_hint = ?"
+		args = append(args, encryptedAPIKey, apiKeyHint(req.APIKey))
 	}
 
 	query += " WHERE id = ?"
 	args = append(args, id)
 
-	_, err = db.Exec(query, args...)
+	result, err := db.Exec(query, args...)
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		WriteError(w, http.StatusNotFound, "Provider not found")
+		return
+	}
 
 	WriteJSON(w, map[string]string{"message": "Provider updated successfully"})
 }
@@ -316,37 +456,66 @@ func deleteProvider(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var count int
-	err = db.QueryRow("SELECT COUNT(*) FROM providers").Scan(&count)
+	tx, err := db.Begin()
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	if count <= 1 {
-		WriteError(w, http.StatusBadRequest, "Cannot delete the last provider")
+	defer tx.Rollback()
+
+	var isActive int
+	err = tx.QueryRow("SELECT is_active FROM providers WHERE id = ?", id).Scan(&isActive)
+	if err == sql.ErrNoRows {
+		WriteError(w, http.StatusNotFound, "Provider not found")
+		return
+	}
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	var isActive int
-	err = db.QueryRow("SELECT is_active FROM providers WHERE id = ?", id).Scan(&isActive)
+	var count int
+	err = tx.QueryRow("SELECT COUNT(*) FROM providers").Scan(&count)
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	if count <= 1 {
+		WriteError(w, http.StatusBadRequest, "Cannot delete the last provider")
+		return
+	}
 
-	_, err = db.Exec("DELETE FROM providers WHERE id = ?", id)
+	result, err := tx.Exec("DELETE FROM providers WHERE id = ?", id)
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		WriteError(w, http.StatusNotFound, "Provider not found")
+		return
+	}
 
+	// The replacement is activated before committing so there is never a moment
+	// without an active provider. Providers that have models are preferred.
 	if isActive == 1 {
-		_, err = db.Exec("UPDATE providers SET is_active = 1 WHERE id = (SELECT id FROM providers LIMIT 1)")
+		_, err = tx.Exec(`
+			UPDATE providers SET is_active = 1, updated_at = CURRENT_TIMESTAMP WHERE id = (
+				SELECT p.id FROM providers p
+				ORDER BY EXISTS(SELECT 1 FROM models m WHERE m.provider_id = p.id) DESC, p.id
+				LIMIT 1
+			)
+		`)
 		if err != nil {
-			log.Println("Error setting new active provider:", err)
+			WriteError(w, http.StatusInternalServerError, "Failed to activate a replacement provider")
+			return
 		}
 	}
 
+	if err := tx.Commit(); err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
 	WriteJSON(w, map[string]string{"message": "Provider deleted successfully"})
 }
 
@@ -358,15 +527,50 @@ func activateProvider(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = db.Exec("UPDATE providers SET is_active = 0")
+	tx, err := db.Begin()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	var modelCount int
+	err = tx.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM providers WHERE id = ?), (SELECT COUNT(*) FROM models WHERE provider_id = ?)
+	`, id, id).Scan(&exists, &modelCount)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !exists {
+		WriteError(w, http.StatusNotFound, "Provider not found")
+		return
+	}
+	if modelCount == 0 {
+		WriteError(w, http.StatusBadRequest, "Provider has no models; add a model before activating it")
+		return
+	}
+
+	_, err = tx.Exec("UPDATE providers SET is_active = 0")
 	if err != nil {
 		log.Println("Error deactivating all providers:", err)
 	}
-	_, err = db.Exec("UPDATE providers SET is_active = 1, updated_at = CURRENT_TIMESTAMP WHERE id = ?", id)
+	result, err := tx.Exec("UPDATE providers SET is_active = 1, updated_at = CURRENT_TIMESTAMP WHERE id = ?", id)
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	// Rolling back keeps the current provider active when the id doesn't exist
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		WriteError(w, http.StatusNotFound, "Provider not found")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
 
 	WriteJSON(w, map[string]string{"message": "Provider activated successfully"})
 }
@@ -391,14 +595,25 @@ func fetchModelsFromAPI(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	models, status, err := discoverModels(context.Background(), id)
+	if err != nil {
+		WriteError(w, status, err.Error())
+		return
+	}
+
+	WriteJSON(w, models)
+}
+
+// discoverModels lists the models a provider's API reports. On failure it also returns
+// the HTTP status that describes the error.
+func discoverModels(ctx context.Context, id int64) ([]ModelInfo, int, error) {
 	var providerType, baseURL, apiKey string
-	err = db.QueryRow(`
+	err := db.QueryRow(`
 		SELECT type, COALESCE(base_url, ''), COALESCE(api_key, '')
 		FROM providers WHERE id = ?
 	`, id).Scan(&providerType, &baseURL, &apiKey)
 	if err != nil {
-		WriteError(w, http.StatusNotFound, "Provider not found")
-		return
+		return nil, http.StatusNotFound, fmt.Errorf("Provider not found")
 	}
 
 	if apiKey != "" {
@@ -408,32 +623,124 @@ func fetchModelsFromAPI(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	ctx := context.Background()
 	var models []ModelInfo
 
 	switch providerType {
 	case "ollama":
 		provider, err := NewOllamaProvider("")
 		if err != nil {
-			WriteError(w, http.StatusInternalServerError, "Failed to connect to Ollama: "+err.Error())
-			return
+			return nil, http.StatusInternalServerError, fmt.Errorf("Failed to connect to Ollama: %w", err)
 		}
 		models, err = provider.FetchModels(ctx)
 		if err != nil {
-			WriteError(w, http.StatusInternalServerError, "Failed to fetch models: "+err.Error())
-			return
+			return nil, http.StatusInternalServerError, fmt.Errorf("Failed to fetch models: %w", err)
 		}
 
 	case "openai_compatible":
+		if err := ValidateProviderURL(providerType, baseURL); err != nil {
+			return nil, http.StatusBadRequest, err
+		}
 		provider := NewOpenAIProvider(baseURL, apiKey, "")
 		models, err = provider.FetchModels(ctx)
 		if err != nil {
-			WriteError(w, http.StatusInternalServerError, "Failed to fetch models: "+err.Error())
+			return nil, http.StatusInternalServerError, fmt.Errorf("Failed to fetch models: %w", err)
+		}
+	}
+
+	return models, http.StatusOK, nil
+}
+
+// importModels adds many models to a provider in one transaction, skipping names it
+// already has. With {"all": true} every discovered model is imported.
+func importModels(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid provider ID")
+		return
+	}
+
+	var req struct {
+		Models []string `json:"models"`
+		All    bool     `json:"all"`
+		// OwnedBy maps model names to the owned_by reported when they were discovered
+		OwnedBy map[string]string `json:"owned_by,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	var exists bool
+	db.QueryRow("SELECT EXISTS(SELECT 1 FROM providers WHERE id = ?)", id).Scan(&exists)
+	if !exists {
+		WriteError(w, http.StatusNotFound, "Provider not found")
+		return
+	}
+
+	names := req.Models
+	if req.All {
+		discovered, status, err := discoverModels(r.Context(), id)
+		if err != nil {
+			WriteError(w, status, err.Error())
 			return
 		}
+		names = make([]string, 0, len(discovered))
+		req.OwnedBy = make(map[string]string, len(discovered))
+		for _, m := range discovered {
+			names = append(names, m.ID)
+			req.OwnedBy[m.ID] = m.OwnedBy
+		}
+	}
+	if len(names) == 0 {
+		WriteError(w, http.StatusBadRequest, "Provide model names or set all to true")
+		return
 	}
 
-	WriteJSON(w, models)
+	tx, err := db.Begin()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer tx.Rollback()
+
+	var hasDefault bool
+	if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM models WHERE provider_id = ? AND is_default = 1)", id).Scan(&hasDefault); err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	added, skipped := 0, 0
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			skipped++
+			continue
+		}
+		result, err := tx.Exec(insertModelQuery, id, name, !hasDefault,
+			req.OwnedBy[name], encodeModelCapabilities(inferModelCapabilities(name)))
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if rows, _ := result.RowsAffected(); rows == 0 {
+			skipped++
+			continue
+		}
+		added++
+		hasDefault = true
+	}
+
+	if err := tx.Commit(); err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	WriteJSON(w, map[string]interface{}{
+		"added":   added,
+		"skipped": skipped,
+		"models":  getModelsForProvider(id),
+	})
 }
 
 func addModel(w http.ResponseWriter, r *http.Request) {
@@ -441,6 +748,9 @@ func addModel(w http.ResponseWriter, r *http.Request) {
 		ProviderID int64  `json:"provider_id"`
 		ModelName  string `json:"model_name"`
 		IsDefault  bool   `json:"is_default"`
+		OwnedBy    string `json:"owned_by,omitempty"`
+		// Capabilities are inferred from the model name when omitted
+		Capabilities *ModelCapabilities `json:"capabilities,omitempty"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -448,11 +758,19 @@ func addModel(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	req.ModelName = strings.TrimSpace(req.ModelName)
 	if req.ProviderID == 0 || req.ModelName == "" {
 		WriteError(w, http.StatusBadRequest, "Provider ID and model name are required")
 		return
 	}
 
+	var exists bool
+	db.QueryRow("SELECT EXISTS(SELECT 1 FROM models WHERE provider_id = ? AND model_name = ?)", req.ProviderID, req.ModelName).Scan(&exists)
+	if exists {
+		WriteError(w, http.StatusConflict, "Model already exists for this provider")
+		return
+	}
+
 	if req.IsDefault {
 		_, err := db.Exec("UPDATE models SET is_default = 0 WHERE provider_id = ?", req.ProviderID)
 		if err != nil {
@@ -460,9 +778,18 @@ func addModel(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	capabilities := inferModelCapabilities(req.ModelName)
+	if req.Capabilities != nil {
+		capabilities = *req.Capabilities
+	}
+
 	result, err := db.Exec(`
-		INSERT INTO models (provider_id, model_name, is_default) VALUES (?, ?, ?)
-	`, req.ProviderID, req.ModelName, req.IsDefault)
+		INSERT INTO models (provider_id, model_name, is_default, owned_by, capabilities) VALUES (?, ?, ?, ?, ?)
+	`, req.ProviderID, req.ModelName, req.IsDefault, strings.TrimSpace(req.OwnedBy), encodeModelCapabilities(capabilities))
+	if isUniqueViolation(err) {
+		WriteError(w, http.StatusConflict, "Model already exists for this provider")
+		return
+	}
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -524,22 +851,93 @@ func setDefaultModel(w http.ResponseWriter, r *http.Request) {
 	WriteJSON(w, map[string]string{"message": "Default model updated successfully"})
 }
 
+// settingDefaults returns the value reported for each known setting while it is unset
+func settingDefaults() map[string]string {
+	return map[string]string{
+		"theme":                       defaultTheme,
+		"temperature":                 "0.7",
+		"max_tokens":                  "4096",
+		"brave_api_key":               "",
+		"global_system_prompt":        "",
+		"max_system_prompt_length":    strconv.Itoa(DefaultMaxSystemPromptLength),
+		"context_token_budget":        strconv.Itoa(DefaultContextTokenBudget),
+		"max_context_messages":        strconv.Itoa(DefaultMaxContextMessages),
+		"summary_provider_id":         "",
+		"summary_model":               "",
+		"token_budget":                "0",
+		"token_budget_daily":          "0",
+		"message_retention_days":      "0",
+		"embedding_model":             "",
+		"memory_enabled":              "1",
+		"memory_fallback_extraction":  "1",
+		"memory_top_k":                strconv.Itoa(DefaultMemoryTopK),
+		"memory_min_confidence":       "0",
+		"memory_categories":           "",
+		"memory_max_injected":         strconv.Itoa(DefaultMemoryMaxInjected),
+		"memory_ttl_reminder":         defaultMemoryTTLs["reminder"],
+		"search_provider":             "brave",
+		"searxng_url":                 "",
+		"search_cache_ttl_minutes":    strconv.Itoa(defaultSearchCacheTTLMinutes),
+		"search_fetch_content":        "0",
+		"auto_search":                 "off",
+		"auto_search_max_per_chat":    strconv.Itoa(DefaultAutoSearchMaxPerChat),
+		"force_tool_support":          "0",
+		"mcp_idle_timeout_minutes":    strconv.Itoa(defaultMCPIdleTimeoutMinutes),
+		"builtin_tools_enabled":       "0",
+		"rate_limit_generation_rps":   strconv.FormatFloat(routeRateLimitDefaults["generation"].RPS, 'f', -1, 64),
+		"rate_limit_generation_burst": strconv.Itoa(routeRateLimitDefaults["generation"].Burst),
+		"rate_limit_search_rps":       strconv.FormatFloat(routeRateLimitDefaults["search"].RPS, 'f', -1, 64),
+		"rate_limit_search_burst":     strconv.Itoa(routeRateLimitDefaults["search"].Burst),
+		"rate_limit_mcp_rps":          strconv.FormatFloat(routeRateLimitDefaults["mcp"].RPS, 'f', -1, 64),
+		"rate_limit_mcp_burst":        strconv.Itoa(routeRateLimitDefaults["mcp"].Burst),
+	}
+}
+
+// sensitiveSettings are masked in responses; sending the mask back leaves them unchanged
+var sensitiveSettings = map[string]bool{
+	"brave_api_key": true,
+}
+
+// isSensitiveSetting reports whether a setting is stored encrypted and masked in responses
+func isSensitiveSetting(key string) bool {
+	return sensitiveSettings[key] || strings.HasPrefix(key, mcpSecretSettingPrefix)
+}
+
+// maskSetting hides the value of a sensitive setting
+func maskSetting(key, value string) string {
+	if isSensitiveSetting(key) && value != "" {
+		return apiKeyMask
+	}
+	return value
+}
+
+// prepareSettingValue returns the value to store for a setting, encrypting sensitive
+// ones. skip is set when the masked value was sent back unchanged.
+func prepareSettingValue(key, value string) (stored string, skip bool, err error) {
+	if !isSensitiveSetting(key) {
+		return value, false, nil
+	}
+	if value == apiKeyMask {
+		return "", true, nil
+	}
+	if value == "" {
+		return "", false, nil
+	}
+	encrypted, err := Encrypt(value)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to encrypt %s: %w", key, err)
+	}
+	return encrypted, false, nil
+}
+
 func getSetting(w http.ResponseWriter, r *http.Request) {
 	key := chi.URLParam(r, "key")
 
 	var value string
 	err := db.QueryRow("SELECT value FROM settings WHERE key = ?", key).Scan(&value)
 	if err == sql.ErrNoRows {
-		switch key {
-		case "theme":
-			value = "light"
-		case "temperature":
-			value = "0.7"
-		case "max_tokens":
-			value = "4096"
-		case "brave_api_key":
-			value = ""
-		default:
+		var ok bool
+		if value, ok = settingDefaults()[key]; !ok {
 			WriteError(w, http.StatusNotFound, "Setting not found")
 			return
 		}
@@ -548,11 +946,46 @@ func getSetting(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if key == "brave_api_key" && value != "" {
-		value = "********"
+	if userValue, ok := getUserSetting(db, requestUserID(r), key); ok {
+		value = userValue
 	}
 
-	WriteJSON(w, map[string]string{"key": key, "value": value})
+	WriteJSON(w, map[string]string{"key": key, "value": maskSetting(key, value)})
+}
+
+// getSettings handles GET /api/settings, returning every stored setting merged over the
+// defaults, with sensitive values masked
+func getSettings(w http.ResponseWriter, r *http.Request) {
+	settings := settingDefaults()
+
+	rows, err := db.Query("SELECT key, value FROM settings")
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			log.Println("Error scanning setting:", err)
+			continue
+		}
+		settings[key] = value
+	}
+	if err := rows.Err(); err != nil {
+		WriteError(w, http.StatusInternalServerError, "Error iterating settings: "+err.Error())
+		return
+	}
+
+	userID := requestUserID(r)
+	for key, value := range settings {
+		if userValue, ok := getUserSetting(db, userID, key); ok {
+			value = userValue
+		}
+		settings[key] = maskSetting(key, value)
+	}
+	WriteJSON(w, settings)
 }
 
 func updateSetting(w http.ResponseWriter, r *http.Request) {
@@ -566,36 +999,159 @@ func updateSetting(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if key == "brave_api_key" && req.Value == "********" {
+	value, err := validateSetting(key, req.Value)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	value, skip, err := prepareSettingValue(key, value)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if skip {
 		WriteJSON(w, map[string]string{"message": "Setting updated successfully (unchanged)"})
 		return
 	}
 
-	if key == "brave_api_key" && req.Value != "" {
-		encrypted, err := Encrypt(req.Value)
+	if err := saveSetting(db, requestUserID(r), key, value); err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	WriteJSON(w, map[string]string{"message": "Setting updated successfully"})
+}
+
+// updateSettings handles PUT /api/settings with a {key: value} map, writing all of them
+// in one transaction. Masked sensitive values are left unchanged.
+func updateSettings(w http.ResponseWriter, r *http.Request) {
+	var req map[string]string
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body: expected an object of setting keys to string values")
+		return
+	}
+	if len(req) == 0 {
+		WriteError(w, http.StatusBadRequest, "No settings provided")
+		return
+	}
+
+	// Every value is checked before anything is written
+	for key, value := range req {
+		if strings.TrimSpace(key) == "" {
+			WriteError(w, http.StatusBadRequest, "Setting keys must not be empty")
+			return
+		}
+		normalized, err := validateSetting(key, value)
 		if err != nil {
-			WriteError(w, http.StatusInternalServerError, "Failed to encrypt key: "+err.Error())
+			WriteError(w, http.StatusBadRequest, err.Error())
 			return
 		}
-		req.Value = encrypted
+		req[key] = normalized
 	}
 
-	_, err := db.Exec(`
-		INSERT INTO settings (key, value) VALUES (?, ?)
-		ON CONFLICT(key) DO UPDATE SET value = excluded.value
-	`, key, req.Value)
+	tx, err := db.Begin()
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	defer tx.Rollback()
 
-	WriteJSON(w, map[string]string{"message": "Setting updated successfully"})
+	userID := requestUserID(r)
+	updated := 0
+	for key, value := range req {
+		stored, skip, err := prepareSettingValue(key, value)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if skip {
+			continue
+		}
+		if err := saveSetting(tx, userID, key, stored); err != nil {
+			WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		updated++
+	}
+
+	if err := tx.Commit(); err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	WriteJSON(w, map[string]interface{}{
+		"message": "Settings updated successfully",
+		"updated": updated,
+	})
+}
+
+// searchWeb runs the configured search backend and returns its results
+func searchWeb(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		WriteError(w, http.StatusBadRequest, "Query parameter q is required")
+		return
+	}
+
+	searcher, err := GetSearcher(db)
+	if err != nil {
+		WriteError(w, http.StatusServiceUnavailable, "Web search is not available: "+err.Error())
+		return
+	}
+
+	results, err := searcher.Search(query)
+	if err != nil {
+		log.Printf("Search failed: %v", err)
+		WriteError(w, searchErrorStatus(err), "Search failed: "+err.Error())
+		return
+	}
+	if results == nil {
+		results = []SearchResult{}
+	}
+
+	WriteJSON(w, map[string]interface{}{
+		"query":   query,
+		"results": results,
+	})
+}
+
+// activeProviderError maps a GetActiveProvider failure to an error code and a message
+// telling the user how to fix it
+func activeProviderError(err error) (string, string) {
+	switch {
+	case errors.Is(err, ErrNoModelConfigured):
+		return "no_model_configured", "The active provider has no models. Add a model to it in Settings (/settings) or activate another provider."
+	case errors.Is(err, ErrNoActiveProvider):
+		return "no_active_provider", "No active provider configured. Please visit /settings to configure one."
+	default:
+		return "provider_unavailable", "The active provider could not be loaded: " + err.Error()
+	}
+}
+
+// writeActiveProviderError reports a GetActiveProvider failure as a 503 with its code
+func writeActiveProviderError(w http.ResponseWriter, err error) {
+	code, message := activeProviderError(err)
+	WriteErrorWithCode(w, http.StatusServiceUnavailable, code, message)
 }
 
 func getActiveProviderInfo(w http.ResponseWriter, r *http.Request) {
 	_, config, err := GetActiveProvider(db)
+	if errors.Is(err, ErrNoModelConfigured) {
+		_, message := activeProviderError(err)
+		WriteJSON(w, map[string]interface{}{
+			"id":          config.ID,
+			"name":        config.Name,
+			"type":        config.Type,
+			"model":       "",
+			"models":      []string{},
+			"needs_model": true,
+			"message":     message,
+		})
+		return
+	}
 	if err != nil {
-		WriteError(w, http.StatusInternalServerError, err.Error())
+		writeActiveProviderError(w, err)
 		return
 	}
 
@@ -606,11 +1162,12 @@ func getActiveProviderInfo(w http.ResponseWriter, r *http.Request) {
 	}
 
 	WriteJSON(w, map[string]interface{}{
-		"id":     config.ID,
-		"name":   config.Name,
-		"type":   config.Type,
-		"model":  config.Model,
-		"models": modelNames,
+		"id":          config.ID,
+		"name":        config.Name,
+		"type":        config.Type,
+		"model":       config.Model,
+		"models":      modelNames,
+		"needs_model": false,
 	})
 }
 
@@ -659,16 +1216,29 @@ func switchModel(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func getMetrics(w http.ResponseWriter, r *http.Request) {
-	var chatCount int
-	err := db.QueryRow("SELECT COUNT(*) FROM chats").Scan(&chatCount)
-	if err != nil {
-		WriteError(w, http.StatusInternalServerError, err.Error())
-		return
-	}
+// ChatUsage counts chats and their messages and recorded tokens
+type ChatUsage struct {
+	Chats    int
+	Messages int
+	Tokens   int64
+}
 
-	var messageCount int
-	err = db.QueryRow("SELECT COUNT(*) FROM messages").Scan(&messageCount)
+// GetChatUsage aggregates usage over the chats matching condition, a WHERE clause on
+// the chats table
+func GetChatUsage(db *sql.DB, condition string, args ...interface{}) (ChatUsage, error) {
+	var stats ChatUsage
+	if err := db.QueryRow("SELECT COUNT(*) FROM chats WHERE "+condition, args...).Scan(&stats.Chats); err != nil {
+		return stats, err
+	}
+	err := db.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(tokens_used), 0) FROM messages
+		WHERE chat_id IN (SELECT id FROM chats WHERE `+condition+`)
+	`, args...).Scan(&stats.Messages, &stats.Tokens)
+	return stats, err
+}
+
+func getMetrics(w http.ResponseWriter, r *http.Request) {
+	usage, err := GetChatUsage(db, "1 = 1")
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -689,8 +1259,9 @@ func getMetrics(w http.ResponseWriter, r *http.Request) {
 	}
 
 	metrics := Metrics{
-		ChatsTotal:     chatCount,
-		MessagesTotal:  messageCount,
+		ChatsTotal:     usage.Chats,
+		MessagesTotal:  usage.Messages,
+		TokensTotal:    usage.Tokens,
 		ProvidersTotal: providerCount,
 		ModelsTotal:    modelCount,
 		UptimeSeconds:  time.Since(startTime).Seconds(),
@@ -1,13 +1,16 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/go-chi/chi"
 )
@@ -20,18 +23,29 @@ type ChatResponse struct {
 	SystemPrompt string            `json:"system_prompt,omitempty"`
 	Messages     []MessageResponse `json:"messages,omitempty"`
 	IsPinned     bool              `json:"is_pinned"`
+	UseMemory    bool              `json:"use_memory"`
 	CreatedAt    string            `json:"created_at"`
 	UpdatedAt    string            `json:"updated_at"`
 }
 
 type MessageResponse struct {
-	ID           int64  `json:"id"`
-	Role         string `json:"role"`
-	Content      string `json:"content"`
-	ModelName    string `json:"model_name,omitempty"`
-	TokensUsed   int    `json:"tokens_used,omitempty"`
-	VersionGroup string `json:"version_group,omitempty"`
-	CreatedAt    string `json:"created_at"`
+	ID           int64   `json:"id"`
+	Role         string  `json:"role"`
+	Content      string  `json:"content"`
+	ModelName    string  `json:"model_name,omitempty"`
+	TokensUsed   int     `json:"tokens_used,omitempty"`
+	LatencyMs    int64   `json:"latency_ms,omitempty"`
+	TokensPerSec float64 `json:"tokens_per_sec,omitempty"`
+	VersionGroup string  `json:"version_group,omitempty"`
+	CreatedAt    string  `json:"created_at"`
+
+	// Feedback is set once the message has been rated
+	Feedback *MessageFeedback `json:"feedback,omitempty"`
+
+	// IsActiveVersion is false for versions of an edited message that are kept for
+	// browsing but left out of the context; Alternatives counts those other versions
+	IsActiveVersion bool `json:"is_active_version"`
+	Alternatives    int  `json:"alternatives,omitempty"`
 }
 
 func sanitizeSearchQuery(query string) string {
@@ -43,7 +57,7 @@ func sanitizeSearchQuery(query string) string {
 
 func getChats(w http.ResponseWriter, r *http.Request) {
 	rows, err := db.Query(`
-		SELECT id, title, COALESCE(provider_name, ''), COALESCE(model_name, ''), created_at, updated_at, is_pinned
+		SELECT id, title, COALESCE(provider_name, ''), COALESCE(model_name, ''), created_at, updated_at, is_pinned, COALESCE(use_memory, 1)
 		FROM chats
 		ORDER BY is_pinned DESC, updated_at DESC
 		LIMIT 50
@@ -58,7 +72,7 @@ func getChats(w http.ResponseWriter, r *http.Request) {
 	for rows.Next() {
 		var c ChatResponse
 		var createdAt, updatedAt time.Time
-		err := rows.Scan(&c.ID, &c.Title, &c.ProviderName, &c.ModelName, &createdAt, &updatedAt, &c.IsPinned)
+		err := rows.Scan(&c.ID, &c.Title, &c.ProviderName, &c.ModelName, &createdAt, &updatedAt, &c.IsPinned, &c.UseMemory)
 		if err != nil {
 			log.Println("Error scanning chat:", err)
 			continue
@@ -82,10 +96,10 @@ func searchChats(w http.ResponseWriter, r *http.Request) {
 	searchPattern := "%" + sanitized + "%"
 
 	rows, err := db.Query(`
-		SELECT DISTINCT c.id, c.title, COALESCE(c.provider_name, ''), COALESCE(c.model_name, ''), c.created_at, c.updated_at, c.is_pinned
+		SELECT DISTINCT c.id, c.title, COALESCE(c.provider_name, ''), COALESCE(c.model_name, ''), c.created_at, c.updated_at, c.is_pinned, COALESCE(c.use_memory, 1)
 		FROM chats c
 		LEFT JOIN messages m ON c.id = m.chat_id
-		WHERE c.title LIKE ? OR m.content LIKE ?
+		WHERE c.title LIKE ? OR (m.content LIKE ? AND m.role != 'tool')
 		ORDER BY c.is_pinned DESC, c.updated_at DESC
 		LIMIT 50
 	`, searchPattern, searchPattern)
@@ -99,7 +113,7 @@ func searchChats(w http.ResponseWriter, r *http.Request) {
 	for rows.Next() {
 		var c ChatResponse
 		var createdAt, updatedAt time.Time
-		err := rows.Scan(&c.ID, &c.Title, &c.ProviderName, &c.ModelName, &createdAt, &updatedAt, &c.IsPinned)
+		err := rows.Scan(&c.ID, &c.Title, &c.ProviderName, &c.ModelName, &createdAt, &updatedAt, &c.IsPinned, &c.UseMemory)
 		if err != nil {
 			log.Println("Error scanning chat:", err)
 			continue
@@ -123,9 +137,9 @@ func getChat(w http.ResponseWriter, r *http.Request) {
 	var chat ChatResponse
 	var createdAt, updatedAt time.Time
 	err = db.QueryRow(`
-		SELECT id, title, COALESCE(provider_name, ''), COALESCE(model_name, ''), COALESCE(system_prompt, ''), created_at, updated_at, is_pinned
+		SELECT id, title, COALESCE(provider_name, ''), COALESCE(model_name, ''), COALESCE(system_prompt, ''), created_at, updated_at, is_pinned, COALESCE(use_memory, 1)
 		FROM chats WHERE id = ?
-	`, id).Scan(&chat.ID, &chat.Title, &chat.ProviderName, &chat.ModelName, &chat.SystemPrompt, &createdAt, &updatedAt, &chat.IsPinned)
+	`, id).Scan(&chat.ID, &chat.Title, &chat.ProviderName, &chat.ModelName, &chat.SystemPrompt, &createdAt, &updatedAt, &chat.IsPinned, &chat.UseMemory)
 	if err == sql.ErrNoRows {
 		WriteError(w, http.StatusNotFound, "Chat not found")
 		return
@@ -150,13 +164,27 @@ func getChat(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Only active versions are returned unless ?all_versions=1; the others are counted
+	// in alternatives and listed by GET /api/messages/{id}/versions
+	allVersions := r.URL.Query().Get("all_versions") == "1"
+	// Tool calls made while answering are stored as tool messages, returned only with
+	// ?include_tools=true
+	includeTools := r.URL.Query().Get("include_tools") == "true"
+	versionCounts, err := chatVersionCounts(db, id)
+	if err != nil {
+		log.Println("Error counting message versions:", err)
+	}
+
 	rows, err := db.Query(`
-		SELECT id, role, content, COALESCE(model_name, ''), COALESCE(tokens_used, 0), COALESCE(version_group, ''), created_at
-		FROM messages
-		WHERE chat_id = ?
-		ORDER BY created_at ASC
+		SELECT m.id, m.role, m.content, COALESCE(m.model_name, ''), COALESCE(m.tokens_used, 0),
+			COALESCE(m.latency_ms, 0), COALESCE(m.tokens_per_sec, 0), COALESCE(m.version_group, ''), m.created_at,
+			COALESCE(f.rating, ''), COALESCE(f.comment, ''), COALESCE(m.is_active_version, 1)
+		FROM messages m
+		LEFT JOIN message_feedback f ON f.message_id = m.id
+		WHERE m.chat_id = ? AND (? OR COALESCE(m.is_active_version, 1) = 1) AND (? OR m.role != 'tool')
+		ORDER BY m.created_at ASC, m.id ASC
 		LIMIT ? OFFSET ?
-	`, id, limit, offset)
+	`, id, allVersions, includeTools, limit, offset)
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -167,10 +195,18 @@ func getChat(w http.ResponseWriter, r *http.Request) {
 	for rows.Next() {
 		var m MessageResponse
 		var msgCreatedAt time.Time
-		if err := rows.Scan(&m.ID, &m.Role, &m.Content, &m.ModelName, &m.TokensUsed, &m.VersionGroup, &msgCreatedAt); err != nil {
+		var feedback MessageFeedback
+		if err := rows.Scan(&m.ID, &m.Role, &m.Content, &m.ModelName, &m.TokensUsed, &m.LatencyMs, &m.TokensPerSec, &m.VersionGroup, &msgCreatedAt,
+			&feedback.Rating, &feedback.Comment, &m.IsActiveVersion); err != nil {
 			continue
 		}
 		m.CreatedAt = msgCreatedAt.Format(time.RFC3339)
+		if feedback.Rating != "" {
+			m.Feedback = &feedback
+		}
+		if n := versionCounts[m.VersionGroup]; n > 1 {
+			m.Alternatives = n - 1
+		}
 		chat.Messages = append(chat.Messages, m)
 	}
 
@@ -179,7 +215,8 @@ func getChat(w http.ResponseWriter, r *http.Request) {
 
 func createChat(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Title string `json:"title"`
+		Title    string `json:"title"`
+		PresetID int64  `json:"preset_id,omitempty"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		WriteError(w, http.StatusBadRequest, "Invalid request body")
@@ -190,6 +227,20 @@ func createChat(w http.ResponseWriter, r *http.Request) {
 		req.Title = "New Chat"
 	}
 
+	var systemPrompt string
+	if req.PresetID > 0 {
+		preset, err := getPromptPreset(req.PresetID)
+		if err == sql.ErrNoRows {
+			WriteError(w, http.StatusBadRequest, "Preset not found")
+			return
+		}
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		systemPrompt = preset.Content
+	}
+
 	_, config, _ := GetActiveProvider(db)
 	var providerName, modelName string
 	if config != nil {
@@ -198,8 +249,8 @@ func createChat(w http.ResponseWriter, r *http.Request) {
 	}
 
 	result, err := db.Exec(`
-		INSERT INTO chats (title, provider_name, model_name) VALUES (?, ?, ?)
-	`, req.Title, providerName, modelName)
+		INSERT INTO chats (title, provider_name, model_name, system_prompt) VALUES (?, ?, ?, ?)
+	`, req.Title, providerName, modelName, systemPrompt)
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -211,11 +262,20 @@ func createChat(w http.ResponseWriter, r *http.Request) {
 	}
 
 	WriteJSON(w, map[string]interface{}{
-		"id":    chatID,
-		"title": req.Title,
+		"id":            chatID,
+		"title":         req.Title,
+		"system_prompt": systemPrompt,
 	})
 }
 
+// chatTitleFromMessage is the title a chat takes from its first user message
+func chatTitleFromMessage(content string) string {
+	if len(content) > 50 {
+		return content[:47] + "..."
+	}
+	return content
+}
+
 func addMessage(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
 	chatID, err := strconv.ParseInt(idStr, 10, 64)
@@ -225,11 +285,13 @@ func addMessage(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		Role         string `json:"role"`
-		Content      string `json:"content"`
-		ModelName    string `json:"model_name,omitempty"`
-		TokensUsed   int    `json:"tokens_used,omitempty"`
-		VersionGroup string `json:"version_group,omitempty"`
+		Role         string  `json:"role"`
+		Content      string  `json:"content"`
+		ModelName    string  `json:"model_name,omitempty"`
+		TokensUsed   int     `json:"tokens_used,omitempty"`
+		LatencyMs    int64   `json:"latency_ms,omitempty"`
+		TokensPerSec float64 `json:"tokens_per_sec,omitempty"`
+		VersionGroup string  `json:"version_group,omitempty"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -237,30 +299,29 @@ func addMessage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.Role != "user" && req.Role != "assistant" {
+	// Tool messages are only recorded by the server, from the calls it ran
+	if req.Role != "user" && req.Role != "assistant" && req.Role != "system" {
 		WriteError(w, http.StatusBadRequest, "Invalid role")
 		return
 	}
 
 	result, err := db.Exec(`
-		INSERT INTO messages (chat_id, role, content, model_name, tokens_used, version_group) VALUES (?, ?, ?, ?, ?, ?)
-	`, chatID, req.Role, req.Content, req.ModelName, req.TokensUsed, req.VersionGroup)
+		INSERT INTO messages (chat_id, role, content, model_name, tokens_used, version_group, latency_ms, tokens_per_sec)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, chatID, req.Role, req.Content, req.ModelName, req.TokensUsed, req.VersionGroup, req.LatencyMs, req.TokensPerSec)
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
+	// The first user message titles the chat, even after stored system messages
 	var msgCount int
-	err = db.QueryRow("SELECT COUNT(*) FROM messages WHERE chat_id = ?", chatID).Scan(&msgCount)
+	err = db.QueryRow("SELECT COUNT(*) FROM messages WHERE chat_id = ? AND role = 'user'", chatID).Scan(&msgCount)
 	if err != nil {
 		log.Println("Error counting messages:", err)
 	}
 	if msgCount == 1 && req.Role == "user" {
-		title := req.Content
-		if len(title) > 50 {
-			title = title[:47] + "..."
-		}
-		_, err := db.Exec("UPDATE chats SET title = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", title, chatID)
+		_, err := db.Exec("UPDATE chats SET title = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", chatTitleFromMessage(req.Content), chatID)
 		if err != nil {
 			log.Println("Error updating chat title:", err)
 		}
@@ -276,6 +337,12 @@ func addMessage(w http.ResponseWriter, r *http.Request) {
 		log.Println("Error getting last insert ID:", err)
 	}
 
+	if req.VersionGroup != "" && req.Role == "user" && messageID > 0 {
+		if err := deactivateOtherVersions(db, chatID, messageID, req.VersionGroup); err != nil {
+			log.Println("Error switching active version:", err)
+		}
+	}
+
 	WriteJSON(w, map[string]interface{}{
 		"id": messageID,
 	})
@@ -298,6 +365,57 @@ func deleteChat(w http.ResponseWriter, r *http.Request) {
 	WriteJSON(w, map[string]string{"message": "Chat deleted successfully"})
 }
 
+// clearChatsConfirmation must be sent as {"confirm": ...} to delete all chats
+const clearChatsConfirmation = "DELETE ALL CHATS"
+
+// deleteAllChats removes every chat and its messages in one transaction. Pinned chats
+// are kept unless include_pinned=true is passed.
+func deleteAllChats(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Confirm string `json:"confirm"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Confirm != clearChatsConfirmation {
+		WriteError(w, http.StatusBadRequest, fmt.Sprintf("Confirmation required: send {\"confirm\": %q}", clearChatsConfirmation))
+		return
+	}
+
+	filter := "WHERE is_pinned = 0"
+	if r.URL.Query().Get("include_pinned") == "true" {
+		filter = ""
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer tx.Rollback()
+
+	// Messages are removed explicitly so databases opened without foreign keys don't
+	// keep orphaned rows
+	if _, err := tx.Exec("DELETE FROM messages WHERE chat_id IN (SELECT id FROM chats " + filter + ")"); err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	result, err := tx.Exec("DELETE FROM chats " + filter)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	deleted, _ := result.RowsAffected()
+
+	if err := tx.Commit(); err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	WriteJSON(w, map[string]interface{}{
+		"message": "Chats deleted successfully",
+		"deleted": deleted,
+	})
+}
+
 func renameChat(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
 	id, err := strconv.ParseInt(idStr, 10, 64)
@@ -364,6 +482,50 @@ func getCurrentChat(w http.ResponseWriter, r *http.Request) {
 	getChat(w, r2)
 }
 
+// DefaultMaxSystemPromptLength is the default limit, in characters, for a chat's system prompt
+const DefaultMaxSystemPromptLength = 8000
+
+// getMaxSystemPromptLength returns the max_system_prompt_length setting
+func getMaxSystemPromptLength(db *sql.DB) int {
+	max, err := strconv.Atoi(GetSetting(db, "max_system_prompt_length", ""))
+	if err != nil || max <= 0 {
+		return DefaultMaxSystemPromptLength
+	}
+	return max
+}
+
+// capSystemPrompt truncates a system prompt to the configured limit. Prompts saved
+// before the limit existed, or after it was lowered, are cut rather than rejected.
+func capSystemPrompt(db *sql.DB, prompt string) string {
+	max := getMaxSystemPromptLength(db)
+	runes := []rune(prompt)
+	if len(runes) <= max {
+		return prompt
+	}
+	log.Printf("System prompt of %d characters truncated to %d", len(runes), max)
+	return string(runes[:max])
+}
+
+// GetChatSystemPrompt returns a chat's system prompt, capped at max_system_prompt_length
+func GetChatSystemPrompt(db *sql.DB, chatID int64) string {
+	var systemPrompt string
+	db.QueryRow("SELECT COALESCE(system_prompt, '') FROM chats WHERE id = ?", chatID).Scan(&systemPrompt)
+	return capSystemPrompt(db, systemPrompt)
+}
+
+// withGlobalSystemPrompt prepends the global_system_prompt setting to a chat's own
+// system prompt, separated by a blank line. An empty setting leaves the prompt as is.
+func withGlobalSystemPrompt(db *sql.DB, systemPrompt string) string {
+	global := strings.TrimSpace(GetSetting(db, "global_system_prompt", ""))
+	if global == "" {
+		return systemPrompt
+	}
+	if strings.TrimSpace(systemPrompt) == "" {
+		return global
+	}
+	return global + "\n\n" + systemPrompt
+}
+
 func updateSystemPrompt(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
 	id, err := strconv.ParseInt(idStr, 10, 64)
@@ -380,6 +542,12 @@ func updateSystemPrompt(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	req.SystemPrompt = strings.TrimSpace(req.SystemPrompt)
+	if max := getMaxSystemPromptLength(db); utf8.RuneCountInString(req.SystemPrompt) > max {
+		WriteError(w, http.StatusBadRequest, fmt.Sprintf("System prompt is too long (max %d characters)", max))
+		return
+	}
+
 	_, err = db.Exec("UPDATE chats SET system_prompt = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", req.SystemPrompt, id)
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, err.Error())
@@ -414,6 +582,18 @@ func updateMessage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var chatID int64
+	var wasSummarized bool
+	err = db.QueryRow("SELECT chat_id, COALESCE(is_summarized, 0) FROM messages WHERE id = ?", id).Scan(&chatID, &wasSummarized)
+	if err == sql.ErrNoRows {
+		WriteError(w, http.StatusNotFound, "Message not found")
+		return
+	}
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
 	var result sql.Result
 	if req.Content != "" && req.VersionGroup != "" {
 		result, err = db.Exec("UPDATE messages SET content = ?, version_group = ? WHERE id = ?", req.Content, req.VersionGroup, id)
@@ -437,11 +617,16 @@ func updateMessage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = db.Exec("UPDATE chats SET updated_at = CURRENT_TIMESTAMP WHERE id = (SELECT chat_id FROM messages WHERE id = ?)", id)
+	_, err = db.Exec("UPDATE chats SET updated_at = CURRENT_TIMESTAMP WHERE id = ?", chatID)
 	if err != nil {
 		log.Println("Error updating chat timestamp:", err)
 	}
 
+	// An edit to a message already in the summary leaves the summary stale
+	if req.Content != "" {
+		InvalidateSummaryForMessage(r.Context(), db, chatID, wasSummarized)
+	}
+
 	WriteJSON(w, map[string]interface{}{
 		"message": "Message updated",
 		"id":      id,
@@ -457,7 +642,8 @@ func deleteMessage(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var chatID int64
-	err = db.QueryRow("SELECT chat_id FROM messages WHERE id = ?", id).Scan(&chatID)
+	var wasSummarized bool
+	err = db.QueryRow("SELECT chat_id, COALESCE(is_summarized, 0) FROM messages WHERE id = ?", id).Scan(&chatID, &wasSummarized)
 	if err == sql.ErrNoRows {
 		WriteError(w, http.StatusNotFound, "Message not found")
 		return
@@ -478,6 +664,8 @@ func deleteMessage(w http.ResponseWriter, r *http.Request) {
 		log.Println("Error updating chat timestamp:", err)
 	}
 
+	InvalidateSummaryForMessage(r.Context(), db, chatID, wasSummarized)
+
 	WriteJSON(w, map[string]interface{}{
 		"message": "Message deleted",
 		"id":      id,
@@ -537,3 +725,262 @@ func togglePinChat(w http.ResponseWriter, r *http.Request) {
 		"is_pinned": req.IsPinned,
 	})
 }
+
+// setChatMemory turns memory injection on or off for one chat, so it can run as a
+// "clean room" that ignores stored memories
+func setChatMemory(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid chat ID")
+		return
+	}
+
+	var req struct {
+		UseMemory *bool `json:"use_memory"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UseMemory == nil {
+		WriteError(w, http.StatusBadRequest, "use_memory is required")
+		return
+	}
+
+	result, err := db.Exec("UPDATE chats SET use_memory = ? WHERE id = ?", *req.UseMemory, id)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		WriteError(w, http.StatusNotFound, "Chat not found")
+		return
+	}
+
+	WriteJSON(w, map[string]interface{}{
+		"message":    "Chat memory setting updated",
+		"use_memory": *req.UseMemory,
+	})
+}
+
+// forkChat copies a chat with its system prompt, summary and messages into a new,
+// unpinned chat. With ?after_message_id= only messages up to that one are copied.
+func forkChat(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid chat ID")
+		return
+	}
+
+	var title string
+	err = db.QueryRow("SELECT title FROM chats WHERE id = ?", id).Scan(&title)
+	if err == sql.ErrNoRows {
+		WriteError(w, http.StatusNotFound, "Chat not found")
+		return
+	}
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var afterID int64
+	if v := r.URL.Query().Get("after_message_id"); v != "" {
+		afterID, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, "Invalid after_message_id")
+			return
+		}
+		var exists bool
+		db.QueryRow("SELECT EXISTS(SELECT 1 FROM messages WHERE id = ? AND chat_id = ?)", afterID, id).Scan(&exists)
+		if !exists {
+			WriteError(w, http.StatusBadRequest, "Message not found in this chat")
+			return
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer tx.Rollback()
+
+	title += " (copy)"
+	result, err := tx.Exec(`
+		INSERT INTO chats (title, provider_name, model_name, system_prompt, summary, is_pinned, use_memory)
+		SELECT ?, provider_name, model_name, system_prompt, summary, 0, use_memory FROM chats WHERE id = ?
+	`, title, id)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	newID, err := result.LastInsertId()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	query := `
+		INSERT INTO messages (chat_id, role, content, model_name, tokens_used, version_group, is_active_version, is_summarized, latency_ms, tokens_per_sec, created_at)
+		SELECT ?, role, content, model_name, tokens_used, version_group, is_active_version, is_summarized, latency_ms, tokens_per_sec, created_at
+		FROM messages WHERE chat_id = ?`
+	args := []interface{}{newID, id}
+	if afterID > 0 {
+		query += " AND id <= ?"
+		args = append(args, afterID)
+	}
+	result, err = tx.Exec(query+" ORDER BY id", args...)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	copied, _ := result.RowsAffected()
+
+	if err := tx.Commit(); err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	WriteJSON(w, map[string]interface{}{
+		"id":              newID,
+		"title":           title,
+		"messages_copied": copied,
+	})
+}
+
+// splitChat moves a message and everything after it into a new chat that inherits the
+// original's provider, model and system prompt. Summaries are reset so neither chat
+// keeps a summary of messages it no longer has.
+func splitChat(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid chat ID")
+		return
+	}
+
+	var req struct {
+		FromMessageID int64  `json:"from_message_id"`
+		Title         string `json:"title,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.FromMessageID <= 0 {
+		WriteError(w, http.StatusBadRequest, "from_message_id is required")
+		return
+	}
+
+	var title string
+	err = db.QueryRow("SELECT title FROM chats WHERE id = ?", id).Scan(&title)
+	if err == sql.ErrNoRows {
+		WriteError(w, http.StatusNotFound, "Chat not found")
+		return
+	}
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var exists bool
+	db.QueryRow("SELECT EXISTS(SELECT 1 FROM messages WHERE id = ? AND chat_id = ?)", req.FromMessageID, id).Scan(&exists)
+	if !exists {
+		WriteError(w, http.StatusBadRequest, "Message not found in this chat")
+		return
+	}
+
+	req.Title = strings.TrimSpace(req.Title)
+	if req.Title == "" {
+		req.Title = title + " (split)"
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer tx.Rollback()
+
+	// If any moved message was already folded into the summary, the original summary
+	// describes messages that are leaving, so it is rebuilt from scratch
+	var movedSummarized bool
+	if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM messages WHERE chat_id = ? AND id >= ? AND is_summarized = 1)", id, req.FromMessageID).Scan(&movedSummarized); err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO chats (title, provider_name, model_name, system_prompt)
+		SELECT ?, provider_name, model_name, system_prompt FROM chats WHERE id = ?
+	`, req.Title, id)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	newID, err := result.LastInsertId()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	result, err = tx.Exec("UPDATE messages SET chat_id = ?, is_summarized = 0 WHERE chat_id = ? AND id >= ?", newID, id, req.FromMessageID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	moved, _ := result.RowsAffected()
+
+	if movedSummarized {
+		if err := ResetChatSummary(tx, id); err != nil {
+			WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	if _, err := tx.Exec("UPDATE chats SET updated_at = CURRENT_TIMESTAMP WHERE id IN (?, ?)", id, newID); err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	WriteJSON(w, map[string]interface{}{
+		"original_chat_id": id,
+		"new_chat_id":      newID,
+		"title":            req.Title,
+		"messages_moved":   moved,
+	})
+}
+
+// resummarizeChatHandler handles POST /api/chats/{id}/resummarize, discarding the chat's summary
+// and rebuilding it from the current messages in the background
+func resummarizeChatHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid chat ID")
+		return
+	}
+
+	var exists bool
+	if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM chats WHERE id = ?)", id).Scan(&exists); err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !exists {
+		WriteError(w, http.StatusNotFound, "Chat not found")
+		return
+	}
+
+	if err := ResetChatSummary(db, id); err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	go resummarizeChat(context.WithoutCancel(r.Context()), db, id)
+
+	WriteJSON(w, map[string]interface{}{
+		"message": "Summary reset; rebuilding in the background",
+		"chat_id": id,
+	})
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// chatCompletionServer answers OpenAI-format chat completions with reply and keeps the
+// body of every request it receives
+type chatCompletionServer struct {
+	*httptest.Server
+	mu     sync.Mutex
+	bodies []string
+}
+
+func newChatCompletionServer(t *testing.T, reply string) *chatCompletionServer {
+	t.Helper()
+	s := &chatCompletionServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		s.mu.Lock()
+		s.bodies = append(s.bodies, string(body))
+		s.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":      "chatcmpl-test",
+			"object":  "chat.completion",
+			"model":   "gpt-test",
+			"choices": []map[string]interface{}{{"index": 0, "finish_reason": "stop", "message": map[string]string{"role": "assistant", "content": reply}}},
+			"usage":   map[string]int{"prompt_tokens": 10, "completion_tokens": 2, "total_tokens": 12},
+		})
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *chatCompletionServer) requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.bodies...)
+}
+
+func TestRunSendsGlobalAndChatSystemPrompts(t *testing.T) {
+	testDB := newTestDB(t)
+	srv := newChatCompletionServer(t, "Noted.")
+	providerID := newTestProvider(t, testDB, srv.URL)
+	if _, err := testDB.Exec("INSERT INTO models (provider_id, model_name, is_default) VALUES (?, 'gpt-test', 1)", providerID); err != nil {
+		t.Fatal(err)
+	}
+	setTestSetting(t, testDB, "global_system_prompt", "Always cite sources.")
+	// Extraction would run in the background past the end of the test
+	setTestSetting(t, testDB, "memory_enabled", "false")
+	res, err := testDB.Exec("INSERT INTO chats (title, system_prompt) VALUES ('Research', 'You are a librarian.')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	chatID, _ := res.LastInsertId()
+
+	body := `{"input": "Who wrote Dune?", "chat_id": ` + strconv.FormatInt(chatID, 10) + `, "stream": false}`
+	rec := httptest.NewRecorder()
+	run(rec, httptest.NewRequest(http.MethodPost, "/run", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("run: status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	requests := srv.requests()
+	if len(requests) == 0 {
+		t.Fatal("the provider received no request")
+	}
+	var sent struct {
+		Messages []struct {
+			Role    string `json:"role"`
+			Content string `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal([]byte(requests[len(requests)-1]), &sent); err != nil {
+		t.Fatalf("decoding the provider request: %v", err)
+	}
+	if len(sent.Messages) == 0 || sent.Messages[0].Role != "system" {
+		t.Fatalf("messages = %+v, want a leading system message", sent.Messages)
+	}
+	system := sent.Messages[0].Content
+	global, chat := strings.Index(system, "Always cite sources."), strings.Index(system, "You are a librarian.")
+	if global < 0 || chat < 0 || global > chat {
+		t.Errorf("system prompt = %q, want the global prompt followed by the chat's", system)
+	}
+}
+
+func TestWithGlobalSystemPrompt(t *testing.T) {
+	testDB := newTestDB(t)
+	if got := withGlobalSystemPrompt(testDB, "chat prompt"); got != "chat prompt" {
+		t.Errorf("with no global prompt: %q", got)
+	}
+	setTestSetting(t, testDB, "global_system_prompt", "  house rules  ")
+	for chat, want := range map[string]string{
+		"":            "house rules",
+		"   ":         "house rules",
+		"chat prompt": "house rules\n\nchat prompt",
+	} {
+		if got := withGlobalSystemPrompt(testDB, chat); got != want {
+			t.Errorf("withGlobalSystemPrompt(%q) = %q, want %q", chat, got, want)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+
+	"github.com/go-chi/chi"
+)
+
+// uploadChatDocument handles POST /api/chats/{id}/documents with a multipart "file"
+// field. The document's text is chunked and stored for retrieval during generation.
+func uploadChatDocument(w http.ResponseWriter, r *http.Request) {
+	chatID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid chat ID")
+		return
+	}
+
+	var exists bool
+	if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM chats WHERE id = ?)", chatID).Scan(&exists); err != nil || !exists {
+		WriteError(w, http.StatusNotFound, "Chat not found")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxDocumentBytes+1<<20)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			WriteError(w, http.StatusRequestEntityTooLarge, "Document exceeds the 10 MB limit")
+			return
+		}
+		WriteError(w, http.StatusBadRequest, "A document must be uploaded in the \"file\" field")
+		return
+	}
+	defer file.Close()
+
+	if header.Size > maxDocumentBytes {
+		WriteError(w, http.StatusRequestEntityTooLarge, "Document exceeds the 10 MB limit")
+		return
+	}
+
+	filename := filepath.Base(header.Filename)
+	contentType, err := documentContentType(filename, header.Header.Get("Content-Type"))
+	if err != nil {
+		WriteError(w, http.StatusUnsupportedMediaType, err.Error())
+		return
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Failed to read document")
+		return
+	}
+
+	text, err := ExtractDocumentText(contentType, data)
+	if err != nil {
+		WriteError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	doc, err := SaveChatDocument(r.Context(), db, chatID, filename, contentType, int64(len(data)), text)
+	if err != nil {
+		log.Printf("Error saving document: %v", err)
+		WriteError(w, http.StatusInternalServerError, "Failed to save document")
+		return
+	}
+
+	WriteJSON(w, doc)
+}
+
+// getChatDocuments lists the documents attached to a chat
+func getChatDocuments(w http.ResponseWriter, r *http.Request) {
+	chatID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid chat ID")
+		return
+	}
+
+	docs, err := GetChatDocuments(db, chatID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to load documents")
+		return
+	}
+	WriteJSON(w, docs)
+}
+
+// deleteChatDocument removes a document and its chunks from a chat
+func deleteChatDocument(w http.ResponseWriter, r *http.Request) {
+	chatID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid chat ID")
+		return
+	}
+	docID, err := strconv.ParseInt(chi.URLParam(r, "docId"), 10, 64)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid document ID")
+		return
+	}
+
+	result, err := db.Exec("DELETE FROM chat_documents WHERE id = ? AND chat_id = ?", docID, chatID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to delete document")
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		WriteError(w, http.StatusNotFound, "Document not found")
+		return
+	}
+
+	WriteJSON(w, map[string]interface{}{
+		"success": true,
+		"id":      docID,
+	})
+}
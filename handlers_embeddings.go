@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	// embeddingBatchSize is how many inputs are sent to the provider per request
+	embeddingBatchSize = 64
+	// maxEmbeddingInputs caps the inputs accepted in one API call
+	maxEmbeddingInputs = 2048
+)
+
+// embeddingInput accepts either a single string or an array of strings
+type embeddingInput []string
+
+func (e *embeddingInput) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*e = embeddingInput{text}
+		return nil
+	}
+
+	var texts []string
+	if err := json.Unmarshal(data, &texts); err != nil {
+		return fmt.Errorf("input must be a string or an array of strings")
+	}
+	*e = embeddingInput(texts)
+	return nil
+}
+
+type embeddingRequest struct {
+	Input embeddingInput `json:"input"`
+	Model string         `json:"model"`
+}
+
+// embeddingResult holds the vectors for one embeddings call
+type embeddingResult struct {
+	Model        string
+	Vectors      [][]float32
+	PromptTokens int
+}
+
+// errNoEmbeddingModel is returned when neither the request nor the embedding_model
+// setting names a model
+var errNoEmbeddingModel = errors.New("no embedding model: pass model or set the embedding_model setting")
+
+// createEmbeddings embeds the request's inputs with the active provider, sending them in
+// batches of embeddingBatchSize
+func createEmbeddings(ctx context.Context, req embeddingRequest) (*embeddingResult, error) {
+	model := strings.TrimSpace(req.Model)
+	if model == "" {
+		model = GetSetting(db, "embedding_model", "")
+	}
+	if model == "" {
+		return nil, errNoEmbeddingModel
+	}
+
+	provider, err := embeddingProviderForModel(db, model)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &embeddingResult{Model: model, Vectors: make([][]float32, 0, len(req.Input))}
+	for start := 0; start < len(req.Input); start += embeddingBatchSize {
+		end := min(start+embeddingBatchSize, len(req.Input))
+		vectors, tokens, err := provider.EmbedWithUsage(ctx, req.Input[start:end])
+		if err != nil {
+			return nil, err
+		}
+		result.Vectors = append(result.Vectors, vectors...)
+		result.PromptTokens += tokens
+	}
+	return result, nil
+}
+
+// validateEmbeddingRequest checks the input count and that no input is empty
+func validateEmbeddingRequest(req embeddingRequest) error {
+	if len(req.Input) == 0 {
+		return fmt.Errorf("input is required")
+	}
+	if len(req.Input) > maxEmbeddingInputs {
+		return fmt.Errorf("at most %d inputs are allowed per request", maxEmbeddingInputs)
+	}
+	for i, text := range req.Input {
+		if strings.TrimSpace(text) == "" {
+			return fmt.Errorf("input %d is empty", i)
+		}
+	}
+	return nil
+}
+
+// embeddingErrorStatus maps a createEmbeddings error to an HTTP status
+func embeddingErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errNoEmbeddingModel):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrNoActiveProvider):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+// embedTexts handles POST /api/embeddings with {input, model?}
+func embedTexts(w http.ResponseWriter, r *http.Request) {
+	var req embeddingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	if err := validateEmbeddingRequest(req); err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	result, err := createEmbeddings(r.Context(), req)
+	if err != nil {
+		WriteError(w, embeddingErrorStatus(err), "Failed to create embeddings: "+err.Error())
+		return
+	}
+
+	WriteJSON(w, map[string]interface{}{
+		"model":      result.Model,
+		"embeddings": result.Vectors,
+		"usage": map[string]int{
+			"prompt_tokens": result.PromptTokens,
+			"total_tokens":  result.PromptTokens,
+		},
+	})
+}
+
+// compatEmbeddings handles POST /v1/embeddings in the OpenAI response format
+func compatEmbeddings(w http.ResponseWriter, r *http.Request) {
+	var req embeddingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "invalid_body", "Invalid request body: "+err.Error())
+		return
+	}
+	if err := validateEmbeddingRequest(req); err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "invalid_input", err.Error())
+		return
+	}
+
+	result, err := createEmbeddings(r.Context(), req)
+	if err != nil {
+		status, errType := embeddingErrorStatus(err), "server_error"
+		if status == http.StatusBadRequest {
+			errType = "invalid_request_error"
+		}
+		writeOpenAIError(w, status, errType, "embedding_failed", err.Error())
+		return
+	}
+
+	data := make([]map[string]interface{}, len(result.Vectors))
+	for i, v := range result.Vectors {
+		data[i] = map[string]interface{}{
+			"object":    "embedding",
+			"index":     i,
+			"embedding": v,
+		}
+	}
+
+	WriteJSON(w, map[string]interface{}{
+		"object": "list",
+		"data":   data,
+		"model":  result.Model,
+		"usage": map[string]int{
+			"prompt_tokens": result.PromptTokens,
+			"total_tokens":  result.PromptTokens,
+		},
+	})
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+// maxFeedbackCommentLength caps the optional comment stored with a rating
+const maxFeedbackCommentLength = 2000
+
+// MessageFeedback is a thumbs up or down on an assistant message
+type MessageFeedback struct {
+	Rating  string `json:"rating"`
+	Comment string `json:"comment,omitempty"`
+}
+
+// FeedbackExport is one rated response with the prompt it answered, for analysis
+type FeedbackExport struct {
+	MessageID int64  `json:"message_id"`
+	ChatID    int64  `json:"chat_id"`
+	ChatTitle string `json:"chat_title"`
+	Rating    string `json:"rating"`
+	Comment   string `json:"comment,omitempty"`
+	Prompt    string `json:"prompt"`
+	Response  string `json:"response"`
+	ModelName string `json:"model_name,omitempty"`
+	RatedAt   string `json:"rated_at"`
+}
+
+// setMessageFeedback handles POST /api/messages/{id}/feedback with {"rating": "up" or
+// "down", "comment": "..."}. Rating again replaces the earlier feedback.
+func setMessageFeedback(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid message ID")
+		return
+	}
+
+	var req MessageFeedback
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	req.Rating = strings.ToLower(strings.TrimSpace(req.Rating))
+	if req.Rating != "up" && req.Rating != "down" {
+		WriteError(w, http.StatusBadRequest, "rating must be \"up\" or \"down\"")
+		return
+	}
+	req.Comment = strings.TrimSpace(req.Comment)
+	if len(req.Comment) > maxFeedbackCommentLength {
+		WriteError(w, http.StatusBadRequest, "comment is too long")
+		return
+	}
+
+	var role string
+	err = db.QueryRow("SELECT role FROM messages WHERE id = ?", id).Scan(&role)
+	if err == sql.ErrNoRows {
+		WriteError(w, http.StatusNotFound, "Message not found")
+		return
+	}
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if role != "assistant" {
+		WriteError(w, http.StatusBadRequest, "Only assistant messages can be rated")
+		return
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO message_feedback (message_id, rating, comment) VALUES (?, ?, ?)
+		ON CONFLICT(message_id) DO UPDATE SET
+			rating = excluded.rating, comment = excluded.comment, updated_at = CURRENT_TIMESTAMP
+	`, id, req.Rating, req.Comment)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	WriteJSON(w, map[string]interface{}{
+		"message_id": id,
+		"feedback":   req,
+	})
+}
+
+// deleteMessageFeedback handles DELETE /api/messages/{id}/feedback, clearing a rating
+func deleteMessageFeedback(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid message ID")
+		return
+	}
+
+	if _, err := db.Exec("DELETE FROM message_feedback WHERE message_id = ?", id); err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	WriteJSON(w, map[string]string{"message": "Feedback removed"})
+}
+
+// exportFeedback handles GET /api/feedback, listing rated responses with the user
+// message before each, newest first. ?rating=up or ?rating=down filters.
+func exportFeedback(w http.ResponseWriter, r *http.Request) {
+	query := `
+		SELECT f.message_id, m.chat_id, c.title, f.rating, COALESCE(f.comment, ''),
+			COALESCE((SELECT p.content FROM messages p
+				WHERE p.chat_id = m.chat_id AND p.id < m.id AND p.role = 'user'
+				ORDER BY p.id DESC LIMIT 1), ''),
+			m.content, COALESCE(m.model_name, ''), f.updated_at
+		FROM message_feedback f
+		JOIN messages m ON m.id = f.message_id
+		JOIN chats c ON c.id = m.chat_id`
+	var args []interface{}
+	if rating := r.URL.Query().Get("rating"); rating != "" {
+		if rating != "up" && rating != "down" {
+			WriteError(w, http.StatusBadRequest, "rating must be \"up\" or \"down\"")
+			return
+		}
+		query += " WHERE f.rating = ?"
+		args = append(args, rating)
+	}
+	query += " ORDER BY f.updated_at DESC, f.message_id DESC"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	feedback := []FeedbackExport{}
+	for rows.Next() {
+		var f FeedbackExport
+		var ratedAt time.Time
+		if err := rows.Scan(&f.MessageID, &f.ChatID, &f.ChatTitle, &f.Rating, &f.Comment,
+			&f.Prompt, &f.Response, &f.ModelName, &ratedAt); err != nil {
+			log.Println("Error scanning feedback:", err)
+			continue
+		}
+		f.RatedAt = ratedAt.Format(time.RFC3339)
+		feedback = append(feedback, f)
+	}
+
+	WriteJSON(w, feedback)
+}
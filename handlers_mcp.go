@@ -1,16 +1,26 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/contactwajeeh/ollamagoweb-v2/mcp"
 	"github.com/go-chi/chi"
 )
 
+// mcpTestCallTimeout bounds a tool call made from the test-invoke endpoint, connecting
+// to the server included
+const mcpTestCallTimeout = 30 * time.Second
+
 type MCPServerHandler struct {
 	*chi.Mux
 	db *sql.DB
@@ -31,13 +41,19 @@ func (h *MCPServerHandler) initRoutes() {
 	h.Put("/{id}", h.updateServer)
 	h.Delete("/{id}", h.deleteServer)
 	h.Get("/{id}/tools", h.getServerTools)
+	h.Get("/{id}/resources", h.getServerResources)
+	h.Get("/{id}/resources/read", h.readServerResource)
+	h.Get("/{id}/prompts", h.getServerPrompts)
+	h.Post("/{id}/prompts/get", h.getServerPrompt)
+	h.With(AuthMiddleware).Post("/{id}/tools/{name}/call", h.invokeTool)
 	h.Get("/tools", h.getAllTools)
 	h.Post("/call", h.callTool)
 }
 
 func (h *MCPServerHandler) listServers(w http.ResponseWriter, r *http.Request) {
 	rows, err := h.db.Query(`
-		SELECT id, name, server_type, endpoint_url, command, args, env_vars, is_enabled, created_at
+		SELECT id, name, server_type, endpoint_url, command, args, env_vars, is_enabled, created_at,
+			CASE WHEN is_enabled = 0 THEN 'disabled' ELSE COALESCE(status, 'unknown') END, last_checked, last_ok, last_error
 		FROM mcp_servers
 		ORDER BY created_at DESC
 	`)
@@ -51,8 +67,9 @@ func (h *MCPServerHandler) listServers(w http.ResponseWriter, r *http.Request) {
 	var servers []MCPServerResponse
 	for rows.Next() {
 		var s MCPServerResponse
-		var endpointURL, command, args, envVars sql.NullString
-		if err := rows.Scan(&s.ID, &s.Name, &s.ServerType, &endpointURL, &command, &args, &envVars, &s.IsEnabled, &s.CreatedAt); err != nil {
+		var endpointURL, command, args, envVars, lastChecked, lastOK, lastError sql.NullString
+		if err := rows.Scan(&s.ID, &s.Name, &s.ServerType, &endpointURL, &command, &args, &envVars, &s.IsEnabled, &s.CreatedAt,
+			&s.Status, &lastChecked, &lastOK, &lastError); err != nil {
 			log.Println("Error scanning MCP server:", err)
 			continue
 		}
@@ -60,6 +77,9 @@ func (h *MCPServerHandler) listServers(w http.ResponseWriter, r *http.Request) {
 		s.Command = command.String
 		s.Args = args.String
 		s.EnvVars = envVars.String
+		s.LastChecked = lastChecked.String
+		s.LastOK = lastOK.String
+		s.LastError = lastError.String
 		servers = append(servers, s)
 	}
 
@@ -127,9 +147,11 @@ func (h *MCPServerHandler) updateServer(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// The old health no longer applies, and the session may point at the old endpoint
 	_, err = h.db.Exec(`
 		UPDATE mcp_servers
-		SET name = ?, server_type = ?, endpoint_url = ?, command = ?, args = ?, env_vars = ?, is_enabled = ?, updated_at = CURRENT_TIMESTAMP
+		SET name = ?, server_type = ?, endpoint_url = ?, command = ?, args = ?, env_vars = ?, is_enabled = ?, updated_at = CURRENT_TIMESTAMP,
+			status = NULL, last_checked = NULL, last_error = NULL
 		WHERE id = ?
 	`, req.Name, req.ServerType, req.EndpointURL, req.Command, req.Args, req.EnvVars, req.IsEnabled, id)
 	if err != nil {
@@ -137,6 +159,7 @@ func (h *MCPServerHandler) updateServer(w http.ResponseWriter, r *http.Request)
 		http.Error(w, "Failed to update server", http.StatusInternalServerError)
 		return
 	}
+	mcp.GetMCPClient().DisconnectServer(id)
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]interface{}{"id": id})
@@ -239,6 +262,181 @@ func (h *MCPServerHandler) getAllTools(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// connectedServer loads the enabled server named by the {id} URL parameter and opens its
+// session, writing the error response itself when it cannot
+func (h *MCPServerHandler) connectedServer(w http.ResponseWriter, r *http.Request) (*mcp.MCPServer, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid server ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	var server mcp.MCPServer
+	var endpointURL, command, args, envVars sql.NullString
+	err = h.db.QueryRow(`
+		SELECT id, name, server_type, endpoint_url, command, args, env_vars, is_enabled
+		FROM mcp_servers WHERE id = ?
+	`, id).Scan(&server.ID, &server.Name, &server.ServerType, &endpointURL, &command, &args, &envVars, &server.IsEnabled)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		log.Println("Error fetching server:", err)
+		http.Error(w, "Failed to fetch server", http.StatusInternalServerError)
+		return nil, false
+	}
+	server.EndpointURL = endpointURL.String
+	server.Command = command.String
+	server.Args = args.String
+	server.EnvVars = envVars.String
+
+	if !server.IsEnabled {
+		http.Error(w, "Server is disabled", http.StatusBadRequest)
+		return nil, false
+	}
+	if err := mcp.GetMCPClient().ConnectServer(r.Context(), &server); err != nil {
+		http.Error(w, "Failed to connect to server: "+err.Error(), http.StatusBadGateway)
+		return nil, false
+	}
+	return &server, true
+}
+
+// getServerResources lists the resources a server exposes, which can be read and
+// attached as context
+func (h *MCPServerHandler) getServerResources(w http.ResponseWriter, r *http.Request) {
+	server, ok := h.connectedServer(w, r)
+	if !ok {
+		return
+	}
+	resources, err := mcp.GetMCPClient().ListResources(r.Context(), server.ID)
+	if err != nil {
+		log.Printf("Error listing resources of MCP server %s: %v", server.Name, err)
+		http.Error(w, "Failed to list resources: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"resources": resources,
+		"count":     len(resources),
+	})
+}
+
+// readServerResource returns the contents of the resource given by ?uri=
+func (h *MCPServerHandler) readServerResource(w http.ResponseWriter, r *http.Request) {
+	uri := r.URL.Query().Get("uri")
+	if uri == "" {
+		http.Error(w, "uri is required", http.StatusBadRequest)
+		return
+	}
+	server, ok := h.connectedServer(w, r)
+	if !ok {
+		return
+	}
+	contents, err := mcp.GetMCPClient().ReadResource(r.Context(), server.ID, uri)
+	if err != nil {
+		log.Printf("Error reading resource %s of MCP server %s: %v", uri, server.Name, err)
+		http.Error(w, "Failed to read resource: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"uri":      uri,
+		"contents": contents,
+	})
+}
+
+// getServerPrompts lists the prompt templates a server offers
+func (h *MCPServerHandler) getServerPrompts(w http.ResponseWriter, r *http.Request) {
+	server, ok := h.connectedServer(w, r)
+	if !ok {
+		return
+	}
+	prompts, err := mcp.GetMCPClient().ListPrompts(r.Context(), server.ID)
+	if err != nil {
+		log.Printf("Error listing prompts of MCP server %s: %v", server.Name, err)
+		http.Error(w, "Failed to list prompts: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"prompts": prompts,
+		"count":   len(prompts),
+	})
+}
+
+type GetPromptRequest struct {
+	Name      string            `json:"name"`
+	Arguments map[string]string `json:"arguments,omitempty"`
+}
+
+// getServerPrompt renders one of a server's prompts. text joins its messages, ready to
+// be used as a chat's system prompt.
+func (h *MCPServerHandler) getServerPrompt(w http.ResponseWriter, r *http.Request) {
+	var req GetPromptRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Name == "" {
+		http.Error(w, "Prompt name is required", http.StatusBadRequest)
+		return
+	}
+	server, ok := h.connectedServer(w, r)
+	if !ok {
+		return
+	}
+	description, messages, err := mcp.GetMCPClient().GetPrompt(r.Context(), server.ID, req.Name, req.Arguments)
+	if err != nil {
+		log.Printf("Error getting prompt %s of MCP server %s: %v", req.Name, server.Name, err)
+		http.Error(w, "Failed to get prompt: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	texts := make([]string, len(messages))
+	for i, m := range messages {
+		texts[i] = m.Text
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"name":        req.Name,
+		"description": description,
+		"messages":    messages,
+		"text":        strings.Join(texts, "\n\n"),
+	})
+}
+
+// resolveToolName maps a name from the tool list, prefixed and possibly numbered, or the
+// server's own name for a tool to the name the server knows it by. A name matching
+// neither is passed on as is, so the server reports the unknown tool itself.
+func (h *MCPServerHandler) resolveToolName(ctx context.Context, server *mcp.MCPServer, name string) string {
+	servers, err := enabledMCPServers(h.db)
+	if err != nil {
+		log.Printf("Error loading MCP servers to resolve tool %s: %v", name, err)
+		return name
+	}
+	tools, err := mcp.GetMCPClient().GetAllEnabledTools(ctx, servers)
+	if err != nil {
+		log.Printf("Error listing MCP tools to resolve tool %s: %v", name, err)
+		return name
+	}
+
+	for _, tool := range tools {
+		if tool.ServerID == server.ID && tool.Name == name {
+			return tool.ToolName
+		}
+	}
+	for _, tool := range tools {
+		if tool.ServerID == server.ID && tool.ToolName == name {
+			return tool.ToolName
+		}
+	}
+	return name
+}
+
 type CallToolRequest struct {
 	ServerID  int64                  `json:"server_id"`
 	ToolName  string                 `json:"tool_name"`
@@ -283,7 +481,8 @@ func (h *MCPServerHandler) callTool(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ctx := r.Context()
-	result, err := mcp.GetMCPClient().CallTool(ctx, server.ID, req.ToolName, req.Arguments)
+	toolName := h.resolveToolName(ctx, &server, req.ToolName)
+	result, err := mcp.GetMCPClient().CallTool(ctx, server.ID, toolName, req.Arguments)
 	if err != nil {
 		log.Println("Error calling tool:", err)
 		http.Error(w, "Failed to call tool: "+err.Error(), http.StatusInternalServerError)
@@ -318,4 +517,64 @@ type MCPServerResponse struct {
 	EnvVars     string `json:"env_vars,omitempty"`
 	IsEnabled   bool   `json:"is_enabled"`
 	CreatedAt   string `json:"created_at,omitempty"`
+
+	// Status is ok, error, unknown (not checked yet) or disabled
+	Status      string `json:"status"`
+	LastChecked string `json:"last_checked,omitempty"`
+	LastOK      string `json:"last_ok,omitempty"`
+	LastError   string `json:"last_error,omitempty"`
+}
+
+type InvokeToolRequest struct {
+	Arguments map[string]interface{} `json:"arguments"`
+}
+
+// invokeTool calls one tool of a server with test arguments, for checking a tool by hand
+// before the model uses it. {name} is the name from the tool list or the server's own
+// name for the tool. A failed call answers 502 with the error, or 504 on timeout.
+func (h *MCPServerHandler) invokeTool(w http.ResponseWriter, r *http.Request) {
+	toolName, err := url.PathUnescape(chi.URLParam(r, "name"))
+	if err != nil || toolName == "" {
+		http.Error(w, "Invalid tool name", http.StatusBadRequest)
+		return
+	}
+
+	var req InvokeToolRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Arguments == nil {
+		req.Arguments = map[string]interface{}{}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), mcpTestCallTimeout)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	server, ok := h.connectedServer(w, r)
+	if !ok {
+		return
+	}
+	toolName = h.resolveToolName(ctx, server, toolName)
+
+	start := time.Now()
+	result, err := mcp.GetMCPClient().CallTool(ctx, server.ID, toolName, req.Arguments)
+	if err != nil {
+		log.Printf("Error test-invoking tool %s of MCP server %s: %v", toolName, server.Name, err)
+		if errors.Is(err, context.DeadlineExceeded) {
+			http.Error(w, "Tool call timed out after "+mcpTestCallTimeout.String(), http.StatusGatewayTimeout)
+			return
+		}
+		http.Error(w, "Tool call failed: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"result":      string(result),
+		"tool":        toolName,
+		"server":      server.Name,
+		"duration_ms": time.Since(start).Milliseconds(),
+	})
 }
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/contactwajeeh/ollamagoweb-v2/mcp"
+)
+
+// toolCall is what a mock MCP server was last asked to run
+type toolCall struct {
+	Name      string
+	Arguments map[string]interface{}
+}
+
+// newToolServer starts a mock MCP server offering the named tools. It records the last
+// tools/call it gets and answers it with "42 results".
+func newToolServer(t *testing.T, tools ...string) (*httptest.Server, *toolCall) {
+	t.Helper()
+	called := &toolCall{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     string `json:"id"`
+			Method string `json:"method"`
+			Params struct {
+				Name      string                 `json:"name"`
+				Arguments map[string]interface{} `json:"arguments"`
+			} `json:"params"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+
+		var result interface{}
+		switch req.Method {
+		case "tools/list":
+			list := make([]map[string]interface{}, len(tools))
+			for i, name := range tools {
+				list[i] = map[string]interface{}{"name": name}
+			}
+			result = map[string]interface{}{"tools": list}
+		case "tools/call":
+			called.Name, called.Arguments = req.Params.Name, req.Params.Arguments
+			result = map[string]interface{}{"content": []map[string]string{{"type": "text", "text": "42 results"}}}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": result})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, called
+}
+
+func addTestMCPServer(t *testing.T, testDB *sql.DB, name, endpoint string) int64 {
+	t.Helper()
+	res, err := testDB.Exec("INSERT INTO mcp_servers (name, server_type, endpoint_url) VALUES (?, 'http', ?)", name, endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := res.LastInsertId()
+	return id
+}
+
+func invokeTestTool(t *testing.T, handler http.Handler, serverID int64, name string) (result, tool string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/"+strconv.FormatInt(serverID, 10)+"/tools/"+name+"/call",
+		strings.NewReader(`{"arguments": {"query": "sqlite"}}`))
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("%s: status %d: %s", name, rec.Code, rec.Body.String())
+	}
+	var out struct {
+		Result string `json:"result"`
+		Tool   string `json:"tool"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	return out.Result, out.Tool
+}
+
+func TestInvokeToolCallsTheServersOwnToolName(t *testing.T) {
+	testDB := newTestDB(t)
+	mcp.InitMCPClient()
+	srv, called := newToolServer(t, "search", "git_log")
+	id := addTestMCPServer(t, testDB, "Git", srv.URL)
+	handler := NewMCPServerHandler(testDB)
+
+	// The name from the tool list is accepted as well as the server's own, and a tool
+	// whose own name starts like the prefix is not cut short
+	for name, want := range map[string]string{
+		"search":         "search",
+		"git_search":     "search",
+		"git_log":        "git_log",
+		"git_git_log":    "git_log",
+		"not_a_list_one": "not_a_list_one",
+	} {
+		result, tool := invokeTestTool(t, handler, id, name)
+		if result != "42 results" || tool != want {
+			t.Errorf("%s: result %q, tool %q, want tool %q", name, result, tool, want)
+		}
+		if called.Name != want || called.Arguments["query"] != "sqlite" {
+			t.Errorf("%s: server got tool %q with %v, want %q", name, called.Name, called.Arguments, want)
+		}
+	}
+}
+
+func TestInvokeToolResolvesNumberedNamesOfCollidingServers(t *testing.T) {
+	testDB := newTestDB(t)
+	mcp.InitMCPClient()
+	firstSrv, first := newToolServer(t, "search")
+	secondSrv, second := newToolServer(t, "search")
+	firstID := addTestMCPServer(t, testDB, "Docs", firstSrv.URL)
+	secondID := addTestMCPServer(t, testDB, "docs", secondSrv.URL)
+	handler := NewMCPServerHandler(testDB)
+
+	// Both servers list docs_search; the later one's is docs_search_2
+	if _, tool := invokeTestTool(t, handler, secondID, "docs_search_2"); tool != "search" || second.Name != "search" {
+		t.Errorf("docs_search_2 ran %q on the second server (response tool %q)", second.Name, tool)
+	}
+	if _, tool := invokeTestTool(t, handler, firstID, "docs_search"); tool != "search" || first.Name != "search" {
+		t.Errorf("docs_search ran %q on the first server (response tool %q)", first.Name, tool)
+	}
+}
+
+func TestCallToolResolvesTheListedName(t *testing.T) {
+	testDB := newTestDB(t)
+	mcp.InitMCPClient()
+	srv, called := newToolServer(t, "git_log")
+	id := addTestMCPServer(t, testDB, "Git", srv.URL)
+	// /call scans these columns as plain strings
+	if _, err := testDB.Exec("UPDATE mcp_servers SET command = '', args = '', env_vars = '' WHERE id = ?", id); err != nil {
+		t.Fatal(err)
+	}
+	handler := NewMCPServerHandler(testDB)
+
+	rec := httptest.NewRecorder()
+	body := `{"server_id": ` + strconv.FormatInt(id, 10) + `, "tool_name": "git_git_log", "arguments": {}}`
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/call", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+	if called.Name != "git_log" {
+		t.Errorf("server got tool %q, want git_log", called.Name)
+	}
+}
+
+func TestInvokeToolReportsUnknownAndDisabledServers(t *testing.T) {
+	testDB := newTestDB(t)
+	mcp.InitMCPClient()
+	res, err := testDB.Exec("INSERT INTO mcp_servers (name, server_type, endpoint_url, is_enabled) VALUES ('Off', 'http', 'http://127.0.0.1:1', 0)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	disabled, _ := res.LastInsertId()
+	handler := NewMCPServerHandler(testDB)
+
+	for path, want := range map[string]int{
+		"/999/tools/search/call": http.StatusNotFound,
+		"/" + strconv.FormatInt(disabled, 10) + "/tools/search/call": http.StatusBadRequest,
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, nil))
+		if rec.Code != want {
+			t.Errorf("%s: status %d, want %d", path, rec.Code, want)
+		}
+	}
+}
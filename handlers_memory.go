@@ -1,8 +1,12 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 func getMemories(w http.ResponseWriter, r *http.Request) {
@@ -23,12 +27,25 @@ func getMemories(w http.ResponseWriter, r *http.Request) {
 		sessionID = "default"
 	}
 
+	var filter MemoryFilter
+	if category := r.URL.Query().Get("category"); category != "" {
+		filter.Categories = []string{category}
+	}
+	if minConfidence := r.URL.Query().Get("min_confidence"); minConfidence != "" {
+		v, err := strconv.Atoi(minConfidence)
+		if err != nil || v < 0 || v > 100 {
+			WriteError(w, http.StatusBadRequest, "min_confidence must be a number between 0 and 100")
+			return
+		}
+		filter.MinConfidence = v
+	}
+
 	memories, err := GetMemories(db, sessionID)
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	WriteJSON(w, memories)
+	WriteJSON(w, FilterMemories(memories, filter))
 }
 
 func setMemory(w http.ResponseWriter, r *http.Request) {
@@ -54,6 +71,7 @@ func setMemory(w http.ResponseWriter, r *http.Request) {
 		Value      string `json:"value"`
 		Category   string `json:"category"`
 		Confidence int    `json:"confidence"`
+		ExpiresAt  string `json:"expires_at,omitempty"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		WriteError(w, http.StatusBadRequest, "Invalid request")
@@ -72,7 +90,17 @@ func setMemory(w http.ResponseWriter, r *http.Request) {
 		req.Confidence = 80
 	}
 
-	if err := SetMemory(db, sessionID, req.Key, req.Value, req.Category, req.Confidence); err != nil {
+	var expiresAt *time.Time
+	if req.ExpiresAt != "" {
+		t, err := time.Parse(time.RFC3339, req.ExpiresAt)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, "expires_at must be an RFC 3339 timestamp")
+			return
+		}
+		expiresAt = &t
+	}
+
+	if err := SetMemory(db, sessionID, req.Key, req.Value, req.Category, req.Confidence, expiresAt); err != nil {
 		WriteError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -187,7 +215,7 @@ func testMemoryExtraction(w http.ResponseWriter, r *http.Request) {
 
 	provider, _, err := GetActiveProvider(db)
 	if err != nil {
-		WriteError(w, http.StatusServiceUnavailable, "No active provider configured")
+		writeActiveProviderError(w, err)
 		return
 	}
 
@@ -198,3 +226,214 @@ func testMemoryExtraction(w http.ResponseWriter, r *http.Request) {
 		"input":   req.Message,
 	})
 }
+
+// previewMemoryExtraction handles POST /api/memories/extract-preview, returning the
+// memories extraction would store for {message} without storing them
+func previewMemoryExtraction(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Message string `json:"message"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.Message == "" {
+		WriteError(w, http.StatusBadRequest, "Message is required")
+		return
+	}
+
+	provider, _, err := GetActiveProvider(db)
+	if err != nil {
+		writeActiveProviderError(w, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Minute)
+	defer cancel()
+
+	extracted, err := ExtractMemories(ctx, provider, req.Message)
+	if err != nil {
+		WriteError(w, generationErrorStatus(w, err), "Extraction failed: "+err.Error())
+		return
+	}
+	if extracted == nil {
+		extracted = []ExtractedMemory{}
+	}
+
+	WriteJSON(w, map[string]interface{}{
+		"input":    req.Message,
+		"memories": extracted,
+	})
+}
+
+func dedupeMemories(w http.ResponseWriter, r *http.Request) {
+	sessionID := getSessionIDFromRequest(r)
+
+	removed, err := DedupeMemories(db, sessionID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	removedKeys := make([]string, 0, len(removed))
+	for _, m := range removed {
+		removedKeys = append(removedKeys, m.Key)
+	}
+
+	WriteJSON(w, map[string]interface{}{
+		"message": fmt.Sprintf("Removed %d duplicate memories", len(removed)),
+		"removed": removedKeys,
+	})
+}
+
+// memorySessionID returns the session whose memories a request addresses: the session
+// cookie when auth is enabled, "default" otherwise. It writes 401 and returns false when
+// auth is enabled and there is no session.
+func memorySessionID(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if !authEnabled {
+		return "default", true
+	}
+	sessionCookie, err := r.Cookie("session_id")
+	if err != nil {
+		http.Error(w, `{"error": true, "message": "Authentication required"}`, http.StatusUnauthorized)
+		return "", false
+	}
+	return sessionCookie.Value, true
+}
+
+// MemoryExport is the file format of GET /api/memories/export and POST /api/memories/import
+type MemoryExport struct {
+	Version    int              `json:"version"`
+	ExportedAt string           `json:"exported_at"`
+	Memories   []ExportedMemory `json:"memories"`
+}
+
+// ExportedMemory is one memory in an export, without session or row ids
+type ExportedMemory struct {
+	Key        string `json:"key"`
+	Value      string `json:"value"`
+	Category   string `json:"category"`
+	Confidence int    `json:"confidence"`
+	ExpiresAt  string `json:"expires_at,omitempty"`
+}
+
+// exportMemories handles GET /api/memories/export, downloading the session's unexpired
+// memories
+func exportMemories(w http.ResponseWriter, r *http.Request) {
+	sessionID, ok := memorySessionID(w, r)
+	if !ok {
+		return
+	}
+
+	memories, err := GetMemories(db, sessionID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	export := MemoryExport{
+		Version:    1,
+		ExportedAt: time.Now().Format(time.RFC3339),
+		Memories:   make([]ExportedMemory, 0, len(memories)),
+	}
+	for _, m := range memories {
+		export.Memories = append(export.Memories, ExportedMemory{
+			Key:        m.Key,
+			Value:      m.Value,
+			Category:   m.Category,
+			Confidence: m.Confidence,
+			ExpiresAt:  m.ExpiresAt,
+		})
+	}
+
+	w.Header().Set("Content-Disposition", "attachment; filename=ollamagoweb-memories.json")
+	WriteJSON(w, export)
+}
+
+// importMemories handles POST /api/memories/import with a memory export, upserting every
+// valid entry into the session in one transaction. Existing keys take the imported
+// value, confidence and expiry; invalid or already expired entries are skipped.
+func importMemories(w http.ResponseWriter, r *http.Request) {
+	sessionID, ok := memorySessionID(w, r)
+	if !ok {
+		return
+	}
+
+	var export MemoryExport
+	if err := json.NewDecoder(r.Body).Decode(&export); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid memory export format")
+		return
+	}
+	if export.Version != 1 {
+		WriteError(w, http.StatusBadRequest, "Unsupported memory export version")
+		return
+	}
+
+	type skippedMemory struct {
+		Key    string `json:"key"`
+		Reason string `json:"reason"`
+	}
+	skipped := []skippedMemory{}
+	var imported []ExportedMemory
+
+	tx, err := db.Begin()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer tx.Rollback()
+
+	for _, m := range export.Memories {
+		if m.Key == "" || m.Value == "" {
+			skipped = append(skipped, skippedMemory{m.Key, "key and value are required"})
+			continue
+		}
+		if m.Confidence < 0 || m.Confidence > 100 {
+			skipped = append(skipped, skippedMemory{m.Key, "confidence must be between 0 and 100"})
+			continue
+		}
+		if m.Category == "" {
+			m.Category = "preference"
+		}
+		if m.Confidence == 0 {
+			m.Confidence = 80
+		}
+
+		var expiresAt *time.Time
+		if m.ExpiresAt != "" {
+			t, err := time.Parse(time.RFC3339, m.ExpiresAt)
+			if err != nil {
+				skipped = append(skipped, skippedMemory{m.Key, "expires_at must be an RFC 3339 timestamp"})
+				continue
+			}
+			if !t.After(time.Now()) {
+				skipped = append(skipped, skippedMemory{m.Key, "already expired"})
+				continue
+			}
+			expiresAt = &t
+		}
+
+		if err := upsertMemory(tx, sessionID, m.Key, m.Value, m.Category, m.Confidence, expiresAt); err != nil {
+			WriteError(w, http.StatusInternalServerError, "Failed to import memory "+m.Key+": "+err.Error())
+			return
+		}
+		imported = append(imported, m)
+	}
+
+	if err := tx.Commit(); err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Embeddings are computed in the background, batched across the imported memories
+	for _, m := range imported {
+		QueueMemoryEmbedding(db, sessionID, m.Key)
+	}
+
+	WriteJSON(w, map[string]interface{}{
+		"imported": len(imported),
+		"skipped":  skipped,
+	})
+}
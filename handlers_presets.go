@@ -0,0 +1,220 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi"
+)
+
+type PromptPreset struct {
+	ID        int64  `json:"id"`
+	Name      string `json:"name"`
+	Content   string `json:"content"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+type promptPresetRequest struct {
+	Name    string `json:"name"`
+	Content string `json:"content"`
+}
+
+// validate trims the request and checks it against the system prompt length limit
+func (req *promptPresetRequest) validate() string {
+	req.Name = strings.TrimSpace(req.Name)
+	req.Content = strings.TrimSpace(req.Content)
+
+	if req.Name == "" || req.Content == "" {
+		return "Name and content are required"
+	}
+	if max := getMaxSystemPromptLength(db); utf8.RuneCountInString(req.Content) > max {
+		return fmt.Sprintf("Preset content is too long (max %d characters)", max)
+	}
+	return ""
+}
+
+// isUniqueViolation reports whether err is SQLite's UNIQUE constraint failure
+func isUniqueViolation(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
+
+func getPromptPreset(id int64) (*PromptPreset, error) {
+	var p PromptPreset
+	var createdAt, updatedAt time.Time
+	err := db.QueryRow("SELECT id, name, content, created_at, updated_at FROM prompt_presets WHERE id = ?", id).
+		Scan(&p.ID, &p.Name, &p.Content, &createdAt, &updatedAt)
+	if err != nil {
+		return nil, err
+	}
+	p.CreatedAt = createdAt.Format(time.RFC3339)
+	p.UpdatedAt = updatedAt.Format(time.RFC3339)
+	return &p, nil
+}
+
+func getPromptPresets(w http.ResponseWriter, r *http.Request) {
+	rows, err := db.Query("SELECT id, name, content, created_at, updated_at FROM prompt_presets ORDER BY name COLLATE NOCASE")
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	presets := []PromptPreset{}
+	for rows.Next() {
+		var p PromptPreset
+		var createdAt, updatedAt time.Time
+		if err := rows.Scan(&p.ID, &p.Name, &p.Content, &createdAt, &updatedAt); err != nil {
+			continue
+		}
+		p.CreatedAt = createdAt.Format(time.RFC3339)
+		p.UpdatedAt = updatedAt.Format(time.RFC3339)
+		presets = append(presets, p)
+	}
+
+	WriteJSON(w, presets)
+}
+
+func createPromptPreset(w http.ResponseWriter, r *http.Request) {
+	var req promptPresetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		WriteError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	result, err := db.Exec("INSERT INTO prompt_presets (name, content) VALUES (?, ?)", req.Name, req.Content)
+	if isUniqueViolation(err) {
+		WriteError(w, http.StatusConflict, "A preset with this name already exists")
+		return
+	}
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	id, _ := result.LastInsertId()
+	preset, err := getPromptPreset(id)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	WriteJSON(w, preset)
+}
+
+func updatePromptPreset(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid preset ID")
+		return
+	}
+
+	var req promptPresetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		WriteError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	result, err := db.Exec("UPDATE prompt_presets SET name = ?, content = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", req.Name, req.Content, id)
+	if isUniqueViolation(err) {
+		WriteError(w, http.StatusConflict, "A preset with this name already exists")
+		return
+	}
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		WriteError(w, http.StatusNotFound, "Preset not found")
+		return
+	}
+
+	preset, err := getPromptPreset(id)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	WriteJSON(w, preset)
+}
+
+func deletePromptPreset(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid preset ID")
+		return
+	}
+
+	result, err := db.Exec("DELETE FROM prompt_presets WHERE id = ?", id)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		WriteError(w, http.StatusNotFound, "Preset not found")
+		return
+	}
+
+	WriteJSON(w, map[string]string{"message": "Preset deleted"})
+}
+
+// applyPresetToChat copies a preset's content into a chat's system prompt
+func applyPresetToChat(chatID, presetID int64) (string, error) {
+	preset, err := getPromptPreset(presetID)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = db.Exec("UPDATE chats SET system_prompt = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", preset.Content, chatID)
+	return preset.Content, err
+}
+
+func applyPromptPreset(w http.ResponseWriter, r *http.Request) {
+	chatID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid chat ID")
+		return
+	}
+
+	var req struct {
+		PresetID int64 `json:"preset_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	var exists int
+	if err := db.QueryRow("SELECT 1 FROM chats WHERE id = ?", chatID).Scan(&exists); err == sql.ErrNoRows {
+		WriteError(w, http.StatusNotFound, "Chat not found")
+		return
+	}
+
+	systemPrompt, err := applyPresetToChat(chatID, req.PresetID)
+	if err == sql.ErrNoRows {
+		WriteError(w, http.StatusNotFound, "Preset not found")
+		return
+	}
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	WriteJSON(w, map[string]string{
+		"message":       "Preset applied",
+		"system_prompt": systemPrompt,
+	})
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// serveAPI sends one request to the versioned API and returns the recorded response
+func serveAPI(t *testing.T, api http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, apiV1Prefix+path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestProviderHandlersReturn404ForUnknownID(t *testing.T) {
+	testDB := newTestDB(t)
+	newTestProvider(t, testDB, "https://api.example.com/v1")
+	api := newTestAPI()
+
+	for _, tc := range []struct {
+		method, path, body string
+	}{
+		{http.MethodPut, "/providers/999", `{"name": "renamed"}`},
+		{http.MethodPut, "/providers/999", `{"base_url": "https://api.example.com/v2"}`},
+		{http.MethodDelete, "/providers/999", ""},
+		{http.MethodPost, "/providers/999/activate", ""},
+	} {
+		rec := serveAPI(t, api, tc.method, tc.path, tc.body)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s %s %s: status %d, want 404: %s", tc.method, tc.path, tc.body, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestProviderHandlersSucceedForExistingID(t *testing.T) {
+	testDB := newTestDB(t)
+	first := newTestProvider(t, testDB, "https://api.example.com/v1")
+	second := newTestProvider(t, testDB, "https://api.example.com/v1")
+	if _, err := testDB.Exec("INSERT INTO models (provider_id, model_name, is_default) VALUES (?, 'gpt-test', 1)", second); err != nil {
+		t.Fatal(err)
+	}
+	api := newTestAPI()
+
+	if rec := serveAPI(t, api, http.MethodPut, "/providers/"+strconv.FormatInt(first, 10), `{"name": "renamed"}`); rec.Code != http.StatusOK {
+		t.Errorf("update: status %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := serveAPI(t, api, http.MethodPost, "/providers/"+strconv.FormatInt(second, 10)+"/activate", ""); rec.Code != http.StatusOK {
+		t.Errorf("activate: status %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := serveAPI(t, api, http.MethodDelete, "/providers/"+strconv.FormatInt(first, 10), ""); rec.Code != http.StatusOK {
+		t.Errorf("delete: status %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestProviderResponsesNeverContainTheAPIKey(t *testing.T) {
+	newTestDB(t)
+	api := newTestAPI()
+	const secret = "sk-test-secret-0123456789"
+
+	rec := serveAPI(t, api, http.MethodPost, "/providers",
+		`{"name": "Remote", "type": "openai_compatible", "base_url": "https://api.example.com/v1", "api_key": "`+secret+`", "models": ["gpt-test"]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("create: status %d: %s", rec.Code, rec.Body.String())
+	}
+	var created struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	id := strconv.FormatInt(created.ID, 10)
+
+	responses := []*httptest.ResponseRecorder{rec}
+	for _, path := range []string{"/providers", "/providers/" + id, "/settings"} {
+		responses = append(responses, serveAPI(t, api, http.MethodGet, path, ""))
+	}
+	responses = append(responses,
+		serveAPI(t, api, http.MethodPut, "/providers/"+id, `{"api_key": "`+apiKeyMask+`6789"}`),
+		serveAPI(t, api, http.MethodPost, "/providers/"+id+"/activate", ""),
+		serveAPI(t, api, http.MethodGet, "/providers/"+id, ""))
+	for _, rec := range responses {
+		if strings.Contains(rec.Body.String(), secret) {
+			t.Errorf("response leaks the API key: %s", rec.Body.String())
+		}
+	}
+
+	var provider ProviderResponse
+	if err := json.Unmarshal(responses[len(responses)-1].Body.Bytes(), &provider); err != nil {
+		t.Fatal(err)
+	}
+	if !provider.HasAPIKey || provider.APIKeyHint != apiKeyMask+"6789" {
+		t.Errorf("has_api_key = %v, api_key_hint = %q; want the stored key kept and hinted", provider.HasAPIKey, provider.APIKeyHint)
+	}
+
+	serveAPI(t, api, http.MethodPut, "/providers/"+id, `{"api_key": "`+apiKeyClearSentinel+`"}`)
+	provider = ProviderResponse{}
+	json.Unmarshal(serveAPI(t, api, http.MethodGet, "/providers/"+id, "").Body.Bytes(), &provider)
+	if provider.HasAPIKey || provider.APIKeyHint != "" {
+		t.Errorf("after clearing: has_api_key = %v, api_key_hint = %q", provider.HasAPIKey, provider.APIKeyHint)
+	}
+}
+
+func TestMigrateAPIKeyHintsBackfillsExistingKeys(t *testing.T) {
+	testDB := newTestDB(t)
+	encrypted, err := Encrypt("sk-old-key-abcdefgh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testDB.Exec("INSERT INTO providers (name, type, base_url, api_key) VALUES ('old', 'openai_compatible', 'https://api.example.com', ?)", encrypted); err != nil {
+		t.Fatal(err)
+	}
+
+	migrateAPIKeyHints(testDB)
+	var hint string
+	if err := testDB.QueryRow("SELECT api_key_hint FROM providers WHERE name = 'old'").Scan(&hint); err != nil {
+		t.Fatal(err)
+	}
+	if hint != apiKeyMask+"efgh" {
+		t.Errorf("api_key_hint = %q, want %q", hint, apiKeyMask+"efgh")
+	}
+}
+
+// countingDriver wraps the sqlite driver and counts the statements prepared on its
+// connections. Its connections do not expose the driver's direct query interfaces, so
+// database/sql prepares every statement it runs.
+type countingDriver struct {
+	driver.Driver
+	statements *atomic.Int32
+}
+
+func (d countingDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return countingConn{conn, d.statements}, nil
+}
+
+type countingConn struct {
+	driver.Conn
+	statements *atomic.Int32
+}
+
+func (c countingConn) Prepare(query string) (driver.Stmt, error) {
+	c.statements.Add(1)
+	return c.Conn.Prepare(query)
+}
+
+// newCountingTestDB is newTestDB with a count of the statements run after migrating
+func newCountingTestDB(t *testing.T) *atomic.Int32 {
+	t.Helper()
+	sqliteDriver := newTestDB(t).Driver()
+	statements := &atomic.Int32{}
+	connector := countingConnector{countingDriver{sqliteDriver, statements}, filepath.Join(t.TempDir(), "counted.db")}
+	counted := sql.OpenDB(connector)
+	counted.SetMaxOpenConns(1)
+	RunMigrations(counted)
+
+	old := db
+	db = counted
+	t.Cleanup(func() {
+		db = old
+		counted.Close()
+	})
+	statements.Store(0)
+	return statements
+}
+
+type countingConnector struct {
+	driver countingDriver
+	name   string
+}
+
+func (c countingConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.name)
+}
+func (c countingConnector) Driver() driver.Driver { return c.driver }
+
+func TestGetProvidersQueryCountDoesNotGrowWithProviders(t *testing.T) {
+	statementsFor := func(providers int) int32 {
+		statements := newCountingTestDB(t)
+		for i := 0; i < providers; i++ {
+			id := newTestProvider(t, db, "https://api.example.com/v1")
+			for _, model := range []string{"model-a", "model-b"} {
+				if _, err := db.Exec("INSERT INTO models (provider_id, model_name) VALUES (?, ?)", id, model); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+
+		statements.Store(0)
+		rec := httptest.NewRecorder()
+		getProviders(rec, httptest.NewRequest(http.MethodGet, "/providers", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+		}
+		var listed []ProviderResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &listed); err != nil {
+			t.Fatal(err)
+		}
+		if len(listed) != providers {
+			t.Fatalf("listed %d providers, want %d", len(listed), providers)
+		}
+		for _, p := range listed {
+			if len(p.Models) != 2 {
+				t.Errorf("provider %d has %d models, want 2", p.ID, len(p.Models))
+			}
+		}
+		return statements.Load()
+	}
+
+	one, many := statementsFor(1), statementsFor(6)
+	if one != many {
+		t.Errorf("statements for 1 provider = %d, for 6 = %d; want the same", one, many)
+	}
+	// The total count and the joined providers-and-models query
+	if many != 2 {
+		t.Errorf("statements = %d, want 2", many)
+	}
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/contactwajeeh/ollamagoweb-v2/mcp"
+	"github.com/go-chi/chi"
+)
+
+const (
+	// httpToolServerID marks HTTP tools in Tool.ServerID, as -1 marks skills
+	httpToolServerID = -2
+	// httpToolTimeout bounds one call to an HTTP tool's endpoint
+	httpToolTimeout = 30 * time.Second
+	// httpToolMaxBytes caps how much of an endpoint's response becomes the tool result
+	httpToolMaxBytes = 64 * 1024
+)
+
+// httpToolName is the pattern tool names must match for providers to accept them
+var httpToolName = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+var httpToolClient = &http.Client{
+	Timeout:       httpToolTimeout,
+	Transport:     guardedTransport,
+	CheckRedirect: checkHTTPToolRedirect,
+}
+
+// checkHTTPToolRedirect validates each redirect target like a stored tool URL, so an
+// endpoint cannot send the request on to a non-http scheme or an internal host
+func checkHTTPToolRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return fmt.Errorf("stopped after 10 redirects")
+	}
+	if err := ValidateProviderURL("http_tool", req.URL.String()); err != nil {
+		return fmt.Errorf("redirect to %s refused: %w", req.URL.Redacted(), err)
+	}
+	return nil
+}
+
+// HTTPTool is a REST endpoint offered to the model as a tool. The model's arguments are
+// sent as the JSON body, or as query parameters for GET and DELETE.
+type HTTPTool struct {
+	ID          int64                  `json:"id"`
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	URL         string                 `json:"url"`
+	Method      string                 `json:"method"`
+	InputSchema map[string]interface{} `json:"input_schema"`
+	IsEnabled   bool                   `json:"is_enabled"`
+	CreatedAt   string                 `json:"created_at"`
+	UpdatedAt   string                 `json:"updated_at"`
+}
+
+type httpToolRequest struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	URL         string                 `json:"url"`
+	Method      string                 `json:"method"`
+	InputSchema map[string]interface{} `json:"input_schema"`
+	IsEnabled   *bool                  `json:"is_enabled"`
+}
+
+// validate trims and normalizes the request, defaulting the method to POST and the
+// schema to an object without properties
+func (req *httpToolRequest) validate() string {
+	req.Name = strings.TrimSpace(req.Name)
+	req.Description = strings.TrimSpace(req.Description)
+	req.URL = strings.TrimSpace(req.URL)
+	req.Method = strings.ToUpper(strings.TrimSpace(req.Method))
+
+	if !httpToolName.MatchString(req.Name) {
+		return "Name is required and may only contain letters, digits, _ and - (at most 64)"
+	}
+	if req.Description == "" {
+		return "Description is required, so the model knows when to use the tool"
+	}
+	if err := ValidateProviderURL("http_tool", req.URL); err != nil {
+		return "Invalid URL: " + strings.TrimPrefix(err.Error(), "base URL ")
+	}
+	switch req.Method {
+	case "":
+		req.Method = http.MethodPost
+	case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+	default:
+		return "Method must be GET, POST, PUT, PATCH or DELETE"
+	}
+	if req.InputSchema == nil {
+		req.InputSchema = map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+	}
+	if req.InputSchema["type"] != "object" {
+		return `Input schema must be a JSON schema with "type": "object"`
+	}
+	return ""
+}
+
+func scanHTTPTool(scanner interface{ Scan(...interface{}) error }) (*HTTPTool, error) {
+	var t HTTPTool
+	var schema string
+	var createdAt, updatedAt time.Time
+	if err := scanner.Scan(&t.ID, &t.Name, &t.Description, &t.URL, &t.Method, &schema, &t.IsEnabled, &createdAt, &updatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(schema), &t.InputSchema); err != nil {
+		return nil, fmt.Errorf("invalid input schema of HTTP tool %s: %w", t.Name, err)
+	}
+	t.CreatedAt = createdAt.Format(time.RFC3339)
+	t.UpdatedAt = updatedAt.Format(time.RFC3339)
+	return &t, nil
+}
+
+const httpToolColumns = "id, name, description, url, method, input_schema, is_enabled, created_at, updated_at"
+
+func getHTTPTool(id int64) (*HTTPTool, error) {
+	return scanHTTPTool(db.QueryRow("SELECT "+httpToolColumns+" FROM http_tools WHERE id = ?", id))
+}
+
+// loadHTTPTools returns the HTTP tools by name, only the enabled ones if enabledOnly
+func loadHTTPTools(db *sql.DB, enabledOnly bool) ([]HTTPTool, error) {
+	query := "SELECT " + httpToolColumns + " FROM http_tools"
+	if enabledOnly {
+		query += " WHERE is_enabled = 1"
+	}
+	rows, err := db.Query(query + " ORDER BY name COLLATE NOCASE")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tools := []HTTPTool{}
+	for rows.Next() {
+		t, err := scanHTTPTool(rows)
+		if err != nil {
+			return nil, err
+		}
+		tools = append(tools, *t)
+	}
+	return tools, rows.Err()
+}
+
+// appendHTTPTools adds the enabled HTTP tools to tools as http_<name>, numbered when the
+// name is taken. ToolName keeps the stored name, by which executeHTTPTool finds the tool.
+func appendHTTPTools(db *sql.DB, tools []Tool) ([]Tool, error) {
+	httpTools, err := loadHTTPTools(db, true)
+	if err != nil {
+		return tools, err
+	}
+	used := make(map[string]bool, len(tools))
+	for _, t := range tools {
+		used[t.Name] = true
+	}
+	for _, t := range httpTools {
+		tools = append(tools, Tool{
+			Name:        mcp.UniqueToolName("http_"+t.Name, used),
+			Description: t.Description,
+			InputSchema: t.InputSchema,
+			ServerID:    httpToolServerID,
+			ToolName:    t.Name,
+		})
+	}
+	return tools, nil
+}
+
+// executeHTTPTool calls the endpoint of the enabled HTTP tool named name and returns the
+// response body. The URL is checked again, since its host may resolve elsewhere by now.
+func executeHTTPTool(ctx context.Context, name string, arguments map[string]interface{}) (string, error) {
+	t, err := scanHTTPTool(db.QueryRow("SELECT "+httpToolColumns+" FROM http_tools WHERE name = ? AND is_enabled = 1", name))
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("HTTP tool not found: %s", name)
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := ValidateProviderURL("http_tool", t.URL); err != nil {
+		return "", fmt.Errorf("HTTP tool %s: %w", t.Name, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, httpToolTimeout)
+	defer cancel()
+
+	var body io.Reader
+	target := t.URL
+	if t.Method == http.MethodGet || t.Method == http.MethodDelete {
+		u, _ := url.Parse(t.URL)
+		q := u.Query()
+		for key, value := range arguments {
+			if s, ok := value.(string); ok {
+				q.Set(key, s)
+			} else {
+				encoded, _ := json.Marshal(value)
+				q.Set(key, string(encoded))
+			}
+		}
+		u.RawQuery = q.Encode()
+		target = u.String()
+	} else {
+		if arguments == nil {
+			arguments = map[string]interface{}{}
+		}
+		encoded, err := json.Marshal(arguments)
+		if err != nil {
+			return "", err
+		}
+		body = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, t.Method, target, body)
+	if err != nil {
+		return "", err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json, text/plain;q=0.9, */*;q=0.5")
+
+	resp, err := httpToolClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("HTTP tool %s: %w", t.Name, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, httpToolMaxBytes))
+	if err != nil {
+		return "", fmt.Errorf("HTTP tool %s: failed to read response: %w", t.Name, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("HTTP tool %s returned %s: %s", t.Name, resp.Status, truncateString(strings.TrimSpace(string(respBody)), 500))
+	}
+	return string(respBody), nil
+}
+
+func getHTTPTools(w http.ResponseWriter, r *http.Request) {
+	tools, err := loadHTTPTools(db, false)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	WriteJSON(w, tools)
+}
+
+func createHTTPTool(w http.ResponseWriter, r *http.Request) {
+	var req httpToolRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		WriteError(w, http.StatusBadRequest, msg)
+		return
+	}
+	enabled := req.IsEnabled == nil || *req.IsEnabled
+	schema, _ := json.Marshal(req.InputSchema)
+
+	result, err := db.Exec(`
+		INSERT INTO http_tools (name, description, url, method, input_schema, is_enabled)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, req.Name, req.Description, req.URL, req.Method, string(schema), enabled)
+	if isUniqueViolation(err) {
+		WriteError(w, http.StatusConflict, "An HTTP tool with this name already exists")
+		return
+	}
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	id, _ := result.LastInsertId()
+	tool, err := getHTTPTool(id)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	WriteJSON(w, tool)
+}
+
+func updateHTTPTool(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid tool ID")
+		return
+	}
+
+	var req httpToolRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		WriteError(w, http.StatusBadRequest, msg)
+		return
+	}
+	enabled := req.IsEnabled == nil || *req.IsEnabled
+	schema, _ := json.Marshal(req.InputSchema)
+
+	result, err := db.Exec(`
+		UPDATE http_tools SET name = ?, description = ?, url = ?, method = ?, input_schema = ?, is_enabled = ?,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, req.Name, req.Description, req.URL, req.Method, string(schema), enabled, id)
+	if isUniqueViolation(err) {
+		WriteError(w, http.StatusConflict, "An HTTP tool with this name already exists")
+		return
+	}
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		WriteError(w, http.StatusNotFound, "Tool not found")
+		return
+	}
+
+	tool, err := getHTTPTool(id)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	WriteJSON(w, tool)
+}
+
+func deleteHTTPTool(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid tool ID")
+		return
+	}
+
+	result, err := db.Exec("DELETE FROM http_tools WHERE id = ?", id)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		WriteError(w, http.StatusNotFound, "Tool not found")
+		return
+	}
+
+	WriteJSON(w, map[string]string{"message": "Tool deleted"})
+}
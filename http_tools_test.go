@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+)
+
+func TestHTTPToolRoutesRequireAdmin(t *testing.T) {
+	r := chi.NewRouter()
+	registerAPIRoutes(r, NewMCPServerHandler(nil))
+
+	// With authentication disabled the admin-only routes are refused outright
+	for _, route := range []struct{ method, path string }{
+		{http.MethodGet, "/tools"},
+		{http.MethodPost, "/tools"},
+		{http.MethodPut, "/tools/1"},
+		{http.MethodDelete, "/tools/1"},
+	} {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(route.method, route.path, nil))
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("%s %s: status %d, want %d", route.method, route.path, rec.Code, http.StatusForbidden)
+		}
+	}
+}
+
+func TestCheckHTTPToolRedirect(t *testing.T) {
+	t.Setenv("BLOCK_PRIVATE_URLS", "true")
+	for target, refused := range map[string]bool{
+		"http://169.254.169.254/latest/meta-data": true,
+		"http://127.0.0.1:8080/admin":             true,
+		"file:///etc/passwd":                      true,
+		"https://93.184.216.34/next":              false,
+	} {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if err := checkHTTPToolRedirect(req, nil); (err != nil) != refused {
+			t.Errorf("%s: refused = %v, want %v", target, err != nil, refused)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "https://93.184.216.34/", nil)
+	if err := checkHTTPToolRedirect(req, make([]*http.Request, 10)); err == nil {
+		t.Error("expected the 11th redirect to be refused")
+	}
+}
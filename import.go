@@ -0,0 +1,274 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxImportBytes caps an uploaded export; ChatGPT's conversations.json is one file
+// holding every conversation
+const maxImportBytes = 256 << 20
+
+// importTimeLayout matches the CURRENT_TIMESTAMP values the rest of the schema stores
+const importTimeLayout = "2006-01-02 15:04:05"
+
+// ChatImporter parses another chat app's export into chats in the native backup shape,
+// which are then stored like a restored backup
+type ChatImporter interface {
+	Parse(r io.Reader) ([]BackupChat, error)
+}
+
+// chatImporters are the formats accepted by POST /api/import?source=. New formats
+// register their parser here.
+var chatImporters = map[string]ChatImporter{
+	"chatgpt": chatGPTImporter{},
+}
+
+// chatGPTConversation is one entry of ChatGPT's conversations.json. Messages form a tree
+// in mapping, since edits and regenerations branch, and current_node is the leaf of the
+// branch that was last shown.
+type chatGPTConversation struct {
+	Title       string                 `json:"title"`
+	CreateTime  float64                `json:"create_time"`
+	UpdateTime  float64                `json:"update_time"`
+	CurrentNode string                 `json:"current_node"`
+	Mapping     map[string]chatGPTNode `json:"mapping"`
+}
+
+type chatGPTNode struct {
+	Parent  string          `json:"parent"`
+	Message *chatGPTMessage `json:"message"`
+}
+
+type chatGPTMessage struct {
+	Author struct {
+		Role string `json:"role"`
+	} `json:"author"`
+	CreateTime *float64 `json:"create_time"`
+	Content    struct {
+		ContentType string            `json:"content_type"`
+		Parts       []json.RawMessage `json:"parts"`
+	} `json:"content"`
+	Metadata struct {
+		ModelSlug string `json:"model_slug"`
+		Hidden    bool   `json:"is_visually_hidden_from_conversation"`
+	} `json:"metadata"`
+}
+
+type chatGPTImporter struct{}
+
+// Parse reads conversations.json. Only the branch ending at current_node is imported,
+// and only user, assistant and visible system text: hidden, tool and image-only
+// messages are dropped.
+func (chatGPTImporter) Parse(r io.Reader) ([]BackupChat, error) {
+	var conversations []chatGPTConversation
+	if err := json.NewDecoder(r).Decode(&conversations); err != nil {
+		return nil, fmt.Errorf("expected the conversations.json array of a ChatGPT export: %w", err)
+	}
+
+	chats := make([]BackupChat, 0, len(conversations))
+	for _, conv := range conversations {
+		chat := BackupChat{
+			Title:     strings.TrimSpace(conv.Title),
+			CreatedAt: unixToImportTime(conv.CreateTime),
+			UpdatedAt: unixToImportTime(conv.UpdateTime),
+		}
+		if chat.Title == "" {
+			chat.Title = "Imported chat"
+		}
+		if conv.UpdateTime == 0 {
+			chat.UpdatedAt = chat.CreatedAt
+		}
+
+		for _, node := range chatGPTBranch(conv) {
+			msg := node.Message
+			role := msg.Author.Role
+			if (role != "user" && role != "assistant" && role != "system") || msg.Metadata.Hidden {
+				continue
+			}
+			content := chatGPTText(msg)
+			if content == "" {
+				continue
+			}
+			m := BackupMessage{Role: role, Content: content, CreatedAt: chat.CreatedAt}
+			if msg.CreateTime != nil {
+				m.CreatedAt = unixToImportTime(*msg.CreateTime)
+			}
+			if role == "assistant" {
+				m.ModelName = msg.Metadata.ModelSlug
+			}
+			chat.Messages = append(chat.Messages, m)
+		}
+		chats = append(chats, chat)
+	}
+	return chats, nil
+}
+
+// chatGPTBranch walks from current_node up to the root and returns the nodes with a
+// message in conversation order. Without a current_node the oldest leaf-to-root path
+// cannot be known, so messages are ordered by their create_time instead.
+func chatGPTBranch(conv chatGPTConversation) []chatGPTNode {
+	var branch []chatGPTNode
+	if conv.CurrentNode != "" {
+		seen := make(map[string]bool)
+		for id := conv.CurrentNode; id != "" && !seen[id]; {
+			seen[id] = true
+			node, ok := conv.Mapping[id]
+			if !ok {
+				break
+			}
+			if node.Message != nil {
+				branch = append(branch, node)
+			}
+			id = node.Parent
+		}
+		for i, j := 0, len(branch)-1; i < j; i, j = i+1, j-1 {
+			branch[i], branch[j] = branch[j], branch[i]
+		}
+		return branch
+	}
+
+	for _, node := range conv.Mapping {
+		if node.Message != nil {
+			branch = append(branch, node)
+		}
+	}
+	sort.SliceStable(branch, func(i, j int) bool {
+		return chatGPTCreateTime(branch[i]) < chatGPTCreateTime(branch[j])
+	})
+	return branch
+}
+
+func chatGPTCreateTime(node chatGPTNode) float64 {
+	if node.Message.CreateTime == nil {
+		return 0
+	}
+	return *node.Message.CreateTime
+}
+
+// chatGPTText joins the string parts of a message; multimodal parts such as images are
+// objects and are skipped
+func chatGPTText(msg *chatGPTMessage) string {
+	var parts []string
+	for _, raw := range msg.Content.Parts {
+		var text string
+		if json.Unmarshal(raw, &text) == nil && strings.TrimSpace(text) != "" {
+			parts = append(parts, text)
+		}
+	}
+	return strings.TrimSpace(strings.Join(parts, "\n\n"))
+}
+
+// unixToImportTime converts a fractional unix timestamp to the stored datetime format
+func unixToImportTime(ts float64) string {
+	if ts <= 0 {
+		return time.Now().UTC().Format(importTimeLayout)
+	}
+	sec, frac := math.Modf(ts)
+	return time.Unix(int64(sec), int64(frac*1e9)).UTC().Format(importTimeLayout)
+}
+
+// importChats handles POST /api/import?source=, taking an export as the request body or
+// as a multipart "file" upload. A chat with the same title and creation time as an
+// existing one is skipped, so importing the same export twice adds nothing.
+func importChats(w http.ResponseWriter, r *http.Request) {
+	source := strings.ToLower(r.URL.Query().Get("source"))
+	importer, ok := chatImporters[source]
+	if !ok {
+		sources := make([]string, 0, len(chatImporters))
+		for name := range chatImporters {
+			sources = append(sources, name)
+		}
+		sort.Strings(sources)
+		WriteError(w, http.StatusBadRequest, "source must be one of: "+strings.Join(sources, ", "))
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+	var body io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				WriteError(w, http.StatusRequestEntityTooLarge, "Export exceeds the 256 MB limit")
+				return
+			}
+			WriteError(w, http.StatusBadRequest, "The export must be uploaded in the \"file\" field")
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+
+	chats, err := importer.Parse(body)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			WriteError(w, http.StatusRequestEntityTooLarge, "Export exceeds the 256 MB limit")
+			return
+		}
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	imported := 0
+	skipped := 0
+	failed := 0
+	messages := 0
+	results := make([]RestoreResult, 0, len(chats))
+
+	for _, chat := range chats {
+		if len(chat.Messages) == 0 {
+			skipped++
+			results = append(results, RestoreResult{Title: chat.Title, Status: "empty"})
+			continue
+		}
+
+		var existingID int64
+		err := db.QueryRow("SELECT id FROM chats WHERE title = ? AND created_at = ?", chat.Title, chat.CreatedAt).Scan(&existingID)
+		if err == nil {
+			skipped++
+			results = append(results, RestoreResult{Title: chat.Title, ChatID: existingID, Status: "skipped"})
+			continue
+		}
+		if err != sql.ErrNoRows {
+			failed++
+			results = append(results, RestoreResult{Title: chat.Title, Status: "failed", Error: err.Error()})
+			continue
+		}
+
+		result, err := restoreChat(db, chat, 0)
+		if err != nil {
+			log.Printf("Error importing chat %q from %s: %v", chat.Title, source, err)
+			failed++
+			results = append(results, RestoreResult{Title: chat.Title, Status: "failed", Error: err.Error(), MessagesFailed: len(chat.Messages)})
+			continue
+		}
+		imported++
+		messages += result.MessagesImported
+		result.Status = "imported"
+		results = append(results, result)
+	}
+
+	log.Printf("Imported %d chats (%d messages) from %s, skipped %d, %d failed", imported, messages, source, skipped, failed)
+	WriteJSON(w, map[string]interface{}{
+		"status":   "success",
+		"source":   source,
+		"imported": imported,
+		"skipped":  skipped,
+		"failed":   failed,
+		"messages": messages,
+		"chats":    results,
+		"message":  fmt.Sprintf("Imported %d chats with %d messages, skipped %d, %d failed", imported, messages, skipped, failed),
+	})
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ollama/ollama/api"
+	"github.com/tmc/langchaingo/llms"
+)
+
+const defaultLLMDebugLogFile = "llm_debug.log"
+
+var (
+	llmDebugLogger        *log.Logger
+	llmDebugRedactContent bool
+	llmDebugMu            sync.Mutex
+)
+
+var (
+	// secretPatterns match credentials that may end up in prompts, such as pasted API keys
+	secretPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`\bsk-[A-Za-z0-9_\-]{16,}`),
+		regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9._\-]{16,}`),
+	}
+	// secretAssignment matches "api_key=..." style pairs, keeping the name
+	secretAssignment = regexp.MustCompile(`(?i)\b(api[_-]?key|token|secret|password)(["']?\s*[:=]\s*["']?)[^\s"',]{8,}`)
+)
+
+// llmLogMessage is one entry of the message array sent to a provider
+type llmLogMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// llmLogRecord is one line of the LLM debug log
+type llmLogRecord struct {
+	Time     string                 `json:"time"`
+	Call     string                 `json:"call"`
+	Provider string                 `json:"provider"`
+	Model    string                 `json:"model"`
+	Params   map[string]interface{} `json:"params,omitempty"`
+	Tools    []string               `json:"tools,omitempty"`
+	Messages []llmLogMessage        `json:"messages"`
+}
+
+// InitLLMDebugLog enables the JSON log of generation requests when DEBUG_LLM=1. Records
+// go to DEBUG_LLM_FILE (default llm_debug.log); DEBUG_LLM_REDACT_CONTENT=1 replaces
+// message content with its length.
+func InitLLMDebugLog() {
+	if os.Getenv("DEBUG_LLM") != "1" {
+		return
+	}
+
+	path := os.Getenv("DEBUG_LLM_FILE")
+	if path == "" {
+		path = defaultLLMDebugLogFile
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		log.Printf("Warning: Could not open LLM debug log %s: %v", path, err)
+		return
+	}
+
+	llmDebugLogger = log.New(f, "", 0)
+	llmDebugRedactContent = os.Getenv("DEBUG_LLM_REDACT_CONTENT") == "1"
+	log.Printf("LLM debug logging enabled, writing to %s", path)
+}
+
+// redactSecrets masks the given secrets and anything that looks like a credential
+func redactSecrets(text string, secrets ...string) string {
+	for _, secret := range secrets {
+		if secret != "" {
+			text = strings.ReplaceAll(text, secret, "[REDACTED]")
+		}
+	}
+	for _, pattern := range secretPatterns {
+		text = pattern.ReplaceAllString(text, "[REDACTED]")
+	}
+	return secretAssignment.ReplaceAllString(text, "${1}${2}[REDACTED]")
+}
+
+// logLLMRequest writes the final request sent to a provider to the debug log. secrets
+// lists values, such as the provider's API key, that must never be written.
+func logLLMRequest(call, provider, model string, params map[string]interface{}, tools []Tool, messages []llmLogMessage, secrets ...string) {
+	if llmDebugLogger == nil {
+		return
+	}
+
+	for i := range messages {
+		if llmDebugRedactContent {
+			messages[i].Content = fmt.Sprintf("[%d chars]", len(messages[i].Content))
+			continue
+		}
+		messages[i].Content = redactSecrets(messages[i].Content, secrets...)
+	}
+
+	record := llmLogRecord{
+		Time:     time.Now().UTC().Format(time.RFC3339Nano),
+		Call:     call,
+		Provider: provider,
+		Model:    model,
+		Params:   params,
+		Messages: messages,
+	}
+	for _, t := range tools {
+		record.Tools = append(record.Tools, t.Name)
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		log.Printf("Error encoding LLM debug record: %v", err)
+		return
+	}
+
+	llmDebugMu.Lock()
+	defer llmDebugMu.Unlock()
+	llmDebugLogger.Println(string(data))
+}
+
+// ollamaLogMessages converts an Ollama message array for the debug log
+func ollamaLogMessages(messages []api.Message) []llmLogMessage {
+	if llmDebugLogger == nil {
+		return nil
+	}
+	out := make([]llmLogMessage, len(messages))
+	for i, m := range messages {
+		content := m.Content
+		for _, tc := range m.ToolCalls {
+			content += fmt.Sprintf("\n[tool call %s]", tc.Function.Name)
+		}
+		out[i] = llmLogMessage{Role: m.Role, Content: content}
+	}
+	return out
+}
+
+// langchainLogMessages converts a langchaingo message array for the debug log
+func langchainLogMessages(messages []llms.MessageContent) []llmLogMessage {
+	if llmDebugLogger == nil {
+		return nil
+	}
+	out := make([]llmLogMessage, len(messages))
+	for i, m := range messages {
+		var content strings.Builder
+		for _, part := range m.Parts {
+			switch p := part.(type) {
+			case llms.TextContent:
+				content.WriteString(p.Text)
+			case llms.ToolCall:
+				if p.FunctionCall != nil {
+					content.WriteString(fmt.Sprintf("[tool call %s %s]", p.FunctionCall.Name, p.FunctionCall.Arguments))
+				}
+			case llms.ToolCallResponse:
+				content.WriteString(fmt.Sprintf("[tool result %s] %s", p.Name, p.Content))
+			}
+		}
+		out[i] = llmLogMessage{Role: string(m.Role), Content: content.String()}
+	}
+	return out
+}
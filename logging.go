@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+)
+
+// ansiEscapes matches terminal color codes, which are dropped from JSON log messages
+var ansiEscapes = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+// jsonLogging is set when LOG_FORMAT=json
+var jsonLogging bool
+
+// InitLogging switches to structured JSON logs on stderr when LOG_FORMAT=json. Existing
+// log.Printf calls are routed through the same handler as info entries. The default
+// console format is kept otherwise.
+func InitLogging() {
+	if os.Getenv("LOG_FORMAT") != "json" {
+		return
+	}
+
+	jsonLogging = true
+	handler := slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.MessageKey && len(groups) == 0 {
+				return slog.String(slog.MessageKey, ansiEscapes.ReplaceAllString(a.Value.String(), ""))
+			}
+			return a
+		},
+	})
+	slog.SetDefault(slog.New(handler))
+}
+
+// requestIDHeader carries the request id in both directions
+const requestIDHeader = "X-Request-ID"
+
+// validRequestID limits incoming ids to short tokens that are safe to log
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// newRequestID returns a random 16-character hex id
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// withRequestID stores a request id under chi's key, so middleware.GetReqID and
+// chi's console logger see it too
+func withRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, middleware.RequestIDKey, id)
+}
+
+// requestID returns the request id stored in ctx, or "" when there is none
+func requestID(ctx context.Context) string {
+	return middleware.GetReqID(ctx)
+}
+
+// RequestIDMiddleware assigns each request an id, honoring a well-formed incoming
+// X-Request-ID, and echoes it in the response so users can quote it in bug reports
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(withRequestID(r.Context(), id)))
+	})
+}
+
+// RequestLogger logs each HTTP request, as structured fields in JSON mode and with
+// chi's colored console logger otherwise
+func RequestLogger(next http.Handler) http.Handler {
+	if !jsonLogging {
+		return middleware.Logger(next)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		slog.Info("http request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", ww.Status(),
+			"bytes", ww.BytesWritten(),
+			"duration_ms", time.Since(start).Milliseconds(),
+			"remote_ip", clientIP(r),
+			"request_id", requestID(r.Context()),
+		)
+	})
+}
+
+// logToolCall records the outcome of one tool call made during an agentic loop
+func logToolCall(ctx context.Context, name string, serverID int64, start time.Time, err error) {
+	if err != nil {
+		slog.Error("tool call failed", "request_id", requestID(ctx), "tool", name, "server_id", serverID,
+			"duration_ms", time.Since(start).Milliseconds(), "error", err.Error())
+		return
+	}
+	slog.Info("tool call", "request_id", requestID(ctx), "tool", name, "server_id", serverID,
+		"duration_ms", time.Since(start).Milliseconds())
+}
@@ -6,14 +6,15 @@ import (
 	"database/sql"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
 	"strings"
 	"syscall"
-	"text/template"
 	"time"
 
 	"github.com/contactwajeeh/ollamagoweb-v2/mcp"
@@ -21,7 +22,6 @@ import (
 	"github.com/go-chi/chi/middleware"
 	"github.com/joho/godotenv"
 	"github.com/klauspost/compress/gzhttp"
-	"github.com/ollama/ollama/api"
 	_ "modernc.org/sqlite"
 )
 
@@ -36,25 +36,46 @@ func init() {
 }
 
 func main() {
+	InitLogging()
+
 	// Initialize database
 	db = InitDB()
 	defer db.Close()
 	RunMigrations(db)
 	SeedFromEnvIfEmpty(db)
+	SeedPromptPresets(db)
 
 	// Initialize authentication
 	authUser := os.Getenv("AUTH_USER")
 	authPass := os.Getenv("AUTH_PASSWORD")
 	InitAuth(authUser, authPass)
 	go CleanupSessions()
-
-	// Initialize Telegram bot (if configured)
-	initAllowedUsers()
-	InitTelegramBot()
-	defer StopTelegramBot()
+	go CleanupExpiredMemories()
+	go RunMessageRetention()
+	go RunWeeklyVacuum()
+	go RunScheduledSnapshots()
 
 	// Initialize MCP client
 	mcp.InitMCPClient()
+	mcp.GetMCPClient().SetVariableLookup(lookupMCPVariable(db))
+	go RunMCPHealthChecks()
+
+	// Initialize Telegram bot (if configured)
+	if os.Getenv("TELEGRAM_BOT_TOKEN") != "" {
+		log.Println("Telegram integration enabled")
+		initAllowedUsers()
+		InitTelegramBot()
+	} else {
+		log.Println("Telegram integration disabled (TELEGRAM_BOT_TOKEN not set)")
+	}
+
+	// Initialize Discord bot (if configured)
+	if os.Getenv("DISCORD_BOT_TOKEN") != "" {
+		log.Println("Discord integration enabled")
+		InitDiscordBot()
+	} else {
+		log.Println("Discord integration disabled (DISCORD_BOT_TOKEN not set)")
+	}
 
 	// Start background cleanup of expired link tokens
 	go func() {
@@ -75,99 +96,71 @@ func main() {
 		}
 	}()
 
+	// Initialize per-IP rate limiting
+	InitRateLimiter()
+	go CleanupLimiters()
+	InitCORS()
+	InitCSP()
+	InitTemplates()
+	InitLLMDebugLog()
+
 	r := chi.NewRouter()
-	r.Use(middleware.Logger)
+	r.Use(RequestIDMiddleware)
+	r.Use(RequestLogger)
 	r.Use(middleware.Recoverer)
+	r.Use(CORSMiddleware)
 	r.Use(RateLimitMiddleware)
-	r.Use(func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Content-Security-Policy",
-				"default-src 'self'; script-src 'self' 'unsafe-inline'; style-src 'self' 'unsafe-inline'; img-src 'self' data:; connect-src 'self' http://localhost:*;")
-			next.ServeHTTP(w, r)
-		})
-	})
-
-	// CSRF token endpoint
-	r.Get("/api/csrf", func(w http.ResponseWriter, r *http.Request) {
-		token := generateCSRFToken()
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{"token": token})
-	})
+	r.Use(CSRFMiddleware)
+	r.Use(CSPMiddleware)
 
 	// Static files with compression
 	staticHandler := http.StripPrefix("/static",
-		http.FileServer(http.Dir("./static")))
+		http.FileServer(http.FS(staticFS())))
 	r.Handle("/static/*", gzhttp.GzipHandler(staticHandler))
 
 	// Main routes
 	r.Get("/", index)
-	r.Post("/run", run)
+	r.With(RouteRateLimit("generation")).Post("/run", run)
 
 	// Settings page
 	r.Get("/settings", settingsPage)
+	r.Get("/admin", adminHandler)
 
-	// Provider API routes
-	r.Get("/api/providers", getProviders)
-	r.Post("/api/providers", createProvider)
-	r.Put("/api/providers/{id}", updateProvider)
-	r.Delete("/api/providers/{id}", deleteProvider)
-	r.Post("/api/providers/{id}/activate", activateProvider)
-	r.Post("/api/providers/{id}/fetch-models", fetchModelsFromAPI)
-
-	// Model API routes
-	r.Get("/api/models/{providerId}", getModels)
-	r.Post("/api/models", addModel)
-	r.Delete("/api/models/{id}", deleteModel)
-	r.Post("/api/models/{id}/set-default", setDefaultModel)
-
-	// Settings API routes
-	r.Get("/api/settings/{key}", getSetting)
-	r.Put("/api/settings/{key}", updateSetting)
-
-	// MCP Server API routes
-	r.Mount("/api/mcp/servers", NewMCPServerHandler(db))
-
-	// Active provider info
-	r.Get("/api/active-provider", getActiveProviderInfo)
-
-	// Chat API routes (autosave)
-	r.Get("/api/chats", getChats)
-	r.Get("/api/chats/search", searchChats)
-	r.Get("/api/chats/current", getCurrentChat)
-	r.Post("/api/chats", createChat)
-	r.Get("/api/chats/{id}", getChat)
-	r.Post("/api/chats/{id}/messages", addMessage)
-	r.Put("/api/chats/{id}/rename", renameChat)
-	r.Put("/api/chats/{id}/pin", togglePinChat)
-	r.Delete("/api/chats/{id}", deleteChat)
-	r.Get("/api/chats/{id}/system-prompt", getSystemPrompt)
-	r.Put("/api/chats/{id}/system-prompt", updateSystemPrompt)
-
-	// Message API routes
-	r.Put("/api/messages/{id}", updateMessage)
-	r.Delete("/api/messages/{id}", deleteMessage)
-
-	// Memory API routes
-	r.Get("/api/memories", getMemories)
-	r.Post("/api/memories", setMemory)
-	r.Delete("/api/memories", deleteMemory)
-	r.Get("/api/memories/search", searchMemories)
-	r.Post("/api/memories/extract", testMemoryExtraction)
-
-	// Model switching
-	r.Post("/api/switch-model", switchModel)
+	// Telegram webhook, when the bot receives updates by webhook instead of polling
+	if path := TelegramWebhookPath(); path != "" {
+		csrfExemptPaths[path] = true
+		r.Post(path, telegramWebhookHandler)
+	}
 
-	// Metrics endpoint
-	r.Get("/api/metrics", getMetrics)
+	// Slack Events API and slash commands, verified with the signing secret
+	if SlackEnabled() {
+		log.Println("Slack integration enabled")
+		csrfExemptPaths[slackEventsPath] = true
+		csrfExemptPaths[slackCommandsPath] = true
+		r.Post(slackEventsPath, slackEventsHandler)
+		r.Post(slackCommandsPath, slackCommandsHandler)
+	} else {
+		log.Println("Slack integration disabled (SLACK_BOT_TOKEN or SLACK_SIGNING_SECRET not set)")
+	}
 
-	// Auth endpoints
-	r.Get("/api/auth/session", sessionStatusHandler)
-	r.Post("/api/auth/login", loginHandler)
-	r.Post("/api/auth/logout", logoutHandler)
-	r.Get("/admin", adminHandler)
+	// OpenAI-compatible API for external clients
+	r.Route("/v1", func(r chi.Router) {
+		r.Use(CompatAuthMiddleware(os.Getenv("COMPAT_API_KEY")))
+		r.Get("/models", listCompatModels)
+		r.With(RouteRateLimit("generation")).Post("/chat/completions", chatCompletions)
+		r.With(RouteRateLimit("generation")).Post("/embeddings", compatEmbeddings)
+	})
 
-	// Session link token endpoint
-	r.Get("/api/session/link-token", getSessionLinkToken)
+	// The API is versioned under /api/v1; the unversioned /api prefix serves the same
+	// routes with deprecation headers
+	mcpHandler := NewMCPServerHandler(db)
+	r.Route(apiV1Prefix, func(r chi.Router) {
+		registerAPIRoutes(r, mcpHandler)
+	})
+	r.Route(legacyAPIPrefix, func(r chi.Router) {
+		r.Use(DeprecatedAPIMiddleware)
+		registerAPIRoutes(r, mcpHandler)
+	})
 
 	// Protected routes (apply auth middleware)
 	protected := chi.NewRouter()
@@ -212,11 +205,153 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatal(err)
+		log.Printf("Error during server shutdown: %v", err)
+	}
+
+	// Stop background integrations once in-flight requests have drained
+	StopTelegramBot()
+	StopDiscordBot()
+	if client := mcp.GetMCPClient(); client != nil {
+		client.DisconnectAll()
 	}
 	log.Println("Server stopped")
 }
 
+// registerAPIRoutes registers the JSON API relative to its version prefix. It is
+// mounted at both /api/v1 and the deprecated /api.
+func registerAPIRoutes(r chi.Router, mcpHandler *MCPServerHandler) {
+	// CSRF token endpoint
+	r.Get("/csrf", func(w http.ResponseWriter, r *http.Request) {
+		token := issueCSRFToken(w)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"token": token})
+	})
+
+	r.Post("/generate/{request_id}/cancel", cancelGeneration)
+
+	// Provider API routes
+	r.Get("/providers", getProviders)
+	r.Post("/providers", createProvider)
+	r.Get("/providers/{id}", getProvider)
+	r.Put("/providers/{id}", updateProvider)
+	r.Delete("/providers/{id}", deleteProvider)
+	r.Post("/providers/{id}/activate", activateProvider)
+	r.Post("/providers/{id}/fetch-models", fetchModelsFromAPI)
+	r.Post("/providers/{id}/models/import", importModels)
+
+	// Model API routes
+	r.Get("/models/{providerId}", getModels)
+	r.Post("/models", addModel)
+	r.Delete("/models/{id}", deleteModel)
+	r.Post("/models/{id}/set-default", setDefaultModel)
+
+	// Settings API routes
+	r.Get("/settings", getSettings)
+	r.Put("/settings", updateSettings)
+	r.Get("/settings/{key}", getSetting)
+	r.Put("/settings/{key}", updateSetting)
+
+	// MCP Server API routes
+	r.With(RouteRateLimit("mcp")).Mount("/mcp/servers", mcpHandler)
+
+	// HTTP tool API routes, admin only since tools make requests from the server
+	r.With(AdminMiddleware).Get("/tools", getHTTPTools)
+	r.With(AdminMiddleware).Post("/tools", createHTTPTool)
+	r.With(AdminMiddleware).Put("/tools/{id}", updateHTTPTool)
+	r.With(AdminMiddleware).Delete("/tools/{id}", deleteHTTPTool)
+
+	// Embeddings API
+	r.With(AuthMiddleware, RouteRateLimit("generation")).Post("/embeddings", embedTexts)
+
+	// Web search API
+	r.With(AuthMiddleware, RouteRateLimit("search")).Get("/search", searchWeb)
+
+	// Active provider info
+	r.Get("/active-provider", getActiveProviderInfo)
+
+	// Chat API routes (autosave)
+	r.Get("/chats", getChats)
+	r.Get("/chats/search", searchChats)
+	r.Get("/chats/current", getCurrentChat)
+	r.Post("/chats", createChat)
+	r.Get("/chats/{id}", getChat)
+	r.Post("/chats/{id}/messages", addMessage)
+	r.Put("/chats/{id}/rename", renameChat)
+	r.Put("/chats/{id}/pin", togglePinChat)
+	r.Put("/chats/{id}/memory", setChatMemory)
+	r.Put("/chats/{id}/budget", setChatTokenBudget)
+	r.Delete("/chats", deleteAllChats)
+	r.Delete("/chats/{id}", deleteChat)
+	r.Get("/chats/{id}/system-prompt", getSystemPrompt)
+	r.Put("/chats/{id}/system-prompt", updateSystemPrompt)
+	r.Get("/chats/{id}/export", exportChat(db))
+	r.Post("/chats/{id}/apply-preset", applyPromptPreset)
+	r.Post("/chats/{id}/fork", forkChat)
+	r.Post("/chats/{id}/split", splitChat)
+	r.Post("/chats/{id}/redact", redactChat)
+	r.Post("/chats/{id}/resummarize", resummarizeChatHandler)
+	r.Get("/chats/{id}/documents", getChatDocuments)
+	r.Post("/chats/{id}/documents", uploadChatDocument)
+	r.Delete("/chats/{id}/documents/{docId}", deleteChatDocument)
+	r.With(RouteRateLimit("generation")).Post("/chats/{id}/regenerate", regenerateChat)
+	r.Post("/chats/{id}/estimate", estimateChatContext)
+
+	// Prompt preset API routes
+	r.Get("/prompt-presets", getPromptPresets)
+	r.Post("/prompt-presets", createPromptPreset)
+	r.Put("/prompt-presets/{id}", updatePromptPreset)
+	r.Delete("/prompt-presets/{id}", deletePromptPreset)
+
+	// Message API routes
+	r.Put("/messages/{id}", updateMessage)
+	r.Delete("/messages/{id}", deleteMessage)
+	r.With(RouteRateLimit("generation")).Post("/messages/{id}/continue", continueMessage)
+	r.Post("/messages/{id}/feedback", setMessageFeedback)
+	r.Delete("/messages/{id}/feedback", deleteMessageFeedback)
+	r.Get("/messages/{id}/versions", getMessageVersions)
+	r.Post("/messages/{id}/activate-version", activateMessageVersion)
+	r.Get("/feedback", exportFeedback)
+
+	// Memory API routes
+	r.Get("/memories", getMemories)
+	r.Post("/memories", setMemory)
+	r.Delete("/memories", deleteMemory)
+	r.Get("/memories/search", searchMemories)
+	r.Get("/memories/export", exportMemories)
+	r.Post("/memories/import", importMemories)
+	r.Post("/memories/extract", testMemoryExtraction)
+	r.With(RouteRateLimit("generation")).Post("/memories/extract-preview", previewMemoryExtraction)
+	r.Post("/memories/dedupe", dedupeMemories)
+
+	// Backup routes (backups contain full chat history, so require a session when auth is enabled)
+	r.Group(func(r chi.Router) {
+		r.Use(AuthMiddleware)
+		RegisterBackupRoutes(r, db)
+		r.Post("/import", importChats)
+	})
+	r.With(AdminMiddleware).Post("/maintenance/prune", pruneMessages)
+	r.With(AdminMiddleware).Post("/maintenance/snapshot", snapshotDatabase)
+	r.With(AdminMiddleware).Post("/maintenance/vacuum", vacuumDatabase)
+	r.With(AdminMiddleware).Get("/admin/overview", getAdminOverview)
+
+	// Model switching
+	r.Post("/switch-model", switchModel)
+
+	// Metrics endpoint
+	r.Get("/metrics", getMetrics)
+	r.Get("/usage/budget", getTokenBudget)
+
+	// Auth endpoints
+	r.Get("/auth/session", sessionStatusHandler)
+	r.Post("/auth/login", loginHandler)
+	r.Post("/auth/logout", logoutHandler)
+	r.With(AdminMiddleware).Get("/auth/sessions", listSessionsHandler)
+	r.With(AdminMiddleware).Delete("/auth/sessions/{id}", revokeSessionHandler)
+
+	// Session link token endpoint
+	r.Get("/session/link-token", getSessionLinkToken)
+}
+
 // index renders the main chat page
 func index(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("X-Content-Type-Options", "nosniff")
@@ -225,7 +360,11 @@ func index(w http.ResponseWriter, r *http.Request) {
 	_, config, err := GetActiveProvider(db)
 
 	var providerName, modelName, providerInfo string
-	if err != nil {
+	if errors.Is(err, ErrNoModelConfigured) {
+		providerName = config.Name
+		modelName = ""
+		providerInfo = config.Name + " has no models. Add one in Settings"
+	} else if err != nil {
 		providerName = "No provider configured"
 		modelName = ""
 		providerInfo = "Please configure a provider in Settings"
@@ -235,7 +374,7 @@ func index(w http.ResponseWriter, r *http.Request) {
 		providerInfo = config.Name + " | " + config.Model
 	}
 
-	t, err := template.ParseFiles("static/index.html")
+	t, err := loadTemplate("index.html")
 	if err != nil {
 		http.Error(w, "Error loading page", http.StatusInternalServerError)
 		return
@@ -245,6 +384,8 @@ func index(w http.ResponseWriter, r *http.Request) {
 		"provider":     providerName,
 		"llm":          modelName,
 		"providerInfo": providerInfo,
+		"theme":        ThemePreference(r),
+		"nonce":        cspNonce(r),
 	}
 
 	if err := t.Execute(w, data); err != nil {
@@ -255,8 +396,10 @@ func index(w http.ResponseWriter, r *http.Request) {
 // run handles LLM generation requests using the active provider
 func run(w http.ResponseWriter, r *http.Request) {
 	prompt := struct {
-		Input  string `json:"input"`
-		ChatID int64  `json:"chat_id,omitempty"`
+		Input     string `json:"input"`
+		ChatID    int64  `json:"chat_id,omitempty"`
+		RequestID string `json:"request_id,omitempty"`
+		Stream    *bool  `json:"stream,omitempty"`
 	}{}
 
 	if err := json.NewDecoder(r.Body).Decode(&prompt); err != nil {
@@ -269,39 +412,35 @@ func run(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Handling Search Logic
-	var braveAPIKey string
-	err := db.QueryRow("SELECT value FROM settings WHERE key = 'brave_api_key'").Scan(&braveAPIKey)
-	if err != nil && err != sql.ErrNoRows {
-		log.Println("Error fetching Brave API key:", err)
+	if !enforceTokenBudget(w, prompt.ChatID) {
+		return
 	}
 
-	// Decrypt the key if it exists
-	if braveAPIKey != "" {
-		decrypted, err := Decrypt(braveAPIKey)
-		if err != nil {
-			log.Println("Error decrypting Brave API key:", err)
-			// Proceed with raw key? Or fail? Failed decryption usually means it wasn't encrypted (legacy) or key change
-			// If Decrypt returns original string on failure (as implemented in crypto.go), we are safe.
-			// Checking crypto.go implementation...
-			// Yes, Decrypt returns input string on some errors, but let's be safe.
-			// Actually crypto.go Decrypt implementation returns input if not base64 etc.
-			// But if it errors on NewCipher/GCM, it returns empty string + error.
-			// We should probably rely on Decrypt's behavior or fallback.
-			// Let's assume Decrypt handles legacy/empty cases reasonably or we handle error.
-			// For this specific code:
-		} else {
-			braveAPIKey = decrypted
-		}
+	sessionID := getSessionIDFromRequest(r)
+
+	// A client-supplied request_id lets POST /api/generate/{request_id}/cancel stop this run
+	ctx, done, err := registerGeneration(r.Context(), prompt.RequestID, sessionID)
+	if err != nil {
+		writeGenerationIDError(w, err)
+		return
 	}
+	defer done()
 
-	enrichedPrompt, err := MaybeSearch(prompt.Input, braveAPIKey)
+	// Handling Search Logic
+	searcher, searcherErr := GetSearcher(db)
+	enrichedPrompt, err := MaybeSearch(prompt.Input, searcher)
 	if err != nil {
 		// If search fails or key missing, fallback to sending error as response or just logging
 		// For now, let's log and maybe return error to user if they explicitly asked for search
 		if strings.HasPrefix(prompt.Input, "/search ") {
+			status := http.StatusInternalServerError
+			if searcherErr != nil {
+				err = searcherErr
+			} else if code := searchErrorStatus(err); code != http.StatusBadGateway {
+				status = code
+			}
 			log.Printf("Search failed: %v", err)
-			http.Error(w, "Search error: "+err.Error(), http.StatusInternalServerError)
+			http.Error(w, "Search error: "+err.Error(), status)
 			return
 		}
 		// Otherwise continue with original prompt
@@ -314,168 +453,84 @@ func run(w http.ResponseWriter, r *http.Request) {
 	// Get system prompt from chat if chatId is provided
 	var systemPrompt string
 	if prompt.ChatID > 0 {
-		db.QueryRow("SELECT COALESCE(system_prompt, '') FROM chats WHERE id = ?", prompt.ChatID).Scan(&systemPrompt)
+		systemPrompt = GetChatSystemPrompt(db, prompt.ChatID)
 	}
+	systemPrompt = withGlobalSystemPrompt(db, systemPrompt)
 
 	// Get active provider
 	provider, config, err := GetActiveProvider(db)
 	if err != nil {
-		http.Error(w, "No active provider configured. Please visit /settings to configure one.", http.StatusServiceUnavailable)
+		writeActiveProviderError(w, err)
 		return
 	}
 
-	log.Printf("Generating response with %s using model %s\n", config.Name, config.Model)
-	if systemPrompt != "" {
-		log.Printf("Using system prompt: %s...\n", truncate(systemPrompt, 50))
-	}
-
-	// Parse settings - maxTokens currently unused with rolling summary
-	// maxTokensStr := "4096"
-	// ...
-
-	// 1. Get Chat Summary
-	var chatSummary sql.NullString
-	if prompt.ChatID > 0 {
-		err := db.QueryRow("SELECT summary FROM chats WHERE id = ?", prompt.ChatID).Scan(&chatSummary)
-		if err != nil {
-			log.Println("Error fetching chat summary:", err)
-		}
-	}
-
-	// 2. Fetch Unsummarized Messages
-	// We fetch ALL unsummarized messages. The sliding window logic might still apply
-	// if there are too many unsummarized ones, but ideally the summarizer keeps this list short.
-	// For safety, we still apply a limit or token check if implemented, but for now let's just fetch unsummarized.
-	var history []api.Message
-
-	if prompt.ChatID > 0 {
-		// Fetch unsummarized messages
-		rows, err := db.Query(`
-			SELECT role, content, model_name
-			FROM messages
-			WHERE chat_id = ? AND is_summarized = 0
-			ORDER BY id ASC
-		`, prompt.ChatID)
-		if err != nil {
-			log.Println("Error fetching history:", err)
-		} else {
-			defer rows.Close()
-			for rows.Next() {
-				var role, content string
-				var modelName sql.NullString
-				if err := rows.Scan(&role, &content, &modelName); err != nil {
-					continue
-				}
-				history = append(history, api.Message{
-					Role:    role,
-					Content: content,
-				})
-			}
-		}
-
-		// Inject Summary as the first "system" or "context" message if it exists
-		if chatSummary.String != "" {
-			summaryMsg := api.Message{
-				Role:    "system", // Or 'user' with a preamble if system prompt is strict. 'system' is usually best.
-				Content: fmt.Sprintf("Here is a summary of the earlier conversation:\n%s", chatSummary.String),
-			}
-			// Prepend summary
-			history = append([]api.Message{summaryMsg}, history...)
+	// Without an explicit /search, optionally decide whether web results would help
+	if enrichedPrompt == prompt.Input {
+		conversationKey := fmt.Sprintf("chat:%d", prompt.ChatID)
+		if prompt.ChatID == 0 {
+			conversationKey = "session:" + getSessionIDFromRequest(r)
 		}
+		enrichedPrompt = MaybeAutoSearch(ctx, db, conversationKey, prompt.Input, searcher, provider)
 	}
 
-	// 3. Inject User Memories (only if enabled)
-	sessionID := getSessionIDFromRequest(r)
-	if IsMemoryEnabled(db) {
-		memories, err := GetMemories(db, sessionID)
-		if err != nil {
-			log.Println("Error fetching memories:", err)
-		} else if len(memories) > 0 {
-			memoryPrompt := FormatMemoriesForPrompt(memories)
-			memoryMsg := api.Message{
-				Role:    "system",
-				Content: fmt.Sprintf("You have access to the following information about this user:\n%s\nUse this information to personalize your responses.", memoryPrompt),
-			}
-			history = append([]api.Message{memoryMsg}, history...)
-		}
-
-		// 4. Check if user is asking about reminders/memories
-		if strings.Contains(strings.ToLower(prompt.Input), "reminder") ||
-			strings.Contains(strings.ToLower(prompt.Input), "show me") ||
-			strings.Contains(strings.ToLower(prompt.Input), "what do you know") ||
-			strings.Contains(strings.ToLower(prompt.Input), "my meetings") {
-			searchResults, err := SearchMemories(db, sessionID, "reminder")
-			if err == nil && len(searchResults) > 0 {
-				var reminderList strings.Builder
-				reminderList.WriteString("\n=== USER'S REMINDERS ===\n")
-				for _, mem := range searchResults {
-					reminderList.WriteString(fmt.Sprintf("- %s\n", mem.Value))
-				}
-				reminderList.WriteString("=== END REMINDERS ===\n")
-
-				reminderContextMsg := api.Message{
-					Role:    "system",
-					Content: reminderList.String(),
-				}
-				history = append([]api.Message{reminderContextMsg}, history...)
-			}
-		}
+	if systemPrompt != "" {
+		log.Printf("Using system prompt: %s...\n", truncate(systemPrompt, 50))
 	}
 
-	log.Printf("Sending %d history messages (context window) to provider", len(history))
+	history := buildChatHistory(prompt.ChatID, sessionID, prompt.Input)
+	ctx, transcript := withToolTranscript(ctx)
 
-	ctx := r.Context()
+	slog.Info("generation started", "request_id", requestID(ctx), "chat_id", prompt.ChatID, "provider", config.Name, "model", config.Model,
+		"history_messages", len(history))
+	start := time.Now()
 
-	tools, err := GetAllEnabledMCPTools(ctx)
-	if err != nil {
-		log.Printf("Warning: Failed to get MCP tools: %v", err)
-		tools = nil
-	}
-
-	skills, err := GetCachedSkills(ctx)
-	if err != nil {
-		log.Printf("Warning: Failed to get Open Skills: %v", err)
-		skills = nil
-	}
-
-	if len(tools) > 0 || len(skills) > 0 {
-		log.Printf("Web: Running agentic loop with %d tools and %d skills", len(tools), len(skills))
-		response, err := RunAgenticLoopWithSkills(ctx, provider, tools, skills, history, enrichedPrompt, systemPrompt, nil)
+	// Streaming is the default; "stream": false or Accept: application/json returns
+	// the whole response as JSON instead
+	if (prompt.Stream != nil && !*prompt.Stream) || strings.Contains(r.Header.Get("Accept"), "application/json") {
+		content, stats, err := generateComplete(ctx, provider, history, enrichedPrompt, systemPrompt)
 		if err != nil {
-			log.Println("Generation error:", err)
-			http.Error(w, "Generation error: "+err.Error(), http.StatusInternalServerError)
+			slog.Error("generation failed", "request_id", requestID(ctx), "chat_id", prompt.ChatID, "model", config.Model,
+				"duration_ms", time.Since(start).Milliseconds(), "error", err.Error())
+			WriteError(w, generationErrorStatus(w, err), "Generation error: "+err.Error())
 			return
 		}
-		w.Header().Set("Content-Type", "text/plain")
-		w.Write([]byte(response))
-
-		if idx := strings.Index(response, "__ANALYTICS__"); idx != -1 {
-			response = strings.TrimSpace(response[:idx])
+		recordTokenUsage(db, prompt.ChatID, usageSourceChat, stats.Usage.TotalTokens)
+		if stats.Model == "" {
+			stats.Model = config.Model
 		}
+		WriteJSON(w, map[string]interface{}{
+			"content":        content,
+			"model":          stats.Model,
+			"usage":          stats.Usage,
+			"latency_ms":     stats.LatencyMs,
+			"tokens_per_sec": stats.TokensPerSec,
+		})
 	} else {
-		if err := provider.Generate(ctx, history, enrichedPrompt, systemPrompt, w); err != nil {
-			log.Println("Generation error:", err)
+		capture := &captureWriter{ResponseWriter: w}
+		if err := streamGeneration(ctx, capture, provider, history, enrichedPrompt, systemPrompt); err != nil {
+			slog.Error("generation failed", "request_id", requestID(ctx), "chat_id", prompt.ChatID, "model", config.Model,
+				"duration_ms", time.Since(start).Milliseconds(), "error", err.Error())
+			return
 		}
+		_, stats := splitAnalytics(capture.buf.String())
+		recordTokenUsage(db, prompt.ChatID, usageSourceChat, stats.Usage.TotalTokens)
 	}
+	slog.Info("generation finished", "request_id", requestID(ctx), "chat_id", prompt.ChatID, "model", config.Model,
+		"duration_ms", time.Since(start).Milliseconds())
 
-	// Trigger background summarization check
 	if prompt.ChatID > 0 {
-		MaybeTriggerSummarization(db, prompt.ChatID)
+		if err := saveToolTranscript(db, prompt.ChatID, latestUserVersionGroup(db, prompt.ChatID), transcript); err != nil {
+			log.Printf("Error saving tool calls for chat %d: %v", prompt.ChatID, err)
+		}
+
+		// Trigger background summarization check
+		MaybeTriggerSummarization(ctx, db, prompt.ChatID)
 	}
 
-	// Extract and store memories (only if enabled)
+	// Extract memories using LLM (autonomous extraction) in the background, with the
+	// pattern-based extractor as its fallback
 	if IsMemoryEnabled(db) {
-		// Extract simple memories from user input (pattern-based)
-		ExtractAndStoreMemory(db, sessionID, prompt.Input)
-
-		// Extract memories using LLM (autonomous extraction)
-		// Only do this for non-empty messages to avoid unnecessary API calls
-		if strings.TrimSpace(prompt.Input) != "" {
-			provider, _, err := GetActiveProvider(db)
-			if err == nil {
-				ExtractMemoriesWithLLM(db, sessionID, prompt.Input, provider, history)
-			}
-		}
+		QueueMemoryExtraction(sessionID, prompt.Input)
 	}
 }
 
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// retentionKeepRecent is how many of each chat's latest messages are kept whatever their
+// age, so pruning never empties a chat
+const retentionKeepRecent = 20
+
+// PruneResult reports what one retention run removed
+type PruneResult struct {
+	RetentionDays   int    `json:"retention_days"`
+	Cutoff          string `json:"cutoff,omitempty"`
+	MessagesDeleted int64  `json:"messages_deleted"`
+	ChatsAffected   int    `json:"chats_affected"`
+	ChatsSummarized int    `json:"chats_summarized"`
+	Vacuumed        bool   `json:"vacuumed"`
+}
+
+// messageRetentionDays returns the message_retention_days setting; 0 keeps messages forever
+func messageRetentionDays(db *sql.DB) int {
+	days, err := strconv.Atoi(GetSetting(db, "message_retention_days", "0"))
+	if err != nil || days < 0 {
+		return 0
+	}
+	return days
+}
+
+// pruneCandidates selects messages past the cutoff in chats that are not pinned, leaving
+// out each chat's retentionKeepRecent latest messages
+const pruneCandidates = `
+	FROM messages
+	WHERE created_at < ?
+	  AND chat_id IN (SELECT id FROM chats WHERE COALESCE(is_pinned, 0) = 0)
+	  AND id NOT IN (
+		SELECT id FROM (
+			SELECT id, ROW_NUMBER() OVER (PARTITION BY chat_id ORDER BY id DESC) AS rn FROM messages
+		) WHERE rn <= ?
+	  )`
+
+// PruneOldMessages deletes messages older than message_retention_days from unpinned chats.
+// Chats whose old messages are not folded into their summary yet are summarized first,
+// so the summary keeps what the deleted messages said. Active messages that are still
+// unsummarized afterwards, because summarization failed or found too few, are kept for
+// a later run. Summaries themselves are kept.
+func PruneOldMessages(ctx context.Context, db *sql.DB) (PruneResult, error) {
+	result := PruneResult{RetentionDays: messageRetentionDays(db)}
+	if result.RetentionDays == 0 {
+		return result, nil
+	}
+	cutoff := time.Now().UTC().AddDate(0, 0, -result.RetentionDays).Format("2006-01-02 15:04:05")
+	result.Cutoff = cutoff
+
+	rows, err := db.Query("SELECT chat_id, SUM(is_summarized = 0 AND COALESCE(is_active_version, 1) = 1) "+pruneCandidates+" GROUP BY chat_id", cutoff, retentionKeepRecent)
+	if err != nil {
+		return result, fmt.Errorf("finding messages to prune: %w", err)
+	}
+	var unsummarized []int64
+	for rows.Next() {
+		var chatID int64
+		var pending int
+		if err := rows.Scan(&chatID, &pending); err != nil {
+			rows.Close()
+			return result, err
+		}
+		result.ChatsAffected++
+		if pending > 0 {
+			unsummarized = append(unsummarized, chatID)
+		}
+	}
+	rows.Close()
+	if result.ChatsAffected == 0 {
+		return result, nil
+	}
+
+	for _, chatID := range unsummarized {
+		resummarizeChat(ctx, db, chatID)
+		result.ChatsSummarized++
+	}
+
+	res, err := db.Exec("DELETE "+pruneCandidates+" AND (is_summarized = 1 OR COALESCE(is_active_version, 1) = 0)", cutoff, retentionKeepRecent)
+	if err != nil {
+		return result, fmt.Errorf("pruning messages: %w", err)
+	}
+	result.MessagesDeleted, _ = res.RowsAffected()
+
+	if result.MessagesDeleted > 0 {
+		if _, err := VacuumDB(ctx, db); err != nil {
+			log.Printf("Error vacuuming database after pruning: %v", err)
+		} else {
+			result.Vacuumed = true
+		}
+	}
+	return result, nil
+}
+
+// VacuumResult reports the database size around a VACUUM, from page_count * page_size
+type VacuumResult struct {
+	SizeBefore     int64 `json:"size_before"`
+	SizeAfter      int64 `json:"size_after"`
+	ReclaimedBytes int64 `json:"reclaimed_bytes"`
+	DurationMs     int64 `json:"duration_ms"`
+}
+
+// rowQueryer is satisfied by *sql.DB and *sql.Conn
+type rowQueryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// databaseSize returns the size of the main database file in bytes
+func databaseSize(ctx context.Context, conn rowQueryer) (int64, error) {
+	var size int64
+	err := conn.QueryRowContext(ctx, "SELECT page_count * page_size FROM pragma_page_count(), pragma_page_size()").Scan(&size)
+	return size, err
+}
+
+// VacuumDB rebuilds the database file to reclaim the space of deleted rows, then runs
+// ANALYZE to refresh the query planner's statistics. VACUUM cannot run inside a
+// transaction, so both run on a connection of their own taken from the pool.
+func VacuumDB(ctx context.Context, db *sql.DB) (VacuumResult, error) {
+	var result VacuumResult
+	start := time.Now()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return result, err
+	}
+	defer conn.Close()
+
+	if result.SizeBefore, err = databaseSize(ctx, conn); err != nil {
+		return result, fmt.Errorf("reading database size: %w", err)
+	}
+	if _, err := conn.ExecContext(ctx, "VACUUM"); err != nil {
+		return result, fmt.Errorf("vacuum: %w", err)
+	}
+	if _, err := conn.ExecContext(ctx, "ANALYZE"); err != nil {
+		return result, fmt.Errorf("analyze: %w", err)
+	}
+	if result.SizeAfter, err = databaseSize(ctx, conn); err != nil {
+		return result, fmt.Errorf("reading database size: %w", err)
+	}
+
+	result.ReclaimedBytes = result.SizeBefore - result.SizeAfter
+	result.DurationMs = time.Since(start).Milliseconds()
+	return result, nil
+}
+
+// RunWeeklyVacuum vacuums and analyzes the database once a week
+func RunWeeklyVacuum() {
+	ticker := time.NewTicker(7 * 24 * time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		result, err := VacuumDB(context.Background(), db)
+		if err != nil {
+			log.Printf("Error running scheduled vacuum: %v", err)
+			continue
+		}
+		log.Printf("Scheduled vacuum reclaimed %d bytes (%d -> %d) in %dms", result.ReclaimedBytes, result.SizeBefore, result.SizeAfter, result.DurationMs)
+	}
+}
+
+// vacuumDatabase handles POST /api/maintenance/vacuum, reporting the size before and after
+func vacuumDatabase(w http.ResponseWriter, r *http.Request) {
+	result, err := VacuumDB(r.Context(), db)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	log.Printf("Vacuum reclaimed %d bytes (%d -> %d) in %dms", result.ReclaimedBytes, result.SizeBefore, result.SizeAfter, result.DurationMs)
+	WriteJSON(w, result)
+}
+
+// RunMessageRetention prunes old messages once a day while message_retention_days is set
+func RunMessageRetention() {
+	ticker := time.NewTicker(24 * time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		result, err := PruneOldMessages(context.Background(), db)
+		if err != nil {
+			log.Printf("Error applying message retention: %v", err)
+		} else if result.MessagesDeleted > 0 {
+			log.Printf("Pruned %d messages older than %d days from %d chats", result.MessagesDeleted, result.RetentionDays, result.ChatsAffected)
+		}
+	}
+}
+
+// pruneMessages handles POST /api/maintenance/prune, applying the retention policy now
+func pruneMessages(w http.ResponseWriter, r *http.Request) {
+	if messageRetentionDays(db) == 0 {
+		WriteError(w, http.StatusBadRequest, "message_retention_days is not set")
+		return
+	}
+	result, err := PruneOldMessages(r.Context(), db)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	WriteJSON(w, result)
+}
+
+const (
+	snapshotPrefix = "ollamagoweb-"
+	snapshotSuffix = ".db"
+
+	defaultSnapshotKeep          = 7
+	defaultSnapshotIntervalHours = 24
+)
+
+// SnapshotResult describes one database snapshot written to DB_SNAPSHOT_DIR
+type SnapshotResult struct {
+	Path    string   `json:"path"`
+	Size    int64    `json:"size"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+// snapshotEnvInt reads a positive integer from an environment variable
+func snapshotEnvInt(env string, fallback int) int {
+	if n, err := strconv.Atoi(os.Getenv(env)); err == nil && n > 0 {
+		return n
+	}
+	return fallback
+}
+
+// SnapshotDB writes a consistent copy of the live database to dir with VACUUM INTO,
+// which reads inside one transaction and so is safe against concurrent writes, unlike
+// copying the file. Only the DB_SNAPSHOT_KEEP newest snapshots are kept.
+func SnapshotDB(ctx context.Context, db *sql.DB, dir string) (SnapshotResult, error) {
+	var result SnapshotResult
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return result, fmt.Errorf("creating snapshot directory: %w", err)
+	}
+
+	result.Path = filepath.Join(dir, snapshotPrefix+time.Now().UTC().Format("20060102-150405")+snapshotSuffix)
+	if _, err := os.Stat(result.Path); err == nil {
+		return result, fmt.Errorf("snapshot %s already exists", result.Path)
+	}
+	if _, err := db.ExecContext(ctx, "VACUUM INTO ?", result.Path); err != nil {
+		return result, fmt.Errorf("writing snapshot: %w", err)
+	}
+	if info, err := os.Stat(result.Path); err == nil {
+		result.Size = info.Size()
+	}
+
+	removed, err := pruneSnapshots(dir, snapshotEnvInt("DB_SNAPSHOT_KEEP", defaultSnapshotKeep))
+	if err != nil {
+		log.Printf("Error removing old snapshots: %v", err)
+	}
+	result.Removed = removed
+	return result, nil
+}
+
+// pruneSnapshots deletes all but the keep newest snapshots in dir. Timestamped names
+// sort in creation order.
+func pruneSnapshots(dir string, keep int) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var snapshots []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasPrefix(e.Name(), snapshotPrefix) && strings.HasSuffix(e.Name(), snapshotSuffix) {
+			snapshots = append(snapshots, e.Name())
+		}
+	}
+	sort.Strings(snapshots)
+
+	var removed []string
+	for len(snapshots) > keep {
+		path := filepath.Join(dir, snapshots[0])
+		if err := os.Remove(path); err != nil {
+			return removed, err
+		}
+		removed = append(removed, path)
+		snapshots = snapshots[1:]
+	}
+	return removed, nil
+}
+
+// RunScheduledSnapshots writes a snapshot every DB_SNAPSHOT_INTERVAL_HOURS (default 24)
+// while DB_SNAPSHOT_DIR is set
+func RunScheduledSnapshots() {
+	dir := os.Getenv("DB_SNAPSHOT_DIR")
+	if dir == "" {
+		return
+	}
+	interval := time.Duration(snapshotEnvInt("DB_SNAPSHOT_INTERVAL_HOURS", defaultSnapshotIntervalHours)) * time.Hour
+	log.Printf("Database snapshots enabled: every %s to %s", interval, dir)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		result, err := SnapshotDB(context.Background(), db, dir)
+		if err != nil {
+			log.Printf("Error writing scheduled snapshot: %v", err)
+			continue
+		}
+		log.Printf("Wrote database snapshot %s (%d bytes)", result.Path, result.Size)
+	}
+}
+
+// snapshotDatabase handles POST /api/maintenance/snapshot, writing a snapshot now
+func snapshotDatabase(w http.ResponseWriter, r *http.Request) {
+	dir := os.Getenv("DB_SNAPSHOT_DIR")
+	if dir == "" {
+		WriteError(w, http.StatusBadRequest, "DB_SNAPSHOT_DIR is not set")
+		return
+	}
+	result, err := SnapshotDB(r.Context(), db, dir)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	log.Printf("Wrote database snapshot %s (%d bytes)", result.Path, result.Size)
+	WriteJSON(w, result)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPruneOldMessagesKeepsUnsummarizedMessages(t *testing.T) {
+	testDB := newTestDB(t)
+	if _, err := testDB.Exec("INSERT INTO settings (key, value) VALUES ('message_retention_days', '30')"); err != nil {
+		t.Fatal(err)
+	}
+	res, err := testDB.Exec("INSERT INTO chats (title) VALUES ('old chat')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	chatID, _ := res.LastInsertId()
+
+	// Five old messages beyond the kept tail: two summarized, three not. With no provider
+	// configured the summarization attempt fails, so the three must survive.
+	old := time.Now().UTC().AddDate(0, 0, -60).Format("2006-01-02 15:04:05")
+	for i := 0; i < 5; i++ {
+		if _, err := testDB.Exec("INSERT INTO messages (chat_id, role, content, created_at, is_summarized) VALUES (?, 'user', 'old', ?, ?)",
+			chatID, old, i < 2); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < retentionKeepRecent; i++ {
+		if _, err := testDB.Exec("INSERT INTO messages (chat_id, role, content, created_at) VALUES (?, 'user', 'recent', ?)", chatID, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err := PruneOldMessages(context.Background(), testDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.MessagesDeleted != 2 {
+		t.Fatalf("deleted %d messages, want only the 2 summarized ones", result.MessagesDeleted)
+	}
+	var remaining int
+	testDB.QueryRow("SELECT COUNT(*) FROM messages WHERE chat_id = ? AND content = 'old'", chatID).Scan(&remaining)
+	if remaining != 3 {
+		t.Fatalf("%d old messages remain, want the 3 unsummarized ones", remaining)
+	}
+}
+
+// checkAdminOnlyRoute asserts a POST route is refused without auth or a session and
+// served for the admin
+func checkAdminOnlyRoute(t *testing.T, path string) {
+	t.Helper()
+	api := newTestAPI()
+	if rec := serveAPI(t, api, http.MethodPost, path, ""); rec.Code != http.StatusForbidden {
+		t.Errorf("%s with auth disabled: status %d, want 403", path, rec.Code)
+	}
+
+	cookie := adminSessionForTest(t)
+	if rec := serveAPI(t, api, http.MethodPost, path, ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("%s without a session: status %d, want 401", path, rec.Code)
+	}
+	req := httptest.NewRequest(http.MethodPost, apiV1Prefix+path, nil)
+	req.AddCookie(cookie)
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("%s as admin: status %d: %s", path, rec.Code, rec.Body.String())
+	}
+}
+
+func TestPruneRouteIsAdminOnly(t *testing.T) {
+	testDB := newTestDB(t)
+	setTestSetting(t, testDB, "message_retention_days", "30")
+	checkAdminOnlyRoute(t, "/maintenance/prune")
+}
+
+func TestSnapshotRouteIsAdminOnly(t *testing.T) {
+	newTestDB(t)
+	t.Setenv("DB_SNAPSHOT_DIR", t.TempDir())
+	checkAdminOnlyRoute(t, "/maintenance/snapshot")
+}
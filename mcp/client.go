@@ -1,15 +1,15 @@
 package mcp
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
+	"os"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -24,22 +24,32 @@ type MCPServer struct {
 	IsEnabled   bool   `json:"is_enabled"`
 }
 
+// MCPTool is a tool of a server. Name is unique across all servers and is what models
+// call; ToolName is the server's own name for it, which CallTool takes.
 type MCPTool struct {
 	Name        string                 `json:"name"`
 	Description string                 `json:"description"`
 	InputSchema map[string]interface{} `json:"input_schema"`
 	ServerID    int64                  `json:"server_id,omitempty"`
+	ToolName    string                 `json:"tool_name,omitempty"`
 }
 
 type MCPClient struct {
 	mu       sync.RWMutex
 	sessions map[int64]*mcpSession
+	// servers keeps the configuration of each connected server, including after its
+	// session is dropped, so the session can be reopened
+	servers map[int64]MCPServer
+	// lookup resolves ${NAME} references in stdio server configurations
+	lookup LookupFunc
 }
 
 type mcpSession struct {
 	client   *http.Client
 	endpoint string
 	serverID int64
+	// lastUsed is when the session was opened or last sent a request, in Unix nanoseconds
+	lastUsed atomic.Int64
 }
 
 var mcpClient *MCPClient
@@ -47,6 +57,8 @@ var mcpClient *MCPClient
 func InitMCPClient() {
 	mcpClient = &MCPClient{
 		sessions: make(map[int64]*mcpSession),
+		servers:  make(map[int64]MCPServer),
+		lookup:   os.LookupEnv,
 	}
 	log.Println("MCP client initialized")
 }
@@ -56,21 +68,38 @@ func GetMCPClient() *MCPClient {
 }
 
 func (c *MCPClient) ConnectServer(ctx context.Context, server *MCPServer) error {
+	if server.ServerType == "stdio" {
+		c.mu.Lock()
+		c.servers[server.ID] = *server
+		lookup := c.lookup
+		c.mu.Unlock()
+
+		// Resolve at spawn time, so secrets are read when needed and a missing one is
+		// reported by name
+		if _, err := ResolveLaunch(server, lookup); err != nil {
+			return err
+		}
+		return fmt.Errorf("MCP server %s: the stdio transport is not supported yet", server.Name)
+	}
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	c.servers[server.ID] = *server
 	if _, ok := c.sessions[server.ID]; ok {
 		log.Printf("MCP server already connected: %s (ID: %d)", server.Name, server.ID)
 		return nil
 	}
 
-	c.sessions[server.ID] = &mcpSession{
+	session := &mcpSession{
 		client: &http.Client{
 			Timeout: 15 * time.Second,
 		},
 		endpoint: server.EndpointURL,
 		serverID: server.ID,
 	}
+	session.lastUsed.Store(time.Now().UnixNano())
+	c.sessions[server.ID] = session
 
 	log.Printf("Connected to MCP server: %s (ID: %d), endpoint: %s", server.Name, server.ID, server.EndpointURL)
 	return nil
@@ -82,62 +111,12 @@ func (c *MCPClient) ListTools(ctx context.Context, serverID int64) ([]MCPTool, e
 	c.mu.RUnlock()
 
 	if !ok {
-		return nil, fmt.Errorf("no active session for server ID: %d", serverID)
-	}
-
-	reqBody := map[string]interface{}{
-		"jsonrpc": "2.0",
-		"id":      "1",
-		"method":  "tools/list",
-		"params":  map[string]interface{}{},
+		return nil, &TransportError{fmt.Errorf("no active session for server ID: %d", serverID)}
 	}
 
-	body, _ := json.Marshal(reqBody)
-
-	req, err := http.NewRequestWithContext(ctx, "POST", session.endpoint, bytes.NewReader(body))
+	result, err := session.rpc(ctx, "1", "tools/list", map[string]interface{}{})
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Add("Accept", "application/json")
-	req.Header.Add("Accept", "text/event-stream")
-
-	resp, err := session.client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("request failed: %w", err)
-	}
-	defer resp.Body.Close()
-
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
-	}
-
-	respBodyStr := string(respBody)
-	var jsonStr string
-
-	if strings.Contains(respBodyStr, "data: ") {
-		dataLine := strings.Split(respBodyStr, "data: ")[1]
-		jsonStr = strings.TrimSpace(dataLine)
-		if idx := strings.Index(jsonStr, "\n"); idx != -1 {
-			jsonStr = jsonStr[:idx]
-		}
-	} else {
-		jsonStr = respBodyStr
-	}
-
-	var response map[string]interface{}
-	if err := json.Unmarshal([]byte(jsonStr), &response); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w, body: %s", err, jsonStr[:min(200, len(jsonStr))])
-	}
-
-	if errorResp, ok := response["error"].(map[string]interface{}); ok {
-		return nil, fmt.Errorf("MCP error: %v", errorResp)
-	}
-
-	result, ok := response["result"].(map[string]interface{})
-	if !ok {
-		return nil, fmt.Errorf("invalid response format")
+		return nil, err
 	}
 
 	toolsArr, ok := result["tools"].([]interface{})
@@ -163,8 +142,15 @@ func (c *MCPClient) ListTools(ctx context.Context, serverID int64) ([]MCPTool, e
 	return tools, nil
 }
 
+// GetAllEnabledTools lists the tools of the enabled servers, named with their server's
+// prefix. Servers are taken in ID order, so when two prefixed names collide the server
+// added later gets the numbered name and existing names stay the same.
 func (c *MCPClient) GetAllEnabledTools(ctx context.Context, servers []*MCPServer) ([]MCPTool, error) {
 	var allTools []MCPTool
+	used := make(map[string]bool)
+
+	servers = append([]*MCPServer(nil), servers...)
+	sort.Slice(servers, func(i, j int) bool { return servers[i].ID < servers[j].ID })
 
 	for _, server := range servers {
 		if !server.IsEnabled {
@@ -183,7 +169,8 @@ func (c *MCPClient) GetAllEnabledTools(ctx context.Context, servers []*MCPServer
 		}
 
 		for i := range tools {
-			tools[i].Name = fmt.Sprintf("%s_%s", sanitizeName(server.Name), tools[i].Name)
+			tools[i].ToolName = tools[i].Name
+			tools[i].Name = UniqueToolName(ToolNamePrefix(server.Name)+tools[i].Name, used)
 			tools[i].ServerID = server.ID
 		}
 
@@ -194,86 +181,54 @@ func (c *MCPClient) GetAllEnabledTools(ctx context.Context, servers []*MCPServer
 	return allTools, nil
 }
 
-func (c *MCPClient) CallTool(ctx context.Context, serverID int64, name string, arguments map[string]interface{}) ([]byte, error) {
-	c.mu.RLock()
-	session, ok := c.sessions[serverID]
-	c.mu.RUnlock()
-
-	if !ok {
-		log.Printf("Warning: no active session for server ID: %d. Available sessions: %v", serverID, func() []int64 {
-			c.mu.RLock()
-			defer c.mu.RUnlock()
-			keys := make([]int64, 0, len(c.sessions))
-			for k := range c.sessions {
-				keys = append(keys, k)
-			}
-			return keys
-		}())
-		return nil, fmt.Errorf("no active session for server ID: %d", serverID)
-	}
-
-	// Remove server prefix from tool name (format: servername_toolname)
-	toolName := name
-	if idx := strings.Index(name, "_"); idx != -1 {
-		toolName = name[idx+1:]
+// CheckServer connects to the server if needed and lists its tools, returning how many
+// it offers. A failed check drops the session, so the next check reconnects from scratch
+// once the server is back.
+func (c *MCPClient) CheckServer(ctx context.Context, server *MCPServer) (int, error) {
+	if err := c.ConnectServer(ctx, server); err != nil {
+		return 0, err
 	}
-
-	reqBody := map[string]interface{}{
-		"jsonrpc": "2.0",
-		"id":      fmt.Sprintf("%d", time.Now().UnixNano()),
-		"method":  "tools/call",
-		"params": map[string]interface{}{
-			"name":      toolName,
-			"arguments": arguments,
-		},
-	}
-
-	body, _ := json.Marshal(reqBody)
-
-	req, err := http.NewRequestWithContext(ctx, "POST", session.endpoint, bytes.NewReader(body))
+	tools, err := c.ListTools(ctx, server.ID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		c.dropSession(server.ID)
+		return 0, err
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Add("Accept", "application/json")
-	req.Header.Add("Accept", "text/event-stream")
-
-	resp, err := session.client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("request failed: %w", err)
-	}
-	defer resp.Body.Close()
+	return len(tools), nil
+}
 
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+// reconnect replaces the server's session with a new one
+func (c *MCPClient) reconnect(ctx context.Context, serverID int64) error {
+	c.mu.RLock()
+	server, ok := c.servers[serverID]
+	c.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("server ID %d was never connected", serverID)
 	}
 
-	respBodyStr := string(respBody)
-	var jsonStr string
-
-	if strings.Contains(respBodyStr, "data: ") {
-		dataLine := strings.Split(respBodyStr, "data: ")[1]
-		jsonStr = strings.TrimSpace(dataLine)
-		if idx := strings.Index(jsonStr, "\n"); idx != -1 {
-			jsonStr = jsonStr[:idx]
-		}
-	} else {
-		jsonStr = respBodyStr
-	}
+	c.dropSession(serverID)
+	return c.ConnectServer(ctx, &server)
+}
 
-	var response map[string]interface{}
-	if err := json.Unmarshal([]byte(jsonStr), &response); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
-	}
+// dropSession closes the server's session but remembers the server for reconnecting
+func (c *MCPClient) dropSession(serverID int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	if errorResp, ok := response["error"].(map[string]interface{}); ok {
-		return nil, fmt.Errorf("MCP error: %v", errorResp)
+	if session, ok := c.sessions[serverID]; ok {
+		session.client.CloseIdleConnections()
 	}
+	delete(c.sessions, serverID)
+}
 
-	result, ok := response["result"].(map[string]interface{})
-	if !ok {
-		return nil, fmt.Errorf("invalid response format")
+// CallTool runs a tool by the server's own name for it (MCPTool.ToolName), reconnecting
+// and retrying once when the exchange itself fails
+func (c *MCPClient) CallTool(ctx context.Context, serverID int64, toolName string, arguments map[string]interface{}) ([]byte, error) {
+	result, err := c.request(ctx, serverID, "tools/call", map[string]interface{}{
+		"name":      toolName,
+		"arguments": arguments,
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	contentArr, ok := result["content"].([]interface{})
@@ -295,11 +250,45 @@ func (c *MCPClient) CallTool(ctx context.Context, serverID int64, name string, a
 	return []byte(responseBuilder.String()), nil
 }
 
+// IsConnected reports whether a session is open for the server
+func (c *MCPClient) IsConnected(serverID int64) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	_, ok := c.sessions[serverID]
+	return ok
+}
+
+// CloseIdleSessions closes the sessions of stdio servers that have not sent a request
+// within timeout, returning their server IDs; the next request reopens them. A stdio
+// session will hold a running process once that transport is implemented; until then
+// ConnectServer opens no stdio sessions and this closes nothing. HTTP sessions cost
+// nothing while unused and stay open.
+func (c *MCPClient) CloseIdleSessions(timeout time.Duration) []int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cutoff := time.Now().Add(-timeout).UnixNano()
+	var closed []int64
+	for id, session := range c.sessions {
+		if c.servers[id].ServerType != "stdio" || session.lastUsed.Load() > cutoff {
+			continue
+		}
+		session.client.CloseIdleConnections()
+		delete(c.sessions, id)
+		closed = append(closed, id)
+	}
+	return closed
+}
+
 func (c *MCPClient) DisconnectServer(serverID int64) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	if session, ok := c.sessions[serverID]; ok {
+		session.client.CloseIdleConnections()
+	}
 	delete(c.sessions, serverID)
+	delete(c.servers, serverID)
 	log.Printf("Disconnected MCP server ID: %d", serverID)
 }
 
@@ -307,10 +296,30 @@ func (c *MCPClient) DisconnectAll() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	for _, session := range c.sessions {
+		session.client.CloseIdleConnections()
+	}
 	c.sessions = make(map[int64]*mcpSession)
+	c.servers = make(map[int64]MCPServer)
 	log.Println("Disconnected all MCP servers")
 }
 
+// ToolNamePrefix is the prefix of a server's tool names
+func ToolNamePrefix(serverName string) string {
+	return sanitizeName(serverName) + "_"
+}
+
+// UniqueToolName returns name, or name with the lowest free numeric suffix when it is
+// already in used, and records the result in used
+func UniqueToolName(name string, used map[string]bool) string {
+	unique := name
+	for n := 2; used[unique]; n++ {
+		unique = fmt.Sprintf("%s_%d", name, n)
+	}
+	used[unique] = true
+	return unique
+}
+
 func sanitizeName(name string) string {
 	name = strings.ReplaceAll(name, " ", "_")
 	name = strings.ToLower(name)
@@ -0,0 +1,86 @@
+package mcp
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCloseIdleSessionsClosesOnlyIdleStdioSessions(t *testing.T) {
+	c := newTestClient()
+	addSession := func(id int64, serverType string, lastUsed time.Time) {
+		c.servers[id] = MCPServer{ID: id, ServerType: serverType}
+		session := &mcpSession{client: &http.Client{}, serverID: id}
+		session.lastUsed.Store(lastUsed.UnixNano())
+		c.sessions[id] = session
+	}
+	addSession(1, "stdio", time.Now().Add(-time.Hour))
+	addSession(2, "stdio", time.Now())
+	addSession(3, "http", time.Now().Add(-time.Hour))
+
+	closed := c.CloseIdleSessions(15 * time.Minute)
+	if len(closed) != 1 || closed[0] != 1 {
+		t.Fatalf("closed = %v, want [1]", closed)
+	}
+	for id, want := range map[int64]bool{1: false, 2: true, 3: true} {
+		if got := c.IsConnected(id); got != want {
+			t.Errorf("server %d connected = %v, want %v", id, got, want)
+		}
+	}
+	if _, ok := c.servers[1]; !ok {
+		t.Error("expected the closed server's configuration to be kept for reconnecting")
+	}
+}
+
+func TestUniqueToolName(t *testing.T) {
+	used := map[string]bool{}
+	for _, tc := range []struct{ name, want string }{
+		{"search", "search"},
+		{"search", "search_2"},
+		{"search", "search_3"},
+		{"search_2", "search_2_2"},
+		{"fetch", "fetch"},
+	} {
+		if got := UniqueToolName(tc.name, used); got != tc.want {
+			t.Errorf("UniqueToolName(%q) = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestGetAllEnabledToolsDisambiguatesCollidingServers(t *testing.T) {
+	first, _ := newMockServer(t, "search", 0)
+	second, _ := newMockServer(t, "search", 0)
+	c := newTestClient()
+	// Both names truncate to the same 20-character prefix; the later ID is listed first
+	servers := []*MCPServer{
+		{ID: 2, Name: "my-company-internal-tools-b", ServerType: "http", EndpointURL: second.URL, IsEnabled: true},
+		{ID: 1, Name: "my-company-internal-tools-a", ServerType: "http", EndpointURL: first.URL, IsEnabled: true},
+	}
+	if ToolNamePrefix(servers[0].Name) != ToolNamePrefix(servers[1].Name) {
+		t.Fatal("expected the server names to share a prefix")
+	}
+
+	tools, err := c.GetAllEnabledTools(context.Background(), servers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tools) != 2 {
+		t.Fatalf("got %d tools, want 2", len(tools))
+	}
+	byName := map[string]MCPTool{}
+	for _, tool := range tools {
+		byName[tool.Name] = tool
+	}
+	prefix := ToolNamePrefix(servers[0].Name)
+	for name, serverID := range map[string]int64{prefix + "search": 1, prefix + "search_2": 2} {
+		tool, ok := byName[name]
+		if !ok {
+			t.Errorf("missing tool %s in %v", name, tools)
+			continue
+		}
+		if tool.ServerID != serverID || tool.ToolName != "search" {
+			t.Errorf("%s: server %d, tool %q; want server %d, tool \"search\"", name, tool.ServerID, tool.ToolName, serverID)
+		}
+	}
+}
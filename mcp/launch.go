@@ -0,0 +1,116 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// LookupFunc resolves a ${NAME} reference in a stdio server's configuration
+type LookupFunc func(name string) (string, bool)
+
+// LaunchSpec is the process a stdio server runs, with its variables resolved
+type LaunchSpec struct {
+	Command string
+	Args    []string
+	Env     map[string]string
+}
+
+// variableRef matches ${NAME} and the $${NAME} escape for a literal ${NAME}
+var variableRef = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// MissingVariablesError lists the ${NAME} references in a server's configuration that
+// no source defines
+type MissingVariablesError struct {
+	Server string
+	Names  []string
+}
+
+func (e *MissingVariablesError) Error() string {
+	return fmt.Sprintf("MCP server %s references undefined variables %s; set them as encrypted mcp_secret_<NAME> settings, or in the host environment if named MCP_ENV_* or listed in MCP_ALLOWED_ENV",
+		e.Server, strings.Join(e.Names, ", "))
+}
+
+// SetVariableLookup sets where ${NAME} references are resolved from. The default is the
+// host environment.
+func (c *MCPClient) SetVariableLookup(lookup LookupFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lookup = lookup
+}
+
+// ResolveLaunch parses a stdio server's command, arguments (a JSON array, or
+// space-separated) and environment (a JSON object) and replaces every ${NAME} in them.
+// Arguments are split before interpolation, so a value containing spaces stays one
+// argument. All undefined names are reported together in a MissingVariablesError.
+func ResolveLaunch(server *MCPServer, lookup LookupFunc) (*LaunchSpec, error) {
+	if lookup == nil {
+		lookup = os.LookupEnv
+	}
+
+	args, err := parseArgs(server.Args)
+	if err != nil {
+		return nil, fmt.Errorf("MCP server %s: invalid args: %w", server.Name, err)
+	}
+	env := map[string]string{}
+	if strings.TrimSpace(server.EnvVars) != "" {
+		if err := json.Unmarshal([]byte(server.EnvVars), &env); err != nil {
+			return nil, fmt.Errorf("MCP server %s: env_vars must be a JSON object of strings: %w", server.Name, err)
+		}
+	}
+
+	missing := map[string]bool{}
+	interpolate := func(s string) string {
+		return variableRef.ReplaceAllStringFunc(s, func(ref string) string {
+			if strings.HasPrefix(ref, "$$") {
+				return ref[1:]
+			}
+			name := ref[2 : len(ref)-1]
+			value, ok := lookup(name)
+			if !ok {
+				missing[name] = true
+			}
+			return value
+		})
+	}
+
+	spec := &LaunchSpec{
+		Command: interpolate(strings.TrimSpace(server.Command)),
+		Args:    make([]string, len(args)),
+		Env:     make(map[string]string, len(env)),
+	}
+	for i, arg := range args {
+		spec.Args[i] = interpolate(arg)
+	}
+	for key, value := range env {
+		spec.Env[key] = interpolate(value)
+	}
+
+	if len(missing) > 0 {
+		names := make([]string, 0, len(missing))
+		for name := range missing {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, &MissingVariablesError{Server: server.Name, Names: names}
+	}
+	if spec.Command == "" {
+		return nil, fmt.Errorf("MCP server %s has no command", server.Name)
+	}
+	return spec, nil
+}
+
+func parseArgs(args string) ([]string, error) {
+	args = strings.TrimSpace(args)
+	if !strings.HasPrefix(args, "[") {
+		return strings.Fields(args), nil
+	}
+	var list []string
+	if err := json.Unmarshal([]byte(args), &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
@@ -0,0 +1,83 @@
+package mcp
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func mapLookup(vars map[string]string) LookupFunc {
+	return func(name string) (string, bool) {
+		value, ok := vars[name]
+		return value, ok
+	}
+}
+
+func TestResolveLaunchInterpolates(t *testing.T) {
+	server := &MCPServer{
+		Name:    "github",
+		Command: "${BIN}/server",
+		Args:    `["--token", "${TOKEN}", "--label=${LABEL}"]`,
+		EnvVars: `{"AUTH": "Bearer ${TOKEN}", "LITERAL": "$${TOKEN}"}`,
+	}
+	spec, err := ResolveLaunch(server, mapLookup(map[string]string{
+		"BIN":   "/opt/mcp",
+		"TOKEN": "abc123",
+		"LABEL": "two words",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.Command != "/opt/mcp/server" {
+		t.Errorf("command = %q", spec.Command)
+	}
+	if want := []string{"--token", "abc123", "--label=two words"}; !reflect.DeepEqual(spec.Args, want) {
+		t.Errorf("args = %q, want %q", spec.Args, want)
+	}
+	if want := map[string]string{"AUTH": "Bearer abc123", "LITERAL": "${TOKEN}"}; !reflect.DeepEqual(spec.Env, want) {
+		t.Errorf("env = %v, want %v", spec.Env, want)
+	}
+}
+
+func TestResolveLaunchSplitsPlainArgsBeforeInterpolating(t *testing.T) {
+	server := &MCPServer{Name: "fs", Command: "mcp-fs", Args: "--root ${ROOT}"}
+	spec, err := ResolveLaunch(server, mapLookup(map[string]string{"ROOT": "/my files"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"--root", "/my files"}; !reflect.DeepEqual(spec.Args, want) {
+		t.Errorf("args = %q, want %q", spec.Args, want)
+	}
+}
+
+func TestResolveLaunchReportsMissingVariables(t *testing.T) {
+	server := &MCPServer{
+		Name:    "slack",
+		Command: "mcp-slack",
+		Args:    `["${WORKSPACE}", "$${ESCAPED}"]`,
+		EnvVars: `{"TOKEN": "${SLACK_TOKEN}", "AGAIN": "${WORKSPACE}"}`,
+	}
+	_, err := ResolveLaunch(server, mapLookup(nil))
+	var missing *MissingVariablesError
+	if !errors.As(err, &missing) {
+		t.Fatalf("expected a MissingVariablesError, got %v", err)
+	}
+	if want := []string{"SLACK_TOKEN", "WORKSPACE"}; !reflect.DeepEqual(missing.Names, want) {
+		t.Errorf("missing = %q, want %q", missing.Names, want)
+	}
+	if missing.Server != "slack" {
+		t.Errorf("server = %q", missing.Server)
+	}
+}
+
+func TestResolveLaunchRejectsBadConfiguration(t *testing.T) {
+	for _, server := range []*MCPServer{
+		{Name: "bad-args", Command: "x", Args: `["unterminated"`},
+		{Name: "bad-env", Command: "x", EnvVars: `["not", "an", "object"]`},
+		{Name: "no-command", Command: "  "},
+	} {
+		if _, err := ResolveLaunch(server, mapLookup(nil)); err == nil {
+			t.Errorf("%s: expected an error", server.Name)
+		}
+	}
+}
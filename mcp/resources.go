@@ -0,0 +1,132 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// MCPResource is a document or other data a server exposes by URI
+type MCPResource struct {
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+// MCPResourceContent is one part of a read resource: Text for text resources, Blob
+// (base64) for binary ones
+type MCPResourceContent struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType,omitempty"`
+	Text     string `json:"text,omitempty"`
+	Blob     string `json:"blob,omitempty"`
+}
+
+// MCPPrompt is a prompt template a server offers
+type MCPPrompt struct {
+	Name        string              `json:"name"`
+	Description string              `json:"description,omitempty"`
+	Arguments   []MCPPromptArgument `json:"arguments,omitempty"`
+}
+
+type MCPPromptArgument struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+// MCPPromptMessage is one message of a rendered prompt. Only text content is kept.
+type MCPPromptMessage struct {
+	Role string `json:"role"`
+	Text string `json:"text"`
+}
+
+// ListResources returns the resources the server exposes
+func (c *MCPClient) ListResources(ctx context.Context, serverID int64) ([]MCPResource, error) {
+	result, err := c.request(ctx, serverID, "resources/list", map[string]interface{}{})
+	if err != nil {
+		return nil, err
+	}
+	var list struct {
+		Resources []MCPResource `json:"resources"`
+	}
+	if err := decodeResult(result, &list); err != nil {
+		return nil, err
+	}
+	if list.Resources == nil {
+		list.Resources = []MCPResource{}
+	}
+	return list.Resources, nil
+}
+
+// ReadResource returns the contents of the resource at uri
+func (c *MCPClient) ReadResource(ctx context.Context, serverID int64, uri string) ([]MCPResourceContent, error) {
+	result, err := c.request(ctx, serverID, "resources/read", map[string]interface{}{"uri": uri})
+	if err != nil {
+		return nil, err
+	}
+	var read struct {
+		Contents []MCPResourceContent `json:"contents"`
+	}
+	if err := decodeResult(result, &read); err != nil {
+		return nil, err
+	}
+	return read.Contents, nil
+}
+
+// ListPrompts returns the prompt templates the server offers
+func (c *MCPClient) ListPrompts(ctx context.Context, serverID int64) ([]MCPPrompt, error) {
+	result, err := c.request(ctx, serverID, "prompts/list", map[string]interface{}{})
+	if err != nil {
+		return nil, err
+	}
+	var list struct {
+		Prompts []MCPPrompt `json:"prompts"`
+	}
+	if err := decodeResult(result, &list); err != nil {
+		return nil, err
+	}
+	if list.Prompts == nil {
+		list.Prompts = []MCPPrompt{}
+	}
+	return list.Prompts, nil
+}
+
+// GetPrompt renders a prompt template with its arguments. Image and embedded resource
+// content of the messages is dropped.
+func (c *MCPClient) GetPrompt(ctx context.Context, serverID int64, name string, arguments map[string]string) (string, []MCPPromptMessage, error) {
+	params := map[string]interface{}{"name": name}
+	if len(arguments) > 0 {
+		params["arguments"] = arguments
+	}
+	result, err := c.request(ctx, serverID, "prompts/get", params)
+	if err != nil {
+		return "", nil, err
+	}
+	var prompt struct {
+		Description string `json:"description"`
+		Messages    []struct {
+			Role    string `json:"role"`
+			Content struct {
+				Type string `json:"type"`
+				Text string `json:"text"`
+			} `json:"content"`
+		} `json:"messages"`
+	}
+	if err := decodeResult(result, &prompt); err != nil {
+		return "", nil, err
+	}
+
+	messages := make([]MCPPromptMessage, 0, len(prompt.Messages))
+	for _, m := range prompt.Messages {
+		if m.Content.Type != "text" || strings.TrimSpace(m.Content.Text) == "" {
+			continue
+		}
+		messages = append(messages, MCPPromptMessage{Role: m.Role, Text: m.Content.Text})
+	}
+	if len(messages) == 0 {
+		return prompt.Description, messages, fmt.Errorf("prompt %s has no text messages", name)
+	}
+	return prompt.Description, messages, nil
+}
@@ -0,0 +1,138 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// TransportError is a failure to exchange a request with the server: it could not be
+// reached, the connection broke, or it answered with an HTTP error. Reconnecting may
+// fix it, unlike an RPCError.
+type TransportError struct {
+	Err error
+}
+
+func (e *TransportError) Error() string { return e.Err.Error() }
+func (e *TransportError) Unwrap() error { return e.Err }
+
+// RPCError is a JSON-RPC error the server returned, such as an unknown tool or invalid
+// arguments. The server handled the request, so retrying would fail the same way.
+type RPCError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("MCP error %d: %s", e.Code, e.Message)
+}
+
+// request sends a JSON-RPC request on the server's session. When the exchange itself
+// fails, as with a stale connection or a restarted server, the session is reopened and
+// the request is retried once; errors the server returns are not retried.
+func (c *MCPClient) request(ctx context.Context, serverID int64, method string, params map[string]interface{}) (map[string]interface{}, error) {
+	result, err := c.requestOnce(ctx, serverID, method, params)
+	var transportErr *TransportError
+	if !errors.As(err, &transportErr) || ctx.Err() != nil {
+		return result, err
+	}
+
+	log.Printf("MCP server ID %d: %v; reconnecting and retrying %s", serverID, err, method)
+	if reconnectErr := c.reconnect(ctx, serverID); reconnectErr != nil {
+		return nil, fmt.Errorf("%w (reconnect failed: %v)", err, reconnectErr)
+	}
+	return c.requestOnce(ctx, serverID, method, params)
+}
+
+func (c *MCPClient) requestOnce(ctx context.Context, serverID int64, method string, params map[string]interface{}) (map[string]interface{}, error) {
+	c.mu.RLock()
+	session, ok := c.sessions[serverID]
+	c.mu.RUnlock()
+
+	if !ok {
+		return nil, &TransportError{fmt.Errorf("no active session for server ID: %d", serverID)}
+	}
+	session.lastUsed.Store(time.Now().UnixNano())
+	return session.rpc(ctx, fmt.Sprintf("%d", time.Now().UnixNano()), method, params)
+}
+
+// decodeResult converts a JSON-RPC result into a typed value
+func decodeResult(result map[string]interface{}, out interface{}) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("invalid response format: %w", err)
+	}
+	return nil
+}
+
+// rpc sends one JSON-RPC request and returns its result. Servers may answer with plain
+// JSON or with a server-sent event whose data line holds the response.
+func (s *mcpSession) rpc(ctx context.Context, id, method string, params map[string]interface{}) (map[string]interface{}, error) {
+	body, _ := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"method":  method,
+		"params":  params,
+	})
+
+	req, err := http.NewRequestWithContext(ctx, "POST", s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Add("Accept", "application/json")
+	req.Header.Add("Accept", "text/event-stream")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, &TransportError{fmt.Errorf("request failed: %w", err)}
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, &TransportError{fmt.Errorf("failed to read response: %w", err)}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, &TransportError{fmt.Errorf("server returned %s: %s", resp.Status, strings.TrimSpace(string(respBody[:min(200, len(respBody))])))}
+	}
+
+	respBodyStr := string(respBody)
+	var jsonStr string
+
+	if strings.Contains(respBodyStr, "data: ") {
+		dataLine := strings.Split(respBodyStr, "data: ")[1]
+		jsonStr = strings.TrimSpace(dataLine)
+		if idx := strings.Index(jsonStr, "\n"); idx != -1 {
+			jsonStr = jsonStr[:idx]
+		}
+	} else {
+		jsonStr = respBodyStr
+	}
+
+	var response struct {
+		Result map[string]interface{} `json:"result"`
+		Error  *RPCError              `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(jsonStr), &response); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w, body: %s", err, jsonStr[:min(200, len(jsonStr))])
+	}
+	if response.Error != nil {
+		return nil, response.Error
+	}
+	if response.Result == nil {
+		return nil, fmt.Errorf("invalid response format")
+	}
+	return response.Result, nil
+}
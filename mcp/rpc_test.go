@@ -0,0 +1,102 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// newMockServer answers tools/list with one tool named toolName and tools/call with the
+// name of the tool called. The first failures requests get a 503, then it recovers.
+func newMockServer(t *testing.T, toolName string, failures int32) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := requests.Add(1)
+		if n <= failures {
+			http.Error(w, "restarting", http.StatusServiceUnavailable)
+			return
+		}
+		var req struct {
+			ID     string                 `json:"id"`
+			Method string                 `json:"method"`
+			Params map[string]interface{} `json:"params"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+
+		var result interface{}
+		switch req.Method {
+		case "tools/list":
+			result = map[string]interface{}{"tools": []map[string]interface{}{{"name": toolName, "description": "mock tool"}}}
+		case "tools/call":
+			if req.Params["name"] == "broken" {
+				json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "error": map[string]interface{}{"code": -32602, "message": "invalid arguments"}})
+				return
+			}
+			result = map[string]interface{}{"content": []map[string]interface{}{{"type": "text", "text": "called " + req.Params["name"].(string)}}}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": result})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func newTestClient() *MCPClient {
+	return &MCPClient{
+		sessions: make(map[int64]*mcpSession),
+		servers:  make(map[int64]MCPServer),
+	}
+}
+
+func TestCallToolRetriesOnceAfterATransportFailure(t *testing.T) {
+	srv, requests := newMockServer(t, "search", 1)
+	c := newTestClient()
+	if err := c.ConnectServer(context.Background(), &MCPServer{ID: 1, Name: "mock", ServerType: "http", EndpointURL: srv.URL}); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := c.CallTool(context.Background(), 1, "search", nil)
+	if err != nil {
+		t.Fatalf("CallTool after one failure: %v", err)
+	}
+	if string(out) != "called search" {
+		t.Errorf("result = %q", out)
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("server saw %d requests, want the failed one and one retry", got)
+	}
+}
+
+func TestCallToolGivesUpAfterOneRetry(t *testing.T) {
+	srv, requests := newMockServer(t, "search", 100)
+	c := newTestClient()
+	c.ConnectServer(context.Background(), &MCPServer{ID: 1, Name: "mock", ServerType: "http", EndpointURL: srv.URL})
+
+	_, err := c.CallTool(context.Background(), 1, "search", nil)
+	var transportErr *TransportError
+	if !errors.As(err, &transportErr) {
+		t.Errorf("error = %v, want a TransportError", err)
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("server saw %d requests, want 2", got)
+	}
+}
+
+func TestCallToolDoesNotRetryRPCErrors(t *testing.T) {
+	srv, requests := newMockServer(t, "broken", 0)
+	c := newTestClient()
+	c.ConnectServer(context.Background(), &MCPServer{ID: 1, Name: "mock", ServerType: "http", EndpointURL: srv.URL})
+
+	_, err := c.CallTool(context.Background(), 1, "broken", nil)
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) || rpcErr.Code != -32602 {
+		t.Errorf("error = %v, want the server's RPCError", err)
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("server saw %d requests, want 1", got)
+	}
+}
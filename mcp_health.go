@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/contactwajeeh/ollamagoweb-v2/mcp"
+)
+
+const (
+	// mcpHealthInterval is how often enabled MCP servers are checked
+	mcpHealthInterval = time.Minute
+	// mcpHealthTimeout bounds one server's check
+	mcpHealthTimeout = 10 * time.Second
+	// defaultMCPIdleTimeoutMinutes applies when mcp_idle_timeout_minutes is not set
+	defaultMCPIdleTimeoutMinutes = 15
+)
+
+// RunMCPHealthChecks checks every enabled MCP server on startup and then once a minute,
+// so the server list shows which ones are reachable, and stops stdio servers that have
+// gone unused
+func RunMCPHealthChecks() {
+	checkMCPServers(context.Background(), db)
+
+	ticker := time.NewTicker(mcpHealthInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		closeIdleMCPSessions(db)
+		checkMCPServers(context.Background(), db)
+	}
+}
+
+// closeIdleMCPSessions stops the stdio servers that have made no request for
+// mcp_idle_timeout_minutes (0 keeps them running); they start again on their next use
+func closeIdleMCPSessions(db *sql.DB) {
+	client := mcp.GetMCPClient()
+	if client == nil {
+		return
+	}
+	minutes, err := strconv.Atoi(GetSetting(db, "mcp_idle_timeout_minutes", strconv.Itoa(defaultMCPIdleTimeoutMinutes)))
+	if err != nil || minutes <= 0 {
+		return
+	}
+	for _, id := range client.CloseIdleSessions(time.Duration(minutes) * time.Minute) {
+		log.Printf("Stopped MCP server ID %d after %d idle minutes", id, minutes)
+	}
+}
+
+// checkMCPServers lists the tools of each enabled server and stores the outcome in its
+// status, last_checked, last_ok and last_error columns. A server that failed is
+// reconnected by the next check that reaches it.
+func checkMCPServers(ctx context.Context, db *sql.DB) {
+	client := mcp.GetMCPClient()
+	if client == nil {
+		return
+	}
+	servers, err := enabledMCPServers(db)
+	if err != nil {
+		log.Printf("Error loading MCP servers for health check: %v", err)
+		return
+	}
+
+	for _, server := range servers {
+		// A stdio check would start the process, so only running ones are checked and
+		// idle servers can stay stopped
+		if server.ServerType == "stdio" && !client.IsConnected(server.ID) {
+			continue
+		}
+
+		var previous sql.NullString
+		db.QueryRow("SELECT status FROM mcp_servers WHERE id = ?", server.ID).Scan(&previous)
+
+		checkCtx, cancel := context.WithTimeout(ctx, mcpHealthTimeout)
+		tools, err := client.CheckServer(checkCtx, server)
+		cancel()
+
+		if err != nil {
+			if previous.String != "error" {
+				log.Printf("MCP server %s is unreachable: %v", server.Name, err)
+			}
+			_, err = db.Exec(`
+				UPDATE mcp_servers SET status = 'error', last_checked = CURRENT_TIMESTAMP, last_error = ?
+				WHERE id = ?
+			`, err.Error(), server.ID)
+		} else {
+			if previous.String == "error" {
+				log.Printf("MCP server %s is reachable again (%d tools)", server.Name, tools)
+			}
+			_, err = db.Exec(`
+				UPDATE mcp_servers SET status = 'ok', last_checked = CURRENT_TIMESTAMP, last_ok = CURRENT_TIMESTAMP, last_error = NULL
+				WHERE id = ?
+			`, server.ID)
+		}
+		if err != nil {
+			log.Printf("Error saving health of MCP server %s: %v", server.Name, err)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"os"
+	"strings"
+)
+
+// mcpSecretSettingPrefix names the settings holding secrets for stdio MCP servers: a
+// ${NAME} reference is resolved from the setting mcp_secret_NAME, which is stored
+// encrypted, before the host environment
+const mcpSecretSettingPrefix = "mcp_secret_"
+
+// mcpEnvPrefix marks host environment variables that server configuration may read.
+// Other variables must be listed in MCP_ALLOWED_ENV, so a server definition cannot
+// pull ENCRYPTION_KEY or other secrets of the app itself.
+const mcpEnvPrefix = "MCP_ENV_"
+
+// mcpEnvAllowed reports whether ${name} may be read from the host environment
+func mcpEnvAllowed(name string) bool {
+	if strings.HasPrefix(name, mcpEnvPrefix) {
+		return true
+	}
+	for _, allowed := range strings.Split(os.Getenv("MCP_ALLOWED_ENV"), ",") {
+		if strings.TrimSpace(allowed) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupMCPVariable resolves a ${NAME} reference in a stdio MCP server's configuration
+func lookupMCPVariable(db *sql.DB) func(name string) (string, bool) {
+	return func(name string) (string, bool) {
+		if stored := GetSetting(db, mcpSecretSettingPrefix+name, ""); stored != "" {
+			value, err := Decrypt(stored)
+			if err == nil {
+				return value, true
+			}
+			log.Printf("Error decrypting MCP secret %s: %v", name, err)
+		}
+		if !mcpEnvAllowed(name) {
+			return "", false
+		}
+		return os.LookupEnv(name)
+	}
+}
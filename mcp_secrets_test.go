@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestLookupMCPVariable(t *testing.T) {
+	testDB := newTestDB(t)
+	encrypted, err := Encrypt("from-settings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testDB.Exec("INSERT INTO settings (key, value) VALUES (?, ?)", mcpSecretSettingPrefix+"API_TOKEN", encrypted); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("API_TOKEN", "from-env")
+	t.Setenv("MCP_ENV_GITHUB", "prefixed")
+	t.Setenv("LISTED", "listed")
+	t.Setenv("MCP_ALLOWED_ENV", "OTHER, LISTED")
+	t.Setenv("UNLISTED", "secret")
+
+	lookup := lookupMCPVariable(testDB)
+	for name, want := range map[string]string{
+		"API_TOKEN":      "from-settings",
+		"MCP_ENV_GITHUB": "prefixed",
+		"LISTED":         "listed",
+	} {
+		if got, ok := lookup(name); !ok || got != want {
+			t.Errorf("%s = %q, %v; want %q", name, got, ok, want)
+		}
+	}
+	for _, name := range []string{"UNLISTED", "ENCRYPTION_KEY", "MCP_ENV_UNSET"} {
+		if got, ok := lookup(name); ok {
+			t.Errorf("%s resolved to %q, want it refused", name, got)
+		}
+	}
+}
@@ -6,7 +6,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -20,26 +22,87 @@ type Memory struct {
 	Value      string `json:"value"`
 	Category   string `json:"category"`
 	Confidence int    `json:"confidence"`
+	ExpiresAt  string `json:"expires_at,omitempty"`
 	CreatedAt  string `json:"created_at"`
 	UpdatedAt  string `json:"updated_at"`
 }
 
-func SetMemory(db *sql.DB, sessionID, key, value, category string, confidence int) error {
+// sqliteTimeFormat matches CURRENT_TIMESTAMP so stored times compare correctly in SQL
+const sqliteTimeFormat = "2006-01-02 15:04:05"
+
+// defaultMemoryTTLs applies when no memory_ttl_<category> setting (in hours) exists
+var defaultMemoryTTLs = map[string]string{
+	"reminder": "168",
+}
+
+// defaultMemoryExpiry returns the expiry implied by the category's TTL, or nil if it never expires
+func defaultMemoryExpiry(db *sql.DB, category string) *time.Time {
+	hours, err := strconv.Atoi(GetSetting(db, "memory_ttl_"+category, defaultMemoryTTLs[category]))
+	if err != nil || hours <= 0 {
+		return nil
+	}
+	expiresAt := time.Now().Add(time.Duration(hours) * time.Hour)
+	return &expiresAt
+}
+
+// SetMemory stores or updates a memory. A nil expiresAt applies the category's default TTL.
+func SetMemory(db *sql.DB, sessionID, key, value, category string, confidence int, expiresAt *time.Time) error {
+	if expiresAt == nil {
+		expiresAt = defaultMemoryExpiry(db, category)
+	}
+	if err := upsertMemory(db, sessionID, key, value, category, confidence, expiresAt); err != nil {
+		return err
+	}
+
+	QueueMemoryEmbedding(db, sessionID, key)
+	return nil
+}
+
+// upsertMemory writes a memory row; an existing (session_id, key) keeps its category and
+// takes the new value, confidence and expiry. A changed value clears the stored vector so
+// it never outlives the text it was computed from.
+func upsertMemory(exec settingsExecer, sessionID, key, value, category string, confidence int, expiresAt *time.Time) error {
+	var expires interface{}
+	if expiresAt != nil {
+		expires = expiresAt.UTC().Format(sqliteTimeFormat)
+	}
+
 	query := `
-		INSERT INTO user_memories (session_id, key, value, category, confidence)
-		VALUES (?, ?, ?, ?, ?)
+		INSERT INTO user_memories (session_id, key, value, category, confidence, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)
 		ON CONFLICT(session_id, key) DO UPDATE SET
-			value = ?, confidence = ?, updated_at = CURRENT_TIMESTAMP
+			embedding = CASE WHEN value = excluded.value THEN embedding ELSE NULL END,
+			value = ?, confidence = ?, expires_at = ?, updated_at = CURRENT_TIMESTAMP
 	`
-	_, err := db.Exec(query, sessionID, key, value, category, confidence, value, confidence)
+	_, err := exec.Exec(query, sessionID, key, value, category, confidence, expires, value, confidence, expires)
 	return err
 }
 
+func scanMemories(rows *sql.Rows) []Memory {
+	var memories []Memory
+	for rows.Next() {
+		var m Memory
+		var createdAt, updatedAt time.Time
+		var expiresAt sql.NullTime
+		err := rows.Scan(&m.ID, &m.SessionID, &m.Key, &m.Value, &m.Category, &m.Confidence, &expiresAt, &createdAt, &updatedAt)
+		if err != nil {
+			continue
+		}
+		if expiresAt.Valid {
+			m.ExpiresAt = expiresAt.Time.Format(time.RFC3339)
+		}
+		m.CreatedAt = createdAt.Format(time.RFC3339)
+		m.UpdatedAt = updatedAt.Format(time.RFC3339)
+		memories = append(memories, m)
+	}
+	return memories
+}
+
 func GetMemories(db *sql.DB, sessionID string) ([]Memory, error) {
 	rows, err := db.Query(`
-		SELECT id, session_id, key, value, category, confidence, created_at, updated_at
+		SELECT id, session_id, key, value, category, confidence, expires_at, created_at, updated_at
 		FROM user_memories
-		WHERE session_id = ?
+		WHERE session_id = ? AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)
 		ORDER BY created_at DESC
 	`, sessionID)
 	if err != nil {
@@ -47,19 +110,22 @@ func GetMemories(db *sql.DB, sessionID string) ([]Memory, error) {
 	}
 	defer rows.Close()
 
-	var memories []Memory
-	for rows.Next() {
-		var m Memory
-		var createdAt, updatedAt time.Time
-		err := rows.Scan(&m.ID, &m.SessionID, &m.Key, &m.Value, &m.Category, &m.Confidence, &createdAt, &updatedAt)
+	return scanMemories(rows), nil
+}
+
+// CleanupExpiredMemories periodically purges memories whose expiry has passed
+func CleanupExpiredMemories() {
+	ticker := time.NewTicker(1 * time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		result, err := db.Exec("DELETE FROM user_memories WHERE expires_at IS NOT NULL AND expires_at <= CURRENT_TIMESTAMP")
 		if err != nil {
-			continue
+			log.Printf("Error cleaning up expired memories: %v", err)
+		} else if rowsAffected, _ := result.RowsAffected(); rowsAffected > 0 {
+			log.Printf("Cleaned up %d expired memories", rowsAffected)
 		}
-		m.CreatedAt = createdAt.Format(time.RFC3339)
-		m.UpdatedAt = updatedAt.Format(time.RFC3339)
-		memories = append(memories, m)
 	}
-	return memories, nil
 }
 
 func DeleteMemory(db *sql.DB, sessionID, key string) error {
@@ -67,7 +133,145 @@ func DeleteMemory(db *sql.DB, sessionID, key string) error {
 	return err
 }
 
-func FormatMemoriesForPrompt(memories []Memory) string {
+// memoryKeyPrefixes are stripped when comparing keys so "user_name" and "name" collide
+var memoryKeyPrefixes = []string{"user_", "my_", "users_"}
+
+// NormalizeMemoryKey reduces a key to a canonical form used to detect near-duplicates
+func NormalizeMemoryKey(key string) string {
+	var sb strings.Builder
+	lastUnderscore := true
+	for _, r := range strings.ToLower(strings.TrimSpace(key)) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			sb.WriteRune(r)
+			lastUnderscore = false
+		} else if !lastUnderscore {
+			sb.WriteRune('_')
+			lastUnderscore = true
+		}
+	}
+	normalized := strings.TrimSuffix(sb.String(), "_")
+
+	for _, prefix := range memoryKeyPrefixes {
+		if strings.HasPrefix(normalized, prefix) && len(normalized) > len(prefix) {
+			normalized = strings.TrimPrefix(normalized, prefix)
+			break
+		}
+	}
+	return normalized
+}
+
+// preferMemory reports whether a should be kept over b. Higher confidence wins,
+// then the more recently updated memory, then the newer row.
+func preferMemory(a, b Memory) bool {
+	if a.Confidence != b.Confidence {
+		return a.Confidence > b.Confidence
+	}
+	aUpdated, aErr := time.Parse(time.RFC3339, a.UpdatedAt)
+	bUpdated, bErr := time.Parse(time.RFC3339, b.UpdatedAt)
+	if aErr == nil && bErr == nil && !aUpdated.Equal(bUpdated) {
+		return aUpdated.After(bUpdated)
+	}
+	return a.ID > b.ID
+}
+
+// MergeDuplicateMemories groups memories by normalized key and returns the memory kept
+// for each group along with the duplicates that lost to it
+func MergeDuplicateMemories(memories []Memory) (kept []Memory, duplicates []Memory) {
+	winners := make(map[string]int)
+
+	for _, m := range memories {
+		norm := NormalizeMemoryKey(m.Key)
+		idx, seen := winners[norm]
+		if !seen {
+			winners[norm] = len(kept)
+			kept = append(kept, m)
+			continue
+		}
+		if preferMemory(m, kept[idx]) {
+			duplicates = append(duplicates, kept[idx])
+			kept[idx] = m
+		} else {
+			duplicates = append(duplicates, m)
+		}
+	}
+	return kept, duplicates
+}
+
+// DedupeMemories removes near-duplicate memories for a session, keeping the
+// preferred memory of each group, and returns the removed memories
+func DedupeMemories(db *sql.DB, sessionID string) ([]Memory, error) {
+	memories, err := GetMemories(db, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, duplicates := MergeDuplicateMemories(memories)
+	for _, m := range duplicates {
+		if _, err := db.Exec("DELETE FROM user_memories WHERE id = ?", m.ID); err != nil {
+			return nil, err
+		}
+		log.Printf("Merged duplicate memory %s into normalized key %s", m.Key, NormalizeMemoryKey(m.Key))
+	}
+	return duplicates, nil
+}
+
+const DefaultMemoryMaxInjected = 50
+
+// MemoryFilter restricts which memories are injected into prompts
+type MemoryFilter struct {
+	MinConfidence int
+	Categories    []string
+	Limit         int
+}
+
+// GetMemoryInjectionFilter builds the filter from the memory_min_confidence,
+// memory_categories (comma-separated) and memory_max_injected settings
+func GetMemoryInjectionFilter(db *sql.DB) MemoryFilter {
+	filter := MemoryFilter{Limit: DefaultMemoryMaxInjected}
+
+	if v, err := strconv.Atoi(GetSetting(db, "memory_min_confidence", "0")); err == nil && v > 0 {
+		filter.MinConfidence = v
+	}
+	if v, err := strconv.Atoi(GetSetting(db, "memory_max_injected", "")); err == nil && v > 0 {
+		filter.Limit = v
+	}
+	for _, c := range strings.Split(GetSetting(db, "memory_categories", ""), ",") {
+		if c = strings.TrimSpace(strings.ToLower(c)); c != "" {
+			filter.Categories = append(filter.Categories, c)
+		}
+	}
+	return filter
+}
+
+// FilterMemories returns the memories that satisfy the filter, preserving order
+func FilterMemories(memories []Memory, filter MemoryFilter) []Memory {
+	var filtered []Memory
+	for _, m := range memories {
+		if m.Confidence < filter.MinConfidence {
+			continue
+		}
+		if len(filter.Categories) > 0 {
+			matched := false
+			for _, c := range filter.Categories {
+				if strings.EqualFold(m.Category, c) {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				continue
+			}
+		}
+		filtered = append(filtered, m)
+		if filter.Limit > 0 && len(filtered) >= filter.Limit {
+			break
+		}
+	}
+	return filtered
+}
+
+func FormatMemoriesForPrompt(memories []Memory, filter MemoryFilter) string {
+	memories = FilterMemories(memories, filter)
 	if len(memories) == 0 {
 		return ""
 	}
@@ -81,28 +285,62 @@ func FormatMemoriesForPrompt(memories []Memory) string {
 	return sb.String()
 }
 
-func ExtractAndStoreMemory(db *sql.DB, sessionID, userMessage string) {
+// ExtractAndStoreMemory stores memories matched by fixed phrases such as "my name is",
+// returning how many were stored. It is the deterministic fallback for LLM extraction.
+func ExtractAndStoreMemory(db *sql.DB, sessionID, userMessage string) int {
 	lowerMsg := strings.ToLower(userMessage)
+	stored := 0
+	store := func(key, value, category string, confidence int) {
+		if err := SetMemory(db, sessionID, key, value, category, confidence, nil); err != nil {
+			log.Printf("Error storing pattern memory: %v", err)
+			return
+		}
+		stored++
+	}
 
 	if strings.Contains(lowerMsg, "prefer") {
 		if strings.Contains(lowerMsg, "concise") {
-			SetMemory(db, sessionID, "response_style", "concise", "preference", 80)
+			store("response_style", "concise", "preference", 80)
 		}
 		if strings.Contains(lowerMsg, "detailed") {
-			SetMemory(db, sessionID, "response_style", "detailed", "preference", 80)
+			store("response_style", "detailed", "preference", 80)
 		}
 	}
 
 	if strings.Contains(lowerMsg, "speak in spanish") {
-		SetMemory(db, sessionID, "language", "spanish", "preference", 90)
+		store("language", "spanish", "preference", 90)
 	}
 
-	if strings.Contains(lowerMsg, "my name is") {
-		parts := strings.Split(userMessage, "my name is")
-		if len(parts) > 1 {
-			name := strings.TrimSpace(strings.Split(parts[1], ".")[0])
-			SetMemory(db, sessionID, "name", name, "fact", 95)
+	// Match case-insensitively but keep the name as written when lowering kept byte offsets
+	if idx := strings.Index(lowerMsg, "my name is"); idx != -1 {
+		rest := lowerMsg[idx+len("my name is"):]
+		if len(lowerMsg) == len(userMessage) {
+			rest = userMessage[idx+len("my name is"):]
 		}
+		if end := strings.IndexAny(rest, ".,!?\n"); end != -1 {
+			rest = rest[:end]
+		}
+		if name := strings.TrimSpace(rest); name != "" {
+			store("name", name, "fact", 95)
+		}
+	}
+
+	return stored
+}
+
+// IsMemoryFallbackEnabled reports whether pattern extraction runs when LLM extraction
+// fails or finds nothing
+func IsMemoryFallbackEnabled(db *sql.DB) bool {
+	return GetBoolSetting(db, "memory_fallback_extraction", true)
+}
+
+// fallbackMemoryExtraction runs the pattern extractor when the fallback is enabled
+func fallbackMemoryExtraction(db *sql.DB, sessionID, userMessage string) {
+	if !IsMemoryFallbackEnabled(db) {
+		return
+	}
+	if n := ExtractAndStoreMemory(db, sessionID, userMessage); n > 0 {
+		log.Printf("Stored %d memories with the pattern fallback", n)
 	}
 }
 
@@ -111,12 +349,32 @@ type ExtractedMemory struct {
 	Value      string `json:"value"`
 	Category   string `json:"category"`
 	Confidence int    `json:"confidence"`
+	ExpiresAt  string `json:"expires_at,omitempty"`
 }
 
-func ExtractMemoriesWithLLM(db *sql.DB, sessionID, userMessage string, provider Provider, history []api.Message) {
-	log.Printf("Starting LLM memory extraction for message: %s", userMessage)
+// parseMemoryExpiry accepts the RFC 3339 timestamps or plain dates the extractor may return.
+// A plain date expires at the end of that day.
+func parseMemoryExpiry(value string) *time.Time {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t
+	}
+	if t, err := time.ParseInLocation("2006-01-02T15:04:05", value, time.Local); err == nil {
+		return &t
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		t = t.Add(24*time.Hour - time.Second)
+		return &t
+	}
+	return nil
+}
 
-	extractionPrompt := fmt.Sprintf(`You are a memory extraction assistant. Analyze the following user message and extract any important information that should be remembered.
+// memoryExtractionPrompt asks the model for the memories in one user message as a JSON array
+func memoryExtractionPrompt(userMessage string) string {
+	return fmt.Sprintf(`You are a memory extraction assistant. Analyze the following user message and extract any important information that should be remembered.
 
 User message: "%s"
 
@@ -131,6 +389,7 @@ For each memory you find, create a JSON object with these exact fields:
 - value: full information to remember (e.g., "Meeting with Ram at 5 PM EST")
 - category: one of: reminder, fact, preference, entity
 - confidence: a number from 70-100 (90-100 for explicit statements, 70-89 for implied information)
+- expires_at: optional, only for reminders with an explicit date or time, as an ISO 8601 timestamp after which the reminder is no longer relevant (today is %s)
 
 Return your response as a JSON array containing all the memories you found.
 
@@ -143,61 +402,181 @@ Output: [{"key":"name","value":"John","category":"fact","confidence":95},{"key":
 
 If no memories found, return an empty array: []
 
-Respond ONLY with a JSON array. No markdown, no explanation.`, userMessage)
+Respond ONLY with a JSON array. No markdown, no explanation.`, userMessage, time.Now().Format("Monday, 2006-01-02 15:04 MST"))
+}
 
+// ExtractMemories runs the extraction prompt for a message and returns the parsed
+// memories without storing anything
+func ExtractMemories(ctx context.Context, provider Provider, userMessage string) ([]ExtractedMemory, error) {
 	wr := newResponseWriter()
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
-	defer cancel()
-
-	provider.Generate(ctx, nil, extractionPrompt, "You are a JSON extraction assistant. Always respond with valid JSON arrays only.", wr)
+	err := provider.Generate(ctx, nil, memoryExtractionPrompt(userMessage), "You are a JSON extraction assistant. Always respond with valid JSON arrays only.", wr)
+	if err != nil {
+		return nil, err
+	}
 
-	response := strings.TrimSpace(wr.String())
+	response, stats := splitAnalytics(wr.String())
+	response = strings.TrimSpace(response)
+	recordTokenUsage(db, 0, usageSourceExtraction, stats.Usage.TotalTokens)
 	log.Printf("LLM extraction response (first 500 chars): %s", truncateString(response, 500))
+	return parseExtractedMemories(response), nil
+}
 
+// memoryCategories are the categories the extractor may assign; anything else is stored as a fact
+var memoryCategories = map[string]bool{"reminder": true, "fact": true, "preference": true, "entity": true}
+
+// defaultExtractedConfidence applies when the extractor omits a confidence
+const defaultExtractedConfidence = 80
+
+// parseExtractedMemories reads the memories from an extraction response. The whole
+// response is tried as strict JSON first; otherwise every JSON array or object that
+// decodes cleanly is collected, so markdown fences, prose, stray brackets and several
+// arrays are tolerated and the valid objects of a broken array are still kept. Each
+// object is validated by validExtractedMemory, and the first memory for a key wins.
+func parseExtractedMemories(response string) []ExtractedMemory {
 	response = strings.TrimSpace(response)
-	response = strings.TrimPrefix(response, "```json")
-	response = strings.TrimPrefix(response, "```")
-	response = strings.TrimSpace(response)
-	response = strings.TrimSuffix(response, "```")
-	response = strings.TrimSpace(response)
 
-	startIdx := strings.Index(response, "[")
-	endIdx := strings.LastIndex(response, "]")
+	var objects []map[string]interface{}
+	if err := json.Unmarshal([]byte(response), &objects); err != nil {
+		objects = scanJSONObjects(response)
+	}
+
 	var extracted []ExtractedMemory
-	if startIdx != -1 && endIdx != -1 && startIdx < endIdx {
-		jsonStr := response[startIdx : endIdx+1]
-		if err := json.Unmarshal([]byte(jsonStr), &extracted); err == nil {
-			for _, mem := range extracted {
-				if mem.Key != "" && mem.Value != "" {
-					category := mem.Category
-					if category == "" {
-						category = "fact"
-					}
-					confidence := mem.Confidence
-					if confidence <= 0 {
-						confidence = 80
-					}
-					if err := SetMemory(db, sessionID, mem.Key, mem.Value, category, confidence); err != nil {
-						log.Printf("Error storing extracted memory: %v", err)
-					} else {
-						log.Printf("✓ Extracted and stored memory: [%s] %s = %s", mem.Category, mem.Key, mem.Value)
-					}
+	seen := make(map[string]bool)
+	for _, obj := range objects {
+		mem, ok := validExtractedMemory(obj)
+		if !ok || seen[mem.Key] {
+			continue
+		}
+		seen[mem.Key] = true
+		extracted = append(extracted, mem)
+	}
+	return extracted
+}
+
+// scanJSONObjects decodes each JSON array of objects, or lone object, found in text.
+// The decoder consumes one balanced value at a time, so brackets inside string values
+// do not confuse it; a value that fails to decode is skipped one character at a time.
+func scanJSONObjects(text string) []map[string]interface{} {
+	var objects []map[string]interface{}
+	for i := 0; i < len(text); i++ {
+		if text[i] != '[' && text[i] != '{' {
+			continue
+		}
+
+		dec := json.NewDecoder(strings.NewReader(text[i:]))
+		var value interface{}
+		if err := dec.Decode(&value); err != nil {
+			continue
+		}
+
+		switch v := value.(type) {
+		case map[string]interface{}:
+			objects = append(objects, v)
+		case []interface{}:
+			for _, item := range v {
+				if obj, ok := item.(map[string]interface{}); ok {
+					objects = append(objects, obj)
 				}
 			}
 		}
+		i += int(dec.InputOffset()) - 1
+	}
+	return objects
+}
+
+// validExtractedMemory converts one decoded object into a memory. Key and value must be
+// non-empty, confidence must be a number (or numeric string) from 0 to 100, and unknown
+// or missing categories become "fact".
+func validExtractedMemory(obj map[string]interface{}) (ExtractedMemory, bool) {
+	key, _ := obj["key"].(string)
+	key = strings.TrimSpace(key)
+	var value string
+	switch v := obj["value"].(type) {
+	case string:
+		value = strings.TrimSpace(v)
+	case float64, bool:
+		value = fmt.Sprint(v)
+	}
+	if key == "" || value == "" {
+		return ExtractedMemory{}, false
+	}
+
+	confidence := defaultExtractedConfidence
+	switch c := obj["confidence"].(type) {
+	case nil:
+	case float64:
+		confidence = int(math.Round(c))
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(c, "%")), 64)
+		if err != nil {
+			return ExtractedMemory{}, false
+		}
+		confidence = int(math.Round(f))
+	default:
+		return ExtractedMemory{}, false
+	}
+	if confidence < 0 || confidence > 100 {
+		return ExtractedMemory{}, false
+	}
+
+	category, _ := obj["category"].(string)
+	category = strings.ToLower(strings.TrimSpace(category))
+	if !memoryCategories[category] {
+		category = "fact"
+	}
+
+	expiresAt, _ := obj["expires_at"].(string)
+
+	return ExtractedMemory{
+		Key:        key,
+		Value:      value,
+		Category:   category,
+		Confidence: confidence,
+		ExpiresAt:  strings.TrimSpace(expiresAt),
+	}, true
+}
+
+// ExtractMemoriesWithLLM extracts memories from a user message and stores them for the
+// session, falling back to pattern extraction when the model errors or finds nothing
+func ExtractMemoriesWithLLM(db *sql.DB, sessionID, userMessage string, provider Provider, history []api.Message) {
+	log.Printf("Starting LLM memory extraction for message: %s", userMessage)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	extracted, err := ExtractMemories(ctx, provider, userMessage)
+	if err != nil {
+		log.Printf("Error extracting memories: %v", err)
+		fallbackMemoryExtraction(db, sessionID, userMessage)
+		return
+	}
+
+	for _, mem := range extracted {
+		if err := SetMemory(db, sessionID, mem.Key, mem.Value, mem.Category, mem.Confidence, parseMemoryExpiry(mem.ExpiresAt)); err != nil {
+			log.Printf("Error storing extracted memory: %v", err)
+		} else {
+			log.Printf("✓ Extracted and stored memory: [%s] %s = %s", mem.Category, mem.Key, mem.Value)
+		}
 	}
 
 	if len(extracted) == 0 {
 		log.Printf("No memories extracted from message")
+		fallbackMemoryExtraction(db, sessionID, userMessage)
+		return
+	}
+
+	if _, err := DedupeMemories(db, sessionID); err != nil {
+		log.Printf("Error merging duplicate memories: %v", err)
 	}
 }
 
 type responseWriter struct {
 	strings.Builder
+	header http.Header
 }
 
 func newResponseWriter() *responseWriter {
-	return &responseWriter{}
+	return &responseWriter{header: http.Header{}}
 }
 
 func (w *responseWriter) Write(p []byte) (n int, err error) {
@@ -207,8 +586,9 @@ func (w *responseWriter) Write(p []byte) (n int, err error) {
 func (w *responseWriter) WriteHeader(statusCode int) {
 }
 
+// Header returns a scratch map; providers set streaming headers on it
 func (w *responseWriter) Header() http.Header {
-	return nil
+	return w.header
 }
 
 func (w *responseWriter) Flush() {
@@ -218,9 +598,9 @@ func SearchMemories(db *sql.DB, sessionID, query string) ([]Memory, error) {
 	searchPattern := "%" + query + "%"
 
 	rows, err := db.Query(`
-		SELECT id, session_id, key, value, category, confidence, created_at, updated_at
+		SELECT id, session_id, key, value, category, confidence, expires_at, created_at, updated_at
 		FROM user_memories
-		WHERE session_id = ? AND (
+		WHERE session_id = ? AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP) AND (
 			key LIKE ? OR value LIKE ? OR category LIKE ?
 		)
 		ORDER BY created_at DESC
@@ -231,33 +611,32 @@ func SearchMemories(db *sql.DB, sessionID, query string) ([]Memory, error) {
 	}
 	defer rows.Close()
 
-	var memories []Memory
-	for rows.Next() {
-		var m Memory
-		var createdAt, updatedAt time.Time
-		err := rows.Scan(&m.ID, &m.SessionID, &m.Key, &m.Value, &m.Category, &m.Confidence, &createdAt, &updatedAt)
-		if err != nil {
-			continue
-		}
-		m.CreatedAt = createdAt.Format(time.RFC3339)
-		m.UpdatedAt = updatedAt.Format(time.RFC3339)
-		memories = append(memories, m)
-	}
-	return memories, nil
+	return scanMemories(rows), nil
 }
 
 func IsMemoryEnabled(db *sql.DB) bool {
-	var value string
-	err := db.QueryRow("SELECT value FROM settings WHERE key = ?", "memory_enabled").Scan(&value)
-	if err == sql.ErrNoRows {
+	return GetBoolSetting(db, "memory_enabled", true)
+}
+
+// ChatUsesMemory reports whether stored memories should be injected into a chat. It is
+// false when memory is disabled globally or the chat has opted out; chatID 0 means no
+// chat, which follows the global setting.
+func ChatUsesMemory(db *sql.DB, chatID int64) bool {
+	if !IsMemoryEnabled(db) {
+		return false
+	}
+	if chatID <= 0 {
 		return true
 	}
+	var useMemory sql.NullBool
+	err := db.QueryRow("SELECT use_memory FROM chats WHERE id = ?", chatID).Scan(&useMemory)
 	if err != nil {
-		log.Printf("Error checking memory_enabled setting: %v", err)
+		if err != sql.ErrNoRows {
+			log.Printf("Error reading memory setting for chat %d: %v", chatID, err)
+		}
 		return true
 	}
-
-	return value == "1" || strings.ToLower(value) == "true" || strings.ToLower(value) == "yes"
+	return !useMemory.Valid || useMemory.Bool
 }
 
 func truncateString(s string, maxLen int) string {
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// MemoryExtractionInterval is the minimum time between LLM extractions for one session.
+// Messages that arrive in between are batched into the next extraction.
+const MemoryExtractionInterval = 10 * time.Second
+
+type memoryExtractionQueue struct {
+	mu        sync.Mutex
+	pending   map[string][]string
+	running   map[string]bool
+	limiters  map[string]*sessionLimiter
+	lastSweep time.Time
+}
+
+// sessionLimiter spaces one session's extractions. lastUsed is when its last run ended.
+type sessionLimiter struct {
+	limiter  *rate.Limiter
+	lastUsed time.Time
+}
+
+var memoryQueue = &memoryExtractionQueue{
+	pending:  make(map[string][]string),
+	running:  make(map[string]bool),
+	limiters: make(map[string]*sessionLimiter),
+}
+
+// QueueMemoryExtraction schedules LLM memory extraction for a message in the background
+// so it never delays the user's response
+func QueueMemoryExtraction(sessionID, userMessage string) {
+	if strings.TrimSpace(userMessage) == "" {
+		return
+	}
+
+	q := memoryQueue
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.pending[sessionID] = append(q.pending[sessionID], userMessage)
+	if q.running[sessionID] {
+		return
+	}
+
+	q.sweepIdleLimiters(time.Now())
+	l, ok := q.limiters[sessionID]
+	if !ok {
+		l = &sessionLimiter{limiter: rate.NewLimiter(rate.Every(MemoryExtractionInterval), 1)}
+		q.limiters[sessionID] = l
+	}
+
+	q.running[sessionID] = true
+	go q.run(sessionID, l.limiter)
+}
+
+// sweepIdleLimiters drops, at most once per MemoryExtractionInterval, the limiters of
+// sessions that have not run for an interval. Such a limiter has refilled, so a new one
+// behaves the same. q.mu must be held.
+func (q *memoryExtractionQueue) sweepIdleLimiters(now time.Time) {
+	if now.Sub(q.lastSweep) < MemoryExtractionInterval {
+		return
+	}
+	q.lastSweep = now
+	for sessionID, l := range q.limiters {
+		if !q.running[sessionID] && now.Sub(l.lastUsed) > MemoryExtractionInterval {
+			delete(q.limiters, sessionID)
+		}
+	}
+}
+
+// run drains the session's pending messages, one rate-limited batch at a time
+func (q *memoryExtractionQueue) run(sessionID string, limiter *rate.Limiter) {
+	for {
+		if err := limiter.Wait(context.Background()); err != nil {
+			log.Printf("Memory extraction rate limiter error: %v", err)
+		}
+
+		q.mu.Lock()
+		batch := q.pending[sessionID]
+		delete(q.pending, sessionID)
+		if len(batch) == 0 {
+			delete(q.running, sessionID)
+			if l, ok := q.limiters[sessionID]; ok {
+				l.lastUsed = time.Now()
+			}
+			q.mu.Unlock()
+			return
+		}
+		q.mu.Unlock()
+
+		provider, _, err := GetActiveProvider(db)
+		if err != nil {
+			log.Printf("Memory extraction skipped: %v", err)
+			fallbackMemoryExtraction(db, sessionID, strings.Join(batch, "\n"))
+			continue
+		}
+
+		if len(batch) > 1 {
+			log.Printf("Extracting memories from %d batched messages for session %s", len(batch), sessionID)
+		}
+		ExtractMemoriesWithLLM(db, sessionID, strings.Join(batch, "\n"), provider, nil)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestSweepIdleMemoryLimiters(t *testing.T) {
+	now := time.Now()
+	newLimiter := func(lastUsed time.Time) *sessionLimiter {
+		return &sessionLimiter{limiter: rate.NewLimiter(rate.Every(MemoryExtractionInterval), 1), lastUsed: lastUsed}
+	}
+	q := &memoryExtractionQueue{
+		pending: make(map[string][]string),
+		running: map[string]bool{"running": true},
+		limiters: map[string]*sessionLimiter{
+			"idle":    newLimiter(now.Add(-2 * MemoryExtractionInterval)),
+			"recent":  newLimiter(now.Add(-time.Second)),
+			"running": newLimiter(now.Add(-2 * MemoryExtractionInterval)),
+		},
+	}
+
+	q.sweepIdleLimiters(now)
+	if _, ok := q.limiters["idle"]; ok {
+		t.Error("idle session's limiter was kept")
+	}
+	for _, id := range []string{"recent", "running"} {
+		if _, ok := q.limiters[id]; !ok {
+			t.Errorf("%s session's limiter was dropped", id)
+		}
+	}
+
+	// Sweeps are spaced by the interval
+	q.limiters["idle"] = newLimiter(now.Add(-2 * MemoryExtractionInterval))
+	q.sweepIdleLimiters(now.Add(time.Second))
+	if _, ok := q.limiters["idle"]; !ok {
+		t.Error("swept again before the interval passed")
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPreferMemory(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b Memory
+		want bool
+	}{
+		{"higher confidence wins", Memory{ID: 1, Confidence: 90}, Memory{ID: 2, Confidence: 50}, true},
+		{"lower confidence loses", Memory{ID: 2, Confidence: 50}, Memory{ID: 1, Confidence: 90}, false},
+		{"newer update wins a tie",
+			Memory{ID: 1, Confidence: 80, UpdatedAt: "2026-05-02T10:00:00Z"},
+			Memory{ID: 2, Confidence: 80, UpdatedAt: "2026-05-01T10:00:00Z"}, true},
+		{"older update loses a tie",
+			Memory{ID: 2, Confidence: 80, UpdatedAt: "2026-05-01T10:00:00Z"},
+			Memory{ID: 1, Confidence: 80, UpdatedAt: "2026-05-02T10:00:00Z"}, false},
+		{"higher ID breaks equal times",
+			Memory{ID: 2, Confidence: 80, UpdatedAt: "2026-05-01T10:00:00Z"},
+			Memory{ID: 1, Confidence: 80, UpdatedAt: "2026-05-01T10:00:00Z"}, true},
+		{"higher ID breaks unparsable times", Memory{ID: 2, Confidence: 80}, Memory{ID: 1, Confidence: 80}, true},
+	}
+	for _, tt := range tests {
+		if got := preferMemory(tt.a, tt.b); got != tt.want {
+			t.Errorf("%s: preferMemory = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMergeDuplicateMemories(t *testing.T) {
+	memories := []Memory{
+		{ID: 1, Key: "user_name", Value: "Ada", Confidence: 60},
+		{ID: 2, Key: "Name", Value: "Ada Lovelace", Confidence: 90},
+		{ID: 3, Key: "my name", Value: "A.", Confidence: 40},
+		{ID: 4, Key: "city", Value: "London", Confidence: 70},
+	}
+
+	kept, duplicates := MergeDuplicateMemories(memories)
+	if len(kept) != 2 || kept[0].ID != 2 || kept[1].ID != 4 {
+		t.Fatalf("kept = %+v, want IDs [2 4]", kept)
+	}
+	removed := map[int64]bool{}
+	for _, m := range duplicates {
+		removed[m.ID] = true
+	}
+	if len(duplicates) != 2 || !removed[1] || !removed[3] {
+		t.Errorf("duplicates = %+v, want IDs 1 and 3", duplicates)
+	}
+}
+
+func TestDedupeMemoriesKeepsNewestOfEqualConfidence(t *testing.T) {
+	testDB := newTestDB(t)
+	if _, err := testDB.Exec(`INSERT INTO user_memories (session_id, key, value, category, confidence, updated_at) VALUES
+		('s1', 'user_name', 'old', 'general', 80, '2026-05-01 10:00:00'),
+		('s1', 'name', 'new', 'general', 80, '2026-05-02 10:00:00')`); err != nil {
+		t.Fatal(err)
+	}
+	// The older row has the higher ID, so only the update time can pick the newer one
+	if _, err := testDB.Exec("UPDATE user_memories SET id = id + 10 WHERE value = 'old'"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := DedupeMemories(testDB, "s1"); err != nil {
+		t.Fatal(err)
+	}
+	memories, err := GetMemories(testDB, "s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(memories) != 1 || memories[0].Value != "new" {
+		t.Errorf("memories = %+v, want only the newer value", memories)
+	}
+}
+
+func TestParseExtractedMemoriesToleratesWrapping(t *testing.T) {
+	const array = `[{"key":"name","value":"John","category":"fact","confidence":95}]`
+	tests := []struct {
+		name     string
+		response string
+		want     []string
+	}{
+		{"bare array", array, []string{"name"}},
+		{"json fence", "```json\n" + array + "\n```", []string{"name"}},
+		{"plain fence", "```\n" + array + "\n```", []string{"name"}},
+		{"leading prose", "Here are the memories I found:\n" + array, []string{"name"}},
+		{"trailing prose", array + "\n\nLet me know if you need anything else.", []string{"name"}},
+		{"fence with prose around it", "Sure!\n```json\n" + array + "\n```\nThese are all.", []string{"name"}},
+		{"empty array", "[]", nil},
+		{"empty fenced array", "```json\n[]\n```", nil},
+		{"no JSON at all", "I could not find anything worth remembering.", nil},
+	}
+	for _, tt := range tests {
+		got := parseExtractedMemories(tt.response)
+		var keys []string
+		for _, m := range got {
+			keys = append(keys, m.Key)
+		}
+		if strings.Join(keys, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: keys = %v, want %v", tt.name, keys, tt.want)
+		}
+	}
+}
+
+func TestParseExtractedMemoriesAdversarialOutput(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     []ExtractedMemory
+	}{
+		{"several arrays",
+			`First: [{"key":"a","value":"1"}] and then [{"key":"b","value":"2"}]`,
+			[]ExtractedMemory{{Key: "a", Value: "1", Category: "fact", Confidence: 80}, {Key: "b", Value: "2", Category: "fact", Confidence: 80}}},
+		{"brackets inside strings",
+			`[{"key":"note","value":"use [brackets] and {braces} ]]","category":"fact","confidence":70}]`,
+			[]ExtractedMemory{{Key: "note", Value: "use [brackets] and {braces} ]]", Category: "fact", Confidence: 70}}},
+		{"stray brackets in prose",
+			`Options [a] or [b]: [{"key":"pet","value":"cat","category":"entity","confidence":90}] (done]`,
+			[]ExtractedMemory{{Key: "pet", Value: "cat", Category: "entity", Confidence: 90}}},
+		{"broken array keeps its valid objects",
+			`[{"key":"a","value":"1"}, {"key":"b","value":}, {"key":"c","value":"3"}]`,
+			[]ExtractedMemory{{Key: "a", Value: "1", Category: "fact", Confidence: 80}, {Key: "c", Value: "3", Category: "fact", Confidence: 80}}},
+		{"truncated output",
+			`[{"key":"a","value":"1"}, {"key":"b","val`,
+			[]ExtractedMemory{{Key: "a", Value: "1", Category: "fact", Confidence: 80}}},
+		{"lone object",
+			`{"key":"tz","value":"UTC+2","category":"preference","confidence":"85%"}`,
+			[]ExtractedMemory{{Key: "tz", Value: "UTC+2", Category: "preference", Confidence: 85}}},
+		{"confidence out of range",
+			`[{"key":"a","value":"1","confidence":150},{"key":"b","value":"2","confidence":-5},{"key":"c","value":"3","confidence":100}]`,
+			[]ExtractedMemory{{Key: "c", Value: "3", Category: "fact", Confidence: 100}}},
+		{"confidence of the wrong type",
+			`[{"key":"a","value":"1","confidence":"high"},{"key":"b","value":"2","confidence":[90]}]`,
+			nil},
+		{"unknown category becomes fact",
+			`[{"key":"a","value":"1","category":"Secret"},{"key":"b","value":"2","category":" Reminder "}]`,
+			[]ExtractedMemory{{Key: "a", Value: "1", Category: "fact", Confidence: 80}, {Key: "b", Value: "2", Category: "reminder", Confidence: 80}}},
+		{"missing or empty fields",
+			`[{"value":"1"},{"key":"  ","value":"2"},{"key":"c"},{"key":"d","value":""},{"key":"e","value":{"nested":true}}]`,
+			nil},
+		{"scalar values are kept as text",
+			`[{"key":"age","value":42},{"key":"vegan","value":true}]`,
+			[]ExtractedMemory{{Key: "age", Value: "42", Category: "fact", Confidence: 80}, {Key: "vegan", Value: "true", Category: "fact", Confidence: 80}}},
+		{"first memory for a key wins",
+			`[{"key":"name","value":"Ann"},{"key":"name","value":"Bob"}]`,
+			[]ExtractedMemory{{Key: "name", Value: "Ann", Category: "fact", Confidence: 80}}},
+		{"non-object items are ignored",
+			`["name", 7, null, [{"key":"deep","value":"x"}], {"key":"a","value":"1"}]`,
+			[]ExtractedMemory{{Key: "a", Value: "1", Category: "fact", Confidence: 80}}},
+	}
+	for _, tt := range tests {
+		got := parseExtractedMemories(tt.response)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: memory %d = %+v, want %+v", tt.name, i, got[i], tt.want[i])
+			}
+		}
+	}
+}
+
+func TestScanJSONObjectsSkipsUndecodableValues(t *testing.T) {
+	objects := scanJSONObjects(`{oops} {"a":1} [1, 2] [{"b":2}, "x"] {"c":`)
+	if len(objects) != 2 || objects[0]["a"] != float64(1) || objects[1]["b"] != float64(2) {
+		t.Errorf("objects = %v, want {a:1} and {b:2}", objects)
+	}
+}
@@ -1,42 +1,181 @@
 package main
 
 import (
+	"context"
 	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
 	"encoding/hex"
+	"log"
+	"math"
+	"net"
 	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"golang.org/x/time/rate"
 )
 
+const (
+	limiterIdleTTL       = 3 * time.Minute
+	limiterSweepInterval = 1 * time.Minute
+)
+
+type visitor struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
 var (
-	limiters     = make(map[string]*rate.Limiter)
+	limiters     = make(map[string]*visitor)
 	limiterMu    sync.Mutex
 	limiterRate  = rate.Limit(10)
 	limiterBurst = 50
+	// trustedProxies are the peers whose X-Forwarded-For is believed, from TRUSTED_PROXIES
+	trustedProxies []*net.IPNet
 )
 
+// InitRateLimiter reads RATE_LIMIT_RPS, RATE_LIMIT_BURST and TRUSTED_PROXIES from the
+// environment
+func InitRateLimiter() {
+	trustedProxies = parseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if v := os.Getenv("RATE_LIMIT_RPS"); v != "" {
+		if rps, err := strconv.ParseFloat(v, 64); err == nil && rps > 0 {
+			limiterRate = rate.Limit(rps)
+		} else {
+			log.Printf("Warning: Invalid RATE_LIMIT_RPS %q, using %v", v, limiterRate)
+		}
+	}
+	if v := os.Getenv("RATE_LIMIT_BURST"); v != "" {
+		if burst, err := strconv.Atoi(v); err == nil && burst > 0 {
+			limiterBurst = burst
+		} else {
+			log.Printf("Warning: Invalid RATE_LIMIT_BURST %q, using %d", v, limiterBurst)
+		}
+	}
+}
+
 func getLimiter(ip string) *rate.Limiter {
+	return getKeyedLimiter(ip, limiterRate, limiterBurst)
+}
+
+// getKeyedLimiter returns the limiter stored under key, adjusting it if the configured
+// rate or burst changed since it was created
+func getKeyedLimiter(key string, limit rate.Limit, burst int) *rate.Limiter {
 	limiterMu.Lock()
 	defer limiterMu.Unlock()
 
-	if l, exists := limiters[ip]; exists {
-		return l
+	if v, exists := limiters[key]; exists {
+		v.lastSeen = time.Now()
+		if v.limiter.Limit() != limit {
+			v.limiter.SetLimit(limit)
+		}
+		if v.limiter.Burst() != burst {
+			v.limiter.SetBurst(burst)
+		}
+		return v.limiter
 	}
 
-	l := rate.NewLimiter(limiterRate, limiterBurst)
-	limiters[ip] = l
+	l := rate.NewLimiter(limit, burst)
+	limiters[key] = &visitor{limiter: l, lastSeen: time.Now()}
 	return l
 }
 
-func RateLimitMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ip := r.RemoteAddr
-		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
-			ip = forwarded
+// evictIdleLimiters removes limiters not used within idleTTL
+func evictIdleLimiters(idleTTL time.Duration) int {
+	limiterMu.Lock()
+	defer limiterMu.Unlock()
+
+	removed := 0
+	for key, v := range limiters {
+		if time.Since(v.lastSeen) > idleTTL {
+			delete(limiters, key)
+			removed++
+		}
+	}
+	return removed
+}
+
+// CleanupLimiters periodically evicts idle per-IP limiters
+func CleanupLimiters() {
+	ticker := time.NewTicker(limiterSweepInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		evictIdleLimiters(limiterIdleTTL)
+	}
+}
+
+// parseTrustedProxies reads a comma-separated list of IP addresses and CIDR ranges,
+// skipping invalid entries with a warning
+func parseTrustedProxies(value string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil {
+				bits := 8 * len(ip.To4())
+				if bits == 0 {
+					bits = 128
+				}
+				entry = ip.String() + "/" + strconv.Itoa(bits)
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			log.Printf("Warning: Ignoring invalid TRUSTED_PROXIES entry %q", entry)
+			continue
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets
+}
+
+func isTrustedProxy(ip net.IP) bool {
+	for _, n := range trustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the connection address. When that is a trusted proxy, X-Forwarded-For
+// is read from the right, skipping further trusted proxies, and the first other address
+// is the client; the leftmost entries are set by the client and cannot be believed.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	remote := net.ParseIP(host)
+	if remote == nil || !isTrustedProxy(remote) {
+		return host
+	}
+
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(hops[i]))
+		if ip == nil {
+			break
+		}
+		if !isTrustedProxy(ip) {
+			return ip.String()
 		}
+	}
+	return remote.String()
+}
 
-		limiter := getLimiter(ip)
+func RateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limiter := getLimiter(clientIP(r))
 		if !limiter.Allow() {
 			http.Error(w, "Rate limit exceeded. Please try again later.", http.StatusTooManyRequests)
 			return
@@ -46,8 +185,295 @@ func RateLimitMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// routeRateLimitDefaults holds the rps and burst used for each route class when the
+// rate_limit_<class>_rps and rate_limit_<class>_burst settings are unset
+var routeRateLimitDefaults = map[string]struct {
+	RPS   float64
+	Burst int
+}{
+	"generation": {RPS: 0.5, Burst: 5},
+	"mcp":        {RPS: 2, Burst: 10},
+	"search":     {RPS: 1, Burst: 5},
+}
+
+// routeRateLimit returns the configured rate and burst for a route class
+func routeRateLimit(class string) (rate.Limit, int) {
+	defaults := routeRateLimitDefaults[class]
+	rps, burst := defaults.RPS, defaults.Burst
+
+	if v := GetSetting(db, "rate_limit_"+class+"_rps", ""); v != "" {
+		if parsed, err := strconv.ParseFloat(v, 64); err == nil && parsed > 0 {
+			rps = parsed
+		}
+	}
+	if v := GetSetting(db, "rate_limit_"+class+"_burst", ""); v != "" {
+		if parsed, err := strconv.Atoi(v); err == nil && parsed > 0 {
+			burst = parsed
+		}
+	}
+	return rate.Limit(rps), burst
+}
+
+// RouteRateLimit applies a per-IP limit for a class of routes on top of the global
+// limiter. A request must pass both to be served.
+func RouteRateLimit(class string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limit, burst := routeRateLimit(class)
+			limiter := getKeyedLimiter(class+"|"+clientIP(r), limit, burst)
+			if !limiter.Allow() {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(1/float64(limit)))))
+				http.Error(w, "Rate limit exceeded. Please try again later.", http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+const (
+	corsAllowedMethods = "GET, POST, PUT, DELETE, OPTIONS"
+	corsAllowedHeaders = "Content-Type, X-CSRF-Token, Authorization, X-Request-ID"
+	corsExposedHeaders = "X-Request-ID"
+	corsMaxAge         = "600"
+)
+
+// corsAllowedOrigins is read from CORS_ALLOWED_ORIGINS; empty means same-origin only
+var corsAllowedOrigins map[string]bool
+
+// InitCORS reads the comma-separated CORS_ALLOWED_ORIGINS list from the environment.
+// Use "*" to allow any origin.
+func InitCORS() {
+	corsAllowedOrigins = make(map[string]bool)
+	for _, origin := range strings.Split(os.Getenv("CORS_ALLOWED_ORIGINS"), ",") {
+		origin = strings.TrimRight(strings.TrimSpace(origin), "/")
+		if origin != "" {
+			corsAllowedOrigins[origin] = true
+		}
+	}
+	if len(corsAllowedOrigins) > 0 {
+		log.Printf("CORS enabled for %d origin(s)", len(corsAllowedOrigins))
+	}
+}
+
+func corsOriginAllowed(origin string) bool {
+	return corsAllowedOrigins["*"] || corsAllowedOrigins[origin]
+}
+
+// CORSMiddleware adds CORS headers for allowed origins and answers preflight requests.
+// Credentials are allowed so the session cookie is sent, which is why the origin is
+// echoed back rather than using a wildcard.
+func CORSMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" || len(corsAllowedOrigins) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+		if !corsOriginAllowed(origin) {
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", corsAllowedMethods)
+			w.Header().Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+			w.Header().Set("Access-Control-Max-Age", corsMaxAge)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		w.Header().Set("Access-Control-Expose-Headers", corsExposedHeaders)
+		next.ServeHTTP(w, r)
+	})
+}
+
+const (
+	csrfCookieName = "csrf_token"
+	csrfHeaderName = "X-CSRF-Token"
+)
+
+// csrfExemptPaths accept state-changing requests without a CSRF token
+var csrfExemptPaths = map[string]bool{
+	"/api/v1/auth/login": true,
+	"/api/auth/login":    true,
+}
+
+// issueCSRFToken mints a token and sets it as the double-submit cookie. The cookie is
+// readable by scripts so the frontend can echo it back in the X-CSRF-Token header.
+func issueCSRFToken(w http.ResponseWriter) string {
+	token := generateCSRFToken()
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookieName,
+		Value:    token,
+		Path:     "/",
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return token
+}
+
+// validCSRFToken reports whether the X-CSRF-Token header matches the csrf_token cookie
+func validCSRFToken(r *http.Request) bool {
+	header := r.Header.Get(csrfHeaderName)
+	cookie, err := r.Cookie(csrfCookieName)
+	if header == "" || err != nil || cookie.Value == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(header), []byte(cookie.Value)) == 1
+}
+
+// CSRFMiddleware rejects state-changing requests without a matching CSRF token while
+// authentication is enabled
+func CSRFMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !IsAuthEnabled() || csrfExemptPaths[r.URL.Path] || isCompatAPIRequest(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !validCSRFToken(r) {
+			WriteError(w, http.StatusForbidden, "Invalid or missing CSRF token")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 func generateCSRFToken() string {
 	b := make([]byte, 32)
 	rand.Read(b)
 	return hex.EncodeToString(b)
 }
+
+// cspSourcePattern matches a CSP host source such as https://api.example.com,
+// wss://*.example.com:8443 or https:
+var cspSourcePattern = regexp.MustCompile(`^([a-z][a-z0-9+.-]*:)(//(\*\.)?[a-zA-Z0-9.-]+(:(\d+|\*))?(/[^\s;,']*)?)?$`)
+
+// cspConfig holds the parts of the Content-Security-Policy taken from the environment
+type cspConfig struct {
+	connectSrc []string
+	reportURI  string
+}
+
+var csp cspConfig
+
+// InitCSP reads CSP_EXTRA_CONNECT, a comma-separated list of sources added to
+// connect-src for custom backends, and CSP_REPORT_URI, where violations are reported.
+// Invalid sources are skipped with a warning.
+func InitCSP() {
+	csp = cspConfig{}
+	for _, source := range strings.Split(os.Getenv("CSP_EXTRA_CONNECT"), ",") {
+		source = strings.TrimSpace(source)
+		if source == "" {
+			continue
+		}
+		if !cspSourcePattern.MatchString(source) {
+			log.Printf("Warning: Ignoring invalid CSP_EXTRA_CONNECT source %q", source)
+			continue
+		}
+		csp.connectSrc = append(csp.connectSrc, source)
+	}
+
+	if uri := strings.TrimSpace(os.Getenv("CSP_REPORT_URI")); uri != "" {
+		if strings.ContainsAny(uri, " ;,'\"") {
+			log.Printf("Warning: Ignoring invalid CSP_REPORT_URI %q", uri)
+		} else {
+			csp.reportURI = uri
+		}
+	}
+}
+
+// cspNonceKey is the request context key holding the per-request script nonce
+type cspNonceKey struct{}
+
+// cspNonce returns the script nonce generated for the request by CSPMiddleware. Inline
+// <script> blocks in templates carry it as nonce="{{.nonce}}".
+func cspNonce(r *http.Request) string {
+	nonce, _ := r.Context().Value(cspNonceKey{}).(string)
+	return nonce
+}
+
+// newCSPNonce returns 128 random bits, base64-encoded. The alphabet needs no escaping
+// inside a quoted HTML attribute or the CSP header.
+func newCSPNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// buildCSP assembles the Content-Security-Policy header value. Scripts load from 'self'
+// or carry the request's nonce; inline event handlers are not allowed.
+func buildCSP(nonce string) string {
+	scriptSrc := "script-src 'self'"
+	if nonce != "" {
+		scriptSrc += " 'nonce-" + nonce + "'"
+	}
+	directives := []string{
+		"default-src 'self'",
+		scriptSrc,
+		"style-src 'self' 'unsafe-inline'",
+		"img-src 'self' data:",
+		"font-src 'self'",
+		"connect-src " + strings.Join(append([]string{"'self'"}, csp.connectSrc...), " "),
+		"object-src 'none'",
+		"base-uri 'self'",
+		"form-action 'self'",
+		"frame-ancestors 'none'",
+	}
+	if csp.reportURI != "" {
+		directives = append(directives, "report-uri "+csp.reportURI)
+	}
+	return strings.Join(directives, "; ")
+}
+
+// CSPMiddleware generates a script nonce for each request and sets the
+// Content-Security-Policy header allowing it
+func CSPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonce, err := newCSPNonce()
+		if err != nil {
+			log.Printf("Error generating CSP nonce: %v", err)
+		}
+		w.Header().Set("Content-Security-Policy", buildCSP(nonce))
+		if nonce != "" {
+			r = r.WithContext(context.WithValue(r.Context(), cspNonceKey{}, nonce))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+const (
+	apiV1Prefix     = "/api/v1"
+	legacyAPIPrefix = "/api"
+)
+
+// DeprecatedAPIMiddleware marks responses from the unversioned /api alias as deprecated
+// and links to the same route under /api/v1
+func DeprecatedAPIMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		successor := apiV1Prefix + strings.TrimPrefix(r.URL.Path, legacyAPIPrefix)
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+successor+">; rel=\"successor-version\"")
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// enableAuthForTest turns authentication on for one test, as CSRF checks only run then
+func enableAuthForTest(t *testing.T) {
+	t.Helper()
+	old := authEnabled
+	authEnabled = true
+	t.Cleanup(func() { authEnabled = old })
+}
+
+func TestCSRFMiddleware(t *testing.T) {
+	enableAuthForTest(t)
+	handler := CSRFMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	for _, tc := range []struct {
+		name           string
+		method         string
+		cookie, header string
+		want           int
+	}{
+		{"GET needs no token", http.MethodGet, "", "", http.StatusNoContent},
+		{"missing header and cookie", http.MethodPost, "", "", http.StatusForbidden},
+		{"missing header", http.MethodPost, "token-a", "", http.StatusForbidden},
+		{"missing cookie", http.MethodDelete, "", "token-a", http.StatusForbidden},
+		{"mismatched token", http.MethodPut, "token-a", "token-b", http.StatusForbidden},
+		{"matching token", http.MethodPost, "token-a", "token-a", http.StatusNoContent},
+	} {
+		req := httptest.NewRequest(tc.method, "/api/v1/chats", nil)
+		if tc.cookie != "" {
+			req.AddCookie(&http.Cookie{Name: csrfCookieName, Value: tc.cookie})
+		}
+		if tc.header != "" {
+			req.Header.Set(csrfHeaderName, tc.header)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("%s: status %d, want %d", tc.name, rec.Code, tc.want)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", nil))
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("login without a token: status %d, want it exempt", rec.Code)
+	}
+}
+
+func TestIssueCSRFTokenSetsMatchingCookie(t *testing.T) {
+	rec := httptest.NewRecorder()
+	token := issueCSRFToken(rec)
+	cookies := rec.Result().Cookies()
+	if token == "" || len(cookies) != 1 || cookies[0].Name != csrfCookieName || cookies[0].Value != token {
+		t.Fatalf("token %q, cookies %v", token, cookies)
+	}
+	if cookies[0].HttpOnly {
+		t.Fatal("the CSRF cookie must be readable by scripts to be echoed back")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	old := trustedProxies
+	trustedProxies = parseTrustedProxies("10.0.0.1, 192.168.0.0/16, not-an-ip")
+	t.Cleanup(func() { trustedProxies = old })
+
+	for _, tc := range []struct {
+		name, remote, forwarded, want string
+	}{
+		{"direct client", "203.0.113.5:4000", "", "203.0.113.5"},
+		{"spoofed header from an untrusted peer", "203.0.113.5:4000", "1.2.3.4", "203.0.113.5"},
+		{"trusted proxy", "10.0.0.1:4000", "198.51.100.7", "198.51.100.7"},
+		{"client-supplied entries are skipped", "10.0.0.1:4000", "1.2.3.4, 198.51.100.7", "198.51.100.7"},
+		{"chain of trusted proxies", "10.0.0.1:4000", "198.51.100.7, 192.168.1.20", "198.51.100.7"},
+		{"trusted proxy without header", "10.0.0.1:4000", "", "10.0.0.1"},
+		{"garbage stops the walk", "10.0.0.1:4000", "198.51.100.7, junk", "10.0.0.1"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = tc.remote
+		if tc.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", tc.forwarded)
+		}
+		if got := clientIP(req); got != tc.want {
+			t.Errorf("%s: clientIP = %s, want %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestEvictIdleLimiters(t *testing.T) {
+	limiterMu.Lock()
+	old := limiters
+	limiters = make(map[string]*visitor)
+	limiterMu.Unlock()
+	t.Cleanup(func() {
+		limiterMu.Lock()
+		limiters = old
+		limiterMu.Unlock()
+	})
+
+	getLimiter("198.51.100.1")
+	getLimiter("198.51.100.2")
+	limiterMu.Lock()
+	limiters["198.51.100.1"].lastSeen = time.Now().Add(-2 * limiterIdleTTL)
+	limiterMu.Unlock()
+
+	if removed := evictIdleLimiters(limiterIdleTTL); removed != 1 {
+		t.Fatalf("evicted %d limiters, want 1", removed)
+	}
+	limiterMu.Lock()
+	defer limiterMu.Unlock()
+	if _, ok := limiters["198.51.100.1"]; ok {
+		t.Error("idle limiter was kept")
+	}
+	if _, ok := limiters["198.51.100.2"]; !ok {
+		t.Error("active limiter was evicted")
+	}
+}
+
+// adminSessionForTest turns authentication on and returns a session cookie of the admin
+func adminSessionForTest(t *testing.T) *http.Cookie {
+	t.Helper()
+	enableAuthForTest(t)
+	old := adminUser
+	adminUser = User{ID: "admin", Username: "admin"}
+	t.Cleanup(func() { adminUser = old })
+	return &http.Cookie{Name: "session_id", Value: CreateSession(adminUser.ID)}
+}
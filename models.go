@@ -0,0 +1,82 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+)
+
+// ModelCapabilities records what a model accepts beyond plain text chat. It is stored as
+// JSON in models.capabilities.
+type ModelCapabilities struct {
+	SupportsTools  bool `json:"supports_tools"`
+	SupportsVision bool `json:"supports_vision"`
+}
+
+// insertModelQuery adds a model unless the provider already has one with that name
+const insertModelQuery = `INSERT OR IGNORE INTO models (provider_id, model_name, is_default, owned_by, capabilities) VALUES (?, ?, ?, ?, ?)`
+
+// toolModelHints and visionModelHints are name fragments of model families known to
+// support function calling and image input. OpenAI's o-series is matched by prefix, since
+// "o3" alone appears inside other names.
+var (
+	toolModelHints = []string{
+		"gpt-4", "gpt-3.5-turbo", "gpt-5", "claude", "gemini",
+		"mistral", "mixtral", "llama3.1", "llama3.2", "llama3.3", "llama-3.1", "llama-3.2", "llama-3.3",
+		"llama4", "qwen2", "qwen3", "command-r", "hermes", "firefunction", "granite3", "deepseek-v3",
+		"grok", "nemotron", "functionary", "gpt-oss", "kimi", "glm-4",
+	}
+	visionModelHints = []string{
+		"vision", "llava", "gpt-4o", "gpt-4.1", "gpt-4-turbo", "gpt-5", "claude-3",
+		"claude-sonnet", "claude-opus", "claude-haiku", "gemini", "pixtral", "-vl", "moondream",
+		"minicpm-v", "gemma3", "llama4",
+	}
+)
+
+// inferModelCapabilities guesses capabilities from the model name, for providers whose
+// model lists do not report them
+func inferModelCapabilities(name string) ModelCapabilities {
+	name = strings.ToLower(name)
+	base := name[strings.LastIndex(name, "/")+1:]
+	oSeries := strings.HasPrefix(base, "o3") || strings.HasPrefix(base, "o4")
+	return ModelCapabilities{
+		SupportsTools:  oSeries || containsAny(name, toolModelHints),
+		SupportsVision: oSeries || containsAny(name, visionModelHints),
+	}
+}
+
+func containsAny(s string, fragments []string) bool {
+	for _, f := range fragments {
+		if strings.Contains(s, f) {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeModelCapabilities returns the JSON stored in models.capabilities
+func encodeModelCapabilities(c ModelCapabilities) string {
+	data, _ := json.Marshal(c)
+	return string(data)
+}
+
+// decodeModelCapabilities reads models.capabilities, inferring from the name for rows
+// saved before the column existed
+func decodeModelCapabilities(raw, name string) ModelCapabilities {
+	var c ModelCapabilities
+	if raw == "" || json.Unmarshal([]byte(raw), &c) != nil {
+		return inferModelCapabilities(name)
+	}
+	return c
+}
+
+// modelSupportsTools reads supports_tools for one of a provider's models, inferring it
+// from the name when the model is not stored
+func modelSupportsTools(db *sql.DB, providerID int64, model string) bool {
+	var raw string
+	if db != nil {
+		db.QueryRow("SELECT COALESCE(capabilities, '') FROM models WHERE provider_id = ? AND model_name = ?",
+			providerID, model).Scan(&raw)
+	}
+	return decodeModelCapabilities(raw, model).SupportsTools
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func countModels(t *testing.T, providerID int64, name string) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM models WHERE provider_id = ? AND model_name = ?", providerID, name).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestAddModelTwiceConflicts(t *testing.T) {
+	testDB := newTestDB(t)
+	providerID := newTestProvider(t, testDB, "https://api.example.com/v1")
+	api := newTestAPI()
+	body := `{"provider_id": ` + strconv.FormatInt(providerID, 10) + `, "model_name": "gpt-test"}`
+
+	if rec := serveAPI(t, api, http.MethodPost, "/models", body); rec.Code != http.StatusOK {
+		t.Fatalf("first add: status %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := serveAPI(t, api, http.MethodPost, "/models", body); rec.Code != http.StatusConflict {
+		t.Errorf("second add: status %d, want 409", rec.Code)
+	}
+	if n := countModels(t, providerID, "gpt-test"); n != 1 {
+		t.Errorf("stored %d rows for the model, want 1", n)
+	}
+
+	// The unique index backs the check when two requests race past it
+	_, err := testDB.Exec("INSERT INTO models (provider_id, model_name) VALUES (?, 'gpt-test')", providerID)
+	if !isUniqueViolation(err) {
+		t.Errorf("duplicate insert error = %v, want a unique violation", err)
+	}
+}
+
+func TestImportModelsSkipsDuplicates(t *testing.T) {
+	testDB := newTestDB(t)
+	providerID := newTestProvider(t, testDB, "https://api.example.com/v1")
+	api := newTestAPI()
+	path := "/providers/" + strconv.FormatInt(providerID, 10) + "/models/import"
+
+	serveAPI(t, api, http.MethodPost, path, `{"models": ["gpt-a"]}`)
+	rec := serveAPI(t, api, http.MethodPost, path, `{"models": ["gpt-a", "gpt-b", "gpt-b"]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("import: status %d: %s", rec.Code, rec.Body.String())
+	}
+	var result struct {
+		Added   int `json:"added"`
+		Skipped int `json:"skipped"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Added != 1 || result.Skipped != 2 {
+		t.Errorf("added %d, skipped %d; want 1 and 2", result.Added, result.Skipped)
+	}
+	for _, name := range []string{"gpt-a", "gpt-b"} {
+		if n := countModels(t, providerID, name); n != 1 {
+			t.Errorf("stored %d rows for %s, want 1", n, name)
+		}
+	}
+}
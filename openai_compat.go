@@ -0,0 +1,391 @@
+package main
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ollama/ollama/api"
+)
+
+// openAIContent is a message content that may be sent either as a plain string or as
+// an array of typed parts; only text parts are kept
+type openAIContent string
+
+func (c *openAIContent) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*c = openAIContent(text)
+		return nil
+	}
+
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(data, &parts); err != nil {
+		return fmt.Errorf("content must be a string or an array of parts")
+	}
+
+	var b strings.Builder
+	for _, p := range parts {
+		if p.Type == "text" {
+			b.WriteString(p.Text)
+		}
+	}
+	*c = openAIContent(b.String())
+	return nil
+}
+
+// openAIChatMessage is one entry of an OpenAI chat completion request
+type openAIChatMessage struct {
+	Role    string        `json:"role"`
+	Content openAIContent `json:"content"`
+}
+
+// openAIChatRequest is the subset of the OpenAI chat completion request that is honored
+type openAIChatRequest struct {
+	Model       string              `json:"model"`
+	Messages    []openAIChatMessage `json:"messages"`
+	Stream      bool                `json:"stream"`
+	Temperature *float64            `json:"temperature"`
+}
+
+// openAIUsage is the token usage block of a chat completion
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// writeOpenAIError writes an error in the OpenAI API's error shape
+func writeOpenAIError(w http.ResponseWriter, status int, errType, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{
+			"message": message,
+			"type":    errType,
+			"code":    code,
+		},
+	})
+}
+
+// isCompatAPIRequest reports whether r is a bearer-authenticated call to the
+// OpenAI-compatible API, which browsers cannot forge cross-site
+func isCompatAPIRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/v1/") &&
+		strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
+
+// CompatAuthMiddleware protects the OpenAI-compatible API. When apiKey is set clients
+// must send it as a bearer token; otherwise the regular session login applies.
+func CompatAuthMiddleware(apiKey string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if apiKey == "" {
+			return AuthMiddleware(next)
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(token), []byte(apiKey)) != 1 {
+				writeOpenAIError(w, http.StatusUnauthorized, "invalid_request_error", "invalid_api_key", "Invalid API key")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// openAICompletionWriter receives the output of streamGeneration and either relays it
+// as chat.completion.chunk events or buffers it for a single response. The analytics
+// block providers append is stripped and kept for the usage figures.
+type openAICompletionWriter struct {
+	w       http.ResponseWriter
+	header  http.Header
+	stream  bool
+	id      string
+	model   string
+	created int64
+
+	started   bool
+	failed    bool
+	done      bool
+	content   strings.Builder
+	errBody   strings.Builder
+	analytics string
+}
+
+func newOpenAICompletionWriter(w http.ResponseWriter, stream bool, model string) *openAICompletionWriter {
+	now := time.Now()
+	return &openAICompletionWriter{
+		w:       w,
+		header:  http.Header{},
+		stream:  stream,
+		id:      fmt.Sprintf("chatcmpl-%d", now.UnixNano()),
+		model:   model,
+		created: now.Unix(),
+	}
+}
+
+// Header returns a scratch header map so providers cannot change the response type
+func (c *openAICompletionWriter) Header() http.Header {
+	return c.header
+}
+
+func (c *openAICompletionWriter) WriteHeader(status int) {
+	if status >= http.StatusBadRequest {
+		c.failed = true
+	}
+}
+
+func (c *openAICompletionWriter) Write(p []byte) (int, error) {
+	if c.failed {
+		c.errBody.Write(p)
+		return len(p), nil
+	}
+	if c.done {
+		c.analytics += string(p)
+		return len(p), nil
+	}
+
+	text := string(p)
+	if idx := strings.Index(text, analyticsMarker); idx != -1 {
+		c.analytics = text[idx+len(analyticsMarker):]
+		c.done = true
+		text = text[:idx]
+	}
+	if text == "" {
+		return len(p), nil
+	}
+
+	c.content.WriteString(text)
+	if c.stream {
+		c.sendChunk(map[string]interface{}{"content": text}, nil)
+	}
+	return len(p), nil
+}
+
+func (c *openAICompletionWriter) Flush() {
+	if f, ok := c.w.(http.Flusher); ok && c.started {
+		f.Flush()
+	}
+}
+
+// sendChunk writes one chat.completion.chunk event, sending the stream headers and the
+// assistant role with the first one
+func (c *openAICompletionWriter) sendChunk(delta map[string]interface{}, finishReason *string) {
+	if !c.started {
+		c.w.Header().Set("Content-Type", "text/event-stream")
+		c.w.Header().Set("Cache-Control", "no-cache")
+		c.w.Header().Set("Connection", "keep-alive")
+		c.w.WriteHeader(http.StatusOK)
+		delta["role"] = "assistant"
+		c.started = true
+	}
+
+	chunk := map[string]interface{}{
+		"id":      c.id,
+		"object":  "chat.completion.chunk",
+		"created": c.created,
+		"model":   c.model,
+		"choices": []map[string]interface{}{{
+			"index":         0,
+			"delta":         delta,
+			"finish_reason": finishReason,
+		}},
+	}
+	data, _ := json.Marshal(chunk)
+	fmt.Fprintf(c.w, "data: %s\n\n", data)
+	c.Flush()
+}
+
+// usage returns the token counts reported in the provider's analytics block
+func (c *openAICompletionWriter) usage() openAIUsage {
+	var analytics struct {
+		Usage openAIUsage `json:"usage"`
+	}
+	json.Unmarshal([]byte(c.analytics), &analytics)
+	return analytics.Usage
+}
+
+// chatCompletions implements POST /v1/chat/completions on top of the active provider.
+// System messages become the system prompt, the final user message the prompt and the
+// rest the history, with the user's memories and the agentic tool loop applied as for
+// the web UI.
+func chatCompletions(w http.ResponseWriter, r *http.Request) {
+	var req openAIChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "invalid_body", "Invalid request body: "+err.Error())
+		return
+	}
+
+	if len(req.Messages) == 0 {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "missing_messages", "messages must not be empty")
+		return
+	}
+	last := req.Messages[len(req.Messages)-1]
+	if last.Role != "user" || strings.TrimSpace(string(last.Content)) == "" {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "invalid_messages", "The last message must be a non-empty user message")
+		return
+	}
+	if req.Temperature != nil && (*req.Temperature < 0 || *req.Temperature > 2) {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "invalid_temperature", "temperature must be between 0 and 2")
+		return
+	}
+
+	// Completions belong to no chat, so only the daily budget applies
+	if budgetErr := checkTokenBudget(0); budgetErr != nil {
+		w.Header().Set("Retry-After", strconv.Itoa(budgetErr.RetryAfter))
+		writeOpenAIError(w, http.StatusTooManyRequests, "rate_limit_error", budgetErr.Code, budgetErr.Message)
+		return
+	}
+
+	provider, config, err := GetActiveProvider(db)
+	if err != nil {
+		code, message := activeProviderError(err)
+		writeOpenAIError(w, http.StatusServiceUnavailable, "server_error", code, message)
+		return
+	}
+
+	if req.Model != "" && req.Model != config.Model {
+		var exists bool
+		db.QueryRow("SELECT EXISTS(SELECT 1 FROM models WHERE provider_id = ? AND model_name = ?)",
+			config.ID, req.Model).Scan(&exists)
+		if !exists {
+			writeOpenAIError(w, http.StatusNotFound, "invalid_request_error", "model_not_found",
+				fmt.Sprintf("Model %q is not configured for the active provider %s", req.Model, config.Name))
+			return
+		}
+		config.Model = req.Model
+		if provider, err = NewProviderFromConfig(config); err != nil {
+			writeOpenAIError(w, http.StatusServiceUnavailable, "server_error", "provider_unavailable", err.Error())
+			return
+		}
+	}
+
+	var systemParts []string
+	var history []api.Message
+	for _, m := range req.Messages[:len(req.Messages)-1] {
+		switch m.Role {
+		case "system", "developer":
+			systemParts = append(systemParts, string(m.Content))
+		case "user", "assistant":
+			history = append(history, api.Message{Role: m.Role, Content: string(m.Content)})
+		}
+	}
+	prompt := string(last.Content)
+	systemPrompt := withGlobalSystemPrompt(db, strings.Join(systemParts, "\n\n"))
+
+	sessionID := getSessionIDFromRequest(r)
+	history = append(buildChatHistory(0, sessionID, prompt), history...)
+
+	ctx := r.Context()
+	if req.Temperature != nil {
+		ctx = withTemperature(ctx, *req.Temperature)
+	}
+
+	slog.Info("generation started", "api", "openai", "provider", config.Name, "model", config.Model,
+		"stream", req.Stream, "history_messages", len(history))
+	start := time.Now()
+
+	out := newOpenAICompletionWriter(w, req.Stream, config.Model)
+	err = streamGeneration(ctx, out, provider, history, prompt, systemPrompt)
+	if err == nil && out.failed {
+		err = fmt.Errorf("%s", strings.TrimSpace(out.errBody.String()))
+	}
+	if err != nil {
+		slog.Error("generation failed", "api", "openai", "model", config.Model,
+			"duration_ms", time.Since(start).Milliseconds(), "error", err.Error())
+		if out.started {
+			data, _ := json.Marshal(map[string]interface{}{
+				"error": map[string]interface{}{"message": err.Error(), "type": "server_error"},
+			})
+			fmt.Fprintf(w, "data: %s\n\ndata: [DONE]\n\n", data)
+			out.Flush()
+			return
+		}
+		if errors.Is(err, ErrProviderBusy) {
+			writeOpenAIError(w, generationErrorStatus(w, err), "server_error", "provider_busy", err.Error())
+			return
+		}
+		writeOpenAIError(w, http.StatusBadGateway, "server_error", "generation_failed", err.Error())
+		return
+	}
+	slog.Info("generation finished", "api", "openai", "model", config.Model,
+		"duration_ms", time.Since(start).Milliseconds())
+	recordTokenUsage(db, 0, usageSourceChat, out.usage().TotalTokens)
+
+	if IsMemoryEnabled(db) {
+		QueueMemoryExtraction(sessionID, prompt)
+	}
+
+	finishReason := "stop"
+	if req.Stream {
+		out.sendChunk(map[string]interface{}{}, &finishReason)
+		fmt.Fprint(w, "data: [DONE]\n\n")
+		out.Flush()
+		return
+	}
+
+	response := map[string]interface{}{
+		"id":      out.id,
+		"object":  "chat.completion",
+		"created": out.created,
+		"model":   config.Model,
+		"choices": []map[string]interface{}{{
+			"index": 0,
+			"message": map[string]interface{}{
+				"role":    "assistant",
+				"content": out.content.String(),
+			},
+			"finish_reason": finishReason,
+		}},
+		"usage": out.usage(),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding chat completion: %v", err)
+	}
+}
+
+// listCompatModels implements GET /v1/models, listing the active provider's models in
+// the OpenAI list format. Only these models are accepted by chatCompletions.
+func listCompatModels(w http.ResponseWriter, r *http.Request) {
+	var providerID int64
+	var providerName string
+	var createdAt time.Time
+	err := db.QueryRow("SELECT id, name, created_at FROM providers WHERE is_active = 1 LIMIT 1").
+		Scan(&providerID, &providerName, &createdAt)
+	if err == sql.ErrNoRows {
+		code, message := activeProviderError(ErrNoActiveProvider)
+		writeOpenAIError(w, http.StatusServiceUnavailable, "server_error", code, message)
+		return
+	}
+	if err != nil {
+		writeOpenAIError(w, http.StatusInternalServerError, "server_error", "database_error", "Failed to load the active provider")
+		return
+	}
+
+	data := []map[string]interface{}{}
+	for _, m := range getModelsForProvider(providerID) {
+		data = append(data, map[string]interface{}{
+			"id":       m.ModelName,
+			"object":   "model",
+			"created":  createdAt.Unix(),
+			"owned_by": providerName,
+		})
+	}
+
+	WriteJSON(w, map[string]interface{}{
+		"object": "list",
+		"data":   data,
+	})
+}
@@ -1,12 +1,15 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"net/http"
 	"strings"
 	"sync"
@@ -22,12 +25,94 @@ var (
 	llmCacheMu sync.RWMutex
 )
 
+// defaultTemperature is the sampling temperature for OpenAI-compatible calls unless the
+// request context sets one with withTemperature
+const defaultTemperature = 0.7
+
+type temperatureKey struct{}
+
+// withTemperature returns a context whose provider calls use the given temperature
+func withTemperature(ctx context.Context, temperature float64) context.Context {
+	return context.WithValue(ctx, temperatureKey{}, temperature)
+}
+
+// generationTemperature returns the temperature for an OpenAI-compatible call
+func generationTemperature(ctx context.Context) float64 {
+	if t, ok := ctx.Value(temperatureKey{}).(float64); ok {
+		return t
+	}
+	return defaultTemperature
+}
+
+// tokensPerSecond returns the generation speed rounded to one decimal, or 0 when it
+// cannot be measured
+func tokensPerSecond(tokens int, d time.Duration) float64 {
+	if tokens <= 0 || d <= 0 {
+		return 0
+	}
+	return math.Round(float64(tokens)/d.Seconds()*10) / 10
+}
+
+// ollamaOptions returns the Ollama request options, leaving the model's own defaults
+// in place unless the context overrides the temperature
+func ollamaOptions(ctx context.Context) map[string]interface{} {
+	if t, ok := ctx.Value(temperatureKey{}).(float64); ok {
+		return map[string]interface{}{"temperature": t}
+	}
+	return nil
+}
+
+// openAILogParams mirrors the call options sent with an OpenAI-compatible request, for
+// the LLM debug log
+func openAILogParams(ctx context.Context) map[string]interface{} {
+	return map[string]interface{}{
+		"max_tokens":  4096,
+		"temperature": generationTemperature(ctx),
+		"top_p":       0.9,
+	}
+}
+
 // Provider interface defines the contract for LLM providers
 type Provider interface {
 	Generate(ctx context.Context, history []api.Message, prompt string, systemPrompt string, w http.ResponseWriter) error
 	GenerateWithTools(ctx context.Context, history []AgenticMessage, systemPrompt string, tools []Tool) (string, []ToolCall, error)
 	GenerateNonStreaming(ctx context.Context, history []api.Message, prompt string, systemPrompt string) (string, error)
 	FetchModels(ctx context.Context) ([]ModelInfo, error)
+	// SupportsTools reports whether the model accepts tool definitions
+	SupportsTools() bool
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+	EmbedWithUsage(ctx context.Context, texts []string) ([][]float32, int, error)
+}
+
+// Every provider type implements the whole interface, tool calling included
+var (
+	_ Provider = (*OllamaProvider)(nil)
+	_ Provider = (*OpenAIProvider)(nil)
+	_ Provider = (*limitedProvider)(nil)
+)
+
+// ErrToolsUnsupported is returned by GenerateWithTools when the provider or model rejects
+// tool definitions. The agentic loop answers without tools instead.
+var ErrToolsUnsupported = errors.New("model does not support tools")
+
+// toolsUnsupportedHints are fragments of the errors Ollama and OpenAI-compatible APIs
+// return for a model without function calling
+var toolsUnsupportedHints = []string{
+	"does not support tools",
+	"tools is not supported",
+	"tool use is not supported",
+	"tools are not supported",
+	"does not support function calling",
+	"function calling is not supported",
+}
+
+// toolsError marks an error from a tool-calling request as ErrToolsUnsupported when the
+// API says the model cannot take tools
+func toolsError(err error) error {
+	if containsAny(strings.ToLower(err.Error()), toolsUnsupportedHints) {
+		return fmt.Errorf("%w: %v", ErrToolsUnsupported, err)
+	}
+	return err
 }
 
 // ModelInfo represents a model returned from the API
@@ -46,12 +131,16 @@ type ProviderConfig struct {
 	APIKey   string
 	IsActive bool
 	Model    string // Currently selected model
+	// MaxConcurrent caps in-flight generations against the provider; 0 means no limit
+	MaxConcurrent int
 }
 
 // OllamaProvider handles Ollama API calls
 type OllamaProvider struct {
 	client *api.Client
 	model  string
+
+	supportsTools bool
 }
 
 // OpenAIProvider handles OpenAI-compatible API calls (Groq, DeepInfra, OpenRouter, etc.)
@@ -59,29 +148,48 @@ type OpenAIProvider struct {
 	baseURL string
 	apiKey  string
 	model   string
+
+	supportsTools bool
 }
 
-// NewOllamaProvider creates a new Ollama provider
+// NewOllamaProvider creates a new Ollama provider. Tool support is guessed from the
+// model name; NewProviderFromConfig uses the stored capabilities instead.
 func NewOllamaProvider(model string) (*OllamaProvider, error) {
 	client, err := api.ClientFromEnvironment()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Ollama client: %w", err)
 	}
 	return &OllamaProvider{
-		client: client,
-		model:  model,
+		client:        client,
+		model:         model,
+		supportsTools: inferModelCapabilities(model).SupportsTools,
 	}, nil
 }
 
 // NewOpenAIProvider creates a new OpenAI-compatible provider
 func NewOpenAIProvider(baseURL, apiKey, model string) *OpenAIProvider {
 	return &OpenAIProvider{
-		baseURL: baseURL,
-		apiKey:  apiKey,
-		model:   model,
+		baseURL:       baseURL,
+		apiKey:        apiKey,
+		model:         model,
+		supportsTools: inferModelCapabilities(model).SupportsTools,
 	}
 }
 
+// SupportsTools reports whether the Ollama model accepts tool definitions
+func (p *OllamaProvider) SupportsTools() bool {
+	return p.supportsTools
+}
+
+// SupportsTools reports whether the OpenAI-compatible model accepts tool definitions
+func (p *OpenAIProvider) SupportsTools() bool {
+	return p.supportsTools
+}
+
+// providerHTTPClient carries every request to OpenAI-compatible providers, including
+// langchaingo's, so the private address block is enforced when connecting
+var providerHTTPClient = &http.Client{Transport: guardedTransport}
+
 func getCachedLLM(baseURL, apiKey, model string) (*openai.LLM, error) {
 	cacheKey := baseURL + "|" + apiKey + "|" + model
 
@@ -103,6 +211,7 @@ func getCachedLLM(baseURL, apiKey, model string) (*openai.LLM, error) {
 		openai.WithModel(model),
 		openai.WithBaseURL(baseURL),
 		openai.WithToken(apiKey),
+		openai.WithHTTPClient(providerHTTPClient),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create OpenAI client: %w", err)
@@ -137,6 +246,7 @@ func (p *OllamaProvider) Generate(ctx context.Context, history []api.Message, pr
 	req := &api.ChatRequest{
 		Model:    p.model,
 		Messages: messages,
+		Options:  ollamaOptions(ctx),
 	}
 
 	// Add system prompt to request if valid
@@ -164,6 +274,8 @@ func (p *OllamaProvider) Generate(ctx context.Context, history []api.Message, pr
 		return nil
 	}
 
+	logLLMRequest("generate", "ollama", p.model, req.Options, nil, ollamaLogMessages(req.Messages))
+	start := time.Now()
 	err := p.client.Chat(ctx, req, respFunc)
 	if err != nil {
 		return err
@@ -171,7 +283,8 @@ func (p *OllamaProvider) Generate(ctx context.Context, history []api.Message, pr
 
 	// Send analytics at the end as a special JSON block (same format as OpenAI)
 	analyticsData := map[string]interface{}{
-		"model": p.model,
+		"model":      p.model,
+		"latency_ms": time.Since(start).Milliseconds(),
 	}
 
 	if evalCount > 0 {
@@ -182,6 +295,7 @@ func (p *OllamaProvider) Generate(ctx context.Context, history []api.Message, pr
 			"total_tokens":      finalMetrics.PromptEvalCount + finalMetrics.EvalCount,
 		}
 		analyticsData["speed"] = fmt.Sprintf("%.1f tokens/s", speed)
+		analyticsData["tokens_per_sec"] = tokensPerSecond(finalMetrics.EvalCount, finalMetrics.EvalDuration)
 	}
 
 	analyticsJSON, _ := json.Marshal(analyticsData)
@@ -223,6 +337,7 @@ func (p *OllamaProvider) GenerateNonStreaming(ctx context.Context, history []api
 	req := &api.ChatRequest{
 		Model:    p.model,
 		Messages: messages,
+		Options:  ollamaOptions(ctx),
 	}
 
 	var response strings.Builder
@@ -231,6 +346,7 @@ func (p *OllamaProvider) GenerateNonStreaming(ctx context.Context, history []api
 		return nil
 	}
 
+	logLLMRequest("generate_non_streaming", "ollama", p.model, req.Options, nil, ollamaLogMessages(req.Messages))
 	err := p.client.Chat(ctx, req, respFunc)
 	if err != nil {
 		return "", err
@@ -256,6 +372,7 @@ func (p *OllamaProvider) GenerateWithTools(ctx context.Context, history []Agenti
 	req := &api.ChatRequest{
 		Model:    p.model,
 		Messages: messages,
+		Options:  ollamaOptions(ctx),
 	}
 
 	if len(tools) > 0 {
@@ -346,14 +463,37 @@ func (p *OllamaProvider) GenerateWithTools(ctx context.Context, history []Agenti
 		return nil
 	}
 
+	logLLMRequest("generate_with_tools", "ollama", p.model, req.Options, tools, ollamaLogMessages(req.Messages))
 	err := p.client.Chat(ctx, req, respFunc)
 	if err != nil {
-		return "", nil, err
+		return "", nil, toolsError(err)
 	}
 
 	return response.String(), toolCalls, nil
 }
 
+// Embed returns one embedding vector per input text using Ollama's /api/embed
+func (p *OllamaProvider) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors, _, err := p.EmbedWithUsage(ctx, texts)
+	return vectors, err
+}
+
+// EmbedWithUsage embeds texts with Ollama's /api/embed and also returns the prompt
+// token count
+func (p *OllamaProvider) EmbedWithUsage(ctx context.Context, texts []string) ([][]float32, int, error) {
+	resp, err := p.client.Embed(ctx, &api.EmbedRequest{
+		Model: p.model,
+		Input: texts,
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create Ollama embeddings: %w", err)
+	}
+	if len(resp.Embeddings) != len(texts) {
+		return nil, 0, fmt.Errorf("expected %d embeddings, got %d", len(texts), len(resp.Embeddings))
+	}
+	return resp.Embeddings, resp.PromptEvalCount, nil
+}
+
 // UsageStats holds token usage information
 type UsageStats struct {
 	PromptTokens     int `json:"prompt_tokens"`
@@ -423,15 +563,19 @@ func (p *OpenAIProvider) Generate(ctx context.Context, history []api.Message, pr
 
 	opts := []llms.CallOption{
 		llms.WithMaxTokens(4096),
-		llms.WithTemperature(0.7),
+		llms.WithTemperature(generationTemperature(ctx)),
 		llms.WithTopP(0.9),
 	}
 
+	logLLMRequest("generate", "openai_compatible", p.model, openAILogParams(ctx), nil, langchainLogMessages(messages), p.apiKey)
+
 	// Use streaming if available
+	start := time.Now()
 	resp, err := llm.GenerateContent(ctx, messages, opts...)
 	if err != nil {
 		return fmt.Errorf("failed to generate content: %w", err)
 	}
+	latency := time.Since(start)
 
 	for _, c := range resp.Choices {
 		w.Write([]byte(c.Content))
@@ -441,7 +585,8 @@ func (p *OpenAIProvider) Generate(ctx context.Context, history []api.Message, pr
 	// Send analytics at the end as a special JSON block
 	// Format: \n\n__ANALYTICS__{"model":"...", "usage":{...}}
 	analyticsData := map[string]interface{}{
-		"model": p.model,
+		"model":      p.model,
+		"latency_ms": latency.Milliseconds(),
 	}
 
 	// Try to extract token usage from GenerationInfo if available
@@ -480,6 +625,9 @@ func (p *OpenAIProvider) Generate(ctx context.Context, history []api.Message, pr
 		if len(usage) > 0 {
 			analyticsData["usage"] = usage
 		}
+		if ct, ok := usage["completion_tokens"].(int); ok {
+			analyticsData["tokens_per_sec"] = tokensPerSecond(ct, latency)
+		}
 	}
 
 	analyticsJSON, _ := json.Marshal(analyticsData)
@@ -503,7 +651,7 @@ func (p *OpenAIProvider) FetchModels(ctx context.Context) ([]ModelInfo, error) {
 	req.Header.Set("Authorization", "Bearer "+p.apiKey)
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := providerHTTPClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch models: %w", err)
 	}
@@ -579,10 +727,11 @@ func (p *OpenAIProvider) GenerateNonStreaming(ctx context.Context, history []api
 
 	opts := []llms.CallOption{
 		llms.WithMaxTokens(4096),
-		llms.WithTemperature(0.7),
+		llms.WithTemperature(generationTemperature(ctx)),
 		llms.WithTopP(0.9),
 	}
 
+	logLLMRequest("generate_non_streaming", "openai_compatible", p.model, openAILogParams(ctx), nil, langchainLogMessages(messages), p.apiKey)
 	resp, err := llm.GenerateContent(ctx, messages, opts...)
 	if err != nil {
 		return "", fmt.Errorf("failed to generate content: %w", err)
@@ -596,6 +745,69 @@ func (p *OpenAIProvider) GenerateNonStreaming(ctx context.Context, history []api
 	return result.String(), nil
 }
 
+// Embed returns one embedding vector per input text using the /embeddings endpoint
+func (p *OpenAIProvider) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors, _, err := p.EmbedWithUsage(ctx, texts)
+	return vectors, err
+}
+
+// EmbedWithUsage calls the /embeddings endpoint directly so the reported token usage
+// is kept
+func (p *OpenAIProvider) EmbedWithUsage(ctx context.Context, texts []string) ([][]float32, int, error) {
+	url := strings.TrimSuffix(p.baseURL, "/") + "/embeddings"
+
+	body, err := json.Marshal(map[string]interface{}{
+		"model": p.model,
+		"input": texts,
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := providerHTTPClient.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create embeddings: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, 0, fmt.Errorf("API error %d: %s", resp.StatusCode, string(body))
+	}
+
+	var result struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+		Usage struct {
+			PromptTokens int `json:"prompt_tokens"`
+		} `json:"usage"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, 0, fmt.Errorf("failed to parse response: %w", err)
+	}
+	if len(result.Data) != len(texts) {
+		return nil, 0, fmt.Errorf("expected %d embeddings, got %d", len(texts), len(result.Data))
+	}
+
+	vectors := make([][]float32, len(texts))
+	for _, d := range result.Data {
+		if d.Index < 0 || d.Index >= len(texts) {
+			return nil, 0, fmt.Errorf("embedding index %d out of range", d.Index)
+		}
+		vectors[d.Index] = d.Embedding
+	}
+	return vectors, result.Usage.PromptTokens, nil
+}
+
 // GenerateWithTools generates a response with tool support for OpenAI
 func (p *OpenAIProvider) GenerateWithTools(ctx context.Context, history []AgenticMessage, systemPrompt string, tools []Tool) (string, []ToolCall, error) {
 	llm, err := getCachedLLM(p.baseURL, p.apiKey, p.model)
@@ -675,7 +887,7 @@ func (p *OpenAIProvider) GenerateWithTools(ctx context.Context, history []Agenti
 
 	opts := []llms.CallOption{
 		llms.WithMaxTokens(4096),
-		llms.WithTemperature(0.7),
+		llms.WithTemperature(generationTemperature(ctx)),
 		llms.WithTopP(0.9),
 	}
 
@@ -694,9 +906,10 @@ func (p *OpenAIProvider) GenerateWithTools(ctx context.Context, history []Agenti
 		opts = append(opts, llms.WithTools(llmTools))
 	}
 
+	logLLMRequest("generate_with_tools", "openai_compatible", p.model, openAILogParams(ctx), tools, langchainLogMessages(messages), p.apiKey)
 	resp, err := llm.GenerateContent(ctx, messages, opts...)
 	if err != nil {
-		return "", nil, fmt.Errorf("failed to generate content: %w", err)
+		return "", nil, fmt.Errorf("failed to generate content: %w", toolsError(err))
 	}
 
 	var result strings.Builder
@@ -725,23 +938,53 @@ func (p *OpenAIProvider) GenerateWithTools(ctx context.Context, history []Agenti
 	return result.String(), toolCalls, nil
 }
 
-// GetActiveProvider retrieves the currently active provider from the database
+var (
+	// ErrNoActiveProvider means no provider is marked active
+	ErrNoActiveProvider = errors.New("no active provider configured")
+	// ErrNoModelConfigured means the active provider has no models to generate with
+	ErrNoModelConfigured = errors.New("no model configured for provider")
+)
+
+// ErrProviderNotFound means no provider has the requested id
+var ErrProviderNotFound = errors.New("provider not found")
+
+// GetActiveProvider retrieves the currently active provider from the database. When the
+// provider has no models it returns ErrNoModelConfigured along with the provider's config.
 func GetActiveProvider(db *sql.DB) (Provider, *ProviderConfig, error) {
+	provider, config, err := loadProvider(db, "p.is_active = 1")
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, ErrNoActiveProvider
+	}
+	return provider, config, err
+}
+
+// GetProviderByID loads a provider by id whether or not it is active, with the same
+// ErrNoModelConfigured behavior as GetActiveProvider
+func GetProviderByID(db *sql.DB, id int64) (Provider, *ProviderConfig, error) {
+	provider, config, err := loadProvider(db, "p.id = ?", id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, ErrProviderNotFound
+	}
+	return provider, config, err
+}
+
+// loadProvider reads the first provider matching condition with its default (or any)
+// model. sql.ErrNoRows is returned unwrapped when no provider matches.
+func loadProvider(db *sql.DB, condition string, args ...interface{}) (Provider, *ProviderConfig, error) {
 	var config ProviderConfig
 
-	// Get active provider
 	err := db.QueryRow(`
-		SELECT p.id, p.name, p.type, COALESCE(p.base_url, ''), COALESCE(p.api_key, '')
+		SELECT p.id, p.name, p.type, COALESCE(p.base_url, ''), COALESCE(p.api_key, ''), COALESCE(p.max_concurrent, 0), p.is_active
 		FROM providers p
-		WHERE p.is_active = 1
+		WHERE `+condition+`
 		LIMIT 1
-	`).Scan(&config.ID, &config.Name, &config.Type, &config.BaseURL, &config.APIKey)
+	`, args...).Scan(&config.ID, &config.Name, &config.Type, &config.BaseURL, &config.APIKey, &config.MaxConcurrent, &config.IsActive)
 
 	if err == sql.ErrNoRows {
-		return nil, nil, fmt.Errorf("no active provider configured")
+		return nil, nil, err
 	}
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to get active provider: %w", err)
+		return nil, nil, fmt.Errorf("failed to get provider: %w", err)
 	}
 
 	// Decrypt the API key
@@ -770,26 +1013,37 @@ func GetActiveProvider(db *sql.DB) (Provider, *ProviderConfig, error) {
 		`, config.ID).Scan(&config.Model)
 	}
 
+	if err == sql.ErrNoRows {
+		return nil, &config, fmt.Errorf("%w %q", ErrNoModelConfigured, config.Name)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get provider model: %w", err)
+	}
+
+	provider, err := NewProviderFromConfig(&config)
 	if err != nil {
-		return nil, nil, fmt.Errorf("no model configured for provider: %w", err)
+		return nil, nil, err
 	}
 
-	config.IsActive = true
+	return provider, &config, nil
+}
 
-	// Create the appropriate provider
-	var provider Provider
+// NewProviderFromConfig creates the appropriate provider for the config's type and model,
+// limited to the config's max_concurrent generations
+func NewProviderFromConfig(config *ProviderConfig) (Provider, error) {
 	switch config.Type {
 	case "ollama":
-		p, err := NewOllamaProvider(config.Model)
+		provider, err := NewOllamaProvider(config.Model)
 		if err != nil {
-			return nil, nil, err
+			return nil, err
 		}
-		provider = p
+		provider.supportsTools = modelSupportsTools(db, config.ID, config.Model)
+		return withConcurrencyLimit(provider, config), nil
 	case "openai_compatible":
-		provider = NewOpenAIProvider(config.BaseURL, config.APIKey, config.Model)
+		provider := NewOpenAIProvider(config.BaseURL, config.APIKey, config.Model)
+		provider.supportsTools = modelSupportsTools(db, config.ID, config.Model)
+		return withConcurrencyLimit(provider, config), nil
 	default:
-		return nil, nil, fmt.Errorf("unknown provider type: %s", config.Type)
+		return nil, fmt.Errorf("unknown provider type: %s", config.Type)
 	}
-
-	return provider, &config, nil
 }
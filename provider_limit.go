@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ollama/ollama/api"
+)
+
+// providerQueueTimeout is how long a generation waits for a free slot on a provider at
+// its max_concurrent limit before it is rejected
+const providerQueueTimeout = 30 * time.Second
+
+// ErrProviderBusy is returned when no generation slot frees up on the provider within
+// providerQueueTimeout
+var ErrProviderBusy = errors.New("provider busy: too many concurrent generations, try again shortly")
+
+// providerSemaphore bounds the generations in flight against one provider
+type providerSemaphore struct {
+	slots chan struct{}
+}
+
+var (
+	providerSemaphores   = make(map[int64]*providerSemaphore)
+	providerSemaphoresMu sync.Mutex
+)
+
+// getProviderSemaphore returns the semaphore for a provider id, replacing it when the
+// configured limit changed. Holders of the old semaphore release into it, so a lowered
+// limit applies fully once they finish.
+func getProviderSemaphore(providerID int64, limit int) *providerSemaphore {
+	providerSemaphoresMu.Lock()
+	defer providerSemaphoresMu.Unlock()
+
+	if sem, ok := providerSemaphores[providerID]; ok && cap(sem.slots) == limit {
+		return sem
+	}
+	sem := &providerSemaphore{slots: make(chan struct{}, limit)}
+	providerSemaphores[providerID] = sem
+	return sem
+}
+
+// acquire waits for a free slot, giving up with ErrProviderBusy after timeout or with
+// the context's error when it is cancelled. The returned func releases the slot.
+func (s *providerSemaphore) acquire(ctx context.Context, timeout time.Duration) (func(), error) {
+	release := func() { <-s.slots }
+
+	select {
+	case s.slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case s.slots <- struct{}{}:
+		return release, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-timer.C:
+		return nil, ErrProviderBusy
+	}
+}
+
+// generationErrorStatus maps a failed generation to an HTTP status, setting Retry-After
+// when the provider was busy
+func generationErrorStatus(w http.ResponseWriter, err error) int {
+	if errors.Is(err, ErrProviderBusy) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(providerQueueTimeout.Seconds())))
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusBadGateway
+}
+
+// limitedProvider caps concurrent generations against a provider at its max_concurrent
+// column. Model listing and embeddings are not limited.
+type limitedProvider struct {
+	Provider
+	sem *providerSemaphore
+}
+
+// withConcurrencyLimit wraps a provider when its config sets max_concurrent
+func withConcurrencyLimit(provider Provider, config *ProviderConfig) Provider {
+	if config.MaxConcurrent <= 0 || config.ID == 0 {
+		return provider
+	}
+	return &limitedProvider{Provider: provider, sem: getProviderSemaphore(config.ID, config.MaxConcurrent)}
+}
+
+// Generate streams a response once a slot is free. A busy provider is reported to the
+// client as 503 with a Retry-After header.
+func (p *limitedProvider) Generate(ctx context.Context, history []api.Message, prompt string, systemPrompt string, w http.ResponseWriter) error {
+	release, err := p.sem.acquire(ctx, providerQueueTimeout)
+	if err != nil {
+		if errors.Is(err, ErrProviderBusy) {
+			http.Error(w, "Generation error: "+err.Error(), generationErrorStatus(w, err))
+		}
+		return err
+	}
+	defer release()
+	return p.Provider.Generate(ctx, history, prompt, systemPrompt, w)
+}
+
+// GenerateWithTools runs one tool-calling turn once a slot is free
+func (p *limitedProvider) GenerateWithTools(ctx context.Context, history []AgenticMessage, systemPrompt string, tools []Tool) (string, []ToolCall, error) {
+	release, err := p.sem.acquire(ctx, providerQueueTimeout)
+	if err != nil {
+		return "", nil, err
+	}
+	defer release()
+	return p.Provider.GenerateWithTools(ctx, history, systemPrompt, tools)
+}
+
+// GenerateNonStreaming returns a complete response once a slot is free
+func (p *limitedProvider) GenerateNonStreaming(ctx context.Context, history []api.Message, prompt string, systemPrompt string) (string, error) {
+	release, err := p.sem.acquire(ctx, providerQueueTimeout)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	return p.Provider.GenerateNonStreaming(ctx, history, prompt, systemPrompt)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ollama/ollama/api"
+)
+
+// blockingProvider holds every generation until release is closed, recording the most
+// generations it saw in flight at once
+type blockingProvider struct {
+	Provider
+	release  chan struct{}
+	inFlight atomic.Int32
+	peak     atomic.Int32
+}
+
+func (p *blockingProvider) GenerateNonStreaming(ctx context.Context, history []api.Message, prompt string, systemPrompt string) (string, error) {
+	n := p.inFlight.Add(1)
+	defer p.inFlight.Add(-1)
+	for {
+		peak := p.peak.Load()
+		if n <= peak || p.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	<-p.release
+	return "done", nil
+}
+
+func TestConcurrencyLimitCapsGenerations(t *testing.T) {
+	inner := &blockingProvider{release: make(chan struct{})}
+	provider := withConcurrencyLimit(inner, &ProviderConfig{ID: 9001, MaxConcurrent: 2})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := provider.GenerateNonStreaming(context.Background(), nil, "hi", ""); err != nil {
+				t.Errorf("generation failed: %v", err)
+			}
+		}()
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for inner.inFlight.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	// Give the queued generations a chance to get past the limit if it were broken
+	time.Sleep(50 * time.Millisecond)
+	if got := inner.inFlight.Load(); got != 2 {
+		t.Errorf("generations in flight = %d, want 2", got)
+	}
+
+	close(inner.release)
+	wg.Wait()
+	if got := inner.peak.Load(); got != 2 {
+		t.Errorf("peak generations in flight = %d, want 2", got)
+	}
+}
+
+func TestProviderSemaphoreRejectsWhenBusy(t *testing.T) {
+	sem := getProviderSemaphore(9002, 1)
+	release, err := sem.acquire(context.Background(), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sem.acquire(context.Background(), 20*time.Millisecond); !errors.Is(err, ErrProviderBusy) {
+		t.Errorf("acquire on a full semaphore = %v, want ErrProviderBusy", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := sem.acquire(ctx, time.Second); !errors.Is(err, context.Canceled) {
+		t.Errorf("acquire with a cancelled context = %v, want context.Canceled", err)
+	}
+
+	release()
+	again, err := sem.acquire(context.Background(), 20*time.Millisecond)
+	if err != nil {
+		t.Fatalf("acquire after release: %v", err)
+	}
+	again()
+}
+
+func TestGetProviderSemaphoreFollowsLimitChanges(t *testing.T) {
+	first := getProviderSemaphore(9003, 2)
+	if getProviderSemaphore(9003, 2) != first {
+		t.Error("expected the same semaphore while the limit is unchanged")
+	}
+	if resized := getProviderSemaphore(9003, 3); resized == first || cap(resized.slots) != 3 {
+		t.Error("expected a new semaphore with 3 slots after the limit changed")
+	}
+}
+
+func TestWithConcurrencyLimitLeavesUnlimitedProvidersUnwrapped(t *testing.T) {
+	inner := &blockingProvider{}
+	if got := withConcurrencyLimit(inner, &ProviderConfig{ID: 9004}); got != Provider(inner) {
+		t.Error("expected a provider without max_concurrent to be returned as is")
+	}
+}
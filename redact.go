@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"regexp/syntax"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+const (
+	// maxRedactPatternLength and maxRedactRepeat bound the size of a redaction pattern
+	maxRedactPatternLength = 512
+	maxRedactRepeat        = 1000
+
+	// redactTimeout caps how long one redaction may spend matching
+	redactTimeout = 10 * time.Second
+
+	defaultRedactReplacement = "[REDACTED]"
+)
+
+// RedactRequest describes a search-and-replace over a chat. Pattern is literal unless
+// Regex is set; Replacement defaults to [REDACTED], and in regex mode may use $1-style
+// group references.
+type RedactRequest struct {
+	Pattern     string  `json:"pattern"`
+	Replacement *string `json:"replacement,omitempty"`
+	Regex       bool    `json:"regex"`
+	IgnoreCase  bool    `json:"ignore_case"`
+}
+
+// compileRedactPattern builds the matcher for a redaction. Go's RE2 engine runs in
+// linear time, so there is no catastrophic backtracking; length and repeat counts are
+// still capped to keep compiled programs small. Patterns that match the empty string
+// are rejected since they would insert the replacement between every character.
+func compileRedactPattern(req RedactRequest) (*regexp.Regexp, error) {
+	if req.Pattern == "" {
+		return nil, errors.New("pattern is required")
+	}
+	if len(req.Pattern) > maxRedactPatternLength {
+		return nil, fmt.Errorf("pattern must be at most %d characters", maxRedactPatternLength)
+	}
+
+	expr := req.Pattern
+	if !req.Regex {
+		expr = regexp.QuoteMeta(expr)
+	}
+	if req.IgnoreCase {
+		expr = "(?i)" + expr
+	}
+
+	parsed, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %w", err)
+	}
+	if redactRepeatCount(parsed) > maxRedactRepeat {
+		return nil, fmt.Errorf("pattern repeats are limited to %d", maxRedactRepeat)
+	}
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %w", err)
+	}
+	if re.MatchString("") {
+		return nil, errors.New("pattern must not match empty text")
+	}
+	return re, nil
+}
+
+// redactRepeatCount multiplies the bounded repeats of a parsed pattern, the factor by
+// which nesting such as (a{100}){100} grows the compiled program
+func redactRepeatCount(re *syntax.Regexp) int {
+	count := 1
+	for _, sub := range re.Sub {
+		count = max(count, redactRepeatCount(sub))
+	}
+	if re.Op == syntax.OpRepeat {
+		count *= max(re.Max, re.Min, 1)
+	}
+	return count
+}
+
+// redactText applies a redaction to one text, reporting whether it changed
+func redactText(re *regexp.Regexp, req RedactRequest, replacement, text string) (string, bool) {
+	if !re.MatchString(text) {
+		return text, false
+	}
+	if req.Regex {
+		return re.ReplaceAllString(text, replacement), true
+	}
+	return re.ReplaceAllLiteralString(text, replacement), true
+}
+
+// redactChat handles POST /api/chats/{id}/redact, replacing a pattern in every message
+// of a chat, including earlier versions, and in its title and rolling summary in one
+// transaction. The title is taken from the first message and is matched by chat search,
+// so it is redacted like the messages.
+func redactChat(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid chat ID")
+		return
+	}
+
+	var req RedactRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	re, err := compileRedactPattern(req)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	replacement := defaultRedactReplacement
+	if req.Replacement != nil {
+		replacement = *req.Replacement
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), redactTimeout)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer tx.Rollback()
+
+	var title string
+	var summary *string
+	if err := tx.QueryRowContext(ctx, "SELECT title, summary FROM chats WHERE id = ?", id).Scan(&title, &summary); err != nil {
+		if err == sql.ErrNoRows {
+			WriteError(w, http.StatusNotFound, "Chat not found")
+			return
+		}
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	rows, err := tx.QueryContext(ctx, "SELECT id, role, content FROM messages WHERE chat_id = ? ORDER BY id", id)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	changed := make(map[int64]string)
+	// A title cut from a secret in the first user message may hold only part of it, so
+	// such a title is rebuilt from the redacted message
+	newTitle, titleChanged := redactText(re, req, replacement, title)
+	firstUser := true
+	for rows.Next() {
+		var msgID int64
+		var role, content string
+		if err := rows.Scan(&msgID, &role, &content); err != nil {
+			rows.Close()
+			WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		redacted, ok := redactText(re, req, replacement, content)
+		if ok {
+			changed[msgID] = redacted
+		}
+		if role == "user" && firstUser {
+			firstUser = false
+			if ok && title == chatTitleFromMessage(content) {
+				newTitle, titleChanged = chatTitleFromMessage(redacted), true
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	rowsErr := rows.Err()
+	rows.Close()
+	if ctx.Err() != nil {
+		WriteError(w, http.StatusRequestTimeout, "Redaction timed out; no messages were changed")
+		return
+	}
+	// A scan cut short would leave later messages unredacted
+	if rowsErr != nil {
+		WriteError(w, http.StatusInternalServerError, rowsErr.Error())
+		return
+	}
+
+	for msgID, content := range changed {
+		if _, err := tx.ExecContext(ctx, "UPDATE messages SET content = ? WHERE id = ?", content, msgID); err != nil {
+			WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	if titleChanged {
+		if _, err := tx.ExecContext(ctx, "UPDATE chats SET title = ? WHERE id = ?", newTitle, id); err != nil {
+			WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	summaryChanged := false
+	if summary != nil {
+		if redacted, ok := redactText(re, req, replacement, *summary); ok {
+			if _, err := tx.ExecContext(ctx, "UPDATE chats SET summary = ? WHERE id = ?", redacted, id); err != nil {
+				WriteError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			summaryChanged = true
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	WriteJSON(w, map[string]interface{}{
+		"messages_changed": len(changed),
+		"title_changed":    titleChanged,
+		"summary_changed":  summaryChanged,
+	})
+}
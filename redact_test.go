@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestRedactChatRedactsTheTitleTakenFromTheFirstMessage(t *testing.T) {
+	testDB := newTestDB(t)
+	api := newTestAPI()
+	res, err := testDB.Exec("INSERT INTO chats (title) VALUES ('New Chat')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	chatID, _ := res.LastInsertId()
+	id := strconv.FormatInt(chatID, 10)
+
+	// The secret straddles the 47-character cut, so the title holds only part of it
+	const secret = "sk-live-0123456789abcdefghijklmnopqrstuvwxyz"
+	first, _ := json.Marshal(map[string]string{"role": "user", "content": "My key is " + secret + ", keep it safe"})
+	if rec := serveAPI(t, api, http.MethodPost, "/chats/"+id+"/messages", string(first)); rec.Code != http.StatusOK {
+		t.Fatalf("add message: status %d: %s", rec.Code, rec.Body.String())
+	}
+	var title string
+	testDB.QueryRow("SELECT title FROM chats WHERE id = ?", chatID).Scan(&title)
+	if title == "New Chat" {
+		t.Fatal("expected the first message to title the chat")
+	}
+
+	rec := serveAPI(t, api, http.MethodPost, "/chats/"+id+"/redact", `{"pattern": "`+secret+`"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("redact: status %d: %s", rec.Code, rec.Body.String())
+	}
+	var result struct {
+		MessagesChanged int  `json:"messages_changed"`
+		TitleChanged    bool `json:"title_changed"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.MessagesChanged != 1 || !result.TitleChanged {
+		t.Errorf("result = %+v, want one message and the title changed", result)
+	}
+
+	testDB.QueryRow("SELECT title FROM chats WHERE id = ?", chatID).Scan(&title)
+	if want := chatTitleFromMessage("My key is [REDACTED], keep it safe"); title != want {
+		t.Errorf("title = %q, want %q", title, want)
+	}
+
+	// Neither the title nor the message still matches a search for part of the secret
+	var found []json.RawMessage
+	search := serveAPI(t, api, http.MethodGet, "/chats/search?q=sk-live-0123", "")
+	if err := json.Unmarshal(search.Body.Bytes(), &found); err != nil {
+		t.Fatalf("search: %v: %s", err, search.Body.String())
+	}
+	if len(found) != 0 {
+		t.Errorf("search still finds the chat: %s", search.Body.String())
+	}
+}
+
+func TestRedactChatRedactsARenamedTitle(t *testing.T) {
+	testDB := newTestDB(t)
+	res, err := testDB.Exec("INSERT INTO chats (title) VALUES ('Deploy with token abc123')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	chatID, _ := res.LastInsertId()
+
+	rec := serveAPI(t, newTestAPI(), http.MethodPost, "/chats/"+strconv.FormatInt(chatID, 10)+"/redact", `{"pattern": "abc123"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("redact: status %d: %s", rec.Code, rec.Body.String())
+	}
+	var title string
+	testDB.QueryRow("SELECT title FROM chats WHERE id = ?", chatID).Scan(&title)
+	if title != "Deploy with token [REDACTED]" {
+		t.Errorf("title = %q", title)
+	}
+}
@@ -1,33 +1,206 @@
 package main
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
+// SearchResult is a single web search hit
+type SearchResult struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Url         string `json:"url"`
+	Content     string `json:"content,omitempty"`
+}
+
+// Searcher runs a web search against one backend
+type Searcher interface {
+	Search(query string) ([]SearchResult, error)
+}
+
 // BraveSearchResponse represents the JSON response from Brave Search API
 type BraveSearchResponse struct {
 	Web struct {
-		Results []struct {
-			Title       string `json:"title"`
-			Description string `json:"description"`
-			Url         string `json:"url"`
-		} `json:"results"`
+		Results []SearchResult `json:"results"`
 	} `json:"web"`
 }
 
+// BraveSearcher searches with the Brave Search API. Results are cached per normalized
+// query for CacheTTL; zero disables the cache.
+type BraveSearcher struct {
+	APIKey   string
+	CacheTTL time.Duration
+}
+
+// maxSearchQueryLength is the longest query, in characters, that Brave accepts
+const maxSearchQueryLength = 400
+
+// errInvalidSearchQuery wraps queries rejected before any request is sent
+var errInvalidSearchQuery = errors.New("invalid search query")
+
+// BraveAPIError is a non-200 response from the Brave Search API, carrying the detail
+// from its JSON error body when there is one
+type BraveAPIError struct {
+	StatusCode int
+	Code       string
+	Detail     string
+}
+
+func (e *BraveAPIError) Error() string {
+	detail := ""
+	if e.Detail != "" {
+		detail = ": " + strings.TrimRight(e.Detail, ".")
+	}
+	switch e.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Sprintf("Brave Search rejected the API key (status %d)%s. Check brave_api_key in Settings.", e.StatusCode, detail)
+	case http.StatusTooManyRequests:
+		return fmt.Sprintf("Brave Search rate limit or quota exceeded%s. Try again later or raise the plan's limits.", detail)
+	default:
+		return fmt.Sprintf("Brave API returned status %d%s", e.StatusCode, detail)
+	}
+}
+
+// braveErrorBody is the JSON body Brave sends with error responses
+type braveErrorBody struct {
+	Error struct {
+		Code   string `json:"code"`
+		Detail string `json:"detail"`
+	} `json:"error"`
+}
+
+// newBraveAPIError reads the error detail from a failed Brave response, falling back to
+// the start of the raw body when it is not JSON
+func newBraveAPIError(resp *http.Response) *BraveAPIError {
+	apiErr := &BraveAPIError{StatusCode: resp.StatusCode}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+
+	var parsed braveErrorBody
+	if err := json.Unmarshal(body, &parsed); err == nil && (parsed.Error.Code != "" || parsed.Error.Detail != "") {
+		apiErr.Code = parsed.Error.Code
+		apiErr.Detail = parsed.Error.Detail
+		return apiErr
+	}
+	apiErr.Detail = truncateString(strings.TrimSpace(string(body)), 200)
+	return apiErr
+}
+
+// validateSearchQuery rejects empty queries and ones longer than maxSearchQueryLength
+func validateSearchQuery(query string) error {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return fmt.Errorf("%w: the query is empty", errInvalidSearchQuery)
+	}
+	if n := len([]rune(query)); n > maxSearchQueryLength {
+		return fmt.Errorf("%w: the query is %d characters, the limit is %d", errInvalidSearchQuery, n, maxSearchQueryLength)
+	}
+	return nil
+}
+
+// searchErrorStatus maps a failed search to an HTTP status
+func searchErrorStatus(err error) int {
+	var apiErr *BraveAPIError
+	switch {
+	case errors.Is(err, errInvalidSearchQuery):
+		return http.StatusBadRequest
+	case errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusTooManyRequests:
+		return http.StatusTooManyRequests
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+const (
+	// defaultSearchCacheTTLMinutes applies when search_cache_ttl_minutes is unset
+	defaultSearchCacheTTLMinutes = 10
+	// braveCacheMaxEntries caps the cached queries
+	braveCacheMaxEntries = 256
+)
+
+type braveCacheEntry struct {
+	results  []SearchResult
+	cachedAt time.Time
+}
+
+var (
+	braveCache   = make(map[string]braveCacheEntry)
+	braveCacheMu sync.Mutex
+)
+
+// SearXNGSearcher searches a SearXNG instance through its JSON API.
+// The instance must have the json format enabled in its settings.
+type SearXNGSearcher struct {
+	BaseURL string
+}
+
+// SearXNGResponse represents the JSON response from a SearXNG instance
+type SearXNGResponse struct {
+	Results []struct {
+		Title   string `json:"title"`
+		Content string `json:"content"`
+		Url     string `json:"url"`
+	} `json:"results"`
+}
+
+var searchClient = &http.Client{Timeout: 10 * time.Second}
+
+// GetSearcher returns the backend selected by the search_provider setting (brave by default),
+// fetching the top result pages when search_fetch_content is enabled
+func GetSearcher(db *sql.DB) (Searcher, error) {
+	searcher, err := getSearchBackend(db)
+	if err != nil {
+		return nil, err
+	}
+	if GetBoolSetting(db, "search_fetch_content", false) {
+		return &contentFetchingSearcher{Searcher: searcher, pages: searchFetchMaxPages}, nil
+	}
+	return searcher, nil
+}
+
+func getSearchBackend(db *sql.DB) (Searcher, error) {
+	switch provider := GetSetting(db, "search_provider", "brave"); provider {
+	case "", "brave":
+		apiKey := GetSetting(db, "brave_api_key", "")
+		if apiKey == "" {
+			return nil, fmt.Errorf("Brave API key is not configured")
+		}
+		// Decrypt returns an error for legacy plaintext keys, which are used as-is
+		if decrypted, err := Decrypt(apiKey); err != nil {
+			log.Println("Error decrypting Brave API key:", err)
+		} else {
+			apiKey = decrypted
+		}
+		return &BraveSearcher{APIKey: apiKey, CacheTTL: searchCacheTTL(db)}, nil
+	case "searxng":
+		baseURL := strings.TrimRight(GetSetting(db, "searxng_url", ""), "/")
+		if baseURL == "" {
+			return nil, fmt.Errorf("SearXNG URL is not configured")
+		}
+		return &SearXNGSearcher{BaseURL: baseURL}, nil
+	default:
+		return nil, fmt.Errorf("unknown search provider %q", provider)
+	}
+}
+
 // MaybeSearch checks if the query triggers a search and returns an enriched prompt
-func MaybeSearch(query string, apiKey string) (string, error) {
+func MaybeSearch(query string, searcher Searcher) (string, error) {
 	// Check for /search prefix
 	if !strings.HasPrefix(strings.TrimSpace(query), "/search ") {
 		return query, nil
 	}
 
-	if apiKey == "" {
-		return "", fmt.Errorf("Brave API key is not configured")
+	if searcher == nil {
+		return "", fmt.Errorf("web search is not configured")
 	}
 
 	// Extract search term
@@ -37,7 +210,7 @@ func MaybeSearch(query string, apiKey string) (string, error) {
 	}
 
 	// Perform search
-	results, err := performBraveSearch(searchTerm, apiKey)
+	results, err := searcher.Search(searchTerm)
 	if err != nil {
 		return "", fmt.Errorf("search failed: %w", err)
 	}
@@ -46,7 +219,11 @@ func MaybeSearch(query string, apiKey string) (string, error) {
 		return "", fmt.Errorf("no search results found for '%s'", searchTerm)
 	}
 
-	// Build enriched prompt
+	return buildSearchContext(results, searchTerm), nil
+}
+
+// buildSearchContext prepends the top search results to the user's query
+func buildSearchContext(results []SearchResult, query string) string {
 	var initialContext strings.Builder
 	initialContext.WriteString("Context from search results:\n")
 	for i, res := range results {
@@ -55,19 +232,97 @@ func MaybeSearch(query string, apiKey string) (string, error) {
 			break
 		}
 		initialContext.WriteString(fmt.Sprintf("- %s: %s (%s)\n", res.Title, res.Description, res.Url))
+		if res.Content != "" {
+			initialContext.WriteString("  Page content:\n  " + strings.ReplaceAll(res.Content, "\n", "\n  ") + "\n")
+		}
 	}
-	initialContext.WriteString("\nUser Query: " + searchTerm)
+	initialContext.WriteString("\nUser Query: " + query)
 
-	return initialContext.String(), nil
+	return initialContext.String()
 }
 
-func performBraveSearch(query string, apiKey string) ([]struct {
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	Url         string `json:"url"`
-}, error) {
+// searchCacheTTL returns the search_cache_ttl_minutes setting; 0 disables caching
+func searchCacheTTL(db *sql.DB) time.Duration {
+	minutes, err := strconv.Atoi(GetSetting(db, "search_cache_ttl_minutes", strconv.Itoa(defaultSearchCacheTTLMinutes)))
+	if err != nil || minutes < 0 {
+		minutes = defaultSearchCacheTTLMinutes
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// normalizeSearchQuery folds case and whitespace so equivalent queries share a cache entry
+func normalizeSearchQuery(query string) string {
+	return strings.ToLower(strings.Join(strings.Fields(query), " "))
+}
+
+// cachedBraveResults returns a copy of the cached results for a query younger than ttl,
+// since callers such as contentFetchingSearcher fill in the results they are given
+func cachedBraveResults(key string, ttl time.Duration) ([]SearchResult, bool) {
+	braveCacheMu.Lock()
+	defer braveCacheMu.Unlock()
+
+	entry, ok := braveCache[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Since(entry.cachedAt) > ttl {
+		delete(braveCache, key)
+		return nil, false
+	}
+	return append([]SearchResult(nil), entry.results...), true
+}
+
+// cacheBraveResults stores a copy of a query's results. When the cache is full, expired
+// entries are dropped first and then the oldest one.
+func cacheBraveResults(key string, results []SearchResult, ttl time.Duration) {
+	braveCacheMu.Lock()
+	defer braveCacheMu.Unlock()
+
+	if _, exists := braveCache[key]; !exists && len(braveCache) >= braveCacheMaxEntries {
+		oldestKey, oldest := "", time.Time{}
+		for k, e := range braveCache {
+			if time.Since(e.cachedAt) > ttl {
+				delete(braveCache, k)
+				continue
+			}
+			if oldestKey == "" || e.cachedAt.Before(oldest) {
+				oldestKey, oldest = k, e.cachedAt
+			}
+		}
+		if len(braveCache) >= braveCacheMaxEntries {
+			delete(braveCache, oldestKey)
+		}
+	}
+	braveCache[key] = braveCacheEntry{results: append([]SearchResult(nil), results...), cachedAt: time.Now()}
+}
+
+// Search queries the Brave Search API, serving repeated queries from the cache
+func (s *BraveSearcher) Search(query string) ([]SearchResult, error) {
+	if err := validateSearchQuery(query); err != nil {
+		return nil, err
+	}
+
+	key := normalizeSearchQuery(query)
+	if s.CacheTTL > 0 {
+		if results, ok := cachedBraveResults(key, s.CacheTTL); ok {
+			return results, nil
+		}
+	}
+
+	results, err := s.search(query)
+	if err != nil {
+		return nil, err
+	}
+	if s.CacheTTL > 0 {
+		cacheBraveResults(key, results, s.CacheTTL)
+	}
+	return results, nil
+}
+
+// search calls the Brave Search API without the cache
+func (s *BraveSearcher) search(query string) ([]SearchResult, error) {
 	endpoint := "https://api.search.brave.com/res/v1/web/search"
-	
+
 	req, err := http.NewRequest("GET", endpoint, nil)
 	if err != nil {
 		return nil, err
@@ -78,18 +333,17 @@ func performBraveSearch(query string, apiKey string) ([]struct {
 	q.Add("count", "3")
 	req.URL.RawQuery = q.Encode()
 
-	req.Header.Add("X-Subscription-Token", apiKey)
+	req.Header.Add("X-Subscription-Token", s.APIKey)
 	req.Header.Add("Accept", "application/json")
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
+	resp, err := searchClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("Brave API returned status %d", resp.StatusCode)
+		return nil, newBraveAPIError(resp)
 	}
 
 	var braveResp BraveSearchResponse
@@ -99,3 +353,36 @@ func performBraveSearch(query string, apiKey string) ([]struct {
 
 	return braveResp.Web.Results, nil
 }
+
+// Search queries the SearXNG instance's /search endpoint
+func (s *SearXNGSearcher) Search(query string) ([]SearchResult, error) {
+	req, err := http.NewRequest("GET", s.BaseURL+"/search?"+url.Values{
+		"q":      {query},
+		"format": {"json"},
+	}.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Accept", "application/json")
+
+	resp, err := searchClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("SearXNG returned status %d", resp.StatusCode)
+	}
+
+	var searxResp SearXNGResponse
+	if err := json.NewDecoder(resp.Body).Decode(&searxResp); err != nil {
+		return nil, err
+	}
+
+	results := make([]SearchResult, 0, len(searxResp.Results))
+	for _, r := range searxResp.Results {
+		results = append(results, SearchResult{Title: r.Title, Description: r.Content, Url: r.Url})
+	}
+	return results, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+// stubSearchClient answers every search request with body and counts the calls
+func stubSearchClient(t *testing.T, body string) *atomic.Int32 {
+	t.Helper()
+	var calls atomic.Int32
+	old := searchClient
+	searchClient = &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		calls.Add(1)
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Request:    req,
+		}, nil
+	})}
+	t.Cleanup(func() { searchClient = old })
+	return &calls
+}
+
+func resetBraveCache(t *testing.T) {
+	t.Helper()
+	braveCacheMu.Lock()
+	braveCache = make(map[string]braveCacheEntry)
+	braveCacheMu.Unlock()
+	t.Cleanup(func() {
+		braveCacheMu.Lock()
+		braveCache = make(map[string]braveCacheEntry)
+		braveCacheMu.Unlock()
+	})
+}
+
+const braveTestResponse = `{"web":{"results":[{"title":"Go","description":"The Go language","url":"https://go.dev/"}]}}`
+
+func TestBraveSearchServesRepeatsFromCache(t *testing.T) {
+	resetBraveCache(t)
+	calls := stubSearchClient(t, braveTestResponse)
+	s := &BraveSearcher{APIKey: "key", CacheTTL: time.Minute}
+
+	first, err := s.Search("golang")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := s.Search("  GoLang ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("expected 1 request to Brave, got %d", n)
+	}
+	if len(second) != 1 || second[0].Url != first[0].Url {
+		t.Fatalf("cached results differ: %+v", second)
+	}
+}
+
+func TestBraveSearchCacheExpires(t *testing.T) {
+	resetBraveCache(t)
+	calls := stubSearchClient(t, braveTestResponse)
+	s := &BraveSearcher{APIKey: "key", CacheTTL: time.Minute}
+
+	if _, err := s.Search("golang"); err != nil {
+		t.Fatal(err)
+	}
+	braveCacheMu.Lock()
+	entry := braveCache["golang"]
+	entry.cachedAt = time.Now().Add(-2 * time.Minute)
+	braveCache["golang"] = entry
+	braveCacheMu.Unlock()
+
+	if _, err := s.Search("golang"); err != nil {
+		t.Fatal(err)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Fatalf("expected an expired entry to be fetched again, got %d requests", n)
+	}
+}
+
+func TestBraveCacheReturnsCopies(t *testing.T) {
+	resetBraveCache(t)
+	results := []SearchResult{{Title: "Go", Url: "https://go.dev/"}}
+	cacheBraveResults("golang", results, time.Minute)
+	results[0].Content = "changed after caching"
+
+	got, ok := cachedBraveResults("golang", time.Minute)
+	if !ok {
+		t.Fatal("expected a cache hit")
+	}
+	got[0].Content = "filled in by the caller"
+
+	again, _ := cachedBraveResults("golang", time.Minute)
+	if again[0].Content != "" {
+		t.Fatalf("cached entry was modified through a returned slice: %q", again[0].Content)
+	}
+}
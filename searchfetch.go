@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	searchFetchMaxPages  = 2
+	searchFetchTimeout   = 8 * time.Second
+	searchFetchMaxBytes  = 512 * 1024
+	searchFetchMaxChars  = 3000
+	robotsCacheTTL       = 1 * time.Hour
+	robotsCacheMaxHosts  = 512
+	searchFetchUserAgent = "ollamagoweb/2 (+https://github.com/contactwajeeh/ollamagoweb-v2)"
+)
+
+var (
+	htmlDropBlocks = regexp.MustCompile(`(?is)<(script|style|noscript|head|svg|nav|footer|template)\b.*?</(script|style|noscript|head|svg|nav|footer|template)>`)
+	htmlComments   = regexp.MustCompile(`(?s)<!--.*?-->`)
+	htmlBreaks     = regexp.MustCompile(`(?i)<(br|/p|/div|/li|/h[1-6]|/tr|/section|/article)\b[^>]*>`)
+	htmlTags       = regexp.MustCompile(`(?s)<[^>]*>`)
+	spaceRuns      = regexp.MustCompile(`[ \t\r\f\v]+`)
+	blankLineRuns  = regexp.MustCompile(`\n\s*\n+`)
+)
+
+var fetchClient = &http.Client{Timeout: searchFetchTimeout, Transport: guardedTransport}
+
+// contentFetchingSearcher wraps a Searcher and attaches the readable text of the top
+// result pages, used when the search_fetch_content setting is enabled
+type contentFetchingSearcher struct {
+	Searcher
+	pages int
+}
+
+// Search runs the wrapped search and fetches the top pages concurrently. Pages that
+// cannot be fetched keep only their title and description.
+func (s *contentFetchingSearcher) Search(query string) ([]SearchResult, error) {
+	results, err := s.Searcher.Search(query)
+	if err != nil {
+		return nil, err
+	}
+
+	var wg sync.WaitGroup
+	for i := range results {
+		if i >= s.pages {
+			break
+		}
+		wg.Add(1)
+		go func(r *SearchResult) {
+			defer wg.Done()
+			text, err := fetchPageText(r.Url)
+			if err != nil {
+				log.Printf("Skipping page content for %s: %v", r.Url, err)
+				return
+			}
+			r.Content = text
+		}(&results[i])
+	}
+	wg.Wait()
+
+	return results, nil
+}
+
+// fetchPageText downloads an HTML or plain text page and returns its readable text,
+// truncated to searchFetchMaxChars
+func fetchPageText(pageURL string) (string, error) {
+	u, err := url.Parse(pageURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return "", fmt.Errorf("unsupported URL")
+	}
+
+	if !robotsAllowed(u) {
+		return "", fmt.Errorf("disallowed by robots.txt")
+	}
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", searchFetchUserAgent)
+	req.Header.Set("Accept", "text/html, text/plain;q=0.9")
+
+	resp, err := fetchClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" && mediaType != "text/plain" {
+		return "", fmt.Errorf("unsupported content type %q", mediaType)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, searchFetchMaxBytes))
+	if err != nil {
+		return "", err
+	}
+
+	text := string(body)
+	if mediaType != "text/plain" {
+		text = htmlToText(text)
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return "", fmt.Errorf("no readable text")
+	}
+
+	return truncate(text, searchFetchMaxChars), nil
+}
+
+// htmlToText strips markup from an HTML document, keeping paragraph breaks
+func htmlToText(doc string) string {
+	doc = htmlComments.ReplaceAllString(doc, "")
+	doc = htmlDropBlocks.ReplaceAllString(doc, "")
+	doc = htmlBreaks.ReplaceAllString(doc, "\n")
+	doc = htmlTags.ReplaceAllString(doc, "")
+	doc = html.UnescapeString(doc)
+	doc = spaceRuns.ReplaceAllString(doc, " ")
+	doc = blankLineRuns.ReplaceAllString(doc, "\n\n")
+	return doc
+}
+
+type robotsRules struct {
+	disallow  []string
+	fetchedAt time.Time
+}
+
+var (
+	robotsCache   = make(map[string]*robotsRules)
+	robotsCacheMu sync.Mutex
+)
+
+// robotsAllowed checks the host's robots.txt rules for all user agents. A robots.txt
+// that cannot be fetched allows everything.
+func robotsAllowed(u *url.URL) bool {
+	host := u.Scheme + "://" + u.Host
+
+	robotsCacheMu.Lock()
+	rules, ok := robotsCache[host]
+	robotsCacheMu.Unlock()
+
+	if !ok || time.Since(rules.fetchedAt) > robotsCacheTTL {
+		rules = fetchRobots(host)
+		cacheRobots(host, rules)
+	}
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	for _, prefix := range rules.disallow {
+		if strings.HasPrefix(path, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// cacheRobots stores a host's rules. When robotsCacheMaxHosts hosts are cached, expired
+// rules are dropped first and then the oldest ones.
+func cacheRobots(host string, rules *robotsRules) {
+	robotsCacheMu.Lock()
+	defer robotsCacheMu.Unlock()
+
+	if _, exists := robotsCache[host]; !exists && len(robotsCache) >= robotsCacheMaxHosts {
+		oldestHost, oldest := "", time.Time{}
+		for h, r := range robotsCache {
+			if time.Since(r.fetchedAt) > robotsCacheTTL {
+				delete(robotsCache, h)
+				continue
+			}
+			if oldestHost == "" || r.fetchedAt.Before(oldest) {
+				oldestHost, oldest = h, r.fetchedAt
+			}
+		}
+		if len(robotsCache) >= robotsCacheMaxHosts {
+			delete(robotsCache, oldestHost)
+		}
+	}
+	robotsCache[host] = rules
+}
+
+// fetchRobots reads the Disallow rules of the "User-agent: *" group
+func fetchRobots(host string) *robotsRules {
+	rules := &robotsRules{fetchedAt: time.Now()}
+
+	req, err := http.NewRequest("GET", host+"/robots.txt", nil)
+	if err != nil {
+		return rules
+	}
+	req.Header.Set("User-Agent", searchFetchUserAgent)
+
+	resp, err := fetchClient.Do(req)
+	if err != nil {
+		return rules
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return rules
+	}
+
+	inWildcardGroup, lastWasAgent := false, false
+	scanner := bufio.NewScanner(io.LimitReader(resp.Body, 64*1024))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		field, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		field = strings.ToLower(strings.TrimSpace(field))
+		value = strings.TrimSpace(value)
+
+		// Consecutive User-agent lines share one group of rules
+		if field == "user-agent" {
+			if !lastWasAgent {
+				inWildcardGroup = false
+			}
+			if value == "*" {
+				inWildcardGroup = true
+			}
+			lastWasAgent = true
+			continue
+		}
+		lastWasAgent = false
+
+		if field == "disallow" && inWildcardGroup && value != "" {
+			rules.disallow = append(rules.disallow, value)
+		}
+	}
+	return rules
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func resetRobotsCache(t *testing.T) {
+	t.Helper()
+	robotsCacheMu.Lock()
+	robotsCache = make(map[string]*robotsRules)
+	robotsCacheMu.Unlock()
+	t.Cleanup(func() {
+		robotsCacheMu.Lock()
+		robotsCache = make(map[string]*robotsRules)
+		robotsCacheMu.Unlock()
+	})
+}
+
+func TestCacheRobotsEvictsExpiredThenOldest(t *testing.T) {
+	resetRobotsCache(t)
+	now := time.Now()
+	for i := 0; i < robotsCacheMaxHosts; i++ {
+		cacheRobots(fmt.Sprintf("https://host%d.example", i), &robotsRules{fetchedAt: now.Add(-time.Duration(robotsCacheMaxHosts-i) * time.Second)})
+	}
+	robotsCache["https://host7.example"].fetchedAt = now.Add(-2 * robotsCacheTTL)
+
+	cacheRobots("https://new.example", &robotsRules{fetchedAt: now})
+	if len(robotsCache) != robotsCacheMaxHosts {
+		t.Fatalf("cache holds %d hosts, want %d", len(robotsCache), robotsCacheMaxHosts)
+	}
+	if _, ok := robotsCache["https://host7.example"]; ok {
+		t.Fatal("expected the expired host to be evicted")
+	}
+	if _, ok := robotsCache["https://host0.example"]; !ok {
+		t.Fatal("expected the oldest live host to stay while an expired one could go")
+	}
+
+	cacheRobots("https://newer.example", &robotsRules{fetchedAt: now})
+	if _, ok := robotsCache["https://host0.example"]; ok {
+		t.Fatal("expected the oldest host to be evicted once nothing had expired")
+	}
+}
+
+func TestFetchPageTextRefusesInternalAddresses(t *testing.T) {
+	resetRobotsCache(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, "internal page")
+	}))
+	defer srv.Close()
+
+	t.Setenv("BLOCK_PRIVATE_URLS", "true")
+	if _, err := fetchPageText(srv.URL); err == nil {
+		t.Fatal("expected a loopback page to be refused while BLOCK_PRIVATE_URLS is set")
+	}
+
+	t.Setenv("BLOCK_PRIVATE_URLS", "")
+	resetRobotsCache(t)
+	text, err := fetchPageText(srv.URL)
+	if err != nil || text != "internal page" {
+		t.Fatalf("fetchPageText = %q, %v", text, err)
+	}
+}
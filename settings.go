@@ -0,0 +1,258 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// themeOptions are the accepted theme preferences; "system" follows the browser's
+// prefers-color-scheme
+var themeOptions = []string{"light", "dark", "system"}
+
+// defaultTheme applies when neither the user nor the global theme setting is set
+const defaultTheme = "light"
+
+// settingValidator checks a value for one setting and returns the normalized value to
+// store, or an error describing the expected format
+type settingValidator func(value string) (string, error)
+
+// settingValidators holds the rule for each setting key. Keys without a rule accept any
+// string; new settings register their rule here.
+var settingValidators = map[string]settingValidator{
+	"temperature":              floatSetting(0, 2),
+	"max_tokens":               intSetting(1),
+	"theme":                    enumSetting(themeOptions...),
+	"memory_enabled":           boolSetting,
+	"memory_top_k":             intSetting(1),
+	"memory_min_confidence":    intRangeSetting(0, 100),
+	"memory_max_injected":      intSetting(1),
+	"max_system_prompt_length": intSetting(1),
+	"context_token_budget":     intSetting(1),
+	"max_context_messages":     intSetting(1),
+	"summary_provider_id":      optionalSetting(intSetting(1)),
+	"token_budget":             intSetting(0),
+	"token_budget_daily":       intSetting(0),
+	"message_retention_days":   intSetting(0),
+	"block_private_urls":       envOnlySetting("BLOCK_PRIVATE_URLS"),
+	"search_provider":          enumSetting("brave", "searxng"),
+	"searxng_url":              urlSetting,
+	"search_cache_ttl_minutes": intSetting(0),
+	"search_fetch_content":     boolSetting,
+	"auto_search":              enumSetting("off", "heuristic", "model"),
+	"auto_search_max_per_chat": intSetting(0),
+	"force_tool_support":       boolSetting,
+	"mcp_idle_timeout_minutes": intSetting(0),
+	"builtin_tools_enabled":    boolSetting,
+
+	"memory_fallback_extraction": boolSetting,
+
+	"rate_limit_generation_rps":   positiveFloatSetting,
+	"rate_limit_generation_burst": intSetting(1),
+	"rate_limit_search_rps":       positiveFloatSetting,
+	"rate_limit_search_burst":     intSetting(1),
+	"rate_limit_mcp_rps":          positiveFloatSetting,
+	"rate_limit_mcp_burst":        intSetting(1),
+}
+
+// settingPrefixValidators apply to families of keys such as memory_ttl_<category>
+var settingPrefixValidators = map[string]settingValidator{
+	"memory_ttl_": intSetting(0),
+}
+
+// validateSetting returns the normalized value for a setting, or an error naming the
+// expected format
+func validateSetting(key, value string) (string, error) {
+	validate, ok := settingValidators[key]
+	if !ok {
+		for prefix, v := range settingPrefixValidators {
+			if strings.HasPrefix(key, prefix) {
+				validate, ok = v, true
+				break
+			}
+		}
+	}
+	if !ok {
+		return value, nil
+	}
+
+	normalized, err := validate(strings.TrimSpace(value))
+	if err != nil {
+		return "", fmt.Errorf("invalid value for %s: %w", key, err)
+	}
+	return normalized, nil
+}
+
+// floatSetting accepts a number within [min, max]
+func floatSetting(min, max float64) settingValidator {
+	return func(value string) (string, error) {
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil || f < min || f > max {
+			return "", fmt.Errorf("expected a number from %g to %g", min, max)
+		}
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+	}
+}
+
+// intSetting accepts an integer of at least min
+func intSetting(min int) settingValidator {
+	return func(value string) (string, error) {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < min {
+			return "", fmt.Errorf("expected an integer of at least %d", min)
+		}
+		return strconv.Itoa(n), nil
+	}
+}
+
+// optionalSetting accepts an empty value, meaning unset, or one that passes validate
+func optionalSetting(validate settingValidator) settingValidator {
+	return func(value string) (string, error) {
+		if value == "" {
+			return "", nil
+		}
+		return validate(value)
+	}
+}
+
+// intRangeSetting accepts an integer within [min, max]
+func intRangeSetting(min, max int) settingValidator {
+	return func(value string) (string, error) {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < min || n > max {
+			return "", fmt.Errorf("expected an integer from %d to %d", min, max)
+		}
+		return strconv.Itoa(n), nil
+	}
+}
+
+// enumSetting accepts one of the allowed values, ignoring case
+func enumSetting(allowed ...string) settingValidator {
+	return func(value string) (string, error) {
+		for _, a := range allowed {
+			if strings.EqualFold(value, a) {
+				return a, nil
+			}
+		}
+		return "", fmt.Errorf("expected one of %s", strings.Join(allowed, ", "))
+	}
+}
+
+// boolSetting normalizes true/false, yes/no, on/off and 1/0 to "1" or "0"
+func boolSetting(value string) (string, error) {
+	switch strings.ToLower(value) {
+	case "1", "true", "yes", "on":
+		return "1", nil
+	case "0", "false", "no", "off":
+		return "0", nil
+	}
+	return "", fmt.Errorf("expected a boolean (1/0 or true/false)")
+}
+
+// urlSetting accepts an empty value or an absolute http(s) URL, without a trailing slash
+func urlSetting(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("expected an http or https URL")
+	}
+	return strings.TrimRight(value, "/"), nil
+}
+
+// envOnlySetting refuses every value for a switch that only the named environment
+// variable controls, so it cannot be changed through the API
+func envOnlySetting(envVar string) settingValidator {
+	return func(value string) (string, error) {
+		return "", fmt.Errorf("set with the %s environment variable instead", envVar)
+	}
+}
+
+// positiveFloatSetting accepts a number greater than zero
+func positiveFloatSetting(value string) (string, error) {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f <= 0 {
+		return "", fmt.Errorf("expected a number greater than 0")
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64), nil
+}
+
+// userScopedSettings are stored per user when auth is enabled. Reads fall back to the
+// global value when the user has not set one.
+var userScopedSettings = map[string]bool{
+	"theme": true,
+}
+
+// requestUserID returns the user of the request's session, or "" when auth is disabled
+// or the session is unknown
+func requestUserID(r *http.Request) string {
+	if !authEnabled {
+		return ""
+	}
+	cookie, err := r.Cookie("session_id")
+	if err != nil {
+		return ""
+	}
+	var userID string
+	if err := db.QueryRow("SELECT user_id FROM sessions WHERE id = ? AND expires_at > ?", cookie.Value, time.Now()).Scan(&userID); err != nil {
+		return ""
+	}
+	return userID
+}
+
+// getUserSetting returns a user's own value for a user-scoped setting
+func getUserSetting(db *sql.DB, userID, key string) (string, bool) {
+	if userID == "" || !userScopedSettings[key] {
+		return "", false
+	}
+	var value string
+	err := db.QueryRow("SELECT value FROM user_settings WHERE user_id = ? AND key = ?", userID, key).Scan(&value)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Error reading setting %s for user %s: %v", key, userID, err)
+		}
+		return "", false
+	}
+	return value, true
+}
+
+// settingsExecer is satisfied by both *sql.DB and *sql.Tx
+type settingsExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// saveSetting stores a setting, in user_settings for user-scoped keys when userID is set
+// and in the global settings table otherwise
+func saveSetting(exec settingsExecer, userID, key, value string) error {
+	if userID != "" && userScopedSettings[key] {
+		_, err := exec.Exec(`
+			INSERT INTO user_settings (user_id, key, value) VALUES (?, ?, ?)
+			ON CONFLICT(user_id, key) DO UPDATE SET value = excluded.value
+		`, userID, key, value)
+		return err
+	}
+	_, err := exec.Exec(`
+		INSERT INTO settings (key, value) VALUES (?, ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value
+	`, key, value)
+	return err
+}
+
+// ThemePreference returns the theme to render a page with, preferring the request
+// user's own setting over the global one
+func ThemePreference(r *http.Request) string {
+	theme, ok := getUserSetting(db, requestUserID(r), "theme")
+	if !ok {
+		theme = GetSetting(db, "theme", defaultTheme)
+	}
+	if normalized, err := validateSetting("theme", theme); err == nil {
+		return normalized
+	}
+	return defaultTheme
+}
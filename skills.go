@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -11,6 +12,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/contactwajeeh/ollamagoweb-v2/mcp"
 	"github.com/ollama/ollama/api"
 )
 
@@ -190,11 +192,18 @@ func RefreshSkillsCache(ctx context.Context) ([]OpenSkill, error) {
 	return skills, nil
 }
 
-func ConvertSkillsToTools(skills []OpenSkill) []Tool {
+// ConvertSkillsToTools offers skills as tools. Names that collide with each other or
+// with a reserved tool, such as an MCP tool offered alongside, get a numeric suffix.
+func ConvertSkillsToTools(skills []OpenSkill, reserved []Tool) []Tool {
+	used := make(map[string]bool, len(reserved))
+	for _, t := range reserved {
+		used[t.Name] = true
+	}
+
 	tools := make([]Tool, len(skills))
 	for i, s := range skills {
 		tools[i] = Tool{
-			Name:        fmt.Sprintf("skill_%s", sanitizeSkillName(s.Name)),
+			Name:        mcp.UniqueToolName(fmt.Sprintf("skill_%s", sanitizeSkillName(s.Name)), used),
 			Description: s.Description,
 			InputSchema: map[string]interface{}{
 				"type": "object",
@@ -207,6 +216,7 @@ func ConvertSkillsToTools(skills []OpenSkill) []Tool {
 				"required": []string{"query"},
 			},
 			ServerID: -1,
+			ToolName: s.Name,
 		}
 	}
 	return tools
@@ -230,12 +240,20 @@ func ExecuteSkill(ctx context.Context, skillName string, query string) (string,
 	}
 
 	var targetSkill *OpenSkill
-	for _, s := range skills {
-		if sanitizeSkillName(s.Name) == skillName || s.Name == skillName {
-			targetSkill = &s
+	for i := range skills {
+		if skills[i].Name == skillName {
+			targetSkill = &skills[i]
 			break
 		}
 	}
+	if targetSkill == nil {
+		for i := range skills {
+			if sanitizeSkillName(skills[i].Name) == skillName {
+				targetSkill = &skills[i]
+				break
+			}
+		}
+	}
 
 	if targetSkill == nil {
 		return "", fmt.Errorf("skill not found: %s", skillName)
@@ -268,10 +286,10 @@ func RunAgenticLoopWithSkills(
 	systemPrompt string,
 	callback ToolExecutionCallback,
 ) (string, error) {
-	skillTools := ConvertSkillsToTools(skills)
-	allTools := append(mcpTools, skillTools...)
+	skillTools := ConvertSkillsToTools(skills, mcpTools)
+	allTools := append(append([]Tool(nil), mcpTools...), skillTools...)
 
-	if len(allTools) == 0 {
+	if len(allTools) == 0 || !toolsEnabledFor(provider, len(allTools)) {
 		return provider.GenerateNonStreaming(ctx, history, prompt, systemPrompt)
 	}
 
@@ -292,6 +310,13 @@ func RunAgenticLoopWithSkills(
 		log.Printf("Agentic loop iteration %d with %d tools", iteration+1, len(allTools))
 
 		response, toolCalls, err := provider.GenerateWithTools(ctx, messages, systemPrompt, allTools)
+		if errors.Is(err, ErrToolsUnsupported) {
+			log.Printf("Provider rejected tools, answering without them: %v", err)
+			if iteration == 0 {
+				return provider.GenerateNonStreaming(ctx, history, prompt, systemPrompt)
+			}
+			break
+		}
 		if err != nil {
 			return "", fmt.Errorf("generation failed: %w", err)
 		}
@@ -308,52 +333,14 @@ func RunAgenticLoopWithSkills(
 			ToolCalls: toolCalls,
 		})
 
-		for _, tc := range toolCalls {
-			if callback != nil {
-				callback(tc.Name, "calling")
-			}
-
-			var result string
-			var execErr error
-
-			if strings.HasPrefix(tc.Name, "skill_") {
-				skillName := strings.TrimPrefix(tc.Name, "skill_")
+		messages = append(messages, runToolCalls(ctx, allTools, toolCalls, callback, func(ctx context.Context, tc *ToolCall) (string, error) {
+			resolveToolCall(allTools, tc)
+			if tc.ServerID == -1 {
 				query, _ := tc.Arguments["query"].(string)
-				result, execErr = ExecuteSkill(ctx, skillName, query)
-				tc.ServerID = -1
-			} else {
-				for _, t := range allTools {
-					if t.Name == tc.Name {
-						tc.ServerID = t.ServerID
-						break
-					}
-				}
-				result, execErr = ExecuteToolCall(ctx, tc)
-			}
-
-			if callback != nil {
-				if execErr != nil {
-					callback(tc.Name, "error")
-				} else {
-					callback(tc.Name, "completed")
-				}
+				return ExecuteSkill(ctx, tc.ToolName, query)
 			}
-
-			if execErr != nil {
-				result = fmt.Sprintf("Error: %v", execErr)
-			}
-
-			resultJSON, _ := json.Marshal(map[string]interface{}{
-				"tool_call_id": tc.ID,
-				"name":         tc.Name,
-				"result":       result,
-			})
-
-			messages = append(messages, AgenticMessage{
-				Role:    "tool",
-				Content: string(resultJSON),
-			})
-		}
+			return ExecuteToolCall(ctx, *tc)
+		})...)
 	}
 
 	apiMessages := make([]api.Message, len(messages))
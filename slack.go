@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	slackEventsPath   = "/slack/events"
+	slackCommandsPath = "/slack/commands"
+
+	// slackMessageLimit keeps each post under Slack's 4000 character text limit
+	slackMessageLimit = 3900
+
+	// slackMaxRequestAge rejects signed requests older than this, against replays
+	slackMaxRequestAge = 5 * time.Minute
+
+	maxSlackRequestBytes = 1 << 20
+)
+
+var slackClient = &http.Client{Timeout: 30 * time.Second}
+
+// slackMentionPattern matches user mentions such as <@U012AB3CD>, which lead the text of
+// an app_mention event
+var slackMentionPattern = regexp.MustCompile(`^(\s*<@[A-Z0-9]+>)+\s*`)
+
+// SlackEnabled reports whether SLACK_BOT_TOKEN and SLACK_SIGNING_SECRET are both set
+func SlackEnabled() bool {
+	return os.Getenv("SLACK_BOT_TOKEN") != "" && os.Getenv("SLACK_SIGNING_SECRET") != ""
+}
+
+// slackSessionID gives each Slack user their own session, so memories follow the user
+// across DMs, channels and slash commands
+func slackSessionID(teamID, userID string) string {
+	return fmt.Sprintf("slack_%s_%s", teamID, userID)
+}
+
+// verifySlackRequest checks the X-Slack-Signature of a request against the signing
+// secret and returns its body
+func verifySlackRequest(r *http.Request, secret string) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxSlackRequestBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	timestamp := r.Header.Get("X-Slack-Request-Timestamp")
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, errors.New("missing request timestamp")
+	}
+	if age := time.Since(time.Unix(ts, 0)); age > slackMaxRequestAge || age < -slackMaxRequestAge {
+		return nil, errors.New("request timestamp too old")
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":"))
+	mac.Write(body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(r.Header.Get("X-Slack-Signature"))) {
+		return nil, errors.New("invalid signature")
+	}
+	return body, nil
+}
+
+// slackEvent is the part of an Events API payload the bot uses
+type slackEvent struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	TeamID    string `json:"team_id"`
+	Event     struct {
+		Type        string `json:"type"`
+		Subtype     string `json:"subtype"`
+		User        string `json:"user"`
+		BotID       string `json:"bot_id"`
+		Text        string `json:"text"`
+		Channel     string `json:"channel"`
+		ChannelType string `json:"channel_type"`
+		TS          string `json:"ts"`
+		ThreadTS    string `json:"thread_ts"`
+	} `json:"event"`
+}
+
+// slackEventsHandler receives the Events API: app mentions in channels and direct
+// messages are answered through generateResponseForSession
+func slackEventsHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := verifySlackRequest(r, os.Getenv("SLACK_SIGNING_SECRET"))
+	if err != nil {
+		log.Printf("Rejected Slack event from %s: %v", r.RemoteAddr, err)
+		WriteError(w, http.StatusUnauthorized, "Invalid Slack signature")
+		return
+	}
+
+	var payload slackEvent
+	if err := json.Unmarshal(body, &payload); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid event payload")
+		return
+	}
+
+	switch payload.Type {
+	case "url_verification":
+		WriteJSON(w, map[string]string{"challenge": payload.Challenge})
+		return
+	case "event_callback":
+	default:
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// Slack retries events not acknowledged within 3 seconds; the first delivery is
+	// already being answered
+	if r.Header.Get("X-Slack-Retry-Num") != "" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	ev := payload.Event
+	isDM := ev.Type == "message" && ev.ChannelType == "im"
+	if (ev.Type != "app_mention" && !isDM) || ev.Subtype != "" || ev.BotID != "" || ev.User == "" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// Channel replies go in a thread; DMs are answered inline
+	threadTS := ""
+	if !isDM {
+		threadTS = ev.ThreadTS
+		if threadTS == "" {
+			threadTS = ev.TS
+		}
+	}
+
+	prompt := strings.TrimSpace(slackMentionPattern.ReplaceAllString(ev.Text, ""))
+	sessionID := slackSessionID(payload.TeamID, ev.User)
+	log.Printf("Slack %s from user %s in channel %s: %s", ev.Type, ev.User, ev.Channel, ev.Text)
+
+	w.WriteHeader(http.StatusOK)
+	go func() {
+		response := "👋 Ask me something after the mention."
+		if prompt != "" {
+			response = generateResponseForSession(sessionID, 0, prompt)
+		}
+		for _, chunk := range splitMessage(response, slackMessageLimit) {
+			if err := postSlackMessage(ev.Channel, threadTS, chunk); err != nil {
+				log.Printf("Error posting Slack message: %v", err)
+				return
+			}
+		}
+	}()
+}
+
+// slackCommandsHandler answers slash commands. The reply is acknowledged at once, since
+// Slack allows 3 seconds, and the answer is posted to the command's response_url only
+// for the user who ran it.
+func slackCommandsHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := verifySlackRequest(r, os.Getenv("SLACK_SIGNING_SECRET"))
+	if err != nil {
+		log.Printf("Rejected Slack command from %s: %v", r.RemoteAddr, err)
+		WriteError(w, http.StatusUnauthorized, "Invalid Slack signature")
+		return
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid command payload")
+		return
+	}
+
+	prompt := strings.TrimSpace(form.Get("text"))
+	if prompt == "" {
+		WriteJSON(w, map[string]string{
+			"response_type": "ephemeral",
+			"text":          fmt.Sprintf("Usage: %s <question>", form.Get("command")),
+		})
+		return
+	}
+
+	responseURL := form.Get("response_url")
+	sessionID := slackSessionID(form.Get("team_id"), form.Get("user_id"))
+	log.Printf("Slack command %s from user %s: %s", form.Get("command"), form.Get("user_id"), prompt)
+
+	WriteJSON(w, map[string]string{"response_type": "ephemeral", "text": "⏳ Working on it..."})
+	go func() {
+		response := generateResponseForSession(sessionID, 0, prompt)
+		for _, chunk := range splitMessage(response, slackMessageLimit) {
+			if err := postSlackJSON(responseURL, "", map[string]string{"response_type": "ephemeral", "text": chunk}); err != nil {
+				log.Printf("Error posting Slack command response: %v", err)
+				return
+			}
+		}
+	}()
+}
+
+// postSlackMessage posts text to a channel with chat.postMessage, in a thread when
+// threadTS is set
+func postSlackMessage(channel, threadTS, text string) error {
+	msg := map[string]string{"channel": channel, "text": text}
+	if threadTS != "" {
+		msg["thread_ts"] = threadTS
+	}
+	return postSlackJSON("https://slack.com/api/chat.postMessage", os.Getenv("SLACK_BOT_TOKEN"), msg)
+}
+
+// postSlackJSON sends a JSON body to a Slack endpoint, authenticated with token when set
+func postSlackJSON(endpoint, token string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := slackClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("slack returned %s: %s", resp.Status, truncateString(string(respBody), 200))
+	}
+
+	// Web API methods report failures with "ok": false and HTTP 200
+	var result struct {
+		OK    *bool  `json:"ok"`
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(respBody, &result) == nil && result.OK != nil && !*result.OK {
+		return fmt.Errorf("slack error: %s", result.Error)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+// Delegated event handlers, so markup needs no inline on* attributes and the CSP can
+// drop 'unsafe-inline' for scripts. An element names a global function in data-click,
+// data-change or data-input, with its arguments as a JSON array in data-args. The
+// placeholders "$el", "$event", "$value" and "$checked" stand for the element, the
+// event, and the element's value and checked state.
+(function () {
+  const events = ['click', 'change', 'input'];
+
+  function resolveArg(arg, el, event) {
+    switch (arg) {
+      case '$el': return el;
+      case '$event': return event;
+      case '$value': return el.value;
+      case '$checked': return el.checked;
+    }
+    return arg;
+  }
+
+  events.forEach(function (type) {
+    const attr = 'data-' + type;
+    document.addEventListener(type, function (event) {
+      const el = event.target.closest && event.target.closest('[' + attr + ']');
+      if (!el) return;
+
+      // An empty action absorbs the event so an enclosing action does not run
+      const name = el.getAttribute(attr);
+      if (!name) return;
+
+      const fn = window[name];
+      if (typeof fn !== 'function') {
+        console.warn('Unknown action:', name);
+        return;
+      }
+      const args = el.dataset.args ? JSON.parse(el.dataset.args) : [];
+      fn.apply(el, args.map(function (arg) { return resolveArg(arg, el, event); }));
+    });
+  });
+
+  // actionArgs encodes arguments for a data-args attribute in generated markup
+  window.actionArgs = function (...args) {
+    return JSON.stringify(args)
+      .replace(/&/g, '&amp;')
+      .replace(/"/g, '&quot;')
+      .replace(/'/g, '&#39;')
+      .replace(/</g, '&lt;')
+      .replace(/>/g, '&gt;');
+  };
+})();
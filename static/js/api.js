@@ -151,6 +151,12 @@ const ProviderAPI = {
     return res.json();
   },
 
+  async get(id) {
+    const res = await fetch(Endpoints.PROVIDER_BY_ID(id));
+    if (!res.ok) throw new Error('Failed to fetch provider');
+    return res.json();
+  },
+
   async create(data) {
     const res = await fetch(Endpoints.PROVIDERS, {
       method: 'POST',
@@ -179,7 +185,10 @@ const ProviderAPI = {
 
   async activate(id) {
     const res = await fetch(Endpoints.PROVIDER_ACTIVATE(id), { method: 'POST' });
-    if (!res.ok) throw new Error('Failed to activate provider');
+    if (!res.ok) {
+      const data = await res.json().catch(() => ({}));
+      throw new Error(data.message || 'Failed to activate provider');
+    }
     return res.json();
   },
 
@@ -207,28 +207,27 @@ window.notify = notify;
 notify.error = (msg) => notify(msg, 'error');
 notify.success = (msg) => notify(msg, 'success');
 
-// Theme management
+// Theme management. theme.js has already applied the saved preference.
 function initTheme() {
-  const savedTheme = localStorage.getItem('theme') || 'light';
-  document.documentElement.setAttribute('data-theme', savedTheme);
-  updateThemeIcon(savedTheme);
+  updateThemeIcon(document.documentElement.dataset.themePreference || 'light');
 }
 
 function toggleTheme() {
-  const current = document.documentElement.getAttribute('data-theme') || 'light';
-  const next = current === 'dark' ? 'light' : 'dark';
-  document.documentElement.setAttribute('data-theme', next);
-  localStorage.setItem('theme', next);
+  const current = document.documentElement.dataset.themePreference || 'light';
+  const next = applyThemePreference(nextThemePreference(current));
   updateThemeIcon(next);
-  safeFetch('/api/settings/theme', {
+  safeFetch('/api/v1/settings/theme', {
     method: 'PUT',
     body: JSON.stringify({ value: next })
   }).catch(() => {});
 }
 
-function updateThemeIcon(theme) {
+function updateThemeIcon(preference) {
   const btn = document.getElementById('theme-toggle');
-  if (btn) btn.textContent = theme === 'dark' ? '☀️' : '🌙';
+  if (!btn) return;
+  const icons = { light: '🌙', dark: '🖥️', system: '☀️' };
+  btn.textContent = icons[preference] || '🌙';
+  btn.title = 'Theme: ' + preference;
 }
 
 // Model management
@@ -241,7 +240,7 @@ async function loadModels() {
   if (!select) return;
 
   try {
-    const res = await fetch('/api/active-provider');
+    const res = await fetch('/api/v1/active-provider');
     if (!res.ok) {
       select.innerHTML = '<option>No provider</option>';
       if (providerNameEl) providerNameEl.textContent = '';
@@ -260,8 +259,12 @@ async function loadModels() {
       providerNameEl.style.display = 'none';
     }
 
-    if (availableModels.length === 0) {
+    if (data.needs_model || availableModels.length === 0) {
       select.innerHTML = '<option>No models</option>';
+      if (data.message) {
+        select.title = data.message;
+        notify(data.message, 'info', 6000);
+      }
       return;
     }
 
@@ -280,11 +283,24 @@ async function loadModels() {
   }
 }
 
+// responseErrorMessage returns the server's error message for a failed response,
+// falling back to the status code
+async function responseErrorMessage(response) {
+  const text = await response.text().catch(() => '');
+  try {
+    const data = JSON.parse(text);
+    if (data.message) return data.message;
+  } catch (e) {
+    if (text.trim()) return text.trim();
+  }
+  return `Server error: ${response.status}`;
+}
+
 async function switchModel(model) {
   if (model === currentModel) return;
 
   try {
-    const res = await fetch('/api/switch-model', {
+    const res = await fetch('/api/v1/switch-model', {
       method: 'POST',
       headers: { 'Content-Type': 'application/json' },
       body: JSON.stringify({ model })
@@ -317,7 +333,7 @@ async function loadMCPTools() {
   }
 
   try {
-    const res = await fetch('/api/mcp/servers/tools');
+    const res = await fetch('/api/v1/mcp/servers/tools');
     if (!res.ok) {
       console.warn('MCP tools request failed:', res.status);
       mcpBadge.style.display = 'none';
@@ -513,7 +529,7 @@ async function runMCPTool() {
     // Find server ID from tool name (format: servername_toolname)
     const serverId = mcpTools.find(t => t.name === selectedMCPTool.name)?.server_id;
 
-    const res = await fetch('/api/mcp/servers/call', {
+    const res = await fetch('/api/v1/mcp/servers/call', {
       method: 'POST',
       headers: { 'Content-Type': 'application/json' },
       body: JSON.stringify({
@@ -548,7 +564,7 @@ async function runMCPTool() {
         <div class="response-wrapper">
           <div class="response-message">
             <div class="mcp-accordion">
-              <button class="mcp-accordion-header" onclick="toggleMcpAccordion('${accordionId}')">
+              <button class="mcp-accordion-header" data-click="toggleMcpAccordion" data-args="${actionArgs(accordionId)}">
                 <span class="mcp-accordion-icon">▶</span>
                 <span class="mcp-accordion-title">MCP Tool Result (${selectedMCPTool.name})</span>
               </button>
@@ -592,7 +608,7 @@ async function runMCPTool() {
         <div class="response-wrapper">
           <div class="response-message">
             <div class="mcp-accordion mcp-accordion-error">
-              <button class="mcp-accordion-header" onclick="toggleMcpAccordion('${accordionId}')">
+              <button class="mcp-accordion-header" data-click="toggleMcpAccordion" data-args="${actionArgs(accordionId)}">
                 <span class="mcp-accordion-icon">▶</span>
                 <span class="mcp-accordion-title" style="color: var(--color-error);">Error running MCP tool</span>
               </button>
@@ -642,7 +658,7 @@ function toggleMcpAccordion(id) {
 // Initialize on page load
 async function checkMemoryFeature() {
   try {
-    const res = await fetch('/api/settings/memory_enabled');
+    const res = await fetch('/api/v1/settings/memory_enabled');
     if (res.ok) {
       const data = await res.json();
       const isEnabled = data.value === '1' || data.value === 'true';
@@ -664,7 +680,7 @@ document.addEventListener('DOMContentLoaded', async function () {
 
   // Fetch CSRF token
   try {
-    const csrfRes = await fetch('/api/csrf');
+    const csrfRes = await fetch('/api/v1/csrf');
     if (csrfRes.ok) {
       const data = await csrfRes.json();
       csrfToken = data.token;
@@ -853,7 +869,7 @@ function showKeyboardShortcutsHelp() {
     <div class="shortcuts-modal">
       <div class="shortcuts-header">
         <h3>Keyboard Shortcuts</h3>
-        <button class="shortcuts-close" onclick="closeKeyboardShortcutsHelp()" aria-label="Close">×</button>
+        <button class="shortcuts-close" data-click="closeKeyboardShortcutsHelp" aria-label="Close">×</button>
       </div>
       <div class="shortcuts-list">
         ${shortcuts.map(s => `
@@ -948,7 +964,7 @@ function getChatsList() {
 // Load chats list for sidebar
 async function loadChatsList() {
   try {
-    const res = await fetch('/api/chats');
+    const res = await fetch('/api/v1/chats');
     if (!res.ok) return;
 
     ChatState.chatsList = await res.json();
@@ -995,16 +1011,16 @@ function createChatItemHtml(chat) {
   const isActive = String(chat.id) === String(ChatState.currentChatId);
   return `
     <div class="chat-item ${isActive ? 'active' : ''} ${chat.is_pinned ? 'pinned' : ''}"
-         data-chat-id="${chat.id}" onclick="selectChat(${chat.id})">
+         data-chat-id="${chat.id}" data-click="selectChat" data-args="${actionArgs(chat.id)}">
       <div class="chat-item-content">
         <div class="chat-item-title">
             ${chat.is_pinned ? '<span class="pin-indicator" title="Pinned">📌</span> ' : ''}${escapeHtml(chat.title).replace(/^\/search\s+/, '<span class="search-pill">SEARCH</span> ')}
         </div>
       </div>
-      <div class="chat-item-actions" onclick="event.stopPropagation()">
-        <button class="chat-item-pin ${chat.is_pinned ? 'pinned' : ''}" onclick="togglePinChat(${chat.id}, ${!chat.is_pinned}, event)" title="${chat.is_pinned ? 'Unpin chat' : 'Pin chat'}">📌</button>
-        <button class="chat-item-rename" onclick="renameChat(${chat.id}, event)" title="Rename chat">✏️</button>
-        <button class="chat-item-delete" onclick="deleteChat(${chat.id}, event)" title="Delete chat">×</button>
+      <div class="chat-item-actions" data-click="">
+        <button class="chat-item-pin ${chat.is_pinned ? 'pinned' : ''}" data-click="togglePinChat" data-args="${actionArgs(chat.id, !chat.is_pinned, '$event')}" title="${chat.is_pinned ? 'Unpin chat' : 'Pin chat'}">📌</button>
+        <button class="chat-item-rename" data-click="renameChat" data-args="${actionArgs(chat.id, '$event')}" title="Rename chat">✏️</button>
+        <button class="chat-item-delete" data-click="deleteChat" data-args="${actionArgs(chat.id, '$event')}" title="Delete chat">×</button>
       </div>
     </div>
   `;
@@ -1029,7 +1045,7 @@ function filterChats(query) {
   }
 
   // API call is now debounced at the event listener level
-  fetch(`/api/chats/search?q=${encodeURIComponent(q)}`)
+  fetch(`/api/v1/chats/search?q=${encodeURIComponent(q)}`)
     .then(res => res.json())
     .then(results => renderSearchResults(results, q))
     .catch(err => {
@@ -1051,14 +1067,14 @@ function renderSearchResults(results, query) {
 
   container.innerHTML = results.map(chat => `
     <div class="chat-item ${String(chat.id) === String(ChatState.currentChatId) ? 'active' : ''}"
-         data-chat-id="${chat.id}" onclick="selectChat(${chat.id})">
+         data-chat-id="${chat.id}" data-click="selectChat" data-args="${actionArgs(chat.id)}">
       <div class="chat-item-content">
         <div class="chat-item-title">${escapeHtml(chat.title)}</div>
         <div class="chat-item-date">${formatDate(chat.updated_at)}</div>
       </div>
-      <div class="chat-item-actions" onclick="event.stopPropagation()">
-        <button class="chat-item-rename" onclick="renameChat(${chat.id}, event)" title="Rename chat">✏️</button>
-        <button class="chat-item-delete" onclick="deleteChat(${chat.id}, event)" title="Delete chat">×</button>
+      <div class="chat-item-actions" data-click="">
+        <button class="chat-item-rename" data-click="renameChat" data-args="${actionArgs(chat.id, '$event')}" title="Rename chat">✏️</button>
+        <button class="chat-item-delete" data-click="deleteChat" data-args="${actionArgs(chat.id, '$event')}" title="Delete chat">×</button>
       </div>
     </div>
   `).join('');
@@ -1118,6 +1134,11 @@ function renderMessages(chat, options = {}) {
   let i = 0;
   while (i < chat.messages.length) {
     const msg = chat.messages[i];
+    // Stored system messages are instructions for the model, not part of the conversation
+    if (msg.role === 'system') {
+      i++;
+      continue;
+    }
 
     if (msg.version_group && versionGroups[msg.version_group]) {
       const groupMsgs = versionGroups[msg.version_group];
@@ -1147,10 +1168,7 @@ function renderMessages(chat, options = {}) {
       if (msg.role === 'user') {
         printout.insertAdjacentHTML('beforeend', createUserMessageHtml(msg.id, msg.content, versionCount));
       } else {
-        const meta = {};
-        if (msg.model_name) meta.model = msg.model_name;
-        if (msg.tokens_used) meta.tokens = msg.tokens_used;
-        printout.insertAdjacentHTML('beforeend', createAssistantMessageHtml(msg.id, msg.content, true, meta, versionCount));
+        printout.insertAdjacentHTML('beforeend', createAssistantMessageHtml(msg.id, msg.content, true, assistantMessageMeta(msg), versionCount));
       }
       i++;
     }
@@ -1174,7 +1192,7 @@ async function selectChat(chatId) {
   ChatState.isLoadingMessages = false;
 
   try {
-    const res = await fetch(`/api/chats/${chatId}`);
+    const res = await fetch(`/api/v1/chats/${chatId}?all_versions=1`);
     if (!res.ok) return;
 
     const chat = await res.json();
@@ -1194,24 +1212,25 @@ async function selectChat(chatId) {
 
 // Create HTML for a version group
 function createVersionGroupHtml(pairs, versionGroupId) {
+  // Show the version used as context, falling back to the newest
+  let activeIndex = pairs.findIndex(pair => pair.user.is_active_version);
+  if (activeIndex < 0) activeIndex = pairs.length - 1;
+
   const versionsHtml = pairs.map((pair, index) => {
     const userHtml = createUserMessageHtml(pair.user.id, pair.user.content);
     let assistantHtml = '';
     if (pair.assistant) {
-      const meta = {};
-      if (pair.assistant.model_name) meta.model = pair.assistant.model_name;
-      if (pair.assistant.tokens_used) meta.tokens = pair.assistant.tokens_used;
-      assistantHtml = createAssistantMessageHtml(pair.assistant.id, pair.assistant.content, true, meta);
+      assistantHtml = createAssistantMessageHtml(pair.assistant.id, pair.assistant.content, true, assistantMessageMeta(pair.assistant));
     }
-    return `<div class="version-item ${index === pairs.length - 1 ? 'active' : ''}" data-version-index="${index}">${userHtml}${assistantHtml}</div>`;
+    return `<div class="version-item ${index === activeIndex ? 'active' : ''}" data-version-index="${index}">${userHtml}${assistantHtml}</div>`;
   }).join('');
 
   return `
-    <div class="version-container" data-version-group="${versionGroupId}" data-current-version="${pairs.length - 1}">
+    <div class="version-container" data-version-group="${versionGroupId}" data-current-version="${activeIndex}">
       <div class="version-nav">
-        <button class="version-nav-btn" onclick="navigateVersion(this, -1)" title="Previous version">◀</button>
-        <span class="version-indicator">Version <span class="version-current">${pairs.length}</span> of <span class="version-total">${pairs.length}</span></span>
-        <button class="version-nav-btn" onclick="navigateVersion(this, 1)" title="Next version" disabled>▶</button>
+        <button class="version-nav-btn" data-click="navigateVersion" data-args="${actionArgs('$el', -1)}" title="Previous version" ${activeIndex === 0 ? 'disabled' : ''}>◀</button>
+        <span class="version-indicator">Version <span class="version-current">${activeIndex + 1}</span> of <span class="version-total">${pairs.length}</span></span>
+        <button class="version-nav-btn" data-click="navigateVersion" data-args="${actionArgs('$el', 1)}" title="Next version" ${activeIndex === pairs.length - 1 ? 'disabled' : ''}>▶</button>
       </div>
       ${versionsHtml}
     </div>
@@ -1223,7 +1242,7 @@ async function deleteChat(chatId, event) {
   event.stopPropagation();
 
   try {
-    const res = await fetch(`/api/chats/${chatId}`, { method: 'DELETE' });
+    const res = await fetch(`/api/v1/chats/${chatId}`, { method: 'DELETE' });
     if (!res.ok) throw new Error('Failed to delete');
 
     const chatToDelete = ChatState.chatsList.find(c => c.id === chatId);
@@ -1258,7 +1277,7 @@ function showUndoNotification(chatTitle) {
   toast.className = 'undo-toast';
   toast.innerHTML = `
     <span>Chat "${escapeHtml(chatTitle)}" deleted</span>
-    <button onclick="undoDeleteChat()">Undo</button>
+    <button data-click="undoDeleteChat">Undo</button>
   `;
   container.appendChild(toast);
 
@@ -1281,7 +1300,7 @@ async function undoDeleteChat() {
 
   try {
     const chat = ChatState.deletedChatBuffer.chat;
-    const res = await fetch('/api/chats', {
+    const res = await fetch('/api/v1/chats', {
       method: 'POST',
       headers: { 'Content-Type': 'application/json' },
       body: JSON.stringify({ title: chat.title })
@@ -1345,7 +1364,7 @@ async function renameChat(chatId, event) {
     }
 
     try {
-      const res = await fetch(`/api/chats/${chatId}/rename`, {
+      const res = await fetch(`/api/v1/chats/${chatId}/rename`, {
         method: 'PUT',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify({ title: newTitle })
@@ -1381,7 +1400,7 @@ async function renameChat(chatId, event) {
 async function togglePinChat(chatId, isPinned, event) {
   event.stopPropagation();
   try {
-    const res = await fetch(`/api/chats/${chatId}/pin`, {
+    const res = await fetch(`/api/v1/chats/${chatId}/pin`, {
       method: 'PUT',
       headers: { 'Content-Type': 'application/json' },
       body: JSON.stringify({ is_pinned: isPinned })
@@ -1403,7 +1422,7 @@ async function loadCurrentChat() {
   ChatState.isLoadingMessages = false;
 
   try {
-    const res = await fetch('/api/chats/current');
+    const res = await fetch('/api/v1/chats/current');
     if (!res.ok) return;
 
     const chat = await res.json();
@@ -1424,7 +1443,7 @@ async function loadCurrentChat() {
 // Start a new chat
 async function startNewChat() {
   try {
-    const res = await fetch('/api/chats', {
+    const res = await fetch('/api/v1/chats', {
       method: 'POST',
       headers: { 'Content-Type': 'application/json' },
       body: JSON.stringify({ title: 'New Chat' })
@@ -1488,7 +1507,7 @@ const KeyboardShortcutsActions = {
 
 function createUserMessageHtml(id, content, versionCount = 0) {
   const versionBadge = versionCount > 1
-    ? `<span class="version-badge" onclick="showVersionHistory('${id}')" title="${versionCount - 1} earlier version${versionCount > 2 ? 's' : ''}">📜 ${versionCount}</span>`
+    ? `<span class="version-badge" data-click="showVersionHistory" data-args="${actionArgs(id)}" title="${versionCount - 1} earlier version${versionCount > 2 ? 's' : ''}">📜 ${versionCount}</span>`
     : '';
   return `
     <div id="msg-${id}" class="message-group user-message-group">
@@ -1496,14 +1515,39 @@ function createUserMessageHtml(id, content, versionCount = 0) {
         ${versionBadge}
         <span class="message-content">${escapeHtml(content)}</span>
         <div class="message-actions">
-           <button class="message-btn edit-btn" onclick="editMessage(${id}, 'user')" title="Edit message">✏️</button>
-           <button class="message-btn delete-btn" onclick="deleteMessage(${id})" title="Delete message">🗑️</button>
+           <button class="message-btn edit-btn" data-click="editMessage" data-args="${actionArgs(id, 'user')}" title="Edit message">✏️</button>
+           <button class="message-btn delete-btn" data-click="deleteMessage" data-args="${actionArgs(id)}" title="Delete message">🗑️</button>
         </div>
       </div>
     </div>
   `;
 }
 
+// Format a generation latency in milliseconds as seconds
+function formatLatency(ms) {
+  return `${(ms / 1000).toFixed(1)}s`;
+}
+
+// Build the metadata shown under a saved assistant message
+function assistantMessageMeta(msg) {
+  const meta = {};
+  if (msg.model_name) meta.model = msg.model_name;
+  if (msg.tokens_used) meta.tokens = msg.tokens_used;
+  if (msg.tokens_per_sec) meta.speed = `${msg.tokens_per_sec} tok/s`;
+  if (msg.latency_ms) meta.latency = formatLatency(msg.latency_ms);
+  if (msg.feedback) meta.feedback = msg.feedback.rating;
+  return meta;
+}
+
+// Copy the generation stats from a response's analytics block into a message payload
+function applyAnalyticsToPayload(payload, analytics) {
+  if (!analytics) return;
+  if (analytics.model) payload.model_name = analytics.model;
+  if (analytics.usage?.total_tokens) payload.tokens_used = analytics.usage.total_tokens;
+  if (analytics.latency_ms) payload.latency_ms = analytics.latency_ms;
+  if (analytics.tokens_per_sec) payload.tokens_per_sec = analytics.tokens_per_sec;
+}
+
 function createAssistantMessageHtml(id, content, isFormatted = false, meta = {}, versionCount = 0) {
   const formattedContent = isFormatted ? converter.makeHtml(content) : content;
 
@@ -1512,7 +1556,7 @@ function createAssistantMessageHtml(id, content, isFormatted = false, meta = {},
   // Don't show controls for pending messages
   const showControls = id && !String(id).startsWith('pending');
 
-  const hasMeta = meta.model || meta.tokens || meta.speed;
+  const hasMeta = meta.model || meta.tokens || meta.speed || meta.latency;
   if (hasMeta || showControls) {
     metaHtml = '<div class="message-meta">';
     if (meta.model) {
@@ -1524,9 +1568,12 @@ function createAssistantMessageHtml(id, content, isFormatted = false, meta = {},
     if (meta.speed) {
       metaHtml += `<span class="message-meta-item" title="Speed">${escapeHtml(meta.speed)}</span>`;
     }
+    if (meta.latency) {
+      metaHtml += `<span class="message-meta-item" title="Generation time">${escapeHtml(meta.latency)}</span>`;
+    }
 
     const versionBadge = versionCount > 1
-      ? `<span class="version-badge" onclick="showVersionHistory('${id}')" title="${versionCount - 1} earlier version${versionCount > 2 ? 's' : ''}">📜 ${versionCount}</span>`
+      ? `<span class="version-badge" data-click="showVersionHistory" data-args="${actionArgs(id)}" title="${versionCount - 1} earlier version${versionCount > 2 ? 's' : ''}">📜 ${versionCount}</span>`
       : '';
 
     if (versionBadge) {
@@ -1534,8 +1581,9 @@ function createAssistantMessageHtml(id, content, isFormatted = false, meta = {},
     }
 
     if (showControls) {
-      metaHtml += `<button class="message-btn regenerate-btn" onclick="regenerateResponse(${id})" title="Regenerate response"><svg viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="2"><path d="M23 4v6h-6"/><path d="M1 20v-6h6"/><path d="M3.51 9a9 9 0 0 1 14.85-3.36L23 10"/><path d="M1 14l4.64 4.36A9 9 0 0 0 20.49 15"/></svg></button>`;
-      metaHtml += `<button class="message-btn delete-btn" onclick="deleteMessage(${id})" title="Delete message"><svg viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="2"><polyline points="3 6 5 6 21 6"></polyline><path d="M19 6v14a2 2 0 0 1-2 2H7a2 2 0 0 1-2-2V6m3 0V4a2 2 0 0 1 2-2h4a2 2 0 0 1 2 2v2"></path><line x1="10" y1="11" x2="10" y2="17"></line><line x1="14" y1="11" x2="14" y2="17"></line></svg></button>`;
+      metaHtml += feedbackButtonsHtml(id, meta.feedback);
+      metaHtml += `<button class="message-btn regenerate-btn" data-click="regenerateResponse" data-args="${actionArgs(id)}" title="Regenerate response"><svg viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="2"><path d="M23 4v6h-6"/><path d="M1 20v-6h6"/><path d="M3.51 9a9 9 0 0 1 14.85-3.36L23 10"/><path d="M1 14l4.64 4.36A9 9 0 0 0 20.49 15"/></svg></button>`;
+      metaHtml += `<button class="message-btn delete-btn" data-click="deleteMessage" data-args="${actionArgs(id)}" title="Delete message"><svg viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="2"><polyline points="3 6 5 6 21 6"></polyline><path d="M19 6v14a2 2 0 0 1-2 2H7a2 2 0 0 1-2-2V6m3 0V4a2 2 0 0 1 2-2h4a2 2 0 0 1 2 2v2"></path><line x1="10" y1="11" x2="10" y2="17"></line><line x1="14" y1="11" x2="14" y2="17"></line></svg></button>`;
     }
 
     metaHtml += '</div>';
@@ -1574,7 +1622,7 @@ async function showVersionHistory(msgId) {
     <div class="version-modal">
       <div class="version-modal-header">
         <h3>Version History</h3>
-        <button class="version-modal-close" onclick="closeVersionModal()">×</button>
+        <button class="version-modal-close" data-click="closeVersionModal">×</button>
       </div>
       <div class="version-modal-content" id="versionModalContent">
         <div class="version-loading">Loading versions...</div>
@@ -1586,7 +1634,7 @@ async function showVersionHistory(msgId) {
   setTimeout(() => modal.classList.add('show'), 10);
 
   try {
-    const res = await fetch(`/api/chats/${ChatState.currentChatId}`);
+    const res = await fetch(`/api/v1/chats/${ChatState.currentChatId}?all_versions=1`);
     if (!res.ok) throw new Error('Failed to load chat');
     const chat = await res.json();
 
@@ -1624,7 +1672,7 @@ async function showVersionHistory(msgId) {
             <span class="version-time">${new Date(v.created_at || Date.now()).toLocaleString()}</span>
           </div>
           <div class="version-content">${escapeHtml(v.content)}</div>
-          ${isLatest ? '' : `<button class="version-restore-btn" onclick="restoreVersion(${v.id})">Restore this version</button>`}
+          ${isLatest ? '' : `<button class="version-restore-btn" data-click="restoreVersion" data-args="${actionArgs(v.id)}">Restore this version</button>`}
         </div>
       `;
     });
@@ -1722,12 +1770,43 @@ function setupCodeBlockCopyButtons() {
   });
 }
 
+// Thumbs up/down buttons for an assistant message, with the current rating pressed
+function feedbackButtonsHtml(id, rating) {
+  return [['up', '👍', 'Good response'], ['down', '👎', 'Bad response']].map(([value, icon, title]) =>
+    `<button class="message-btn feedback-btn ${rating === value ? 'active' : ''}" data-click="rateMessage" data-args="${actionArgs(id, value, '$el')}" title="${title}" aria-pressed="${rating === value}">${icon}</button>`
+  ).join('');
+}
+
+// Rate an assistant message; clicking the active rating again clears it
+async function rateMessage(id, rating, button) {
+  const clearing = button.classList.contains('active');
+  try {
+    const res = await fetch(`/api/v1/messages/${id}/feedback`, clearing
+      ? { method: 'DELETE' }
+      : {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ rating })
+      });
+    if (!res.ok) throw new Error(await responseErrorMessage(res));
+
+    button.closest('.message-meta').querySelectorAll('.feedback-btn').forEach(btn => {
+      const active = !clearing && btn === button;
+      btn.classList.toggle('active', active);
+      btn.setAttribute('aria-pressed', String(active));
+    });
+  } catch (err) {
+    console.error('Error saving feedback:', err);
+    alert('Failed to save feedback');
+  }
+}
+
 // Delete a message
 async function deleteMessage(id) {
   if (!confirm('Are you sure you want to delete this message?')) return;
 
   try {
-    const res = await fetch(`/api/messages/${id}`, { method: 'DELETE' });
+    const res = await fetch(`/api/v1/messages/${id}`, { method: 'DELETE' });
     if (!res.ok) throw new Error('Failed to delete message');
 
     // Remove from UI
@@ -1756,7 +1835,7 @@ async function sendMessage() {
   if (!prompt) return;
 
   if (!ChatState.currentChatId) {
-    const res = await fetch('/api/chats', {
+    const res = await fetch('/api/v1/chats', {
       method: 'POST',
       headers: { 'Content-Type': 'application/json' },
       body: JSON.stringify({ title: 'New Chat' })
@@ -1780,7 +1859,7 @@ async function sendMessage() {
 
   let userMsgId;
   try {
-    const res = await fetch(`/api/chats/${ChatState.currentChatId}/messages`, {
+    const res = await fetch(`/api/v1/chats/${ChatState.currentChatId}/messages`, {
       method: 'POST',
       headers: { 'Content-Type': 'application/json' },
       body: JSON.stringify({ role: 'user', content: prompt })
@@ -1824,7 +1903,7 @@ async function sendMessage() {
       body: JSON.stringify({ input: prompt, chat_id: ChatState.currentChatId })
     });
 
-    if (!response.ok) throw new Error(`Server error: ${response.status}`);
+    if (!response.ok) throw new Error(await responseErrorMessage(response));
 
     const outputEl = document.getElementById(`response-${assistantMsgId}`);
     outputEl.innerHTML = '';
@@ -1877,8 +1956,11 @@ async function sendMessage() {
       if (analytics.usage && analytics.usage.total_tokens) {
         metaHtml += `<span class="message-meta-item" title="Tokens used"><svg viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="2"><circle cx="12" cy="12" r="10"/><path d="M12 6v6l4 2"/></svg>${analytics.usage.total_tokens} tokens</span>`;
       }
-      if (analytics.speed) {
-        metaHtml += `<span class="message-meta-item" title="Speed">⚡${escapeHtml(analytics.speed)}</span>`;
+      if (analytics.tokens_per_sec) {
+        metaHtml += `<span class="message-meta-item" title="Speed">⚡${analytics.tokens_per_sec} tok/s</span>`;
+      }
+      if (analytics.latency_ms) {
+        metaHtml += `<span class="message-meta-item" title="Generation time">${formatLatency(analytics.latency_ms)}</span>`;
       }
       metaHtml += '</div>';
       metaEl.innerHTML = metaHtml;
@@ -1890,13 +1972,8 @@ async function sendMessage() {
         role: 'assistant',
         content: responseContent
       };
-      if (analytics) {
-        if (analytics.model) msgPayload.model_name = analytics.model;
-        if (analytics.usage && analytics.usage.total_tokens) {
-          msgPayload.tokens_used = analytics.usage.total_tokens;
-        }
-      }
-      await fetch(`/api/chats/${ChatState.currentChatId}/messages`, {
+      applyAnalyticsToPayload(msgPayload, analytics);
+      await fetch(`/api/v1/chats/${ChatState.currentChatId}/messages`, {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify(msgPayload)
@@ -1921,7 +1998,7 @@ function updateProgressBar(count) {
   if (!container) return;
 
   if (count === undefined) {
-    fetch(`/api/chats/${ChatState.currentChatId}`)
+    fetch(`/api/v1/chats/${ChatState.currentChatId}`)
       .then(res => res.json())
       .then(chat => {
         const msgCount = chat.messages ? Math.ceil(chat.messages.length / 2) : 0;
@@ -2046,7 +2123,7 @@ async function loadMoreMessages() {
   const nextOffset = ChatState.messageOffset + MESSAGE_PAGE_SIZE;
 
   try {
-    const res = await fetch(`/api/chats/${ChatState.currentChatId}?limit=${MESSAGE_PAGE_SIZE}&offset=${nextOffset}`);
+    const res = await fetch(`/api/v1/chats/${ChatState.currentChatId}?limit=${MESSAGE_PAGE_SIZE}&offset=${nextOffset}&all_versions=1`);
     if (!res.ok) {
       ChatState.hasMoreMessages = false;
       return;
@@ -2062,10 +2139,11 @@ async function loadMoreMessages() {
     if (printout && chat.messages.length > 0) {
       const tempDiv = document.createElement('div');
       for (const msg of chat.messages) {
+        if (msg.role === 'system') continue;
         const versionCount = countVersions(chat.messages, msg.id);
         const msgHtml = msg.role === 'user'
           ? createUserMessageHtml(msg.id, msg.content, versionCount)
-          : createAssistantMessageHtml(msg.id, msg.content, false, { model: msg.model_name, tokens: msg.tokens_used }, versionCount);
+          : createAssistantMessageHtml(msg.id, msg.content, false, assistantMessageMeta(msg), versionCount);
         tempDiv.innerHTML += msgHtml;
       }
 
@@ -2108,6 +2186,7 @@ function handleMessagesScroll(e) {
 }
 
 function exportChat(format = 'html') {
+  closeExportMenu();
   const printout = document.getElementById('printout');
   if (!printout) return;
 
@@ -2206,12 +2285,12 @@ async function editMessage(msgId, role) {
   contentElement.innerHTML = `
     <textarea class="inline-edit-textarea" rows="3">${escapeHtml(currentContent)}</textarea>
     <div class="inline-edit-actions">
-      <button class="inline-edit-btn save" onclick="saveInlineEdit(${msgId}, this)" title="Save changes">
+      <button class="inline-edit-btn save" data-click="saveInlineEdit" data-args="${actionArgs(msgId, '$el')}" title="Save changes">
         <svg viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="2.5" stroke-linecap="round" stroke-linejoin="round">
           <polyline points="20 6 9 17 4 12"></polyline>
         </svg>
       </button>
-      <button class="inline-edit-btn cancel" onclick="cancelInlineEdit(${msgId}, this)" title="Cancel">
+      <button class="inline-edit-btn cancel" data-click="cancelInlineEdit" data-args="${actionArgs(msgId, '$el')}" title="Cancel">
         <svg viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="2.5" stroke-linecap="round" stroke-linejoin="round">
           <line x1="18" y1="6" x2="6" y2="18"></line>
           <line x1="6" y1="6" x2="18" y2="18"></line>
@@ -2274,7 +2353,7 @@ async function saveInlineEdit(msgId, element) {
       versionGroupId = `vg-${msgId}`;
 
       // Update the original messages with version_group in DB
-      await fetch(`/api/messages/${msgId}`, {
+      await fetch(`/api/v1/messages/${msgId}`, {
         method: 'PUT',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify({ version_group: versionGroupId })
@@ -2283,7 +2362,7 @@ async function saveInlineEdit(msgId, element) {
       if (assistantMsgGroup) {
         const assistantId = assistantMsgGroup.dataset.msgId;
         if (assistantId && !String(assistantId).startsWith('pending')) {
-          await fetch(`/api/messages/${assistantId}`, {
+          await fetch(`/api/v1/messages/${assistantId}`, {
             method: 'PUT',
             headers: { 'Content-Type': 'application/json' },
             body: JSON.stringify({ version_group: versionGroupId })
@@ -2316,16 +2395,16 @@ async function saveInlineEdit(msgId, element) {
       // Add navigation controls
       const navHtml = `
         <div class="version-nav">
-          <button class="version-nav-btn" onclick="navigateVersion(this, -1)" title="Previous version">◀</button>
+          <button class="version-nav-btn" data-click="navigateVersion" data-args="${actionArgs('$el', -1)}" title="Previous version">◀</button>
           <span class="version-indicator">Version <span class="version-current">1</span> of <span class="version-total">1</span></span>
-          <button class="version-nav-btn" onclick="navigateVersion(this, 1)" title="Next version">▶</button>
+          <button class="version-nav-btn" data-click="navigateVersion" data-args="${actionArgs('$el', 1)}" title="Next version">▶</button>
         </div>
       `;
       versionContainer.insertAdjacentHTML('afterbegin', navHtml);
     }
 
     // Save the new user message to DB with version_group
-    const userRes = await fetch(`/api/chats/${ChatState.currentChatId}/messages`, {
+    const userRes = await fetch(`/api/v1/chats/${ChatState.currentChatId}/messages`, {
       method: 'POST',
       headers: { 'Content-Type': 'application/json' },
       body: JSON.stringify({ role: 'user', content: trimmedContent, version_group: versionGroupId })
@@ -2398,7 +2477,7 @@ async function generateResponseForVersion(prompt, assistantMsgId, versionElement
       body: JSON.stringify({ input: prompt, chat_id: ChatState.currentChatId })
     });
 
-    if (!response.ok) throw new Error(`Server error: ${response.status}`);
+    if (!response.ok) throw new Error(await responseErrorMessage(response));
 
     const outputEl = document.getElementById(`response-${assistantMsgId}`);
     if (!outputEl) return;
@@ -2439,11 +2518,8 @@ async function generateResponseForVersion(prompt, assistantMsgId, versionElement
     // Save assistant message with version_group
     try {
       const msgPayload = { role: 'assistant', content: responseContent, version_group: versionGroupId };
-      if (analytics) {
-        if (analytics.model) msgPayload.model_name = analytics.model;
-        if (analytics.usage?.total_tokens) msgPayload.tokens_used = analytics.usage.total_tokens;
-      }
-      const saveRes = await fetch(`/api/chats/${ChatState.currentChatId}/messages`, {
+      applyAnalyticsToPayload(msgPayload, analytics);
+      const saveRes = await fetch(`/api/v1/chats/${ChatState.currentChatId}/messages`, {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify(msgPayload)
@@ -2458,6 +2534,7 @@ async function generateResponseForVersion(prompt, assistantMsgId, versionElement
             let metaHtml = '<div class="message-meta">';
             if (analytics?.model) metaHtml += `<span class="message-meta-item" title="Model">🤖 ${escapeHtml(analytics.model)}</span>`;
             if (analytics?.usage?.total_tokens) metaHtml += `<span class="message-meta-item" title="Tokens">📊 ${analytics.usage.total_tokens} tokens</span>`;
+            metaHtml += feedbackButtonsHtml(savedMsg.id);
             metaHtml += '</div>';
             metaEl.innerHTML = metaHtml;
           }
@@ -2495,6 +2572,13 @@ function navigateVersion(btn, direction) {
   });
 
   updateVersionNav(container);
+
+  // Make the shown version the one sent as context for the next turn
+  const shownId = versions[currentIndex]?.querySelector('.message-group')?.dataset.msgId;
+  if (shownId && !String(shownId).startsWith('pending')) {
+    fetch(`/api/v1/messages/${shownId}/activate-version`, { method: 'POST' })
+      .catch(err => console.log('Error activating version:', err));
+  }
 }
 
 function updateVersionNav(container) {
@@ -2530,7 +2614,7 @@ async function regenerateResponse(assistantMsgId) {
 
   // Delete the assistant message from DB
   try {
-    await fetch(`/api/messages/${assistantMsgId}`, { method: 'DELETE' });
+    await fetch(`/api/v1/messages/${assistantMsgId}`, { method: 'DELETE' });
   } catch (err) {
     console.log('Error deleting message:', err);
   }
@@ -2567,7 +2651,7 @@ async function generateResponse(prompt) {
       body: JSON.stringify({ input: prompt, chat_id: ChatState.currentChatId })
     });
 
-    if (!response.ok) throw new Error(`Server error: ${response.status}`);
+    if (!response.ok) throw new Error(await responseErrorMessage(response));
 
     const outputEl = document.getElementById(`response-${assistantMsgId}`);
     outputEl.innerHTML = '';
@@ -2617,8 +2701,11 @@ async function generateResponse(prompt) {
       if (analytics.usage && analytics.usage.total_tokens) {
         metaHtml += `<span class="message-meta-item" title="Tokens used"><svg viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="2"><circle cx="12" cy="12" r="10"/><path d="M12 6v6l4 2"/></svg>${analytics.usage.total_tokens} tokens</span>`;
       }
-      if (analytics.speed) {
-        metaHtml += `<span class="message-meta-item" title="Speed">⚡${escapeHtml(analytics.speed)}</span>`;
+      if (analytics.tokens_per_sec) {
+        metaHtml += `<span class="message-meta-item" title="Speed">⚡${analytics.tokens_per_sec} tok/s</span>`;
+      }
+      if (analytics.latency_ms) {
+        metaHtml += `<span class="message-meta-item" title="Generation time">${formatLatency(analytics.latency_ms)}</span>`;
       }
       metaHtml += '</div>';
       metaEl.innerHTML = metaHtml;
@@ -2627,13 +2714,8 @@ async function generateResponse(prompt) {
     // Save assistant message to database
     try {
       const msgPayload = { role: 'assistant', content: responseContent };
-      if (analytics) {
-        if (analytics.model) msgPayload.model_name = analytics.model;
-        if (analytics.usage && analytics.usage.total_tokens) {
-          msgPayload.tokens_used = analytics.usage.total_tokens;
-        }
-      }
-      const saveRes = await fetch(`/api/chats/${ChatState.currentChatId}/messages`, {
+      applyAnalyticsToPayload(msgPayload, analytics);
+      const saveRes = await fetch(`/api/v1/chats/${ChatState.currentChatId}/messages`, {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify(msgPayload)
@@ -2645,7 +2727,7 @@ async function generateResponse(prompt) {
         if (msgGroup && savedMsg.id) {
           msgGroup.dataset.msgId = savedMsg.id;
           const metaDiv = metaEl.querySelector('.message-meta');
-          const btnHtml = `<button class="regenerate-btn" onclick="regenerateResponse(${savedMsg.id})" title="Regenerate response"><svg viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="2"><path d="M23 4v6h-6"/><path d="M1 20v-6h6"/><path d="M3.51 9a9 9 0 0 1 14.85-3.36L23 10"/><path d="M1 14l4.64 4.36A9 9 0 0 0 20.49 15"/></svg></button>`;
+          const btnHtml = feedbackButtonsHtml(savedMsg.id) + `<button class="regenerate-btn" data-click="regenerateResponse" data-args="${actionArgs(savedMsg.id)}" title="Regenerate response"><svg viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="2"><path d="M23 4v6h-6"/><path d="M1 20v-6h6"/><path d="M3.51 9a9 9 0 0 1 14.85-3.36L23 10"/><path d="M1 14l4.64 4.36A9 9 0 0 0 20.49 15"/></svg></button>`;
 
           if (metaDiv) {
             metaDiv.insertAdjacentHTML('beforeend', btnHtml);
@@ -2674,7 +2756,7 @@ async function loadSystemPrompt() {
   if (!ChatState.currentChatId) return;
 
   try {
-    const res = await fetch(`/api/chats/${ChatState.currentChatId}/system-prompt`);
+    const res = await fetch(`/api/v1/chats/${ChatState.currentChatId}/system-prompt`);
     if (res.ok) {
       const data = await res.json();
       currentSystemPrompt = data.system_prompt || '';
@@ -2703,7 +2785,7 @@ async function saveSystemPrompt() {
   const newPrompt = textarea.value.trim();
 
   try {
-    const res = await fetch(`/api/chats/${ChatState.currentChatId}/system-prompt`, {
+    const res = await fetch(`/api/v1/chats/${ChatState.currentChatId}/system-prompt`, {
       method: 'PUT',
       headers: { 'Content-Type': 'application/json' },
       body: JSON.stringify({ system_prompt: newPrompt })
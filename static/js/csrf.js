@@ -0,0 +1,43 @@
+// Adds the CSRF token to state-changing same-origin fetch requests
+(function () {
+  const originalFetch = window.fetch.bind(window);
+  const SAFE_METHODS = ['GET', 'HEAD', 'OPTIONS'];
+
+  function readCookie(name) {
+    const match = document.cookie.split('; ').find(row => row.startsWith(name + '='));
+    return match ? decodeURIComponent(match.substring(name.length + 1)) : null;
+  }
+
+  async function getToken() {
+    const token = readCookie('csrf_token');
+    if (token) return token;
+
+    try {
+      const res = await originalFetch('/api/v1/csrf');
+      if (res.ok) {
+        const data = await res.json();
+        return data.token;
+      }
+    } catch (e) {
+      console.warn('Could not fetch CSRF token:', e);
+    }
+    return null;
+  }
+
+  window.fetch = async function (input, init = {}) {
+    const request = input instanceof Request ? input : null;
+    const method = (init.method || (request ? request.method : 'GET')).toUpperCase();
+    const url = new URL(request ? request.url : input, window.location.origin);
+
+    if (!SAFE_METHODS.includes(method) && url.origin === window.location.origin) {
+      const token = await getToken();
+      if (token) {
+        const headers = new Headers(init.headers || (request ? request.headers : undefined));
+        headers.set('X-CSRF-Token', token);
+        init = { ...init, headers };
+      }
+    }
+
+    return originalFetch(input, init);
+  };
+})();
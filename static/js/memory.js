@@ -24,7 +24,7 @@ async function loadMemories() {
   container.innerHTML = '<div class="loading-memories" style="padding: 20px; text-align: center; color: var(--text-muted);">Loading memories...</div>';
 
   try {
-    const response = await fetch('/api/memories');
+    const response = await fetch('/api/v1/memories');
 
     if (!response.ok) {
       const errorText = await response.text().catch(() => 'Unknown error');
@@ -87,8 +87,8 @@ function renderMemories() {
         </div>
       </div>
       <div class="memory-item-actions">
-        <button class="memory-action-btn" onclick="editMemory('${escapeHtml(memory.key)}')" title="Edit">✏️</button>
-        <button class="memory-action-btn delete" onclick="deleteMemory('${escapeHtml(memory.key)}')" title="Delete">🗑️</button>
+        <button class="memory-action-btn" data-click="editMemory" data-args="${actionArgs(memory.key)}" title="Edit">✏️</button>
+        <button class="memory-action-btn delete" data-click="deleteMemory" data-args="${actionArgs(memory.key)}" title="Delete">🗑️</button>
       </div>
     </div>
   `).join('');
@@ -132,7 +132,7 @@ async function addMemory() {
 
     if (editingMemory) {
       // Update existing memory - the key is disabled so it stays the same
-      response = await fetch('/api/memories', {
+      response = await fetch('/api/v1/memories', {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify({ key: editingMemory, value, category })
@@ -140,7 +140,7 @@ async function addMemory() {
       successMessage = 'Memory updated successfully';
     } else {
       // Add new memory
-      response = await fetch('/api/memories', {
+      response = await fetch('/api/v1/memories', {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify({ key, value, category })
@@ -183,7 +183,7 @@ async function deleteMemory(key) {
   }
 
   try {
-    const response = await fetch('/api/memories', {
+    const response = await fetch('/api/v1/memories', {
       method: 'DELETE',
       headers: { 'Content-Type': 'application/json' },
       body: JSON.stringify({ key })
@@ -243,7 +243,7 @@ async function testMemoryExtraction() {
   }
 
   try {
-    const response = await fetch('/api/memories/extract', {
+    const response = await fetch('/api/v1/memories/extract', {
       method: 'POST',
       headers: { 'Content-Type': 'application/json' },
       body: JSON.stringify({ message: testMessage.trim() })
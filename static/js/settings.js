@@ -3,6 +3,7 @@
 let providers = [];
 let selectedModels = [];
 let editingProviderId = null;
+let editingProviderModels = [];
 let fetchedModels = []; // Store fetched models for filtering
 
 // Initialize page
@@ -10,6 +11,7 @@ document.addEventListener('DOMContentLoaded', function () {
     initTheme();
     loadProviders();
     loadMCPServers();
+    loadHTTPTools();
     loadSettings();
 
     // Temperature slider
@@ -31,27 +33,41 @@ document.addEventListener('DOMContentLoaded', function () {
     document.getElementById('brave-api-key').addEventListener('change', function () {
         updateSetting('brave_api_key', this.value);
     });
+
+    // Search provider
+    document.getElementById('search-provider').addEventListener('change', function () {
+        updateSetting('search_provider', this.value);
+    });
+    document.getElementById('searxng-url').addEventListener('change', function () {
+        updateSetting('searxng_url', this.value.trim());
+    });
+
+    // Auto-search
+    document.getElementById('auto-search').addEventListener('change', function () {
+        updateSetting('auto_search', this.value);
+    });
 });
 
-// Theme management
+// Theme management. theme.js has already applied the saved preference.
 function initTheme() {
-    const savedTheme = localStorage.getItem('theme') || 'light';
-    document.documentElement.setAttribute('data-theme', savedTheme);
-    updateThemeButtons(savedTheme);
-    updateThemeIcon(savedTheme);
+    showTheme(document.documentElement.dataset.themePreference || 'light');
 }
 
-function setTheme(theme) {
-    document.documentElement.setAttribute('data-theme', theme);
-    localStorage.setItem('theme', theme);
+// showTheme applies a preference and updates the controls without saving it
+function showTheme(theme) {
+    theme = applyThemePreference(theme);
     updateThemeButtons(theme);
     updateThemeIcon(theme);
-    updateSetting('theme', theme);
+    return theme;
+}
+
+function setTheme(theme) {
+    updateSetting('theme', showTheme(theme));
 }
 
 function toggleTheme() {
-    const current = document.documentElement.getAttribute('data-theme') || 'light';
-    setTheme(current === 'dark' ? 'light' : 'dark');
+    const current = document.documentElement.dataset.themePreference || 'light';
+    setTheme(nextThemePreference(current));
 }
 
 function updateThemeButtons(theme) {
@@ -62,45 +78,30 @@ function updateThemeButtons(theme) {
 
 function updateThemeIcon(theme) {
     const btn = document.getElementById('theme-toggle');
-    if (btn) btn.textContent = theme === 'dark' ? '☀️' : '🌙';
+    if (!btn) return;
+    const icons = { light: '🌙', dark: '🖥️', system: '☀️' };
+    btn.textContent = icons[theme] || '🌙';
+    btn.title = 'Theme: ' + theme;
 }
 
 // Load settings from server
 async function loadSettings() {
     try {
-        const tempRes = await fetch('/api/settings/temperature');
-        if (tempRes.ok) {
-            const data = await tempRes.json();
-            document.getElementById('temperature').value = data.value;
-            document.getElementById('temp-value').textContent = data.value;
-        }
-
-        const tokensRes = await fetch('/api/settings/max_tokens');
-        if (tokensRes.ok) {
-            const data = await tokensRes.json();
-            document.getElementById('max-tokens').value = data.value;
-        }
-
-        const themeRes = await fetch('/api/settings/theme');
-        if (themeRes.ok) {
-            const data = await themeRes.json();
-            setTheme(data.value);
-        }
-
-        const braveRes = await fetch('/api/settings/brave_api_key');
-        if (braveRes.ok) {
-            const data = await braveRes.json();
-            document.getElementById('brave-api-key').value = data.value;
-        }
-
-        const memoryRes = await fetch('/api/settings/memory_enabled');
-        if (memoryRes.ok) {
-            const data = await memoryRes.json();
-            document.getElementById('memory-enabled').checked = data.value === '1' || data.value === 'true';
-        } else {
-            // Default to enabled if not set
-            document.getElementById('memory-enabled').checked = true;
-        }
+        const res = await fetch('/api/v1/settings');
+        if (!res.ok) throw new Error('Failed to load settings');
+        const settings = await res.json();
+
+        document.getElementById('temperature').value = settings.temperature;
+        document.getElementById('temp-value').textContent = settings.temperature;
+        document.getElementById('max-tokens').value = settings.max_tokens;
+        showTheme(settings.theme);
+        document.getElementById('brave-api-key').value = settings.brave_api_key;
+        document.getElementById('search-provider').value = settings.search_provider;
+        document.getElementById('searxng-url').value = settings.searxng_url;
+        document.getElementById('auto-search').value = settings.auto_search;
+        // Memory defaults to enabled when the setting was never saved
+        const memory = settings.memory_enabled;
+        document.getElementById('memory-enabled').checked = memory === undefined || memory === '1' || memory === 'true';
     } catch (err) {
         console.error('Error loading settings:', err);
     }
@@ -112,7 +113,7 @@ async function toggleMemoryFeature() {
     const isEnabled = checkbox.checked;
 
     try {
-        const res = await fetch('/api/settings/memory_enabled', {
+        const res = await fetch('/api/v1/settings/memory_enabled', {
             method: 'PUT',
             headers: { 'Content-Type': 'application/json' },
             body: JSON.stringify({ value: isEnabled ? '1' : '0' })
@@ -149,7 +150,7 @@ async function updateSetting(key, value) {
     const input = document.getElementById(inputId);
 
     try {
-        const res = await fetch(`/api/settings/${key}`, {
+        const res = await fetch(`/api/v1/settings/${key}`, {
             method: 'PUT',
             headers: { 'Content-Type': 'application/json' },
             body: JSON.stringify({ value: String(value) })
@@ -179,7 +180,7 @@ async function updateSetting(key, value) {
 // Provider management
 async function loadProviders() {
     try {
-        const res = await fetch('/api/providers');
+        const res = await fetch('/api/v1/providers');
         providers = await res.json();
         renderProviders();
     } catch (err) {
@@ -203,20 +204,20 @@ function renderProviders() {
                 <div class="provider-name">
                     <input type="radio" name="active-provider" 
                            ${p.is_active ? 'checked' : ''} 
-                           onchange="activateProvider(${p.id})"
+                           data-change="activateProvider" data-args="${actionArgs(p.id)}"
                            style="margin-right: 8px;">
                     ${escapeHtml(p.name)}
                     <span class="provider-badge">${p.type === 'ollama' ? 'Ollama' : 'OpenAI'}</span>
                     ${p.is_active ? '<span class="badge bg-success ms-2">Active</span>' : ''}
                 </div>
                 <div class="provider-actions">
-                    <button class="btn btn-sm btn-outline-secondary" onclick="editProvider(${p.id})">Edit</button>
-                    <button class="btn btn-sm btn-outline-danger" onclick="deleteProvider(${p.id})">×</button>
+                    <button class="btn btn-sm btn-outline-secondary" data-click="editProvider" data-args="${actionArgs(p.id)}">Edit</button>
+                    <button class="btn btn-sm btn-outline-danger" data-click="deleteProvider" data-args="${actionArgs(p.id)}">×</button>
                 </div>
             </div>
             <div class="provider-models">
                 Models: ${p.models && p.models.length > 0
-            ? p.models.map(m => `<span class="${m.is_default ? 'fw-bold' : ''}">${escapeHtml(m.model_name)}${m.is_default ? ' ★' : ''}</span>`).join(', ')
+            ? p.models.map(m => `<span class="${m.is_default ? 'fw-bold' : ''}"${m.owned_by ? ` title="${escapeHtml(m.owned_by)}"` : ''}>${escapeHtml(m.model_name)}${m.is_default ? ' ★' : ''}${modelCapabilityIcons(m.capabilities)}</span>`).join(', ')
             : '<em>None configured</em>'}
             </div>
         </div>
@@ -225,6 +226,7 @@ function renderProviders() {
 
 function showAddProviderModal() {
     editingProviderId = null;
+    editingProviderModels = [];
     selectedModels = [];
     document.getElementById('providerModalTitle').textContent = 'Add Provider';
     document.getElementById('provider-id').value = '';
@@ -232,6 +234,8 @@ function showAddProviderModal() {
     document.getElementById('provider-type').value = 'ollama';
     document.getElementById('provider-baseurl').value = '';
     document.getElementById('provider-apikey').value = '';
+    document.getElementById('provider-apikey').placeholder = 'sk-...';
+    document.getElementById('provider-maxconcurrent').value = 0;
     document.getElementById('fetched-models-container').style.display = 'none';
     document.getElementById('fetched-models-container').innerHTML = '';
     toggleProviderFields();
@@ -240,14 +244,25 @@ function showAddProviderModal() {
     showModal('providerModal');
 }
 
-function editProvider(id) {
-    const provider = providers.find(p => p.id === id);
+async function editProvider(id) {
+    let provider;
+    try {
+        const res = await fetch(`/api/v1/providers/${id}`);
+        if (!res.ok) throw new Error('Failed to load provider');
+        provider = await res.json();
+    } catch (e) {
+        console.error('Error loading provider:', e);
+        provider = providers.find(p => p.id === id);
+    }
     if (!provider) return;
 
     editingProviderId = id;
+    editingProviderModels = provider.models || [];
     selectedModels = provider.models ? provider.models.map(m => ({
         name: m.model_name,
-        isDefault: m.is_default
+        isDefault: m.is_default,
+        ownedBy: m.owned_by,
+        capabilities: m.capabilities
     })) : [];
 
     document.getElementById('providerModalTitle').textContent = 'Edit Provider';
@@ -256,6 +271,8 @@ function editProvider(id) {
     document.getElementById('provider-type').value = provider.type;
     document.getElementById('provider-baseurl').value = provider.base_url || '';
     document.getElementById('provider-apikey').value = ''; // Don't show existing key
+    document.getElementById('provider-apikey').placeholder = provider.api_key_hint || 'sk-...';
+    document.getElementById('provider-maxconcurrent').value = provider.max_concurrent || 0;
     document.getElementById('fetched-models-container').style.display = 'none';
     toggleProviderFields();
     renderSelectedModels();
@@ -327,7 +344,7 @@ async function fetchModels() {
     btn.innerHTML = '<span class="loading-spinner"></span> Fetching...';
 
     try {
-        const res = await fetch(`/api/providers/${providerId}/fetch-models`, {
+        const res = await fetch(`/api/v1/providers/${providerId}/fetch-models`, {
             method: 'POST'
         });
 
@@ -348,7 +365,7 @@ async function fetchModels() {
                     <input type="text" class="form-control form-control-sm" 
                            id="model-filter" 
                            placeholder="Filter models..." 
-                           oninput="filterFetchedModels(this.value)">
+                           data-input="filterFetchedModels" data-args="${actionArgs('$value')}">
                 </div>
                 <p class="small text-muted-dark mb-2">Select models to add (<span id="models-count">${models.length}</span> available):</p>
                 <div id="fetched-models-list">
@@ -365,6 +382,13 @@ async function fetchModels() {
     }
 }
 
+// modelCapabilityIcons marks models that accept tools or images
+function modelCapabilityIcons(capabilities) {
+    if (!capabilities) return '';
+    return (capabilities.supports_tools ? ' <span title="Supports tools">🛠</span>' : '') +
+        (capabilities.supports_vision ? ' <span title="Supports images">👁</span>' : '');
+}
+
 function renderFetchedModelsList(models) {
     if (models.length === 0) {
         return '<p class="text-muted small">No models match the filter</p>';
@@ -375,7 +399,7 @@ function renderFetchedModelsList(models) {
                    id="model-${escapeHtml(m.id)}" 
                    value="${escapeHtml(m.id)}"
                    ${selectedModels.some(sm => sm.name === m.id) ? 'checked' : ''}
-                   onchange="toggleFetchedModel('${escapeHtml(m.id)}', this.checked)">
+                   data-change="toggleFetchedModel" data-args="${actionArgs(m.id, '$checked')}">
             <label class="form-check-label small" for="model-${escapeHtml(m.id)}">
                 ${escapeHtml(m.id)}
                 ${m.owned_by ? `<span class="text-muted">(${escapeHtml(m.owned_by)})</span>` : ''}
@@ -403,7 +427,8 @@ function filterFetchedModels(query) {
 function toggleFetchedModel(modelName, checked) {
     if (checked) {
         if (!selectedModels.some(m => m.name === modelName)) {
-            selectedModels.push({ name: modelName, isDefault: selectedModels.length === 0 });
+            const fetched = fetchedModels.find(m => m.id === modelName);
+            selectedModels.push({ name: modelName, isDefault: selectedModels.length === 0, ownedBy: fetched && fetched.owned_by });
         }
     } else {
         selectedModels = selectedModels.filter(m => m.name !== modelName);
@@ -445,8 +470,8 @@ function renderSelectedModels() {
                 ${m.isDefault ? '<span class="badge bg-primary ms-1">Default</span>' : ''}
             </span>
             <div>
-                ${!m.isDefault ? `<button class="btn btn-sm btn-link p-0 me-2" onclick="setDefaultModel(${i})">Set Default</button>` : ''}
-                <button class="btn btn-sm btn-link text-danger p-0" onclick="removeModel(${i})">×</button>
+                ${!m.isDefault ? `<button class="btn btn-sm btn-link p-0 me-2" data-click="setDefaultModel" data-args="${actionArgs(i)}">Set Default</button>` : ''}
+                <button class="btn btn-sm btn-link text-danger p-0" data-click="removeModel" data-args="${actionArgs(i)}">×</button>
             </div>
         </div>
     `).join('');
@@ -471,6 +496,7 @@ async function saveProvider() {
     const type = document.getElementById('provider-type').value;
     const baseUrl = document.getElementById('provider-baseurl').value.trim();
     const apiKey = document.getElementById('provider-apikey').value.trim();
+    const maxConcurrent = parseInt(document.getElementById('provider-maxconcurrent').value, 10) || 0;
 
     if (!name) {
         alert('Please enter a provider name');
@@ -489,13 +515,15 @@ async function saveProvider() {
         type,
         base_url: baseUrl,
         api_key: apiKey,
-        models: selectedModels.map(m => m.name)
+        max_concurrent: Math.max(0, maxConcurrent),
+        models: selectedModels.map(m => m.name),
+        model_owners: Object.fromEntries(selectedModels.filter(m => m.ownedBy).map(m => [m.name, m.ownedBy]))
     };
 
     try {
         let res;
         if (editingProviderId) {
-            res = await fetch(`/api/providers/${editingProviderId}`, {
+            res = await fetch(`/api/v1/providers/${editingProviderId}`, {
                 method: 'PUT',
                 headers: { 'Content-Type': 'application/json' },
                 body: JSON.stringify(data)
@@ -503,25 +531,24 @@ async function saveProvider() {
 
             // Update models separately
             // First, delete existing models and add new ones
-            const existingProvider = providers.find(p => p.id === editingProviderId);
-            if (existingProvider && existingProvider.models) {
-                for (const m of existingProvider.models) {
-                    await fetch(`/api/models/${m.id}`, { method: 'DELETE' });
-                }
+            for (const m of editingProviderModels) {
+                await fetch(`/api/v1/models/${m.id}`, { method: 'DELETE' });
             }
             for (const m of selectedModels) {
-                await fetch('/api/models', {
+                await fetch('/api/v1/models', {
                     method: 'POST',
                     headers: { 'Content-Type': 'application/json' },
                     body: JSON.stringify({
                         provider_id: editingProviderId,
                         model_name: m.name,
-                        is_default: m.isDefault
+                        is_default: m.isDefault,
+                        owned_by: m.ownedBy,
+                        capabilities: m.capabilities
                     })
                 });
             }
         } else {
-            res = await fetch('/api/providers', {
+            res = await fetch('/api/v1/providers', {
                 method: 'POST',
                 headers: { 'Content-Type': 'application/json' },
                 body: JSON.stringify(data)
@@ -544,7 +571,7 @@ async function deleteProvider(id) {
     if (!confirm('Are you sure you want to delete this provider?')) return;
 
     try {
-        const res = await fetch(`/api/providers/${id}`, { method: 'DELETE' });
+        const res = await fetch(`/api/v1/providers/${id}`, { method: 'DELETE' });
         if (!res.ok) {
             const error = await res.text();
             throw new Error(error);
@@ -557,7 +584,7 @@ async function deleteProvider(id) {
 
 async function activateProvider(id) {
     try {
-        const res = await fetch(`/api/providers/${id}/activate`, { method: 'POST' });
+        const res = await fetch(`/api/v1/providers/${id}/activate`, { method: 'POST' });
         if (!res.ok) {
             const error = await res.text();
             throw new Error(error);
@@ -573,7 +600,7 @@ let mcpServers = [];
 
 async function loadMCPServers() {
     try {
-        const res = await fetch('/api/mcp/servers');
+        const res = await fetch('/api/v1/mcp/servers');
         mcpServers = await res.json();
         renderMCPServers();
     } catch (err) {
@@ -598,19 +625,30 @@ function renderMCPServers() {
                     ${escapeHtml(s.name)}
                     <span class="provider-badge">${s.server_type.toUpperCase()}</span>
                     ${s.is_enabled ? '<span class="badge bg-success ms-2">Active</span>' : '<span class="badge bg-secondary ms-2">Disabled</span>'}
+                    ${mcpStatusBadge(s)}
                 </div>
                 <div class="provider-actions">
-                    <button class="btn btn-sm btn-outline-secondary" onclick="editMCPServer(${s.id})">Edit</button>
-                    <button class="btn btn-sm btn-outline-danger" onclick="deleteMCPServer(${s.id})">×</button>
+                    <button class="btn btn-sm btn-outline-secondary" data-click="editMCPServer" data-args="${actionArgs(s.id)}">Edit</button>
+                    <button class="btn btn-sm btn-outline-danger" data-click="deleteMCPServer" data-args="${actionArgs(s.id)}">×</button>
                 </div>
             </div>
             <div class="provider-models">
                 ${s.server_type === 'http' ? s.endpoint_url : s.command + ' ' + (s.args || '')}
+                ${s.status === 'error' && s.last_error ? `<div class="text-danger small">${escapeHtml(s.last_error)}</div>` : ''}
             </div>
         </div>
     `).join('');
 }
 
+// mcpStatusBadge shows the result of the server's last health check
+function mcpStatusBadge(s) {
+    const checked = s.last_checked ? ` title="Checked ${escapeHtml(new Date(s.last_checked).toLocaleString())}"` : '';
+    if (s.status === 'ok') return `<span class="badge bg-success ms-1"${checked}>Reachable</span>`;
+    if (s.status === 'error') return `<span class="badge bg-danger ms-1"${checked}>Unreachable</span>`;
+    if (s.status === 'unknown') return '<span class="badge bg-secondary ms-1">Not checked</span>';
+    return '';
+}
+
 function toggleMCPFields() {
     const type = document.getElementById('mcp-server-type').value;
     document.getElementById('mcp-http-fields').style.display = type === 'http' ? 'block' : 'none';
@@ -686,13 +724,13 @@ async function saveMCPServer() {
     try {
         let res;
         if (id) {
-            res = await fetch(`/api/mcp/servers/${id}`, {
+            res = await fetch(`/api/v1/mcp/servers/${id}`, {
                 method: 'PUT',
                 headers: { 'Content-Type': 'application/json' },
                 body: JSON.stringify(data)
             });
         } else {
-            res = await fetch('/api/mcp/servers', {
+            res = await fetch('/api/v1/mcp/servers', {
                 method: 'POST',
                 headers: { 'Content-Type': 'application/json' },
                 body: JSON.stringify(data)
@@ -715,7 +753,7 @@ async function deleteMCPServer(id) {
     if (!confirm('Are you sure you want to delete this MCP server?')) return;
 
     try {
-        const res = await fetch(`/api/mcp/servers/${id}`, { method: 'DELETE' });
+        const res = await fetch(`/api/v1/mcp/servers/${id}`, { method: 'DELETE' });
         if (!res.ok) {
             const error = await res.text();
             throw new Error(error);
@@ -726,6 +764,139 @@ async function deleteMCPServer(id) {
     }
 }
 
+// HTTP Tool Management
+let httpTools = [];
+
+async function loadHTTPTools() {
+    try {
+        const res = await fetch('/api/v1/tools');
+        if (!res.ok) {
+            const data = await res.json().catch(() => ({}));
+            document.getElementById('http-tools-list').innerHTML =
+                `<p class="text-muted">${escapeHtml(data.message || 'HTTP tools are unavailable')}</p>`;
+            return;
+        }
+        httpTools = await res.json();
+        renderHTTPTools();
+    } catch (err) {
+        console.error('Error loading HTTP tools:', err);
+        document.getElementById('http-tools-list').innerHTML =
+            '<p class="text-danger">Error loading HTTP tools</p>';
+    }
+}
+
+function renderHTTPTools() {
+    const container = document.getElementById('http-tools-list');
+
+    if (!httpTools || httpTools.length === 0) {
+        container.innerHTML = '<p class="text-muted">No HTTP tools configured.</p>';
+        return;
+    }
+
+    container.innerHTML = httpTools.map(t => `
+        <div class="provider-card ${t.is_enabled ? '' : 'disabled'}" data-id="${t.id}">
+            <div class="provider-header">
+                <div class="provider-name">
+                    ${escapeHtml(t.name)}
+                    <span class="provider-badge">${escapeHtml(t.method)}</span>
+                    ${t.is_enabled ? '<span class="badge bg-success ms-2">Active</span>' : '<span class="badge bg-secondary ms-2">Disabled</span>'}
+                </div>
+                <div class="provider-actions">
+                    <button class="btn btn-sm btn-outline-secondary" data-click="editHTTPTool" data-args="${actionArgs(t.id)}">Edit</button>
+                    <button class="btn btn-sm btn-outline-danger" data-click="deleteHTTPTool" data-args="${actionArgs(t.id)}">×</button>
+                </div>
+            </div>
+            <div class="provider-models">
+                ${escapeHtml(t.url)}
+                <div class="text-muted small">${escapeHtml(t.description)}</div>
+            </div>
+        </div>
+    `).join('');
+}
+
+function showAddHTTPToolModal() {
+    document.getElementById('http-tool-id').value = '';
+    document.getElementById('http-tool-name').value = '';
+    document.getElementById('http-tool-description').value = '';
+    document.getElementById('http-tool-method').value = 'POST';
+    document.getElementById('http-tool-url').value = '';
+    document.getElementById('http-tool-schema').value = '';
+    document.getElementById('http-tool-enabled').checked = true;
+    document.getElementById('httpToolModalTitle').textContent = 'Add HTTP Tool';
+    showModal('httpToolModal');
+}
+
+function editHTTPTool(id) {
+    const tool = httpTools.find(t => t.id === id);
+    if (!tool) return;
+
+    document.getElementById('http-tool-id').value = id;
+    document.getElementById('http-tool-name').value = tool.name;
+    document.getElementById('http-tool-description').value = tool.description;
+    document.getElementById('http-tool-method').value = tool.method;
+    document.getElementById('http-tool-url').value = tool.url;
+    document.getElementById('http-tool-schema').value = JSON.stringify(tool.input_schema, null, 2);
+    document.getElementById('http-tool-enabled').checked = tool.is_enabled;
+    document.getElementById('httpToolModalTitle').textContent = 'Edit HTTP Tool';
+    showModal('httpToolModal');
+}
+
+async function saveHTTPTool() {
+    const id = document.getElementById('http-tool-id').value;
+    const schemaText = document.getElementById('http-tool-schema').value.trim();
+
+    let inputSchema = null;
+    if (schemaText) {
+        try {
+            inputSchema = JSON.parse(schemaText);
+        } catch (err) {
+            alert('Input schema is not valid JSON: ' + err.message);
+            return;
+        }
+    }
+
+    const data = {
+        name: document.getElementById('http-tool-name').value.trim(),
+        description: document.getElementById('http-tool-description').value.trim(),
+        method: document.getElementById('http-tool-method').value,
+        url: document.getElementById('http-tool-url').value.trim(),
+        input_schema: inputSchema,
+        is_enabled: document.getElementById('http-tool-enabled').checked
+    };
+
+    try {
+        const res = await fetch(id ? `/api/v1/tools/${id}` : '/api/v1/tools', {
+            method: id ? 'PUT' : 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(data)
+        });
+        const result = await res.json();
+        if (!res.ok || result.error) {
+            throw new Error(result.message || res.statusText);
+        }
+
+        hideModal('httpToolModal');
+        await loadHTTPTools();
+    } catch (err) {
+        alert('Error saving HTTP tool: ' + err.message);
+    }
+}
+
+async function deleteHTTPTool(id) {
+    if (!confirm('Are you sure you want to delete this HTTP tool?')) return;
+
+    try {
+        const res = await fetch(`/api/v1/tools/${id}`, { method: 'DELETE' });
+        const result = await res.json();
+        if (!res.ok || result.error) {
+            throw new Error(result.message || res.statusText);
+        }
+        await loadHTTPTools();
+    } catch (err) {
+        alert('Error deleting HTTP tool: ' + err.message);
+    }
+}
+
 // Utility
 function escapeHtml(text) {
     if (!text) return '';
@@ -0,0 +1,35 @@
+// Applies the theme before the page renders, so it is loaded in <head>. The server
+// renders the saved preference as data-theme-preference; "system" follows the OS.
+(function () {
+  const root = document.documentElement;
+  const media = window.matchMedia('(prefers-color-scheme: dark)');
+  const preferences = ['light', 'dark', 'system'];
+
+  function resolveTheme(preference) {
+    if (preference === 'system') return media.matches ? 'dark' : 'light';
+    return preference;
+  }
+
+  // applyThemePreference sets the preference and the resolved data-theme, returning
+  // the preference actually applied
+  window.applyThemePreference = function (preference) {
+    if (!preferences.includes(preference)) preference = 'light';
+    root.dataset.themePreference = preference;
+    root.setAttribute('data-theme', resolveTheme(preference));
+    localStorage.setItem('theme', preference);
+    return preference;
+  };
+
+  // nextThemePreference cycles light -> dark -> system
+  window.nextThemePreference = function (preference) {
+    return preferences[(preferences.indexOf(preference) + 1) % preferences.length];
+  };
+
+  media.addEventListener('change', function () {
+    if (root.dataset.themePreference === 'system') {
+      root.setAttribute('data-theme', resolveTheme('system'));
+    }
+  });
+
+  applyThemePreference(root.dataset.themePreference || localStorage.getItem('theme') || 'light');
+})();
@@ -3,10 +3,15 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/ollama/ollama/api"
 )
@@ -14,8 +19,82 @@ import (
 const (
 	SummaryThreshold = 10 // Trigger summarization when we have 10+ unsummarized messages
 	SummaryBatchSize = 10 // Convert 10 messages into a summary
+
+	DefaultMaxContextMessages = 50   // Hard cap on unsummarized messages sent to the model
+	DefaultContextTokenBudget = 8192 // Estimated tokens a turn may use before it is flagged
+	charsPerToken             = 4    // Rough average for English text across common tokenizers
 )
 
+// EstimateTokens approximates the token count of text from its length
+func EstimateTokens(text string) int {
+	if text == "" {
+		return 0
+	}
+	return (utf8.RuneCountInString(text) + charsPerToken - 1) / charsPerToken
+}
+
+// GetContextTokenBudget returns the context_token_budget setting
+func GetContextTokenBudget(db *sql.DB) int {
+	budget, err := strconv.Atoi(GetSetting(db, "context_token_budget", ""))
+	if err != nil || budget <= 0 {
+		return DefaultContextTokenBudget
+	}
+	return budget
+}
+
+// GetMaxContextMessages returns the max_context_messages setting
+func GetMaxContextMessages(db *sql.DB) int {
+	max, err := strconv.Atoi(GetSetting(db, "max_context_messages", ""))
+	if err != nil || max <= 0 {
+		return DefaultMaxContextMessages
+	}
+	return max
+}
+
+// GetContextMessages returns the most recent unsummarized messages of a chat, capped at
+// max_context_messages so a chat that has not been summarized yet still fits the model.
+// Stored system messages are sent as they are, and stored tool calls as system notes so
+// the model can refer back to them.
+func GetContextMessages(db *sql.DB, chatID int64) ([]api.Message, error) {
+	limit := GetMaxContextMessages(db)
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM messages WHERE chat_id = ? AND is_summarized = 0 AND role IN ('user', 'assistant', 'system', 'tool') AND COALESCE(is_active_version, 1) = 1", chatID).Scan(&total); err != nil {
+		return nil, err
+	}
+	if total > limit {
+		log.Printf("Chat %d has %d unsummarized messages, sending only the latest %d", chatID, total, limit)
+	}
+
+	rows, err := db.Query(`
+		SELECT role, content FROM (
+			SELECT id, role, content
+			FROM messages
+			WHERE chat_id = ? AND is_summarized = 0 AND role IN ('user', 'assistant', 'system', 'tool') AND COALESCE(is_active_version, 1) = 1
+			ORDER BY id DESC
+			LIMIT ?
+		) ORDER BY id ASC
+	`, chatID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []api.Message
+	for rows.Next() {
+		var role, content string
+		if err := rows.Scan(&role, &content); err != nil {
+			continue
+		}
+		if role == "tool" {
+			history = append(history, toolContextMessage(content))
+			continue
+		}
+		history = append(history, api.Message{Role: role, Content: content})
+	}
+	return history, rows.Err()
+}
+
 // StringResponseWriter mocks http.ResponseWriter to capture output
 type StringResponseWriter struct {
 	strings.Builder
@@ -40,12 +119,13 @@ func (w *StringResponseWriter) Flush() {
 	// No-op, satisfy http.Flusher
 }
 
-// MaybeTriggerSummarization checks if a chat needs summarization and runs it in background
-func MaybeTriggerSummarization(db *sql.DB, chatID int64) {
+// MaybeTriggerSummarization checks if a chat needs summarization and runs it in background.
+// The background run keeps ctx's request id for logging but not its cancellation.
+func MaybeTriggerSummarization(ctx context.Context, db *sql.DB, chatID int64) {
 	var count int
 	// Check how many messages are NOT summarized yet
 	// We only count assistant/user messages, ignoring system
-	err := db.QueryRow("SELECT COUNT(*) FROM messages WHERE chat_id = ? AND is_summarized = 0 AND role IN ('user', 'assistant')", chatID).Scan(&count)
+	err := db.QueryRow("SELECT COUNT(*) FROM messages WHERE chat_id = ? AND is_summarized = 0 AND role IN ('user', 'assistant') AND COALESCE(is_active_version, 1) = 1", chatID).Scan(&count)
 	if err != nil {
 		log.Println("Error checking summarization trigger:", err)
 		return
@@ -56,17 +136,106 @@ func MaybeTriggerSummarization(db *sql.DB, chatID int64) {
 	// when we have Threshold + Buffer. But simpler: Trigger when > Threshold,
 	// and the summarizer itself will decide what to pick.
 	if count >= SummaryThreshold { // e.g. 10 messages
-		go summarizeChat(db, chatID)
+		go summarizeChat(context.WithoutCancel(ctx), db, chatID)
+	}
+}
+
+// unsummarizedCount returns how many user and assistant messages of a chat are not yet
+// folded into its summary
+func unsummarizedCount(db *sql.DB, chatID int64) (int, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM messages WHERE chat_id = ? AND is_summarized = 0 AND role IN ('user', 'assistant') AND COALESCE(is_active_version, 1) = 1", chatID).Scan(&count)
+	return count, err
+}
+
+// ResetChatSummary drops a chat's summary and marks all its messages unsummarized, so
+// the summary is rebuilt from the current history
+func ResetChatSummary(exec settingsExecer, chatID int64) error {
+	if _, err := exec.Exec("UPDATE chats SET summary = NULL WHERE id = ?", chatID); err != nil {
+		return err
+	}
+	_, err := exec.Exec("UPDATE messages SET is_summarized = 0 WHERE chat_id = ?", chatID)
+	return err
+}
+
+// InvalidateSummaryForMessage resets a chat's summary when an edited or deleted message
+// had already been folded into it, then starts rebuilding it. Messages that were not
+// summarized yet are read fresh on every turn and need nothing.
+func InvalidateSummaryForMessage(ctx context.Context, db *sql.DB, chatID int64, wasSummarized bool) {
+	if !wasSummarized {
+		return
+	}
+	if err := ResetChatSummary(db, chatID); err != nil {
+		log.Printf("Error resetting summary of chat %d: %v", chatID, err)
+		return
 	}
+	go resummarizeChat(context.WithoutCancel(ctx), db, chatID)
 }
 
-func summarizeChat(db *sql.DB, chatID int64) {
-	log.Printf("Starting background summarization for chat %d...", chatID)
+// resummarizeChat runs summarization batch by batch until fewer than SummaryThreshold
+// messages are left unsummarized, stopping early if a batch makes no progress
+func resummarizeChat(ctx context.Context, db *sql.DB, chatID int64) {
+	for {
+		before, err := unsummarizedCount(db, chatID)
+		if err != nil {
+			log.Println("Error checking summarization trigger:", err)
+			return
+		}
+		if before < SummaryThreshold {
+			return
+		}
+		summarizeChat(ctx, db, chatID)
+		if after, err := unsummarizedCount(db, chatID); err != nil || after >= before {
+			return
+		}
+	}
+}
+
+// GetSummaryProvider returns the provider summaries are generated with: the provider in
+// summary_provider_id when set, otherwise the active one, using summary_model when set
+// instead of the provider's default model. A configured provider that is gone or
+// unusable falls back to the active provider so summarization keeps working.
+func GetSummaryProvider(db *sql.DB) (Provider, *ProviderConfig, error) {
+	var provider Provider
+	var config *ProviderConfig
+	var err error
 
-	// 1. Get the active provider to generate the summary
-	provider, _, err := GetActiveProvider(db)
+	if id, convErr := strconv.ParseInt(GetSetting(db, "summary_provider_id", ""), 10, 64); convErr == nil && id > 0 {
+		provider, config, err = GetProviderByID(db, id)
+		if err != nil && !errors.Is(err, ErrNoModelConfigured) {
+			log.Printf("Warning: Summary provider %d unavailable, using the active provider: %v", id, err)
+			provider, config, err = nil, nil, nil
+		}
+	}
+	if config == nil {
+		provider, config, err = GetActiveProvider(db)
+	}
+
+	model := strings.TrimSpace(GetSetting(db, "summary_model", ""))
+	if model == "" {
+		return provider, config, err
+	}
+	if config == nil {
+		return nil, nil, err
+	}
+
+	summaryConfig := *config
+	summaryConfig.Model = model
+	provider, err = NewProviderFromConfig(&summaryConfig)
 	if err != nil {
-		log.Println("Summarization skipped: No active provider")
+		return nil, nil, err
+	}
+	return provider, &summaryConfig, nil
+}
+
+func summarizeChat(ctx context.Context, db *sql.DB, chatID int64) {
+	slog.Info("summarization started", "request_id", requestID(ctx), "chat_id", chatID)
+	start := time.Now()
+
+	// 1. Get the provider to generate the summary with
+	provider, config, err := GetSummaryProvider(db)
+	if err != nil {
+		log.Printf("Summarization skipped: %v", err)
 		return
 	}
 
@@ -83,7 +252,7 @@ func summarizeChat(db *sql.DB, chatID int64) {
 	rows, err := db.Query(`
 		SELECT id, role, content 
 		FROM messages 
-		WHERE chat_id = ? AND is_summarized = 0 AND role IN ('user', 'assistant')
+		WHERE chat_id = ? AND is_summarized = 0 AND role IN ('user', 'assistant') AND COALESCE(is_active_version, 1) = 1
 		ORDER BY id ASC 
 		LIMIT ?`, chatID, SummaryBatchSize)
 	if err != nil {
@@ -155,14 +324,15 @@ Summary:`, conversationText)
 	// 5. Generate Summary
 	writer := NewStringResponseWriter()
 	// We pass empty history because the prompt contains everything needed
-	ctx := context.Background()
 	err = provider.Generate(ctx, []api.Message{}, prompt, "", writer)
 	if err != nil {
-		log.Println("Error generating summary:", err)
+		slog.Error("summarization failed", "request_id", requestID(ctx), "chat_id", chatID, "error", err.Error())
 		return
 	}
 
-	newSummary := strings.TrimSpace(writer.String())
+	newSummary, stats := splitAnalytics(writer.String())
+	newSummary = strings.TrimSpace(newSummary)
+	recordTokenUsage(db, chatID, usageSourceSummary, stats.Usage.TotalTokens)
 	
 	// Remove any artifacts like "Here is the summary:" if model chats too much (simple cleanup)
 	// For reasoning models, we might get <think> blocks. We should probably strip them?
@@ -203,10 +373,19 @@ Summary:`, conversationText)
 		return
 	}
 
+	// Tool calls made before the last summarized message are covered by the summary too
+	_, err = tx.Exec("UPDATE messages SET is_summarized = 1 WHERE chat_id = ? AND role = 'tool' AND id <= ?", chatID, batchIDs[len(batchIDs)-1])
+	if err != nil {
+		tx.Rollback()
+		log.Println("Error marking tool calls summarized:", err)
+		return
+	}
+
 	if err := tx.Commit(); err != nil {
 		log.Println("Error committing summary transaction:", err)
 		return
 	}
 
-	log.Printf("Successfully summarized %d messages for chat %d", len(batch), chatID)
+	slog.Info("summarization finished", "request_id", requestID(ctx), "chat_id", chatID, "model", config.Model, "messages", len(batch),
+		"duration_ms", time.Since(start).Milliseconds())
 }
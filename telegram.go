@@ -3,9 +3,11 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -21,6 +23,7 @@ var (
 	telegramSessions = make(map[int64]string)
 	telegramMutex    sync.RWMutex
 	allowedUsers     []int64
+	allowedGroups    []int64
 )
 
 func InitTelegramBot() {
@@ -41,6 +44,21 @@ func InitTelegramBot() {
 
 	telegramCtx, telegramCancel = context.WithCancel(context.Background())
 
+	// With TELEGRAM_WEBHOOK_URL set, Telegram pushes updates to telegramWebhookHandler
+	if TelegramWebhookPath() != "" {
+		if err := setTelegramWebhook(); err != nil {
+			log.Printf("Failed to set up Telegram webhook: %v", err)
+			return
+		}
+		log.Println("Telegram bot started and receiving updates via webhook...")
+		return
+	}
+
+	// A webhook left from an earlier run would make getUpdates fail
+	if _, err := telegramBot.Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+		log.Printf("Warning: Failed to remove Telegram webhook: %v", err)
+	}
+
 	u := tgbotapi.NewUpdate(0)
 	u.Timeout = 60
 
@@ -52,42 +70,56 @@ func InitTelegramBot() {
 			if !ok {
 				break
 			}
-			message := update.Message
-			if message == nil {
-				continue
-			}
-			go handleTelegramMessage(message)
+			dispatchTelegramUpdate(update)
 		}
 	}()
 
 	log.Println("Telegram bot started and listening for messages...")
 }
 
-func initAllowedUsers() {
-	allowedUsersEnv := os.Getenv("TELEGRAM_ALLOWED_USERS")
-	if allowedUsersEnv == "" {
-		allowedUsers = []int64{}
+// dispatchTelegramUpdate hands an update from polling or the webhook to its handler
+func dispatchTelegramUpdate(update tgbotapi.Update) {
+	if update.CallbackQuery != nil {
+		go handleTelegramCallback(update.CallbackQuery)
 		return
 	}
+	if update.Message != nil {
+		go handleTelegramMessage(update.Message)
+	}
+}
 
-	ids := strings.Split(allowedUsersEnv, ",")
-	allowedUsers = make([]int64, 0, len(ids))
+func initAllowedUsers() {
+	allowedUsers = parseTelegramIDs("TELEGRAM_ALLOWED_USERS", "user")
+	allowedGroups = parseTelegramIDs("TELEGRAM_ALLOWED_GROUPS", "group")
+}
 
-	for _, idStr := range ids {
+// parseTelegramIDs reads a comma-separated list of Telegram ids from an environment
+// variable
+func parseTelegramIDs(env, kind string) []int64 {
+	value := os.Getenv(env)
+	if value == "" {
+		return []int64{}
+	}
+
+	idStrs := strings.Split(value, ",")
+	ids := make([]int64, 0, len(idStrs))
+
+	for _, idStr := range idStrs {
 		idStr = strings.TrimSpace(idStr)
 		if idStr == "" {
 			continue
 		}
-		var userID int64
-		_, err := fmt.Sscanf(idStr, "%d", &userID)
+		var id int64
+		_, err := fmt.Sscanf(idStr, "%d", &id)
 		if err != nil {
-			log.Printf("Warning: Invalid user ID in allowlist: %s", idStr)
+			log.Printf("Warning: Invalid %s ID in allowlist: %s", kind, idStr)
 			continue
 		}
-		allowedUsers = append(allowedUsers, userID)
+		ids = append(ids, id)
 	}
 
-	log.Printf("Telegram allowlist configured with %d user(s)", len(allowedUsers))
+	log.Printf("Telegram allowlist configured with %d %s(s)", len(ids), kind)
+	return ids
 }
 
 func isUserAllowed(userID int64) bool {
@@ -105,7 +137,11 @@ func isUserAllowed(userID int64) bool {
 }
 
 func handleTelegramMessage(message *tgbotapi.Message) {
-	if message.Text == "" {
+	if message.Text == "" || message.From == nil {
+		return
+	}
+	if isTelegramGroup(message.Chat) {
+		handleTelegramGroupMessage(message)
 		return
 	}
 
@@ -128,7 +164,7 @@ func handleTelegramMessage(message *tgbotapi.Message) {
 	sessionID := getTelegramSession(userID)
 
 	sendTypingIndicator(chatID)
-	response := generateResponseForSession(sessionID, message.Text)
+	response := generateResponseForSession(sessionID, currentTelegramChat(userID), message.Text)
 
 	sendTelegramMessage(chatID, response)
 }
@@ -149,7 +185,10 @@ func handleTelegramCommand(message *tgbotapi.Message, userID, chatID int64) {
 				"/help - Show this help\n"+
 				"/memories - View your memories\n"+
 				"/clear - Clear conversation history\n"+
+				"/newchat [title] - Start a separate chat\n"+
+				"/chats - Switch between your chats\n"+
 				"/settings - Show your settings\n"+
+				"/stats - Show your usage\n"+
 				"/search <query> - Search the web\n"+
 				"/skills - List available skills\n\n"+
 				"🔗 Session Linking:\n"+
@@ -165,7 +204,10 @@ func handleTelegramCommand(message *tgbotapi.Message, userID, chatID int64) {
 			"💬 Chat:\n" +
 			"  /start - Start a new session\n" +
 			"  /clear - Clear current conversation\n" +
+			"  /newchat [title] - Start a separate chat\n" +
+			"  /chats - List your recent chats and switch\n" +
 			"  /settings - Show your current settings\n" +
+			"  /stats - Show your message and token usage\n" +
 			"  /search <query> - Search the web for info\n\n" +
 			"📚 Skills:\n" +
 			"  /skills - List available Open Skills\n" +
@@ -176,7 +218,7 @@ func handleTelegramCommand(message *tgbotapi.Message, userID, chatID int64) {
 			"  /link_session <id> <token> - Link Telegram to web session\n" +
 			"  /unlink_session - Unlink from web session\n" +
 			"  /session_info - Show session status\n\n" +
-			"❓ Get link token from web: GET /api/session/link-token"
+			"❓ Get link token from web: GET /api/v1/session/link-token"
 		sendTelegramMessage(chatID, msg)
 
 	case "memories":
@@ -204,9 +246,28 @@ func handleTelegramCommand(message *tgbotapi.Message, userID, chatID int64) {
 		telegramMutex.Lock()
 		telegramSessions[userID] = newSessionID
 		telegramMutex.Unlock()
+		if _, err := db.Exec("DELETE FROM telegram_current_chats WHERE telegram_user_id = ?", userID); err != nil {
+			log.Printf("Error clearing current chat for Telegram user %d: %v", userID, err)
+		}
 
 		sendTelegramMessage(chatID, "🧹 Conversation cleared! Starting a new session.")
 
+	case "newchat":
+		title := strings.Join(parts[1:], " ")
+		if title == "" {
+			title = "Telegram chat " + time.Now().Format("2006-01-02 15:04")
+		}
+		newChatID, err := createTelegramChat(userID, title)
+		if err != nil {
+			log.Printf("Error creating chat for Telegram user %d: %v", userID, err)
+			sendTelegramMessage(chatID, "❌ Error creating chat. Please try again.")
+			return
+		}
+		sendTelegramMessage(chatID, fmt.Sprintf("🆕 Started new chat: %s (#%d)\n\nUse /chats to switch between chats.", title, newChatID))
+
+	case "chats":
+		sendTelegramChatList(userID, chatID)
+
 	case "settings":
 		providerName := "Unknown"
 		modelName := "Unknown"
@@ -225,6 +286,9 @@ func handleTelegramCommand(message *tgbotapi.Message, userID, chatID int64) {
 		)
 		sendTelegramMessage(chatID, msg)
 
+	case "stats":
+		sendTelegramMessage(chatID, telegramStats(userID))
+
 	case "link_session":
 		if len(parts) < 3 {
 			sendTelegramMessage(chatID,
@@ -232,7 +296,7 @@ func handleTelegramCommand(message *tgbotapi.Message, userID, chatID int64) {
 					"To get your link token:\n"+
 					"1. Visit web app: http://localhost:1102\n"+
 					"2. Open browser console (F12)\n"+
-					"3. Run: fetch('/api/session/link-token').then(r=>r.json()).then(console.log)\n"+
+					"3. Run: fetch('/api/v1/session/link-token').then(r=>r.json()).then(console.log)\n"+
 					"4. Copy session_id and link_token")
 			return
 		}
@@ -312,7 +376,7 @@ func handleTelegramCommand(message *tgbotapi.Message, userID, chatID int64) {
 
 		if err == sql.ErrNoRows {
 			currentSession := getTelegramSession(userID)
-			msg := fmt.Sprintf("📱 Session Info\n\nStatus: 🔓 Unlinked\n\nCurrent Session ID: %s\n\nTo link with web, use:\n/link_session <session_id> <token>\n\nGet your link token from:\nGET /api/session/link-token", currentSession)
+			msg := fmt.Sprintf("📱 Session Info\n\nStatus: 🔓 Unlinked\n\nCurrent Session ID: %s\n\nTo link with web, use:\n/link_session <session_id> <token>\n\nGet your link token from:\nGET /api/v1/session/link-token", currentSession)
 			sendTelegramMessage(chatID, msg)
 			return
 		}
@@ -329,7 +393,7 @@ func handleTelegramCommand(message *tgbotapi.Message, userID, chatID int64) {
 		sessionID := getTelegramSession(userID)
 		searchQuery := "/search " + strings.Join(parts[1:], " ")
 		sendTypingIndicator(chatID)
-		response := generateResponseForSession(sessionID, searchQuery)
+		response := generateResponseForSession(sessionID, currentTelegramChat(userID), searchQuery)
 		sendTelegramMessage(chatID, response)
 
 	case "skills":
@@ -370,6 +434,53 @@ func handleTelegramCommand(message *tgbotapi.Message, userID, chatID int64) {
 	}
 }
 
+// telegramStats summarizes usage across the chats of a Telegram user
+func telegramStats(userID int64) string {
+	sessionID := getTelegramSession(userID)
+	usage, err := GetChatUsage(db, telegramChatsCondition, telegramChatsArgs(userID, sessionID)...)
+	if err != nil {
+		log.Printf("Error reading Telegram stats for user %d: %v", userID, err)
+		return "❌ Could not load your usage. Please try again."
+	}
+
+	providerName, modelName := "None", "None"
+	if _, config, err := GetActiveProvider(db); config != nil {
+		providerName = config.Name
+		if err == nil {
+			modelName = config.Model
+		}
+	}
+
+	scope := "🔓 Telegram-only"
+	if !strings.HasPrefix(sessionID, "telegram_") {
+		scope = "🔗 Linked to web"
+	}
+
+	return fmt.Sprintf(
+		"📊 Your Usage:\n\n"+
+			"Chats: %s\n"+
+			"Messages: %s\n"+
+			"Tokens: %s\n\n"+
+			"Provider: %s\n"+
+			"Model: %s\n"+
+			"Session: %s",
+		formatCount(int64(usage.Chats)), formatCount(int64(usage.Messages)), formatCount(usage.Tokens),
+		providerName, modelName, scope,
+	)
+}
+
+// formatCount renders n with thousands separators
+func formatCount(n int64) string {
+	if n < 0 {
+		return "-" + formatCount(-n)
+	}
+	s := strconv.FormatInt(n, 10)
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
+
 func createTelegramSession(userID int64) string {
 	sessionID := fmt.Sprintf("telegram_%d_%d", userID, time.Now().Unix())
 
@@ -399,59 +510,57 @@ func getTelegramSession(userID int64) string {
 	}
 
 	telegramMutex.RLock()
-	defer telegramMutex.RUnlock()
-
 	sessionID, exists := telegramSessions[userID]
+	telegramMutex.RUnlock()
 	if !exists {
 		return createTelegramSession(userID)
 	}
 	return sessionID
 }
 
-func generateResponseForSession(sessionID, userMessage string) string {
+// generateResponseForSession answers userMessage in chatID, or in the session's rolling
+// chat when chatID is 0
+func generateResponseForSession(sessionID string, chatID int64, userMessage string) string {
 	provider, config, err := GetActiveProvider(db)
 	if err != nil {
-		return "❌ Error: No active provider configured in web settings."
+		_, message := activeProviderError(err)
+		return "❌ Error: " + message
 	}
 
 	log.Printf("Generating response for Telegram session %s with provider: %s, model: %s", sessionID, config.Name, config.Model)
 
-	var braveAPIKey string
-	err = db.QueryRow("SELECT value FROM settings WHERE key = 'brave_api_key'").Scan(&braveAPIKey)
-	if err != nil && err != sql.ErrNoRows {
-		log.Println("Error fetching Brave API key:", err)
-	}
-
-	if braveAPIKey != "" {
-		decrypted, err := Decrypt(braveAPIKey)
-		if err != nil {
-			log.Println("Error decrypting Brave API key:", err)
-		} else {
-			braveAPIKey = decrypted
-		}
-	}
-
-	enrichedPrompt, err := MaybeSearch(userMessage, braveAPIKey)
+	searcher, searcherErr := GetSearcher(db)
+	enrichedPrompt, err := MaybeSearch(userMessage, searcher)
 	if err != nil {
 		if strings.HasPrefix(userMessage, "/search ") {
+			if searcherErr != nil {
+				err = searcherErr
+			}
 			return fmt.Sprintf("❌ Search error: %v", err)
 		}
 		enrichedPrompt = userMessage
 	}
 
-	chatID, err := getOrCreateChatForSession(sessionID)
-	if err != nil {
-		log.Printf("Error getting/creating chat for session: %v", err)
-		return fmt.Sprintf("❌ Error getting chat: %v", err)
+	if chatID == 0 {
+		chatID, err = getOrCreateChatForSession(sessionID)
+		if err != nil {
+			log.Printf("Error getting/creating chat for session: %v", err)
+			return fmt.Sprintf("❌ Error getting chat: %v", err)
+		}
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
-	defer cancel()
+	if budgetErr := checkTokenBudget(chatID); budgetErr != nil {
+		return "❌ " + budgetErr.Message
+	}
 
-	if IsMemoryEnabled(db) {
-		ExtractMemoriesWithLLM(db, sessionID, userMessage, provider, nil)
+	if enrichedPrompt == userMessage {
+		enrichedPrompt = MaybeAutoSearch(context.Background(), db, fmt.Sprintf("chat:%d", chatID), userMessage, searcher, provider)
 	}
 
+	// Telegram messages get their own request id so their log lines can be correlated
+	ctx, cancel := context.WithTimeout(withRequestID(context.Background(), "tg-"+newRequestID()), 5*time.Minute)
+	defer cancel()
+
 	var chatSummary sql.NullString
 	err = db.QueryRow("SELECT summary FROM chats WHERE id = ?", chatID).Scan(&chatSummary)
 	if err != nil {
@@ -467,10 +576,9 @@ func generateResponseForSession(sessionID, userMessage string) string {
 		})
 	}
 
-	if IsMemoryEnabled(db) {
-		memories, _ := GetMemories(db, sessionID)
-		if len(memories) > 0 {
-			memoryPrompt := FormatMemoriesForPrompt(memories)
+	if ChatUsesMemory(db, chatID) {
+		memories, _ := GetRelevantMemories(db, sessionID, userMessage)
+		if memoryPrompt := FormatMemoriesForPrompt(memories, GetMemoryInjectionFilter(db)); memoryPrompt != "" {
 			history = append(history, api.Message{
 				Role:    "system",
 				Content: fmt.Sprintf("You have access to the following information about this user:\n%s\nUse this information to personalize your responses.", memoryPrompt),
@@ -478,28 +586,17 @@ func generateResponseForSession(sessionID, userMessage string) string {
 		}
 	}
 
-	rows, err := db.Query(`
-		SELECT role, content
-		FROM messages
-		WHERE chat_id = ? AND is_summarized = 0 AND role IN ('user', 'assistant')
-		ORDER BY id ASC
-	`, chatID)
-	if err == nil {
-		defer rows.Close()
-		for rows.Next() {
-			var role, content string
-			rows.Scan(&role, &content)
-			history = append(history, api.Message{
-				Role:    role,
-				Content: content,
-			})
-		}
+	messages, err := GetContextMessages(db, chatID)
+	if err != nil {
+		log.Printf("Error fetching history for Telegram session %s: %v", sessionID, err)
 	}
+	history = append(history, messages...)
 
 	var systemPrompt string
 	if chatID > 0 {
-		db.QueryRow("SELECT COALESCE(system_prompt, '') FROM chats WHERE id = ?", chatID).Scan(&systemPrompt)
+		systemPrompt = GetChatSystemPrompt(db, chatID)
 	}
+	systemPrompt = withGlobalSystemPrompt(db, systemPrompt)
 
 	log.Printf("Telegram sending %d messages to provider (systemPrompt='%s')", len(history), truncateString(systemPrompt, 50))
 
@@ -535,15 +632,21 @@ func generateResponseForSession(sessionID, userMessage string) string {
 	}
 
 	var response string
+	var transcript *ToolTranscript
 	if len(tools) > 0 || len(skills) > 0 {
+		var toolCtx context.Context
+		toolCtx, transcript = withToolTranscript(ctx)
 		log.Printf("Telegram: Running agentic loop with %d tools and %d skills", len(tools), len(skills))
-		response, err = RunAgenticLoopWithSkills(ctx, provider, tools, skills, history, enrichedPrompt, systemPrompt, callback)
+		response, err = RunAgenticLoopWithSkills(toolCtx, provider, tools, skills, history, enrichedPrompt, systemPrompt, callback)
 	} else {
 		response, err = provider.GenerateNonStreaming(ctx, history, enrichedPrompt, systemPrompt)
 	}
 
 	if err != nil {
-		log.Printf("Error generating Telegram response: %v", err)
+		log.Printf("Error generating Telegram response (request %s): %v", requestID(ctx), err)
+		if errors.Is(err, ErrProviderBusy) {
+			return "⏳ The AI provider is busy right now. Please try again in a moment."
+		}
 		return "❌ Error generating response. Please try again."
 	}
 
@@ -566,6 +669,10 @@ func generateResponseForSession(sessionID, userMessage string) string {
 		log.Printf("Error saving Telegram message to database: %v", err)
 	}
 
+	if err := saveToolTranscript(db, chatID, "", transcript); err != nil {
+		log.Printf("Error saving Telegram tool calls to database: %v", err)
+	}
+
 	if _, err := db.Exec(`
 		INSERT INTO messages (chat_id, role, content, model_name)
 		VALUES (?, 'assistant', ?, ?)
@@ -576,12 +683,170 @@ func generateResponseForSession(sessionID, userMessage string) string {
 	db.Exec("UPDATE chats SET updated_at = CURRENT_TIMESTAMP WHERE id = ?", chatID)
 
 	if chatID > 0 {
-		MaybeTriggerSummarization(db, chatID)
+		MaybeTriggerSummarization(ctx, db, chatID)
+	}
+
+	if IsMemoryEnabled(db) {
+		QueueMemoryExtraction(sessionID, userMessage)
 	}
 
 	return aiResponse
 }
 
+// telegramChatsCondition matches the chats of a Telegram user: those made with /newchat,
+// the rolling chat of the current session (the linked web session when linked) and those
+// of earlier Telegram-only sessions. "_" is a LIKE wildcard, so it is escaped to keep user
+// 5 from matching user 55.
+const telegramChatsCondition = `telegram_user_id = ? OR title = ? OR title LIKE ? ESCAPE '\'`
+
+// telegramChatsArgs returns the arguments for telegramChatsCondition
+func telegramChatsArgs(userID int64, sessionID string) []interface{} {
+	return []interface{}{userID, sessionID, fmt.Sprintf(`telegram\_%d\_%%`, userID)}
+}
+
+// currentTelegramChat returns the chat a user switched to with /newchat or /chats, or 0
+// to use the session's rolling chat
+func currentTelegramChat(userID int64) int64 {
+	var chatID int64
+	err := db.QueryRow(`
+		SELECT t.chat_id FROM telegram_current_chats t JOIN chats c ON c.id = t.chat_id
+		WHERE t.telegram_user_id = ?
+	`, userID).Scan(&chatID)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Error reading current chat for Telegram user %d: %v", userID, err)
+	}
+	return chatID
+}
+
+// setCurrentTelegramChat makes chatID the chat the user's messages go to
+func setCurrentTelegramChat(userID, chatID int64) error {
+	_, err := db.Exec(`
+		INSERT INTO telegram_current_chats (telegram_user_id, chat_id) VALUES (?, ?)
+		ON CONFLICT(telegram_user_id) DO UPDATE SET chat_id = excluded.chat_id, selected_at = CURRENT_TIMESTAMP
+	`, userID, chatID)
+	return err
+}
+
+// createTelegramChat creates a chat owned by a Telegram user and switches to it
+func createTelegramChat(userID int64, title string) (int64, error) {
+	var providerName, modelName string
+	if _, config, err := GetActiveProvider(db); err == nil {
+		providerName = config.Name
+		modelName = config.Model
+	}
+
+	result, err := db.Exec(`
+		INSERT INTO chats (title, provider_name, model_name, telegram_user_id)
+		VALUES (?, ?, ?, ?)
+	`, title, providerName, modelName, userID)
+	if err != nil {
+		return 0, err
+	}
+	chatID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return chatID, setCurrentTelegramChat(userID, chatID)
+}
+
+// telegramChatListLimit caps the chats offered by /chats
+const telegramChatListLimit = 10
+
+// sendTelegramChatList lists a user's recent chats with a button to switch to each
+func sendTelegramChatList(userID, telegramChatID int64) {
+	sessionID := getTelegramSession(userID)
+	current := currentTelegramChat(userID)
+	if current == 0 {
+		var err error
+		if current, err = getOrCreateChatForSession(sessionID); err != nil {
+			log.Printf("Error getting chat for Telegram session %s: %v", sessionID, err)
+		}
+	}
+
+	args := append(telegramChatsArgs(userID, sessionID), telegramChatListLimit)
+	rows, err := db.Query(`
+		SELECT id, title FROM chats WHERE `+telegramChatsCondition+`
+		ORDER BY updated_at DESC LIMIT ?
+	`, args...)
+	if err != nil {
+		log.Printf("Error listing chats for Telegram user %d: %v", userID, err)
+		sendTelegramMessage(telegramChatID, "❌ Could not load your chats. Please try again.")
+		return
+	}
+	defer rows.Close()
+
+	var keyboard [][]tgbotapi.InlineKeyboardButton
+	for rows.Next() {
+		var id int64
+		var title string
+		if err := rows.Scan(&id, &title); err != nil {
+			log.Printf("Error scanning Telegram chat: %v", err)
+			continue
+		}
+		label := truncateString(title, 40)
+		if id == current {
+			label = "✅ " + label
+		}
+		keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(label, fmt.Sprintf("chat:%d", id)),
+		))
+	}
+	if len(keyboard) == 0 {
+		sendTelegramMessage(telegramChatID, "📭 No chats yet. Send a message or use /newchat to start one.")
+		return
+	}
+
+	msg := tgbotapi.NewMessage(telegramChatID, "💬 Your recent chats (✅ is current). Tap one to switch:")
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(keyboard...)
+	if _, err := telegramBot.Send(msg); err != nil {
+		log.Printf("Error sending Telegram chat list: %v", err)
+	}
+}
+
+// handleTelegramCallback handles the buttons of /chats, switching the user to the chosen
+// chat after checking it is theirs
+func handleTelegramCallback(query *tgbotapi.CallbackQuery) {
+	userID := query.From.ID
+	answer := func(text string) {
+		if _, err := telegramBot.Request(tgbotapi.NewCallback(query.ID, text)); err != nil {
+			log.Printf("Error answering Telegram callback: %v", err)
+		}
+	}
+
+	if !isUserAllowed(userID) {
+		log.Printf("Unauthorized callback from user %d", userID)
+		answer("🚫 Access Denied")
+		return
+	}
+
+	var chatID int64
+	if _, err := fmt.Sscanf(query.Data, "chat:%d", &chatID); err != nil {
+		answer("Unknown action")
+		return
+	}
+
+	var title string
+	args := append([]interface{}{chatID}, telegramChatsArgs(userID, getTelegramSession(userID))...)
+	err := db.QueryRow("SELECT title FROM chats WHERE id = ? AND ("+telegramChatsCondition+")", args...).Scan(&title)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Error reading chat %d for Telegram user %d: %v", chatID, userID, err)
+		}
+		answer("❌ Chat not found")
+		return
+	}
+
+	if err := setCurrentTelegramChat(userID, chatID); err != nil {
+		log.Printf("Error switching Telegram user %d to chat %d: %v", userID, chatID, err)
+		answer("❌ Could not switch chats")
+		return
+	}
+	answer("Switched to " + truncateString(title, 40))
+	if query.Message != nil {
+		sendTelegramMessage(query.Message.Chat.ID, "🔀 Switched to chat: "+title)
+	}
+}
+
 func getOrCreateChatForSession(sessionID string) (int64, error) {
 	var chatID int64
 	err := db.QueryRow("SELECT id FROM chats WHERE title = ?", sessionID).Scan(&chatID)
@@ -827,9 +1092,13 @@ func sendTelegramMessage(chatID int64, text string) {
 }
 
 func StopTelegramBot() {
+	if telegramBot == nil {
+		return
+	}
 	if telegramCancel != nil {
 		telegramCancel()
 	}
+	telegramBot.StopReceivingUpdates()
 	log.Println("Telegram bot stopped")
 }
 
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// telegramGroupSessions holds the session of each group chat, keyed by chat id, so a
+// group shares one conversation and its memories. Guarded by telegramMutex.
+var telegramGroupSessions = make(map[int64]string)
+
+// isTelegramGroup reports whether a chat is a group or supergroup
+func isTelegramGroup(chat *tgbotapi.Chat) bool {
+	return chat != nil && (chat.IsGroup() || chat.IsSuperGroup())
+}
+
+// isGroupAllowed checks the allowlists for a message in a group. With
+// TELEGRAM_ALLOWED_GROUPS set, the group must be listed or the sender must be an
+// allowed user; otherwise the user allowlist applies as in private chats.
+func isGroupAllowed(groupID, userID int64) bool {
+	if len(allowedGroups) == 0 {
+		return isUserAllowed(userID)
+	}
+	return slices.Contains(allowedGroups, groupID) || slices.Contains(allowedUsers, userID)
+}
+
+// getTelegramGroupSession returns the session of a group chat
+func getTelegramGroupSession(groupID int64) string {
+	telegramMutex.RLock()
+	sessionID, exists := telegramGroupSessions[groupID]
+	telegramMutex.RUnlock()
+	if exists {
+		return sessionID
+	}
+	return resetTelegramGroupSession(groupID, fmt.Sprintf("telegram_group_%d", groupID))
+}
+
+// resetTelegramGroupSession switches a group to sessionID, starting a new conversation
+func resetTelegramGroupSession(groupID int64, sessionID string) string {
+	telegramMutex.Lock()
+	telegramGroupSessions[groupID] = sessionID
+	telegramMutex.Unlock()
+	return sessionID
+}
+
+// handleTelegramGroupMessage answers only messages that mention the bot or reply to it,
+// and commands addressed to it, so the bot stays quiet in ordinary group conversation
+func handleTelegramGroupMessage(message *tgbotapi.Message) {
+	userID := message.From.ID
+	groupID := message.Chat.ID
+
+	if message.IsCommand() {
+		if _, bot, found := strings.Cut(message.CommandWithAt(), "@"); found && !strings.EqualFold(bot, telegramBot.Self.UserName) {
+			return
+		}
+		if !isGroupAllowed(groupID, userID) {
+			log.Printf("Unauthorized command in group %d from user %d", groupID, userID)
+			return
+		}
+		handleTelegramGroupCommand(message, groupID)
+		return
+	}
+
+	prompt, addressed := telegramGroupPrompt(message, telegramBot.Self)
+	if !addressed {
+		return
+	}
+
+	log.Printf("Telegram group message in %d from user %d: %s", groupID, userID, message.Text)
+
+	if !isGroupAllowed(groupID, userID) {
+		log.Printf("Unauthorized access attempt in group %d from user %d", groupID, userID)
+		sendTelegramMessage(groupID, "🚫 Access Denied: This group is not authorized to use this bot.")
+		return
+	}
+	if prompt == "" {
+		sendTelegramMessage(groupID, "👋 Mention me with a question, or reply to one of my messages.")
+		return
+	}
+
+	sendTypingIndicator(groupID)
+	response := generateResponseForSession(getTelegramGroupSession(groupID), 0, prompt)
+	sendTelegramMessage(groupID, response)
+}
+
+// handleTelegramGroupCommand runs the commands that make sense for a whole group.
+// Per-user commands such as /memories and /link_session stay in private chats so their
+// output is not shown to the group.
+func handleTelegramGroupCommand(message *tgbotapi.Message, groupID int64) {
+	switch message.Command() {
+	case "help", "start":
+		sendTelegramMessage(groupID, "📖 Group Commands:\n\n"+
+			"  Mention me or reply to my messages to chat\n"+
+			"  /search <query> - Search the web for info\n"+
+			"  /clear - Start a new group conversation\n\n"+
+			"Other commands work in a private chat with me.")
+
+	case "clear":
+		resetTelegramGroupSession(groupID, fmt.Sprintf("telegram_group_%d_%d", groupID, time.Now().Unix()))
+		sendTelegramMessage(groupID, "🧹 Group conversation cleared! Starting a new session.")
+
+	case "search":
+		query := strings.TrimSpace(message.CommandArguments())
+		if query == "" {
+			sendTelegramMessage(groupID, "❌ Usage: /search <query>\n\nExample: /search latest AI news")
+			return
+		}
+		sendTypingIndicator(groupID)
+		sendTelegramMessage(groupID, generateResponseForSession(getTelegramGroupSession(groupID), 0, "/search "+query))
+
+	default:
+		sendTelegramMessage(groupID, fmt.Sprintf("ℹ️ /%s only works in a private chat with me.", message.Command()))
+	}
+}
+
+// telegramGroupPrompt reports whether a group message is addressed to the bot, by an
+// @-mention entity or a reply to one of its messages, and returns the text with the
+// bot's mentions removed
+func telegramGroupPrompt(message *tgbotapi.Message, self tgbotapi.User) (string, bool) {
+	addressed := message.ReplyToMessage != nil && message.ReplyToMessage.From != nil &&
+		message.ReplyToMessage.From.ID == self.ID
+
+	// Entity offsets and lengths count UTF-16 code units
+	text := utf16.Encode([]rune(message.Text))
+	var mentions []tgbotapi.MessageEntity
+	for _, e := range message.Entities {
+		if e.Offset < 0 || e.Length <= 0 || e.Offset+e.Length > len(text) {
+			continue
+		}
+		switch e.Type {
+		case "mention":
+			if strings.EqualFold(string(utf16.Decode(text[e.Offset:e.Offset+e.Length])), "@"+self.UserName) {
+				mentions = append(mentions, e)
+			}
+		case "text_mention":
+			if e.User != nil && e.User.ID == self.ID {
+				mentions = append(mentions, e)
+			}
+		}
+	}
+	if len(mentions) > 0 {
+		addressed = true
+	}
+
+	// Remove from the end so earlier offsets stay valid
+	sort.Slice(mentions, func(i, j int) bool { return mentions[i].Offset > mentions[j].Offset })
+	for _, e := range mentions {
+		text = append(text[:e.Offset], text[e.Offset+e.Length:]...)
+	}
+	return strings.TrimSpace(string(utf16.Decode(text))), addressed
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+
+	"github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// defaultTelegramWebhookPath receives updates when TELEGRAM_WEBHOOK_URL has no path
+const defaultTelegramWebhookPath = "/telegram/webhook"
+
+// maxTelegramUpdateBytes caps the body of a webhook request
+const maxTelegramUpdateBytes = 1 << 20
+
+// telegramSecretTokenPattern is the character set Telegram allows for secret_token
+var telegramSecretTokenPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,256}$`)
+
+// telegramWebhookSecret is sent back by Telegram in X-Telegram-Bot-Api-Secret-Token on
+// every webhook request. Set by setTelegramWebhook.
+var telegramWebhookSecret string
+
+// TelegramWebhookPath returns the route that receives webhook updates, or "" when
+// TELEGRAM_WEBHOOK_URL is not set and the bot uses long polling
+func TelegramWebhookPath() string {
+	raw := os.Getenv("TELEGRAM_WEBHOOK_URL")
+	if raw == "" || os.Getenv("TELEGRAM_BOT_TOKEN") == "" {
+		return ""
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Path == "" || u.Path == "/" {
+		return defaultTelegramWebhookPath
+	}
+	return u.Path
+}
+
+// telegramWebhookURL returns the URL registered with Telegram, adding the default path
+// when TELEGRAM_WEBHOOK_URL has none
+func telegramWebhookURL() (string, error) {
+	u, err := url.Parse(os.Getenv("TELEGRAM_WEBHOOK_URL"))
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return "", fmt.Errorf("TELEGRAM_WEBHOOK_URL must be an https URL")
+	}
+	u.Path = TelegramWebhookPath()
+	return u.String(), nil
+}
+
+// setTelegramWebhook registers the webhook with Telegram. The secret comes from
+// TELEGRAM_WEBHOOK_SECRET, or is generated for this run since the webhook is registered
+// again on every start.
+func setTelegramWebhook() error {
+	link, err := telegramWebhookURL()
+	if err != nil {
+		return err
+	}
+
+	secret := os.Getenv("TELEGRAM_WEBHOOK_SECRET")
+	if secret == "" {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return fmt.Errorf("generating webhook secret: %w", err)
+		}
+		secret = hex.EncodeToString(b)
+	} else if !telegramSecretTokenPattern.MatchString(secret) {
+		return fmt.Errorf("TELEGRAM_WEBHOOK_SECRET may only contain A-Z, a-z, 0-9, _ and - (1-256 characters)")
+	}
+
+	// WebhookConfig has no secret_token field, so the request is made directly
+	params := tgbotapi.Params{"url": link, "secret_token": secret}
+	if err := params.AddInterface("allowed_updates", []string{"message", "callback_query"}); err != nil {
+		return err
+	}
+	if _, err := telegramBot.MakeRequest("setWebhook", params); err != nil {
+		return fmt.Errorf("registering webhook: %w", err)
+	}
+
+	telegramWebhookSecret = secret
+	log.Printf("Telegram webhook registered at %s", link)
+	return nil
+}
+
+// telegramWebhookHandler receives updates pushed by Telegram. Requests without the
+// secret token registered with the webhook are rejected.
+func telegramWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if telegramBot == nil || telegramWebhookSecret == "" {
+		WriteError(w, http.StatusServiceUnavailable, "Telegram bot is not running")
+		return
+	}
+	token := r.Header.Get("X-Telegram-Bot-Api-Secret-Token")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(telegramWebhookSecret)) != 1 {
+		log.Printf("Rejected Telegram webhook request without a valid secret token from %s", r.RemoteAddr)
+		WriteError(w, http.StatusUnauthorized, "Invalid secret token")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxTelegramUpdateBytes)
+	update, err := telegramBot.HandleUpdate(r)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid update")
+		return
+	}
+
+	// Answer right away; Telegram retries updates that are not acknowledged in time
+	go dispatchTelegramUpdate(*update)
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-chi/chi"
+)
+
+func TestMain(m *testing.M) {
+	os.Setenv("ENCRYPTION_KEY", "test-encryption-key")
+	os.Exit(m.Run())
+}
+
+// newTestDB opens a migrated database in a temporary directory and installs it as the
+// package-level db for the duration of the test
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	testDB, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db")+"?_pragma=foreign_keys(1)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	RunMigrations(testDB)
+
+	old := db
+	db = testDB
+	t.Cleanup(func() {
+		db = old
+		testDB.Close()
+	})
+	return testDB
+}
+
+// newTestProvider registers an active openai_compatible provider that sends its requests
+// to baseURL
+func newTestProvider(t *testing.T, testDB *sql.DB, baseURL string) int64 {
+	t.Helper()
+	apiKey, err := Encrypt("test-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := testDB.Exec("INSERT INTO providers (name, type, base_url, api_key, is_active) VALUES ('test', 'openai_compatible', ?, ?, 1)", baseURL, apiKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := res.LastInsertId()
+	return id
+}
+
+// setTestSetting stores a setting directly, bypassing validation
+func setTestSetting(t *testing.T, testDB *sql.DB, key, value string) {
+	t.Helper()
+	if _, err := testDB.Exec("INSERT INTO settings (key, value) VALUES (?, ?) ON CONFLICT(key) DO UPDATE SET value = excluded.value", key, value); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newTestAPI serves the versioned API routes backed by the current package-level db
+func newTestAPI() http.Handler {
+	r := chi.NewRouter()
+	r.Route(apiV1Prefix, func(r chi.Router) {
+		registerAPIRoutes(r, NewMCPServerHandler(db))
+	})
+	return r
+}
@@ -4,19 +4,25 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/contactwajeeh/ollamagoweb-v2/mcp"
 	"github.com/ollama/ollama/api"
 )
 
+// Tool is a tool offered to the model. Name is unique among the offered tools; ToolName
+// is what its server (or, for skills, the skill cache) calls it.
 type Tool struct {
 	Name        string                 `json:"name"`
 	Description string                 `json:"description"`
 	InputSchema map[string]interface{} `json:"input_schema"`
 	ServerID    int64                  `json:"server_id,omitempty"`
+	ToolName    string                 `json:"tool_name,omitempty"`
 }
 
 type ToolCall struct {
@@ -24,6 +30,7 @@ type ToolCall struct {
 	Name      string                 `json:"name"`
 	Arguments map[string]interface{} `json:"arguments"`
 	ServerID  int64                  `json:"server_id,omitempty"`
+	ToolName  string                 `json:"tool_name,omitempty"`
 }
 
 type ToolResult struct {
@@ -40,7 +47,8 @@ type AgenticMessage struct {
 
 const MaxToolIterations = 5
 
-func GetAllEnabledMCPTools(ctx context.Context) ([]Tool, error) {
+// enabledMCPServers loads the MCP servers that are switched on
+func enabledMCPServers(db *sql.DB) ([]*mcp.MCPServer, error) {
 	rows, err := db.Query(`
 		SELECT id, name, server_type, endpoint_url, command, args, env_vars, is_enabled
 		FROM mcp_servers
@@ -66,6 +74,16 @@ func GetAllEnabledMCPTools(ctx context.Context) ([]Tool, error) {
 		s.EnvVars = envVars.String
 		servers = append(servers, &s)
 	}
+	return servers, rows.Err()
+}
+
+// GetAllEnabledMCPTools returns the tools of the enabled MCP servers followed by the
+// enabled HTTP tools and, when switched on, the built-in tools
+func GetAllEnabledMCPTools(ctx context.Context) ([]Tool, error) {
+	servers, err := enabledMCPServers(db)
+	if err != nil {
+		return nil, err
+	}
 
 	client := mcp.GetMCPClient()
 	if client == nil {
@@ -84,19 +102,46 @@ func GetAllEnabledMCPTools(ctx context.Context) ([]Tool, error) {
 			Description: t.Description,
 			InputSchema: t.InputSchema,
 			ServerID:    t.ServerID,
+			ToolName:    t.ToolName,
 		}
 	}
 
-	return tools, nil
+	tools, err = appendHTTPTools(db, tools)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get HTTP tools: %w", err)
+	}
+	return appendBuiltinTools(db, tools), nil
+}
+
+// resolveToolCall sets the server and server-side name of the offered tool a call names
+func resolveToolCall(tools []Tool, tc *ToolCall) {
+	for _, t := range tools {
+		if t.Name == tc.Name {
+			tc.ServerID = t.ServerID
+			tc.ToolName = t.ToolName
+			return
+		}
+	}
 }
 
 func ExecuteToolCall(ctx context.Context, toolCall ToolCall) (string, error) {
+	toolName := toolCall.ToolName
+	if toolName == "" {
+		toolName = toolCall.Name
+	}
+	switch toolCall.ServerID {
+	case httpToolServerID:
+		return executeHTTPTool(ctx, toolName, toolCall.Arguments)
+	case builtinToolServerID:
+		return executeBuiltinTool(ctx, toolName, toolCall.Arguments)
+	}
+
 	client := mcp.GetMCPClient()
 	if client == nil {
 		return "", fmt.Errorf("MCP client not initialized")
 	}
 
-	result, err := client.CallTool(ctx, toolCall.ServerID, toolCall.Name, toolCall.Arguments)
+	result, err := client.CallTool(ctx, toolCall.ServerID, toolName, toolCall.Arguments)
 	if err != nil {
 		return "", fmt.Errorf("tool execution failed: %w", err)
 	}
@@ -136,6 +181,91 @@ func FormatToolsForOllama(tools []Tool) []map[string]interface{} {
 
 type ToolExecutionCallback func(toolName string, status string)
 
+// maxParallelToolCalls bounds how many tool calls of one iteration run at once
+const maxParallelToolCalls = 4
+
+// runToolCalls executes the tool calls of one agentic iteration concurrently, at most
+// maxParallelToolCalls at a time, and returns their tool messages in the order the model
+// requested them. Calls whose arguments do not match the tool's input schema are not run;
+// the model gets the validation problems as the result instead. execute runs one call and
+// may set its ServerID for logging. The calls are added to the context's tool transcript,
+// if it has one. callback still reports "calling" and then "completed" or "error" for
+// every call; its calls are serialized, so callbacks need no locking of their own.
+func runToolCalls(ctx context.Context, tools []Tool, toolCalls []ToolCall, callback ToolExecutionCallback, execute func(ctx context.Context, tc *ToolCall) (string, error)) []AgenticMessage {
+	var callbackMu sync.Mutex
+	report := func(name, status string) {
+		if callback == nil {
+			return
+		}
+		callbackMu.Lock()
+		defer callbackMu.Unlock()
+		callback(name, status)
+	}
+
+	results := make([]AgenticMessage, len(toolCalls))
+	entries := make([]ToolTranscriptEntry, len(toolCalls))
+	slots := make(chan struct{}, maxParallelToolCalls)
+	var wg sync.WaitGroup
+
+	for i, tc := range toolCalls {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, tc ToolCall) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			report(tc.Name, "calling")
+			start := time.Now()
+			var result string
+			err := validateToolCall(tools, tc)
+			if err == nil {
+				result, err = execute(ctx, &tc)
+			}
+			logToolCall(ctx, tc.Name, tc.ServerID, start, err)
+			entries[i] = ToolTranscriptEntry{ToolCallID: tc.ID, Name: tc.Name, Arguments: tc.Arguments, Error: err != nil}
+			var argErr *ToolArgumentError
+			if errors.As(err, &argErr) {
+				report(tc.Name, "error")
+				result = argErr.toolResultJSON()
+			} else if err != nil {
+				report(tc.Name, "error")
+				result = fmt.Sprintf("Error: %v", err)
+			} else {
+				report(tc.Name, "completed")
+			}
+
+			entries[i].Result = result
+			resultJSON, _ := json.Marshal(map[string]interface{}{
+				"tool_call_id": tc.ID,
+				"name":         tc.Name,
+				"result":       result,
+			})
+			results[i] = AgenticMessage{
+				Role:    "tool",
+				Content: string(resultJSON),
+			}
+		}(i, tc)
+	}
+	wg.Wait()
+	recordToolCalls(ctx, entries...)
+	return results
+}
+
+// toolsEnabledFor reports whether tools should be offered to the provider's model. Models
+// without function calling either fail or make up calls, so they get plain generation
+// unless force_tool_support is set.
+func toolsEnabledFor(provider Provider, toolCount int) bool {
+	if provider.SupportsTools() {
+		return true
+	}
+	if GetBoolSetting(db, "force_tool_support", false) {
+		log.Printf("Model does not report tool support; sending %d tools anyway (force_tool_support)", toolCount)
+		return true
+	}
+	log.Printf("Model does not support tools; skipping %d tools and generating without them", toolCount)
+	return false
+}
+
 func RunAgenticLoop(
 	ctx context.Context,
 	provider Provider,
@@ -145,7 +275,7 @@ func RunAgenticLoop(
 	systemPrompt string,
 	callback ToolExecutionCallback,
 ) (string, error) {
-	if len(tools) == 0 {
+	if len(tools) == 0 || !toolsEnabledFor(provider, len(tools)) {
 		return provider.GenerateNonStreaming(ctx, history, prompt, systemPrompt)
 	}
 
@@ -166,6 +296,13 @@ func RunAgenticLoop(
 		log.Printf("Agentic loop iteration %d", iteration+1)
 
 		response, toolCalls, err := provider.GenerateWithTools(ctx, messages, systemPrompt, tools)
+		if errors.Is(err, ErrToolsUnsupported) {
+			log.Printf("Provider rejected tools, answering without them: %v", err)
+			if iteration == 0 {
+				return provider.GenerateNonStreaming(ctx, history, prompt, systemPrompt)
+			}
+			break
+		}
 		if err != nil {
 			return "", fmt.Errorf("generation failed: %w", err)
 		}
@@ -182,46 +319,10 @@ func RunAgenticLoop(
 			ToolCalls: toolCalls,
 		})
 
-		for _, tc := range toolCalls {
-			var serverID int64
-			for _, t := range tools {
-				if t.Name == tc.Name {
-					serverID = t.ServerID
-					break
-				}
-			}
-
-			tc.ServerID = serverID
-
-			if callback != nil {
-				callback(tc.Name, "calling")
-			}
-
-			result, err := ExecuteToolCall(ctx, tc)
-			if callback != nil {
-				if err != nil {
-					callback(tc.Name, "error")
-				} else {
-					callback(tc.Name, "completed")
-				}
-			}
-
-			toolResultContent := result
-			if err != nil {
-				toolResultContent = fmt.Sprintf("Error: %v", err)
-			}
-
-			resultJSON, _ := json.Marshal(map[string]interface{}{
-				"tool_call_id": tc.ID,
-				"name":         tc.Name,
-				"result":       toolResultContent,
-			})
-
-			messages = append(messages, AgenticMessage{
-				Role:    "tool",
-				Content: string(resultJSON),
-			})
-		}
+		messages = append(messages, runToolCalls(ctx, tools, toolCalls, callback, func(ctx context.Context, tc *ToolCall) (string, error) {
+			resolveToolCall(tools, tc)
+			return ExecuteToolCall(ctx, *tc)
+		})...)
 	}
 
 	apiMessages := make([]api.Message, len(messages))
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var echoTool = Tool{Name: "echo", InputSchema: map[string]interface{}{"type": "object"}}
+
+func TestRunToolCallsRunsSlowToolsInParallel(t *testing.T) {
+	const delay = 200 * time.Millisecond
+	var inFlight, peak atomic.Int32
+	execute := func(ctx context.Context, tc *ToolCall) (string, error) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		// Earlier calls take longer, so results finish out of order
+		time.Sleep(delay - time.Duration(tc.Arguments["index"].(int))*time.Millisecond)
+		return fmt.Sprintf("result %s", tc.ID), nil
+	}
+
+	calls := make([]ToolCall, 2*maxParallelToolCalls)
+	for i := range calls {
+		calls[i] = ToolCall{ID: fmt.Sprintf("call-%d", i), Name: "echo", Arguments: map[string]interface{}{"index": i}}
+	}
+
+	start := time.Now()
+	results := runToolCalls(context.Background(), []Tool{echoTool}, calls, nil, execute)
+	elapsed := time.Since(start)
+
+	// Two rounds of maxParallelToolCalls; run one at a time they would take eight delays
+	if elapsed >= 4*delay {
+		t.Errorf("%d calls took %v, want well under the %v of running them in sequence", len(calls), elapsed, time.Duration(len(calls))*delay)
+	}
+	if got := peak.Load(); got != maxParallelToolCalls {
+		t.Errorf("peak calls in flight = %d, want %d", got, maxParallelToolCalls)
+	}
+	for i, msg := range results {
+		var result struct {
+			ToolCallID string `json:"tool_call_id"`
+			Result     string `json:"result"`
+		}
+		if err := json.Unmarshal([]byte(msg.Content), &result); err != nil {
+			t.Fatal(err)
+		}
+		if want := fmt.Sprintf("call-%d", i); msg.Role != "tool" || result.ToolCallID != want || result.Result != "result "+want {
+			t.Errorf("result %d = %s, want the result of %s", i, msg.Content, want)
+		}
+	}
+}
+
+func TestRunToolCallsReportsEveryCall(t *testing.T) {
+	var statuses []string
+	callback := func(name, status string) { statuses = append(statuses, name+":"+status) }
+	execute := func(ctx context.Context, tc *ToolCall) (string, error) {
+		if tc.ID == "bad" {
+			return "", fmt.Errorf("boom")
+		}
+		return "ok", nil
+	}
+
+	runToolCalls(context.Background(), []Tool{echoTool}, []ToolCall{{ID: "good", Name: "echo"}, {ID: "bad", Name: "echo"}}, callback, execute)
+
+	counts := map[string]int{}
+	for _, s := range statuses {
+		counts[s]++
+	}
+	if counts["echo:calling"] != 2 || counts["echo:completed"] != 1 || counts["echo:error"] != 1 {
+		t.Errorf("statuses = %v, want two calling, one completed and one error", statuses)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// ToolArgumentError lists what is wrong with the arguments of a tool call. It is sent
+// back to the model as the tool result so it can retry with corrected arguments.
+type ToolArgumentError struct {
+	Tool     string   `json:"tool"`
+	Problems []string `json:"problems"`
+}
+
+func (e *ToolArgumentError) Error() string {
+	return fmt.Sprintf("invalid arguments for tool %s: %s", e.Tool, strings.Join(e.Problems, "; "))
+}
+
+// toolResultJSON is the result the model sees for a rejected call
+func (e *ToolArgumentError) toolResultJSON() string {
+	data, _ := json.Marshal(map[string]interface{}{
+		"error":    "invalid_arguments",
+		"tool":     e.Tool,
+		"problems": e.Problems,
+		"hint":     "Call the tool again with arguments that match its input schema",
+	})
+	return string(data)
+}
+
+// validateToolCall checks a call's arguments against the top level of the tool's input
+// schema: required arguments, declared types and enums. Nested objects are not checked.
+func validateToolCall(tools []Tool, tc ToolCall) error {
+	var schema map[string]interface{}
+	found := false
+	for _, t := range tools {
+		if t.Name == tc.Name {
+			schema, found = t.InputSchema, true
+			break
+		}
+	}
+	if !found {
+		return &ToolArgumentError{Tool: tc.Name, Problems: []string{"no tool with this name is available"}}
+	}
+	if schema == nil {
+		return nil
+	}
+
+	var problems []string
+	for _, name := range schemaStrings(schema["required"]) {
+		if _, ok := tc.Arguments[name]; !ok {
+			problems = append(problems, fmt.Sprintf("missing required argument %q", name))
+		}
+	}
+
+	properties, _ := schema["properties"].(map[string]interface{})
+	names := make([]string, 0, len(tc.Arguments))
+	for name := range tc.Arguments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		prop, ok := properties[name].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		value := tc.Arguments[name]
+		if types := schemaStrings(prop["type"]); len(types) > 0 && !matchesSchemaType(value, types) {
+			problems = append(problems, fmt.Sprintf("argument %q must be %s, got %s", name, strings.Join(types, " or "), jsonTypeName(value)))
+			continue
+		}
+		if enum, ok := prop["enum"]; ok && !inSchemaEnum(value, enum) {
+			problems = append(problems, fmt.Sprintf("argument %q must be one of %s", name, formatSchemaEnum(enum)))
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ToolArgumentError{Tool: tc.Name, Problems: problems}
+	}
+	return nil
+}
+
+// schemaStrings reads a schema keyword that holds a string or a list of strings, such as
+// "type" and "required". Schemas built in Go use []string, decoded ones []interface{}.
+func schemaStrings(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for _, s := range v {
+			if s, ok := s.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// matchesSchemaType reports whether a decoded JSON value has one of the JSON schema types
+func matchesSchemaType(value interface{}, types []string) bool {
+	actual := jsonTypeName(value)
+	for _, t := range types {
+		switch {
+		case t == actual:
+			return true
+		case t == "number" && actual == "integer":
+			return true
+		case t == "integer" && actual == "number":
+			// Whole numbers decode as float64
+			if f, ok := value.(float64); ok && f == math.Trunc(f) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// jsonTypeName names the JSON schema type of a decoded value
+func jsonTypeName(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float32, float64:
+		return "number"
+	case int, int32, int64:
+		return "integer"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func inSchemaEnum(value, enum interface{}) bool {
+	var options []interface{}
+	switch e := enum.(type) {
+	case []interface{}:
+		options = e
+	case []string:
+		for _, s := range e {
+			options = append(options, s)
+		}
+	default:
+		return true
+	}
+	for _, o := range options {
+		if fmt.Sprint(o) == fmt.Sprint(value) {
+			return true
+		}
+	}
+	return false
+}
+
+func formatSchemaEnum(enum interface{}) string {
+	data, _ := json.Marshal(enum)
+	return string(data)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+var weatherTool = Tool{
+	Name: "get_weather",
+	InputSchema: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"city":  map[string]interface{}{"type": "string"},
+			"days":  map[string]interface{}{"type": "integer"},
+			"units": map[string]interface{}{"type": "string", "enum": []interface{}{"metric", "imperial"}},
+			"hours": map[string]interface{}{"type": []interface{}{"number", "null"}},
+		},
+		"required": []interface{}{"city"},
+	},
+}
+
+func TestValidateToolCall(t *testing.T) {
+	tests := []struct {
+		name     string
+		call     ToolCall
+		problems []string
+	}{
+		{"valid", ToolCall{Name: "get_weather", Arguments: map[string]interface{}{"city": "Oslo", "days": float64(3), "units": "metric"}}, nil},
+		{"missing required", ToolCall{Name: "get_weather", Arguments: map[string]interface{}{"days": float64(3)}},
+			[]string{`missing required argument "city"`}},
+		{"wrong type", ToolCall{Name: "get_weather", Arguments: map[string]interface{}{"city": float64(42)}},
+			[]string{`argument "city" must be string, got number`}},
+		{"fractional integer", ToolCall{Name: "get_weather", Arguments: map[string]interface{}{"city": "Oslo", "days": 2.5}},
+			[]string{`argument "days" must be integer, got number`}},
+		{"value outside the enum", ToolCall{Name: "get_weather", Arguments: map[string]interface{}{"city": "Oslo", "units": "kelvin"}},
+			[]string{`argument "units" must be one of ["metric","imperial"]`}},
+		{"one of several types", ToolCall{Name: "get_weather", Arguments: map[string]interface{}{"city": "Oslo", "hours": nil}}, nil},
+		{"undeclared arguments are allowed", ToolCall{Name: "get_weather", Arguments: map[string]interface{}{"city": "Oslo", "extra": true}}, nil},
+		{"every problem is reported", ToolCall{Name: "get_weather", Arguments: map[string]interface{}{"days": "three", "units": "kelvin"}},
+			[]string{`missing required argument "city"`, `argument "days" must be integer, got string`, `argument "units" must be one of ["metric","imperial"]`}},
+		{"unknown tool", ToolCall{Name: "get_stock"}, []string{"no tool with this name is available"}},
+	}
+	for _, tt := range tests {
+		err := validateToolCall([]Tool{weatherTool}, tt.call)
+		if tt.problems == nil {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", tt.name, err)
+			}
+			continue
+		}
+		var argErr *ToolArgumentError
+		if !errors.As(err, &argErr) {
+			t.Errorf("%s: error = %v, want a ToolArgumentError", tt.name, err)
+			continue
+		}
+		if strings.Join(argErr.Problems, "|") != strings.Join(tt.problems, "|") {
+			t.Errorf("%s: problems = %q, want %q", tt.name, argErr.Problems, tt.problems)
+		}
+	}
+}
+
+func TestRunToolCallsSendsArgumentProblemsToTheModel(t *testing.T) {
+	executed := false
+	execute := func(ctx context.Context, tc *ToolCall) (string, error) {
+		executed = true
+		return "sunny", nil
+	}
+
+	results := runToolCalls(context.Background(), []Tool{weatherTool},
+		[]ToolCall{{ID: "c1", Name: "get_weather", Arguments: map[string]interface{}{"city": true}}}, nil, execute)
+	if executed {
+		t.Error("a call with invalid arguments was executed")
+	}
+
+	var msg struct {
+		Result string `json:"result"`
+	}
+	if err := json.Unmarshal([]byte(results[0].Content), &msg); err != nil {
+		t.Fatal(err)
+	}
+	var result struct {
+		Error    string   `json:"error"`
+		Problems []string `json:"problems"`
+	}
+	if err := json.Unmarshal([]byte(msg.Result), &result); err != nil {
+		t.Fatalf("result is not the validation JSON: %q", msg.Result)
+	}
+	if result.Error != "invalid_arguments" || len(result.Problems) != 1 {
+		t.Errorf("result = %+v, want invalid_arguments with one problem", result)
+	}
+}
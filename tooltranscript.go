@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/ollama/ollama/api"
+)
+
+// maxToolContextChars caps how much of a stored tool result is fed back as context
+const maxToolContextChars = 2000
+
+// ToolTranscriptEntry is one tool call and its result. Stored transcripts are messages
+// with role "tool" whose content is this entry as JSON.
+type ToolTranscriptEntry struct {
+	ToolCallID string                 `json:"tool_call_id"`
+	Name       string                 `json:"name"`
+	Arguments  map[string]interface{} `json:"arguments"`
+	Result     string                 `json:"result"`
+	Error      bool                   `json:"error,omitempty"`
+}
+
+// ToolTranscript collects the tool calls made while answering one prompt
+type ToolTranscript struct {
+	mu      sync.Mutex
+	entries []ToolTranscriptEntry
+}
+
+type toolTranscriptKey struct{}
+
+// withToolTranscript returns a context whose agentic loop records its tool calls in the
+// returned transcript
+func withToolTranscript(ctx context.Context) (context.Context, *ToolTranscript) {
+	t := &ToolTranscript{}
+	return context.WithValue(ctx, toolTranscriptKey{}, t), t
+}
+
+// recordToolCalls adds entries to the context's transcript, if it has one
+func recordToolCalls(ctx context.Context, entries ...ToolTranscriptEntry) {
+	t, ok := ctx.Value(toolTranscriptKey{}).(*ToolTranscript)
+	if !ok {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.entries = append(t.entries, entries...)
+}
+
+// Entries returns the recorded tool calls in the order they were made
+func (t *ToolTranscript) Entries() []ToolTranscriptEntry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]ToolTranscriptEntry(nil), t.entries...)
+}
+
+// saveToolTranscript stores the recorded tool calls as tool messages of a chat, in the
+// version group of the exchange they belong to. They are hidden from getChat unless
+// asked for and are sent back as context on later turns.
+func saveToolTranscript(db *sql.DB, chatID int64, versionGroup string, t *ToolTranscript) error {
+	if t == nil || chatID == 0 {
+		return nil
+	}
+	entries := t.Entries()
+
+	var group interface{}
+	if versionGroup != "" {
+		group = versionGroup
+	}
+	for _, e := range entries {
+		content, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		if _, err := db.Exec("INSERT INTO messages (chat_id, role, content, version_group) VALUES (?, 'tool', ?, ?)",
+			chatID, string(content), group); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// latestUserVersionGroup returns the version group of a chat's latest active user
+// message, which the tool calls answering it belong to
+func latestUserVersionGroup(db *sql.DB, chatID int64) string {
+	var group string
+	db.QueryRow(`
+		SELECT COALESCE(version_group, '') FROM messages
+		WHERE chat_id = ? AND role = 'user' AND COALESCE(is_active_version, 1) = 1
+		ORDER BY id DESC LIMIT 1
+	`, chatID).Scan(&group)
+	return group
+}
+
+// toolContextMessage turns a stored tool message into context for the model. It is sent
+// as a system note rather than a tool message, since providers reject tool results that
+// do not follow the call that asked for them.
+func toolContextMessage(content string) api.Message {
+	var e ToolTranscriptEntry
+	if err := json.Unmarshal([]byte(content), &e); err != nil {
+		return api.Message{Role: "system", Content: "Earlier tool output:\n" + truncateString(content, maxToolContextChars)}
+	}
+	args, _ := json.Marshal(e.Arguments)
+	outcome := "returned"
+	if e.Error {
+		outcome = "failed with"
+	}
+	return api.Message{
+		Role:    "system",
+		Content: fmt.Sprintf("Earlier tool call %s(%s) %s:\n%s", e.Name, args, outcome, truncateString(e.Result, maxToolContextChars)),
+	}
+}
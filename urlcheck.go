@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"syscall"
+	"time"
+)
+
+const urlLookupTimeout = 5 * time.Second
+
+// cgnatRange is the carrier-grade NAT block, which net.IP.IsPrivate does not cover
+var cgnatRange = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// blockPrivateURLs reports whether outbound URLs may not point at internal addresses.
+// It is set only by the BLOCK_PRIVATE_URLS environment variable, so API clients cannot
+// switch it off.
+func blockPrivateURLs() bool {
+	return os.Getenv("BLOCK_PRIVATE_URLS") == "true"
+}
+
+// guardedTransport dials through guardedDialer. Clients for URLs that come from users
+// or the web use it, so the private address block holds for every connection: after
+// DNS resolution, on each redirect hop and when a host is rebound to a new address.
+var guardedTransport = func() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.DialContext = guardedDialer.DialContext
+	return t
+}()
+
+var guardedDialer = &net.Dialer{
+	Timeout:   30 * time.Second,
+	KeepAlive: 30 * time.Second,
+	Control:   refuseInternalAddress,
+}
+
+// refuseInternalAddress is the dialer's Control hook, which sees the resolved address
+// the connection is about to use
+func refuseInternalAddress(network, address string, _ syscall.RawConn) error {
+	if !blockPrivateURLs() {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || isInternalIP(ip) {
+		return fmt.Errorf("connection to private or internal address %s refused", host)
+	}
+	return nil
+}
+
+// isInternalIP reports whether ip is loopback, private, link-local or otherwise not
+// publicly routable
+func isInternalIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsUnspecified() || cgnatRange.Contains(ip)
+}
+
+// ValidateProviderURL checks that a provider base URL is an absolute http(s) URL. For
+// providers other than ollama it also rejects hosts resolving to internal addresses
+// while BLOCK_PRIVATE_URLS is set, so a bad URL is refused when saved; connections
+// are checked again by guardedDialer.
+func ValidateProviderURL(providerType, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("base URL must be an absolute http or https URL")
+	}
+
+	if providerType == "ollama" || !blockPrivateURLs() {
+		return nil
+	}
+
+	host := u.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		if isInternalIP(ip) {
+			return fmt.Errorf("base URL points to a private or internal address")
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), urlLookupTimeout)
+	defer cancel()
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("could not resolve base URL host %q", host)
+	}
+	for _, addr := range addrs {
+		if isInternalIP(addr.IP) {
+			return fmt.Errorf("base URL host %q resolves to a private or internal address", host)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGuardedTransportRefusesInternalAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	client := &http.Client{Transport: guardedTransport}
+
+	t.Setenv("BLOCK_PRIVATE_URLS", "true")
+	if resp, err := client.Get(srv.URL); err == nil {
+		resp.Body.Close()
+		t.Fatal("expected the connection to the loopback server to be refused")
+	}
+
+	t.Setenv("BLOCK_PRIVATE_URLS", "")
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("expected the connection to succeed with the block off: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestRefuseInternalAddress(t *testing.T) {
+	t.Setenv("BLOCK_PRIVATE_URLS", "true")
+	for address, refused := range map[string]bool{
+		"127.0.0.1:80":       true,
+		"10.1.2.3:443":       true,
+		"169.254.169.254:80": true,
+		"100.64.0.1:80":      true,
+		"[::1]:80":           true,
+		"0.0.0.0:80":         true,
+		"8.8.8.8:443":        false,
+		"[2606:4700::1]:443": false,
+	} {
+		if err := refuseInternalAddress("tcp", address, nil); (err != nil) != refused {
+			t.Errorf("%s: refused = %v, want %v", address, err != nil, refused)
+		}
+	}
+}
+
+func TestStoredProviderURLIsRefusedWhenConnecting(t *testing.T) {
+	testDB := newTestDB(t)
+	srv := newChatCompletionServer(t, "reached")
+	providerID := newTestProvider(t, testDB, srv.URL)
+	if _, err := testDB.Exec("INSERT INTO models (provider_id, model_name, is_default) VALUES (?, 'gpt-test', 1)", providerID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Saved before the block was turned on: loading does not look the host up again, the
+	// connection is refused instead
+	t.Setenv("BLOCK_PRIVATE_URLS", "true")
+	provider, _, err := GetActiveProvider(testDB)
+	if err != nil {
+		t.Fatalf("loading the provider: %v", err)
+	}
+	if _, err := provider.GenerateNonStreaming(context.Background(), nil, "hello", ""); err == nil {
+		t.Fatal("expected the request to the loopback provider to be refused")
+	}
+	if n := len(srv.requests()); n != 0 {
+		t.Errorf("provider got %d requests, want none", n)
+	}
+}
+
+func TestValidateProviderURLBlocksPrivateHosts(t *testing.T) {
+	t.Setenv("BLOCK_PRIVATE_URLS", "true")
+	if err := ValidateProviderURL("openai", "http://169.254.169.254/v1"); err == nil {
+		t.Error("expected a link-local URL to be rejected")
+	}
+	if err := ValidateProviderURL("ollama", "http://127.0.0.1:11434"); err != nil {
+		t.Errorf("expected ollama to stay exempt: %v", err)
+	}
+	if err := ValidateProviderURL("openai", "ftp://"+net.JoinHostPort("8.8.8.8", "21")); err == nil {
+		t.Error("expected a non-http scheme to be rejected")
+	}
+}
+
+func TestBlockPrivateURLsSettingIsEnvOnly(t *testing.T) {
+	for _, value := range []string{"true", "false"} {
+		if _, err := validateSetting("block_private_urls", value); err == nil {
+			t.Errorf("expected writing block_private_urls=%s to be refused", value)
+		}
+	}
+}
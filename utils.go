@@ -15,6 +15,18 @@ func WriteError(w http.ResponseWriter, code int, message string) {
 	})
 }
 
+// WriteErrorWithCode writes a JSON error response with a machine-readable code so
+// clients can react to specific failures
+func WriteErrorWithCode(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":   true,
+		"code":    code,
+		"message": message,
+	})
+}
+
 // WriteJSON writes a consistent JSON success response
 func WriteJSON(w http.ResponseWriter, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
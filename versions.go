@@ -0,0 +1,211 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+// MessageVersion is one alternative in a version group: an edited user message and the
+// assistant replies to it
+type MessageVersion struct {
+	Version  int               `json:"version"`
+	IsActive bool              `json:"is_active"`
+	Messages []MessageResponse `json:"messages"`
+}
+
+// MessageVersions lists the alternatives sharing a version_group, oldest first
+type MessageVersions struct {
+	VersionGroup  string           `json:"version_group"`
+	ActiveVersion int              `json:"active_version"`
+	Versions      []MessageVersion `json:"versions"`
+}
+
+// loadMessageVersions reads the version group of a message and splits it into versions.
+// Each user message starts a new version and the assistant messages after it belong to
+// it, matching how edits are saved. It returns the group's chat and the version the
+// message is in; a message without a version_group is reported as sql.ErrNoRows.
+func loadMessageVersions(db *sql.DB, messageID int64) (MessageVersions, int64, int, error) {
+	var group MessageVersions
+	var chatID int64
+	err := db.QueryRow("SELECT chat_id, COALESCE(version_group, '') FROM messages WHERE id = ?", messageID).Scan(&chatID, &group.VersionGroup)
+	if err != nil {
+		return group, 0, 0, err
+	}
+	if group.VersionGroup == "" {
+		return group, chatID, 0, sql.ErrNoRows
+	}
+
+	rows, err := db.Query(`
+		SELECT id, role, content, COALESCE(model_name, ''), COALESCE(tokens_used, 0),
+			COALESCE(latency_ms, 0), COALESCE(tokens_per_sec, 0), created_at, COALESCE(is_active_version, 1)
+		FROM messages
+		WHERE chat_id = ? AND version_group = ?
+		ORDER BY id ASC
+	`, chatID, group.VersionGroup)
+	if err != nil {
+		return group, chatID, 0, err
+	}
+	defer rows.Close()
+
+	group.Versions = []MessageVersion{}
+	target := 0
+	for rows.Next() {
+		var m MessageResponse
+		var createdAt time.Time
+		var active bool
+		if err := rows.Scan(&m.ID, &m.Role, &m.Content, &m.ModelName, &m.TokensUsed, &m.LatencyMs, &m.TokensPerSec, &createdAt, &active); err != nil {
+			return group, chatID, 0, err
+		}
+		m.VersionGroup = group.VersionGroup
+		m.CreatedAt = createdAt.Format(time.RFC3339)
+		m.IsActiveVersion = active
+
+		if m.Role == "user" || len(group.Versions) == 0 {
+			group.Versions = append(group.Versions, MessageVersion{Version: len(group.Versions), IsActive: active})
+		}
+		v := &group.Versions[len(group.Versions)-1]
+		v.Messages = append(v.Messages, m)
+		if m.ID == messageID {
+			target = v.Version
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return group, chatID, 0, err
+	}
+
+	group.ActiveVersion = len(group.Versions) - 1
+	for _, v := range group.Versions {
+		if v.IsActive {
+			group.ActiveVersion = v.Version
+		}
+	}
+	return group, chatID, target, nil
+}
+
+// getMessageVersions handles GET /api/messages/{id}/versions, listing every version in
+// the message's version group and which one is active
+func getMessageVersions(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid message ID")
+		return
+	}
+
+	group, chatID, _, err := loadMessageVersions(db, id)
+	if err == sql.ErrNoRows {
+		if chatID == 0 {
+			WriteError(w, http.StatusNotFound, "Message not found")
+			return
+		}
+		WriteError(w, http.StatusBadRequest, "Message has no other versions")
+		return
+	}
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	WriteJSON(w, group)
+}
+
+// activateMessageVersion handles POST /api/messages/{id}/activate-version, making the
+// version holding the message the one sent as context. The other versions stay stored
+// for browsing but are left out of the history the model sees.
+func activateMessageVersion(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid message ID")
+		return
+	}
+
+	group, chatID, target, err := loadMessageVersions(db, id)
+	if err == sql.ErrNoRows {
+		if chatID == 0 {
+			WriteError(w, http.StatusNotFound, "Message not found")
+			return
+		}
+		WriteError(w, http.StatusBadRequest, "Message has no other versions")
+		return
+	}
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE messages SET is_active_version = 0 WHERE chat_id = ? AND version_group = ?", chatID, group.VersionGroup); err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for _, m := range group.Versions[target].Messages {
+		if _, err := tx.Exec("UPDATE messages SET is_active_version = 1 WHERE id = ?", m.ID); err != nil {
+			WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	// A summary written while another version was active describes the wrong branch
+	var summarized bool
+	if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM messages WHERE chat_id = ? AND version_group = ? AND is_summarized = 1)",
+		chatID, group.VersionGroup).Scan(&summarized); err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if group.ActiveVersion != target {
+		InvalidateSummaryForMessage(r.Context(), db, chatID, summarized)
+	}
+
+	group, _, _, err = loadMessageVersions(db, id)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	WriteJSON(w, group)
+}
+
+// chatVersionCounts returns the number of versions in each version group of a chat
+func chatVersionCounts(db *sql.DB, chatID int64) (map[string]int, error) {
+	rows, err := db.Query(`
+		SELECT version_group, MAX(SUM(role = 'user'), 1)
+		FROM messages
+		WHERE chat_id = ? AND COALESCE(version_group, '') <> ''
+		GROUP BY version_group
+	`, chatID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var group string
+		var n int
+		if err := rows.Scan(&group, &n); err != nil {
+			return counts, err
+		}
+		counts[group] = n
+	}
+	return counts, rows.Err()
+}
+
+// deactivateOtherVersions makes a newly saved user message the active version of its
+// group, so an edit replaces the earlier versions in the context
+func deactivateOtherVersions(db *sql.DB, chatID, messageID int64, versionGroup string) error {
+	_, err := db.Exec("UPDATE messages SET is_active_version = 0 WHERE chat_id = ? AND version_group = ? AND id <> ?",
+		chatID, versionGroup, messageID)
+	return err
+}